@@ -0,0 +1,112 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// aclRule is one resource rule of a Consul ACL policy
+type aclRule struct {
+	resource string // e.g. "service", "node_prefix"
+	name     string
+	policy   string // "read" or "write"
+}
+
+// RequiredACLPolicy returns the minimal Consul ACL policy, in HCL, that the
+// current configuration needs: service:read on every watched service and
+// node:read to include node data in health results, plus
+//   - service:write on the services registered with Register so far
+//   - key_prefix write under the WithTopologyPublisher and
+//     WithSpreadCoordination prefixes, read under the WithTopologyMirror one
+//   - session:write for the sessions owning spread keys
+//   - agent:read for TransparentProxyAuto and for reading max_query_time
+//     when WithWaitTime exceeds the default
+//
+// Services queried with their own token (WithServiceToken) need the read on
+// that token instead
+func (cm *ConnManager) RequiredACLPolicy() string {
+	var b strings.Builder
+
+	for i, r := range cm.aclRules() {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		fmt.Fprintf(&b, "%s %q {\n  policy = %q\n}\n", r.resource, r.name, r.policy)
+	}
+
+	return b.String()
+}
+
+// RequiredACLPolicyJSON returns RequiredACLPolicy in Consul's JSON rules form
+func (cm *ConnManager) RequiredACLPolicyJSON() string {
+	doc := map[string]map[string]map[string]string{}
+
+	for _, r := range cm.aclRules() {
+		if doc[r.resource] == nil {
+			doc[r.resource] = map[string]map[string]string{}
+		}
+
+		doc[r.resource][r.name] = map[string]string{"policy": r.policy}
+	}
+
+	out, _ := json.MarshalIndent(doc, "", "  ")
+
+	return string(out)
+}
+
+// aclRules lists the rules for the current configuration in a stable order
+func (cm *ConnManager) aclRules() []aclRule {
+	services := make(map[string]string, len(cm.watchList))
+
+	for _, svc := range cm.watchList {
+		if _, ok := cm.serviceTokens[svc]; ok {
+			continue
+		}
+
+		services[cm.consulName(svc)] = "read"
+	}
+
+	cm.mu.RLock()
+	for _, name := range cm.registered {
+		services[name] = "write"
+	}
+	cm.mu.RUnlock()
+
+	keys := make(map[string]string)
+	if cm.mirrorPrefix != "" {
+		keys[cm.mirrorPrefix] = "read"
+	}
+
+	for _, prefix := range []string{cm.publishPrefix, cm.spreadPrefix} {
+		if prefix != "" {
+			keys[prefix] = "write"
+		}
+	}
+
+	rules := appendACLRules(nil, "service", services)
+	rules = appendACLRules(rules, "key_prefix", keys)
+	rules = append(rules, aclRule{resource: "node_prefix", name: "", policy: "read"})
+
+	if cm.spreadPrefix != "" {
+		rules = append(rules, aclRule{resource: "session_prefix", name: "", policy: "write"})
+	}
+
+	if cm.tproxyAuto || cm.waitTime > defaultWaitTime {
+		rules = append(rules, aclRule{resource: "agent_prefix", name: "", policy: "read"})
+	}
+
+	return rules
+}
+
+// appendACLRules appends a rule per name of policies, sorted by name
+func appendACLRules(rules []aclRule, resource string, policies map[string]string) []aclRule {
+	for _, name := range slices.Sorted(maps.Keys(policies)) {
+		rules = append(rules, aclRule{resource: resource, name: name, policy: policies[name]})
+	}
+
+	return rules
+}
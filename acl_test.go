@@ -0,0 +1,88 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequiredACLPolicy(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"}, WithServiceNamePrefix("staging-"))
+
+	want := `service "staging-billing" {
+  policy = "read"
+}
+
+service "staging-users" {
+  policy = "read"
+}
+
+node_prefix "" {
+  policy = "read"
+}
+`
+	if got := cm.RequiredACLPolicy(); got != want {
+		t.Errorf("policy =\n%s\nwant\n%s", got, want)
+	}
+
+	var doc map[string]map[string]map[string]string
+	if err := json.Unmarshal([]byte(cm.RequiredACLPolicyJSON()), &doc); err != nil {
+		t.Fatalf("json policy: %v", err)
+	}
+
+	if doc["service"]["staging-users"]["policy"] != "read" || !strings.Contains(cm.RequiredACLPolicyJSON(), "node_prefix") {
+		t.Errorf("unexpected json policy: %v", doc)
+	}
+}
+
+// hasACLRule reports whether the HCL policy of cm grants policy on name of
+// resource
+func hasACLRule(cm *ConnManager, resource, name, policy string) bool {
+	return strings.Contains(cm.RequiredACLPolicy(), fmt.Sprintf("%s %q {\n  policy = %q\n}", resource, name, policy))
+}
+
+func TestRequiredACLPolicy_Options(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     []Option
+		resource string
+		rule     string
+		policy   string
+	}{
+		{"topology publisher", []Option{WithTopologyPublisher("topology")}, "key_prefix", "topology/", "write"},
+		{"topology mirror", []Option{WithTopologyMirror("topology")}, "key_prefix", "topology/", "read"},
+		{"publisher and mirror", []Option{WithTopologyMirror("topology"), WithTopologyPublisher("topology")}, "key_prefix", "topology/", "write"},
+		{"spread keys", []Option{WithSpreadCoordination("spread")}, "key_prefix", "spread/", "write"},
+		{"spread session", []Option{WithSpreadCoordination("spread")}, "session_prefix", "", "write"},
+		{"transparent proxy", []Option{WithTransparentProxy(TransparentProxyAuto)}, "agent_prefix", "", "read"},
+		{"max query time", []Option{WithWaitTime(5 * time.Minute)}, "agent_prefix", "", "read"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := newTestManager(t, []string{"users"}, tc.opts...)
+
+			if !hasACLRule(cm, tc.resource, tc.rule, tc.policy) {
+				t.Errorf("policy lacks %s %q %s:\n%s", tc.resource, tc.rule, tc.policy, cm.RequiredACLPolicy())
+			}
+		})
+	}
+
+	cm := newTestManager(t, []string{"users"})
+	for _, resource := range []string{"key_prefix", "session_prefix", "agent_prefix"} {
+		if strings.Contains(cm.RequiredACLPolicy(), resource) {
+			t.Errorf("default policy grants %s:\n%s", resource, cm.RequiredACLPolicy())
+		}
+	}
+}
+
+func TestRequiredACLPolicy_Registration(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+	cm.registered["users-1"] = "users" // as by Register
+
+	if !hasACLRule(cm, "service", "users", "write") || hasACLRule(cm, "service", "users", "read") {
+		t.Errorf("want service:write on users only:\n%s", cm.RequiredACLPolicy())
+	}
+}
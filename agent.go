@@ -0,0 +1,94 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// hostIPEnv holds the node address in Kubernetes pods when exposed through
+// the downward API, where the Consul agent runs as a DaemonSet
+const hostIPEnv = "HOST_IP"
+
+const defaultAgentPort = "8500"
+
+// NewWithAutoAgent creates a ConnManager with a Consul client configured the
+// way the consul CLI is: CONSUL_HTTP_ADDR, CONSUL_HTTP_TOKEN(_FILE),
+// CONSUL_HTTP_SSL, CONSUL_CACERT, CONSUL_CLIENT_CERT/KEY and friends. Without
+// CONSUL_HTTP_ADDR the local agent is used: HOST_IP:8500 when set, otherwise
+// 127.0.0.1:8500 (not "localhost", which may resolve to ::1 on Windows while
+// the agent listens on IPv4)
+func NewWithAutoAgent(services []string, opts ...Option) (*ConnManager, error) {
+	cfg, err := autoAgentConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("consul client for %s: %w", cfg.Address, err)
+	}
+
+	return New(client, services, opts...)
+}
+
+// autoAgentConfig builds the client config from the environment and checks
+// the parts api.NewClient reports poorly
+func autoAgentConfig() (*api.Config, error) {
+	cfg := api.DefaultConfig()
+
+	if _, ok := os.LookupEnv(api.HTTPAddrEnvName); !ok {
+		if ip := os.Getenv(hostIPEnv); ip != "" {
+			cfg.Address = net.JoinHostPort(ip, defaultAgentPort)
+		}
+	} else if err := checkAgentAddr(cfg.Address); err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", api.HTTPAddrEnvName, cfg.Address, err)
+	}
+
+	for env, path := range map[string]string{
+		api.HTTPTokenFileEnvName: cfg.TokenFile,
+		api.HTTPCAFile:           cfg.TLSConfig.CAFile,
+		api.HTTPClientCert:       cfg.TLSConfig.CertFile,
+		api.HTTPClientKey:        cfg.TLSConfig.KeyFile,
+	} {
+		if path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("%s: %w", env, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// checkAgentAddr validates a CONSUL_HTTP_ADDR value: an http(s) URL, whose
+// port defaults to the scheme's, host:port, or a unix socket
+func checkAgentAddr(addr string) error {
+	if strings.HasPrefix(addr, "unix://") {
+		return nil
+	}
+
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		_, _, err := net.SplitHostPort(addr)
+
+		return err
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return err
+	}
+
+	if u.Hostname() == "" {
+		return errors.New("missing_host")
+	}
+
+	return nil
+}
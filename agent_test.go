@@ -0,0 +1,87 @@
+package consul_service_discovery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestAutoAgentConfig_Fallbacks(t *testing.T) {
+	// t.Setenv restores the variables once the test ends
+	for _, env := range []string{hostIPEnv, api.HTTPAddrEnvName} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+
+	cfg, err := autoAgentConfig()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+
+	if cfg.Address != "127.0.0.1:8500" {
+		t.Errorf("address = %s, want local agent", cfg.Address)
+	}
+
+	t.Setenv(hostIPEnv, "10.0.0.7")
+
+	if cfg, _ := autoAgentConfig(); cfg.Address != "10.0.0.7:8500" {
+		t.Errorf("address = %s, want node agent from HOST_IP", cfg.Address)
+	}
+
+	t.Setenv(api.HTTPAddrEnvName, "https://consul.example:8501")
+
+	if cfg, _ := autoAgentConfig(); cfg.Address != "https://consul.example:8501" {
+		t.Errorf("address = %s, want CONSUL_HTTP_ADDR", cfg.Address)
+	}
+}
+
+func TestCheckAgentAddr(t *testing.T) {
+	valid := []string{
+		"127.0.0.1:8500",
+		"http://127.0.0.1:8500",
+		"https://consul.example.com",
+		"https://consul.example.com:8501",
+		"unix:///var/run/consul.sock",
+	}
+
+	for _, addr := range valid {
+		if err := checkAgentAddr(addr); err != nil {
+			t.Errorf("checkAgentAddr(%q) = %v, want valid", addr, err)
+		}
+	}
+
+	for _, addr := range []string{"consul.example", "https://", "http://consul:port"} {
+		if err := checkAgentAddr(addr); err == nil {
+			t.Errorf("checkAgentAddr(%q) accepted", addr)
+		}
+	}
+}
+
+func TestAutoAgentConfig_Errors(t *testing.T) {
+	t.Setenv(api.HTTPAddrEnvName, "consul.example")
+
+	if _, err := autoAgentConfig(); err == nil || !strings.Contains(err.Error(), api.HTTPAddrEnvName) {
+		t.Errorf("err = %v, want invalid CONSUL_HTTP_ADDR", err)
+	}
+
+	t.Setenv(api.HTTPAddrEnvName, "127.0.0.1:8500")
+	t.Setenv(api.HTTPTokenFileEnvName, filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := autoAgentConfig(); err == nil || !strings.Contains(err.Error(), api.HTTPTokenFileEnvName) {
+		t.Errorf("err = %v, want missing token file", err)
+	}
+}
+
+func TestNewWithAutoAgent(t *testing.T) {
+	t.Setenv(api.HTTPAddrEnvName, "127.0.0.1:8500")
+
+	cm, err := NewWithAutoAgent([]string{"users"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	cm.Stop()
+}
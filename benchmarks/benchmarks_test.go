@@ -0,0 +1,251 @@
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/consultest"
+)
+
+// workload describes the topology a benchmark runs against
+type workload struct {
+	services  int
+	instances int // per service
+}
+
+func (w workload) String() string {
+	return fmt.Sprintf("services=%d/instances=%d", w.services, w.instances)
+}
+
+func (w workload) names() []string {
+	names := make([]string, w.services)
+	for i := range names {
+		names[i] = fmt.Sprintf("svc-%d", i)
+	}
+
+	return names
+}
+
+// ports returns the instance ports of service i in generation gen, distinct
+// across services and generations
+func (w workload) ports(i, gen int) []int {
+	ports := make([]int, w.instances)
+	for k := range ports {
+		ports[k] = 10000 + (gen%4)*10000 + i*w.instances + k
+	}
+
+	return ports
+}
+
+// setup starts a consultest server seeded with w and a started manager
+// connected to every service
+func setup(b *testing.B, w workload, opts ...csd.Option) (*csd.ConnManager, *consultest.Server) {
+	b.Helper()
+
+	srv := consultest.NewServer()
+	b.Cleanup(srv.Close)
+
+	names := w.names()
+	for i, svc := range names {
+		srv.SetInstances(svc, w.ports(i, 0)...)
+	}
+
+	client, err := srv.Client()
+	if err != nil {
+		b.Fatalf("client: %v", err)
+	}
+
+	cm, err := csd.New(client, names, append([]csd.Option{csd.WithWaitTime(time.Minute)}, opts...)...)
+	if err != nil {
+		b.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Cleanup(func() {
+		cancel()
+		cm.Stop()
+	})
+
+	cm.Start(ctx)
+
+	wait, waitCancel := context.WithTimeout(ctx, 30*time.Second)
+	defer waitCancel()
+
+	for _, svc := range names {
+		if _, err := cm.GetConnContext(wait, svc); err != nil {
+			b.Fatalf("%s never connected: %v", svc, err)
+		}
+	}
+
+	return cm, srv
+}
+
+var workloads = []workload{
+	{services: 10, instances: 3},
+	{services: 100, instances: 3},
+	{services: 100, instances: 20},
+	{services: 1000, instances: 3},
+}
+
+// BenchmarkGetConn measures the GetConn read path on a steady topology
+func BenchmarkGetConn(b *testing.B) {
+	for _, w := range workloads {
+		b.Run(w.String(), func(b *testing.B) {
+			cm, _ := setup(b, w)
+			names := w.names()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(len(names))
+
+				for pb.Next() {
+					if _, err := cm.GetConn(names[i%len(names)]); err != nil {
+						b.Error(err)
+
+						return
+					}
+
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkGetConnChurn measures GetConn while instances of random services
+// are replaced at the given rate, so readers race target swaps
+func BenchmarkGetConnChurn(b *testing.B) {
+	w := workload{services: 100, instances: 5}
+
+	for _, every := range []time.Duration{10 * time.Millisecond, time.Millisecond} {
+		b.Run(fmt.Sprintf("%s/churn=%s", w, every), func(b *testing.B) {
+			cm, srv := setup(b, w)
+			names := w.names()
+
+			var changes atomic.Int64
+
+			stop := make(chan struct{})
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+
+				ticker := time.NewTicker(every)
+				defer ticker.Stop()
+
+				for gen := 1; ; gen++ {
+					select {
+					case <-stop:
+						return
+					case <-ticker.C:
+					}
+
+					i := rand.Intn(len(names))
+					srv.SetInstances(names[i], w.ports(i, gen)...)
+					changes.Add(1)
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(len(names))
+
+				for pb.Next() {
+					// a miss is legal mid-swap; only the read cost matters
+					_, _ = cm.GetConn(names[i%len(names)])
+					i++
+				}
+			})
+
+			b.StopTimer()
+			close(stop)
+			<-done
+
+			b.ReportMetric(float64(changes.Load())/b.Elapsed().Seconds(), "changes/s")
+		})
+	}
+}
+
+// BenchmarkUpdatePropagation measures the time from a Consul change to the
+// new target being selected. ns/op is the mean; p50 and p99 are reported
+// separately
+func BenchmarkUpdatePropagation(b *testing.B) {
+	for _, w := range []workload{{services: 10, instances: 3}, {services: 100, instances: 3}} {
+		b.Run(w.String(), func(b *testing.B) {
+			selected := make(chan csd.Event, 64)
+
+			_, srv := setup(b, w, csd.WithEventHandler(func(ev csd.Event) {
+				if ev.Type == csd.EventTargetSelected {
+					select {
+					case selected <- ev:
+					default:
+					}
+				}
+			}))
+
+			names := w.names()
+			latencies := make([]time.Duration, 0, b.N)
+
+			drain(selected)
+			b.ResetTimer()
+
+			for n := range b.N {
+				i := n % len(names)
+				ports := w.ports(i, n/len(names)+1)
+				target := fmt.Sprintf("127.0.0.1:%d", ports[0])
+
+				began := time.Now()
+				srv.SetInstances(names[i], ports[0])
+
+				if !awaitTarget(selected, names[i], target, 10*time.Second) {
+					b.Fatalf("%s never switched to %s", names[i], target)
+				}
+
+				latencies = append(latencies, time.Since(began))
+			}
+
+			b.StopTimer()
+
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[len(latencies)/2].Nanoseconds()), "p50-ns")
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+		})
+	}
+}
+
+// awaitTarget waits for service to select target
+func awaitTarget(selected <-chan csd.Event, service, target string, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case ev := <-selected:
+			if ev.Service == service && ev.Target == target {
+				return true
+			}
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+func drain(ch <-chan csd.Event) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// Package benchmarks holds the performance regression suite of
+// consul_service_discovery. The workloads run the real watch loop against
+// the in-memory consultest server with N services of M instances and
+// configurable churn, and measure GetConn latency and allocations, GetConn
+// under churn, and the latency from a Consul change to the new target being
+// published. Run them with
+//
+//	go test ./benchmarks -run '^$' -bench . -benchmem
+//
+// and compare runs with benchstat before and after a performance change
+package benchmarks
@@ -0,0 +1,121 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// connIdleAfter is how long a per-instance connection must go unused before
+// it may be closed to make room under the connection budget
+const connIdleAfter = time.Minute
+
+// ErrConnBudgetExceeded is matched (via errors.Is) by *ConnBudgetError
+var ErrConnBudgetExceeded = errors.New("conn_budget_exceeded")
+
+// ConnBudgetError is returned when a new connection would exceed the limit set
+// with WithMaxTotalConns and no idle connection could be closed
+type ConnBudgetError struct {
+	Limit int
+	Open  int
+}
+
+func (e *ConnBudgetError) Error() string {
+	return fmt.Sprintf("%s: %d of %d connections open", ErrConnBudgetExceeded, e.Open, e.Limit)
+}
+
+// Unwrap makes errors.Is(err, ErrConnBudgetExceeded) hold
+func (e *ConnBudgetError) Unwrap() error { return ErrConnBudgetExceeded }
+
+// WithMaxTotalConns caps the connections held across all services, including
+// per-instance and standby ones, protecting the process from file-descriptor
+// exhaustion. When the cap is reached the least recently used idle
+// per-instance connection is closed, then a standby one (see
+// WithStandbyConn); if neither exists the new connection fails with
+// *ConnBudgetError
+func WithMaxTotalConns(n int) Option {
+	return func(cm *ConnManager) error {
+		if n <= 0 {
+			return errors.New("max_conns_must_be_positive")
+		}
+
+		cm.maxConns = n
+
+		return nil
+	}
+}
+
+// reserveConnLocked makes room for one more connection, closing idle
+// per-instance connections as needed; callers hold cm.mu
+func (cm *ConnManager) reserveConnLocked() error {
+	if cm.maxConns == 0 {
+		return nil
+	}
+
+	for {
+		open := cm.openConnsLocked()
+		if open < cm.maxConns {
+			return nil
+		}
+
+		key, ok := cm.lruIdleLocked()
+		if !ok {
+			if cm.dropStandbyLocked() {
+				continue
+			}
+
+			return &ConnBudgetError{Limit: cm.maxConns, Open: open}
+		}
+
+		mc := cm.instanceConns[key]
+		delete(cm.instanceConns, key)
+
+		if err := cm.releaseLocked(mc.conn); err != nil {
+			cm.logger.Warn("close instance conn", zap.String("service", key.service), zap.String("instance", key.id), zap.Error(err))
+		}
+
+		cm.logger.Info("closed idle instance conn to stay within budget",
+			zap.String("service", key.service),
+			zap.String("instance", key.id),
+			zap.Int("limit", cm.maxConns),
+		)
+	}
+}
+
+// openConnsLocked counts the connections held against WithMaxTotalConns
+func (cm *ConnManager) openConnsLocked() int {
+	return len(cm.conns) + len(cm.instanceConns) + len(cm.standbys)
+}
+
+// hasConnRoomLocked reports whether one more connection fits the budget
+// without closing another
+func (cm *ConnManager) hasConnRoomLocked() bool {
+	return cm.maxConns == 0 || cm.openConnsLocked() < cm.maxConns
+}
+
+// lruIdleLocked returns the least recently used per-instance connection among
+// those not handed out for connIdleAfter
+func (cm *ConnManager) lruIdleLocked() (instanceKey, bool) {
+	var (
+		best     instanceKey
+		bestUsed int64
+		found    bool
+	)
+
+	cutoff := time.Now().Add(-connIdleAfter).UnixNano()
+
+	for key, mc := range cm.instanceConns {
+		used := mc.lastUsed.Load()
+		if used > cutoff {
+			continue
+		}
+
+		if !found || used < bestUsed {
+			best, bestUsed, found = key, used, true
+		}
+	}
+
+	return best, found
+}
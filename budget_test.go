@@ -0,0 +1,53 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMaxTotalConns(t *testing.T) {
+	cm := newTestManager(t, []string{"users"}, WithMaxTotalConns(2))
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001, 9002, 9003)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	cm.mu.RLock()
+	current := cm.conns["users"].instanceID
+	cm.mu.RUnlock()
+
+	var others []string
+	for _, id := range []string{"users-9001", "users-9002", "users-9003"} {
+		if id != current {
+			others = append(others, id)
+		}
+	}
+
+	if _, err := cm.GetConnByInstanceID("users", others[0]); err != nil {
+		t.Fatalf("first instance conn: %v", err)
+	}
+
+	_, err := cm.GetConnByInstanceID("users", others[1])
+
+	var budgetErr *ConnBudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrConnBudgetExceeded) || budgetErr.Limit != 2 {
+		t.Fatalf("err = %v, want budget error", err)
+	}
+
+	// once the first instance conn has gone unused it makes room
+	cm.mu.RLock()
+	cm.instanceConns[instanceKey{service: "users", instanceRef: testRef(others[0])}].lastUsed.Store(time.Now().Add(-2 * connIdleAfter).UnixNano())
+	cm.mu.RUnlock()
+
+	if _, err := cm.GetConnByInstanceID("users", others[1]); err != nil {
+		t.Fatalf("expected idle conn to be evicted, got %v", err)
+	}
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if _, ok := cm.instanceConns[instanceKey{service: "users", instanceRef: testRef(others[0])}]; ok {
+		t.Error("least recently used conn should have been closed")
+	}
+}
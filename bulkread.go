@@ -0,0 +1,202 @@
+package consul_service_discovery
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// maxTxnOps is the operation limit of one Consul transaction on older
+// servers (newer ones accept 128)
+const maxTxnOps = 64
+
+// WithBulkInitialRead makes Start read the healthy instances of all watched
+// services in a few round trips instead of one query per service: one call
+// for every health check in the datacenter, then transactions fetching the
+// passing instances and their nodes, 64 operations each. Services connect
+// from that read, and each watcher's first query only re-selects if it
+// differs. Instances without any health check and services using a sameness
+// group or their own token (WithServiceToken) are not covered and appear
+// with the watcher's first response. If the bulk read fails the watchers
+// start as usual
+func WithBulkInitialRead(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.bulkInitialRead = enabled
+
+		return nil
+	}
+}
+
+// startWatchers runs the watchers, after seeding them from the shared cache
+// and a bulk read when enabled
+func (cm *ConnManager) startWatchers(ctx context.Context) {
+	if cm.waitTime > defaultWaitTime {
+		go cm.detectMaxWait(ctx)
+	}
+
+	seeded := 0
+	if cm.sharedCache != nil {
+		seeded = cm.seedFromSharedCache(ctx)
+	}
+
+	if cm.bulkInitialRead && seeded < len(cm.watchList) {
+		cm.seedFromBulkRead(ctx)
+	}
+
+	for _, svc := range cm.watchList {
+		cm.launchWatcher(ctx, svc)
+	}
+}
+
+// seedFromBulkRead refreshes every service found by bulkRead and records
+// the digest its watcher compares the first response against
+func (cm *ConnManager) seedFromBulkRead(ctx context.Context) {
+	began := time.Now()
+
+	found, err := cm.bulkRead(ctx)
+	if err != nil {
+		cm.logger.Warn("bulk initial read failed, querying services one by one", zap.Error(err))
+
+		return
+	}
+
+	for svc, entries := range found {
+		if err := cm.refresh(ctx, svc, entries); err != nil {
+			cm.logger.Warn("select instance", zap.String("service", svc), zap.Error(err))
+
+			continue
+		}
+
+		cm.watchStates[svc].seed(entriesDigest(entries))
+	}
+
+	cm.logger.Debug("bulk initial read",
+		zap.Int("services", len(found)),
+		zap.Duration("took", time.Since(began)),
+	)
+}
+
+// bulkRead returns the passing instances of the watched services, as
+// Health().Service with passingOnly would, keyed by logical service name.
+// Services in a sameness group or read with their own token (see
+// WithServiceToken) are left to their watchers
+func (cm *ConnManager) bulkRead(ctx context.Context) (map[string][]*api.ServiceEntry, error) {
+	names := make(map[string]string, len(cm.watchList)) // Consul -> logical name
+	for _, svc := range cm.watchList {
+		_, grouped := cm.samenessGroups[svc]
+		_, ownToken := cm.serviceTokens[svc]
+
+		if !grouped && !ownToken {
+			names[cm.consulName(svc)] = svc
+		}
+	}
+
+	checks, _, err := cm.client.Health().State(api.HealthAny, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("health state: %w", err)
+	}
+
+	nodeChecks := make(map[string]api.HealthChecks)
+	instChecks := make(map[instanceRef]api.HealthChecks)
+
+	for _, c := range checks {
+		switch {
+		case c.ServiceID == "":
+			nodeChecks[c.Node] = append(nodeChecks[c.Node], c)
+		case names[c.ServiceName] != "":
+			ref := instanceRef{c.Node, c.ServiceID}
+			instChecks[ref] = append(instChecks[ref], c)
+		}
+	}
+
+	var passing []instanceRef
+
+	for ref, cs := range instChecks {
+		all := slices.Concat(cs, nodeChecks[ref.node])
+		if all.AggregatedStatus() == api.HealthPassing {
+			instChecks[ref] = all
+			passing = append(passing, ref)
+		}
+	}
+
+	slices.SortFunc(passing, func(a, b instanceRef) int {
+		return cmp.Or(cmp.Compare(a.node, b.node), cmp.Compare(a.id, b.id))
+	})
+
+	services, nodes, err := cm.txnRead(ctx, passing)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]*api.ServiceEntry, len(names))
+	for _, svc := range names {
+		out[svc] = []*api.ServiceEntry{}
+	}
+
+	for i, ref := range passing {
+		svc := names[services[i].Service]
+		out[svc] = append(out[svc], &api.ServiceEntry{
+			Node:    nodes[ref.node],
+			Service: services[i],
+			Checks:  instChecks[ref],
+		})
+	}
+
+	return out, nil
+}
+
+// txnRead fetches the instances in refs (in order) and their nodes with as
+// few transactions as the operation limit allows
+func (cm *ConnManager) txnRead(ctx context.Context, refs []instanceRef) ([]*api.AgentService, map[string]*api.Node, error) {
+	ops := make(api.TxnOps, 0, len(refs)*2)
+	nodes := make(map[string]*api.Node)
+
+	for _, ref := range refs {
+		if _, ok := nodes[ref.node]; !ok {
+			nodes[ref.node] = nil
+			ops = append(ops, &api.TxnOp{Node: &api.NodeTxnOp{Verb: api.NodeGet, Node: api.Node{Node: ref.node}}})
+		}
+
+		ops = append(ops, &api.TxnOp{Service: &api.ServiceTxnOp{
+			Verb:    api.ServiceGet,
+			Node:    ref.node,
+			Service: api.AgentService{ID: ref.id},
+		}})
+	}
+
+	services := make([]*api.AgentService, 0, len(refs))
+	q := (&api.QueryOptions{}).WithContext(ctx)
+
+	for chunk := range slices.Chunk(ops, maxTxnOps) {
+		ok, resp, _, err := cm.client.Txn().Txn(chunk, q)
+		if err != nil {
+			return nil, nil, fmt.Errorf("txn: %w", err)
+		}
+
+		if !ok {
+			// an instance or node went away between the reads
+			return nil, nil, errors.New(resp.Errors[0].What)
+		}
+
+		for _, r := range resp.Results {
+			switch {
+			case r.Node != nil:
+				nodes[r.Node.Node] = r.Node
+			case r.Service != nil:
+				services = append(services, r.Service)
+			}
+		}
+	}
+
+	if len(services) != len(refs) {
+		return nil, nil, fmt.Errorf("txn: %d of %d instances returned", len(services), len(refs))
+	}
+
+	return services, nodes, nil
+}
@@ -0,0 +1,128 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// checkedEntries returns testEntries with a service check of the given
+// status on each instance and a passing serf check on each node
+func checkedEntries(service, status string, ports ...int) []*api.ServiceEntry {
+	entries := testEntries(service, ports...)
+
+	for _, e := range entries {
+		e.Checks = api.HealthChecks{
+			{Node: e.Node.Node, CheckID: "serfHealth", Status: api.HealthPassing},
+			{
+				Node:        e.Node.Node,
+				CheckID:     "service:" + e.Service.ID,
+				ServiceID:   e.Service.ID,
+				ServiceName: service,
+				Status:      status,
+			},
+		}
+	}
+
+	return entries
+}
+
+func TestBulkInitialRead(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setEntries("users", append(checkedEntries("users", api.HealthPassing, 9001, 9002),
+		checkedEntries("users", api.HealthCritical, 9003)...))
+	fake.setEntries("billing", checkedEntries("billing", api.HealthPassing, 9101))
+	fake.setEntries("other", checkedEntries("other", api.HealthPassing, 9201))
+
+	// a failing node check takes down every instance on the node
+	down := checkedEntries("billing", api.HealthPassing, 9102)
+	down[0].Checks[0].Status = api.HealthCritical
+	fake.setEntries("billing", append(fake.services["billing"], down...))
+
+	rec := &eventRecorder{}
+
+	cm, err := New(newTestClient(t, fake), []string{"users", "billing"},
+		WithBulkInitialRead(true),
+		WithWaitTime(time.Minute),
+		WithEventHandler(rec.handle),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.seedFromBulkRead(ctx)
+
+	for svc, want := range map[string][]int{"users": {9001, 9002}, "billing": {9101}} {
+		instances, _ := cm.Instances(svc)
+		if len(instances) != len(want) {
+			t.Fatalf("%s instances = %+v, want ports %v", svc, instances, want)
+		}
+
+		for i, inst := range instances {
+			if inst.Port != want[i] || inst.Node != "node-"+strconv.Itoa(want[i]) {
+				t.Errorf("%s instance %d = %+v, want port %d", svc, i, inst, want[i])
+			}
+		}
+
+		if _, err := cm.GetConn(svc); err != nil {
+			t.Errorf("%s not connected after the bulk read: %v", svc, err)
+		}
+	}
+
+	if n := fake.callCount("health/state") + fake.callCount("txn"); n != 2 {
+		t.Errorf("bulk read took %d requests, want 2", n)
+	}
+
+	if n := fake.callCount("health/service"); n != 0 {
+		t.Errorf("bulk read issued %d per-service queries", n)
+	}
+
+	// the watcher's first response matches the seed: no re-selection
+	changes := len(rec.types())
+
+	go cm.watchService(ctx, "users")
+
+	deadline := time.Now().Add(time.Second)
+	for fake.callCount("health/service") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if types := rec.types(); len(types) != changes {
+		t.Errorf("watcher re-applied the seeded set: %v", types[changes:])
+	}
+}
+
+func TestBulkRead_SkipsServiceTokens(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setEntries("users", checkedEntries("users", api.HealthPassing, 9001))
+	fake.setEntries("billing", checkedEntries("billing", api.HealthPassing, 9101))
+
+	cm, err := New(newTestClient(t, fake), []string{"users", "billing"},
+		WithBulkInitialRead(true),
+		WithServiceToken("billing", "billing-token"),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	found, err := cm.bulkRead(t.Context())
+	if err != nil {
+		t.Fatalf("bulk read: %v", err)
+	}
+
+	if _, ok := found["billing"]; ok {
+		t.Errorf("billing bulk-read with the default token: %v", found["billing"])
+	}
+
+	if len(found["users"]) != 1 {
+		t.Errorf("users = %v, want one instance", found["users"])
+	}
+}
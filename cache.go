@@ -0,0 +1,110 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"slices"
+	"strconv"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+// Per-entry overhead assumed for strings and map entries when estimating
+// cache memory
+const (
+	stringHeaderBytes = int(unsafe.Sizeof(""))
+	mapEntryBytes     = 48
+)
+
+// CacheLimits bounds the manager's internal caches. Zero fields are unlimited
+type CacheLimits struct {
+	// MaxInstancesPerService caps the cached healthy set of each service;
+	// larger sets are subsampled stably per process
+	MaxInstancesPerService int
+	// MaxSignals caps the per-instance signals kept for a Scorer; the least
+	// recently updated of a sample of entries is evicted
+	MaxSignals int
+}
+
+// WithCacheLimits bounds internal caches so memory stays predictable when
+// watching services with very large healthy sets
+func WithCacheLimits(l CacheLimits) Option {
+	return func(cm *ConnManager) error {
+		if l.MaxInstancesPerService < 0 || l.MaxSignals < 0 {
+			return errors.New("negative_cache_limit")
+		}
+
+		cm.maxInstances = l.MaxInstancesPerService
+		cm.signals.limit = l.MaxSignals
+
+		return nil
+	}
+}
+
+// boundInstances subsamples instances to the configured per-service cap. The
+// subset is chosen by hashing instance IDs with a per-process salt, so it is
+// stable across refreshes here yet differs between processes
+func (cm *ConnManager) boundInstances(service string, instances []Instance) []Instance {
+	if cm.maxInstances == 0 || len(instances) <= cm.maxInstances {
+		return instances
+	}
+
+	rank := func(inst Instance) uint64 {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(cm.cacheSalt))
+		_, _ = h.Write([]byte(inst.ID))
+
+		return h.Sum64()
+	}
+
+	out := slices.Clone(instances)
+	slices.SortFunc(out, func(a, b Instance) int {
+		ra, rb := rank(a), rank(b)
+
+		switch {
+		case ra < rb:
+			return -1
+		case ra > rb:
+			return 1
+		}
+
+		return 0
+	})
+
+	cm.logger.Debug("healthy set exceeds cache limit, subsampling",
+		zap.String("service", service),
+		zap.Int("instances", len(instances)),
+		zap.Int("limit", cm.maxInstances),
+	)
+
+	return out[:cm.maxInstances]
+}
+
+// newCacheSalt returns the per-process salt used by boundInstances
+func newCacheSalt() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// estimateBytes approximates the memory held by a cached instance set
+func estimateBytes(instances []Instance) int {
+	n := int(unsafe.Sizeof(Instance{})) * cap(instances)
+
+	for _, inst := range instances {
+		n += len(inst.ID) + len(inst.Service) + len(inst.Node) + len(inst.Address) + len(inst.Datacenter) +
+			len(inst.IPv4) + len(inst.IPv6)
+
+		for _, tag := range inst.Tags {
+			n += stringHeaderBytes + len(tag)
+		}
+
+		for _, m := range []map[string]string{inst.Meta, inst.NodeMeta} {
+			for k, v := range m {
+				n += mapEntryBytes + len(k) + len(v)
+			}
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,101 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheLimits_BoundInstances(t *testing.T) {
+	cm := newTestManager(t, []string{"users"}, WithCacheLimits(CacheLimits{MaxInstancesPerService: 3}))
+
+	ports := []int{9001, 9002, 9003, 9004, 9005, 9006, 9007, 9008}
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", ports...)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	first, _ := cm.Instances("users")
+	if len(first) != 3 {
+		t.Fatalf("cached %d instances, want 3", len(first))
+	}
+
+	// the subset is stable for the process regardless of response order
+	slices.Reverse(ports)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", ports...)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	second, _ := cm.Instances("users")
+	if !slices.EqualFunc(first, second, func(a, b Instance) bool { return a.ID == b.ID }) {
+		t.Errorf("subset changed: %v then %v", first, second)
+	}
+
+	st := cm.Status()[0]
+	if st.CachedInstances != 3 || st.CacheBytes <= 0 {
+		t.Errorf("status = %+v, want 3 cached instances with a size estimate", st)
+	}
+}
+
+func TestSignalStore_Limit(t *testing.T) {
+	s := signalStore{limit: 2}
+
+	for _, id := range []string{"a", "b", "c"} {
+		s.failed(instanceKey{service: "users", instanceRef: instanceRef{id: id}})
+	}
+
+	if n := s.size.Load(); n != 2 {
+		t.Fatalf("kept %d signals, want 2", n)
+	}
+
+	if sig := s.get(instanceKey{service: "users", instanceRef: instanceRef{id: "a"}}); sig != (Signals{}) {
+		t.Errorf("oldest entry should have been evicted, got %+v", sig)
+	}
+}
+
+func TestSignalStore_ConcurrentLimit(t *testing.T) {
+	const workers, keys, limit = 8, 200, 50
+
+	s := signalStore{limit: limit}
+
+	var wg sync.WaitGroup
+
+	for w := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range keys {
+				key := instanceKey{service: "users", instanceRef: instanceRef{id: fmt.Sprintf("%d-%d", w, i)}}
+				s.observe(key, time.Millisecond, nil)
+				s.get(key)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	stored := 0
+	for i := range s.shards {
+		stored += len(s.shards[i].entries)
+	}
+
+	if n := s.size.Load(); n != int64(stored) || stored > limit {
+		t.Errorf("size = %d with %d stored, want them equal and within %d", n, stored, limit)
+	}
+}
+
+func TestEstimateBytes(t *testing.T) {
+	small := estimateBytes(instancesFromEntries(testEntries("users", 9001)))
+
+	big := instancesFromEntries(testEntries("users", 9001))
+	big[0].Meta = map[string]string{"version": "1.2.3", "zone": "eu-west-1a"}
+
+	if estimateBytes(big) <= small || small <= 0 {
+		t.Errorf("estimates: plain %d, with meta %d", small, estimateBytes(big))
+	}
+}
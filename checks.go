@@ -0,0 +1,101 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// CheckInterpreter derives the load of an instance from its health checks,
+// e.g. from metrics the service publishes in check output. ok is false when
+// the checks carry no load information
+type CheckInterpreter func(checks api.HealthChecks) (load float64, ok bool)
+
+// JSONCheckLoad interprets check outputs as JSON objects and returns the
+// highest numeric value of field among them, e.g. {"load": 0.93}. Outputs
+// that are not JSON or lack the field are ignored
+func JSONCheckLoad(field string) CheckInterpreter {
+	return func(checks api.HealthChecks) (float64, bool) {
+		var (
+			load  float64
+			found bool
+		)
+
+		for _, c := range checks {
+			var body map[string]any
+			if err := json.Unmarshal([]byte(c.Output), &body); err != nil {
+				continue
+			}
+
+			v, ok := body[field].(float64)
+			if !ok {
+				continue
+			}
+
+			if !found || v > load {
+				load, found = v, true
+			}
+		}
+
+		return load, found
+	}
+}
+
+// WithCheckInterpreter sets how Instance.Load is read from health checks.
+// Passing instances with a load at or above maxLoad are avoided while any
+// other eligible instance exists; the load is also visible to a Scorer
+func WithCheckInterpreter(interp CheckInterpreter, maxLoad float64) Option {
+	return func(cm *ConnManager) error {
+		if interp == nil {
+			return errors.New("nil_check_interpreter")
+		}
+
+		if maxLoad <= 0 {
+			return errors.New("invalid_max_load")
+		}
+
+		cm.checkInterpreter = interp
+		cm.maxLoad = maxLoad
+
+		return nil
+	}
+}
+
+// applyLoad sets the load of instances, built from entries in order
+func (cm *ConnManager) applyLoad(entries []*api.ServiceEntry, instances []Instance) {
+	if cm.checkInterpreter == nil {
+		return
+	}
+
+	for i, e := range entries {
+		if load, ok := cm.checkInterpreter(e.Checks); ok {
+			instances[i].Load = load
+		}
+	}
+}
+
+// withoutOverloaded drops instances at or above the max load unless all of
+// them are
+func (cm *ConnManager) withoutOverloaded(service string, instances []Instance) []Instance {
+	if cm.checkInterpreter == nil {
+		return instances
+	}
+
+	out := make([]Instance, 0, len(instances))
+
+	for _, inst := range instances {
+		if inst.Load < cm.maxLoad {
+			out = append(out, inst)
+		}
+	}
+
+	if len(out) == 0 && len(instances) > 0 {
+		cm.logger.Warn("all instances overloaded", zap.String("service", service), zap.Int("instances", len(instances)))
+
+		return instances
+	}
+
+	return out
+}
@@ -0,0 +1,79 @@
+package consul_service_discovery
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// withLoad attaches a passing check reporting load to every entry
+func withLoad(entries []*api.ServiceEntry, loads ...string) []*api.ServiceEntry {
+	for i, e := range entries {
+		e.Checks = api.HealthChecks{
+			{CheckID: "serfHealth", Status: api.HealthPassing},
+			{CheckID: "service:" + e.Service.ID, Status: api.HealthPassing, Output: loads[i]},
+		}
+	}
+
+	return entries
+}
+
+func TestJSONCheckLoad(t *testing.T) {
+	interp := JSONCheckLoad("load")
+
+	checks := api.HealthChecks{
+		{Output: "Agent alive and reachable"},
+		{Output: `{"load": 0.4}`},
+		{Output: `{"load": 0.7, "conns": 12}`},
+	}
+
+	if load, ok := interp(checks); !ok || load != 0.7 {
+		t.Errorf("load = %v, %v; want 0.7, true", load, ok)
+	}
+
+	if _, ok := interp(api.HealthChecks{{Output: `{"cpu": 1}`}}); ok {
+		t.Error("checks without the field should report no load")
+	}
+}
+
+func TestCheckInterpreter_AvoidsOverloaded(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithCheckInterpreter(JSONCheckLoad("load"), 0.9))
+
+	entries := withLoad(testEntries("svc", 9001, 9002, 9003), `{"load": 0.95}`, `{"load": 0.3}`, `{"load": 1.2}`)
+
+	for range 10 {
+		if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if id := cm.conns["svc"].instanceID; id != "svc-9002" {
+			t.Fatalf("selected %s, want the only instance below max load", id)
+		}
+	}
+
+	if inst, _ := cm.View().GetInstance("svc", "svc-9001"); inst.Load != 0.95 {
+		t.Errorf("load = %v, want 0.95", inst.Load)
+	}
+
+	// everyone overloaded: still connect rather than drop the service
+	entries = withLoad(testEntries("svc", 9001, 9003), `{"load": 0.95}`, `{"load": 1.2}`)
+	if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("svc"); err != nil {
+		t.Errorf("get conn: %v", err)
+	}
+}
+
+func TestWithCheckInterpreter_Invalid(t *testing.T) {
+	cm := &ConnManager{}
+
+	if err := WithCheckInterpreter(nil, 1)(cm); err == nil {
+		t.Error("expected error for nil interpreter")
+	}
+
+	if err := WithCheckInterpreter(JSONCheckLoad("load"), 0)(cm); err == nil {
+		t.Error("expected error for non-positive max load")
+	}
+}
@@ -0,0 +1,72 @@
+package consul_service_discovery
+
+import (
+	"slices"
+)
+
+// Child creates a manager for services that shares infrastructure with cm:
+// the Consul client, logger, metrics sinks, event handlers, connection
+// decorators, dial options (TLS included), stats handlers, proxy, service
+// naming, query timing and limits. Dials across cm and its children share
+// one WithDialConcurrency budget; WithMaxTotalConns and WithCacheLimits
+// apply per manager. opts are applied after the inherited settings, so they
+// may override them.
+//
+// The child is started separately, but Stop on cm also stops it
+func (cm *ConnManager) Child(services []string, opts ...Option) (*ConnManager, error) {
+	child, err := New(cm.client, services, append([]Option{cm.inherit}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	cm.children = append(cm.children, child)
+	cm.mu.Unlock()
+
+	return child, nil
+}
+
+// inherit is the Option copying cm's shared settings into a child
+func (cm *ConnManager) inherit(child *ConnManager) error {
+	child.logger = cm.logger
+	child.metrics = slices.Clone(cm.metrics)
+	child.eventHandlers = slices.Clone(cm.eventHandlers)
+	child.decorators = slices.Clone(cm.decorators)
+	child.dialOpts = slices.Clone(cm.dialOpts)
+	child.statsHandlers = slices.Clone(cm.statsHandlers)
+	child.otel = cm.otel
+	child.peerService = cm.peerService
+	child.proxyDial = cm.proxyDial
+	child.proxyOptions = slices.Clone(cm.proxyOptions)
+	child.serverName = cm.serverName
+
+	child.namePrefix = cm.namePrefix
+	child.nameSuffix = cm.nameSuffix
+	child.nameTemplate = cm.nameTemplate
+	child.environment = cm.environment
+
+	child.waitTime = cm.waitTime
+	child.retryInterval = cm.retryInterval
+	child.forcedRefresh = cm.forcedRefresh
+	child.queryTimeout = cm.queryTimeout
+	child.dryRun = cm.dryRun
+
+	child.maxConns = cm.maxConns
+	child.dialSlots = cm.dialSlots
+	child.maxInstances = cm.maxInstances
+	child.signals.limit = cm.signals.limit
+
+	return nil
+}
+
+// stopChildren stops the managers created with Child
+func (cm *ConnManager) stopChildren() {
+	cm.mu.Lock()
+	children := cm.children
+	cm.children = nil
+	cm.mu.Unlock()
+
+	for _, child := range children {
+		child.Stop()
+	}
+}
@@ -0,0 +1,95 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestChild_InheritsSettings(t *testing.T) {
+	logger := zap.NewExample()
+	rec := &eventRecorder{}
+
+	parent := newTestManager(t, []string{"users"},
+		WithLogger(logger),
+		WithEventHandler(rec.handle),
+		WithWaitTime(10*time.Second),
+		WithServiceNamePrefix("staging-"),
+		WithDialConcurrency(2),
+		WithMaxTotalConns(8),
+	)
+
+	child, err := parent.Child([]string{"billing"}, WithRetryInterval(time.Second))
+	if err != nil {
+		t.Fatalf("child: %v", err)
+	}
+
+	if child.client != parent.client || child.logger != logger {
+		t.Error("client or logger not inherited")
+	}
+
+	if child.waitTime != 10*time.Second || child.retryInterval != time.Second {
+		t.Errorf("timing = %s/%s, want inherited wait time and overridden retry", child.waitTime, child.retryInterval)
+	}
+
+	if got := child.consulName("billing"); got != "staging-billing" {
+		t.Errorf("consul name = %q, want staging-billing", got)
+	}
+
+	if child.dialSlots != parent.dialSlots || child.maxConns != 8 {
+		t.Error("limits not inherited")
+	}
+
+	if len(child.dialOpts) != len(parent.dialOpts) {
+		t.Errorf("dial options = %d, want %d", len(child.dialOpts), len(parent.dialOpts))
+	}
+
+	if err := child.refresh(t.Context(), "billing", testEntries("billing", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if len(rec.types()) == 0 {
+		t.Error("child events not delivered to the inherited handler")
+	}
+
+	if _, err := parent.GetConn("billing"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("parent conn for child service: %v", err)
+	}
+}
+
+func TestChild_OptionsDoNotLeakToParent(t *testing.T) {
+	parent := newTestManager(t, []string{"users"})
+
+	if _, err := parent.Child([]string{"billing"}, WithEventHandler(func(Event) {})); err != nil {
+		t.Fatalf("child: %v", err)
+	}
+
+	if len(parent.eventHandlers) != 0 {
+		t.Error("child option changed the parent")
+	}
+
+	if _, err := parent.Child(nil); err == nil {
+		t.Error("child without services accepted")
+	}
+}
+
+func TestChild_StoppedWithParent(t *testing.T) {
+	parent := newTestManager(t, []string{"users"})
+
+	child, err := parent.Child([]string{"billing"})
+	if err != nil {
+		t.Fatalf("child: %v", err)
+	}
+
+	if err := child.refresh(t.Context(), "billing", testEntries("billing", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	parent.Stop()
+
+	if _, err := child.GetConn("billing"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("child conn after parent stop: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package consul_service_discovery
+
+import (
+	"errors"
+
+	"google.golang.org/grpc"
+)
+
+// ManagedHooks are callbacks a ConnDecorator attaches to one service
+// connection. Either may be nil
+type ManagedHooks struct {
+	// OnReplace runs when next took over the service, nil when the service
+	// lost its connection
+	OnReplace func(next *grpc.ClientConn)
+	// OnClose runs once the manager released the connection: after
+	// OnReplace, or on CloseAll and Stop
+	OnClose func()
+}
+
+// ConnDecorator is called when conn becomes the connection of service, e.g.
+// to register it with an application pool or instrumentation, and returns
+// the hooks to run when it is replaced and closed
+type ConnDecorator func(service string, conn *grpc.ClientConn) ManagedHooks
+
+// WithConnDecorator calls d for every new service connection. Decorators
+// and hooks run on discovery goroutines, outside the manager's locks, and
+// should not block. It may be given several times
+func WithConnDecorator(d ConnDecorator) Option {
+	return func(cm *ConnManager) error {
+		if d == nil {
+			return errors.New("nil_conn_decorator")
+		}
+
+		cm.decorators = append(cm.decorators, d)
+
+		return nil
+	}
+}
+
+// decorate runs the decorators on mc, the new connection of service
+func (cm *ConnManager) decorate(service string, mc *managedConn) {
+	if len(cm.decorators) == 0 {
+		return
+	}
+
+	hooks := make([]ManagedHooks, 0, len(cm.decorators))
+	for _, d := range cm.decorators {
+		hooks = append(hooks, d(service, mc.conn))
+	}
+
+	cm.mu.Lock()
+	cur, ok := cm.conns[service]
+	current := ok && cur.conn == mc.conn
+
+	if current {
+		cur.hooks = hooks
+	}
+	cm.mu.Unlock()
+
+	if !current {
+		closed(hooks) // replaced or closed while the decorators ran
+	}
+}
+
+// replaced runs the hooks of a connection next took over from
+func replaced(hooks []ManagedHooks, next *grpc.ClientConn) {
+	for _, h := range hooks {
+		if h.OnReplace != nil {
+			h.OnReplace(next)
+		}
+	}
+
+	closed(hooks)
+}
+
+// closed runs the close hooks of a released connection
+func closed(hooks []ManagedHooks) {
+	for _, h := range hooks {
+		if h.OnClose != nil {
+			h.OnClose()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package consul_service_discovery
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// hookLog records decorator and hook calls in order
+type hookLog struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (l *hookLog) add(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls = append(l.calls, s)
+}
+
+func (l *hookLog) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := l.calls
+	l.calls = nil
+
+	return out
+}
+
+func TestConnDecorator_Lifecycle(t *testing.T) {
+	var (
+		log hookLog
+		cm  *ConnManager
+	)
+
+	decorator := func(service string, conn *grpc.ClientConn) ManagedHooks {
+		// the manager's locks are not held
+		if _, err := cm.GetConnMap(service); err != nil {
+			t.Errorf("GetConnMap in decorator: %v", err)
+		}
+
+		target := conn.Target()
+		log.add("create " + target)
+
+		return ManagedHooks{
+			OnReplace: func(next *grpc.ClientConn) {
+				if next == nil {
+					log.add("replace " + target + " -> none")
+				} else {
+					log.add("replace " + target + " -> " + next.Target())
+				}
+			},
+			OnClose: func() { log.add("close " + target) },
+		}
+	}
+
+	cm = newTestManager(t, []string{"svc"}, WithConnDecorator(decorator))
+
+	steps := []struct {
+		ports []int
+		want  []string
+	}{
+		{[]int{9001}, []string{"create 127.0.0.1:9001"}},
+		{[]int{9001}, nil}, // same target, nothing happens
+		{[]int{9002}, []string{"replace 127.0.0.1:9001 -> 127.0.0.1:9002", "close 127.0.0.1:9001", "create 127.0.0.1:9002"}},
+		{nil, []string{"replace 127.0.0.1:9002 -> none", "close 127.0.0.1:9002"}},
+		{[]int{9003}, []string{"create 127.0.0.1:9003"}},
+	}
+
+	for i, s := range steps {
+		if err := cm.refresh(t.Context(), "svc", testEntries("svc", s.ports...)); err != nil {
+			t.Fatalf("step %d: refresh: %v", i, err)
+		}
+
+		if got := log.take(); !slices.Equal(got, s.want) {
+			t.Errorf("step %d: calls = %q, want %q", i, got, s.want)
+		}
+	}
+
+	cm.CloseAll()
+
+	if got, want := log.take(), []string{"close 127.0.0.1:9003"}; !slices.Equal(got, want) {
+		t.Errorf("CloseAll: calls = %q, want %q", got, want)
+	}
+}
+
+func TestWithConnDecorator_Nil(t *testing.T) {
+	if err := WithConnDecorator(nil)(newTestManager(t, []string{"svc"})); err == nil {
+		t.Error("expected an error")
+	}
+}
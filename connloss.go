@@ -0,0 +1,124 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+)
+
+// WithKeepalive sends gRPC keepalive pings with kp and treats the death of
+// an established connection (keepalive timeout, GOAWAY, transport closing)
+// as a signal instead of leaving gRPC to reconnect to a possibly dead
+// target: the manager emits EventConnLost, excludes the instance from
+// selection for quarantine and re-selects right away. An instance stays
+// eligible when all of them are quarantined
+func WithKeepalive(kp keepalive.ClientParameters, quarantine time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if quarantine <= 0 {
+			return errors.New("quarantine_must_be_positive")
+		}
+
+		cm.dialOpts = append(cm.dialOpts, grpc.WithKeepaliveParams(kp))
+		cm.lossQuarantine = quarantine
+
+		return nil
+	}
+}
+
+// monitorConn watches the service connection mc until it is replaced or
+// shut down, reporting the first loss of an established transport
+func (cm *ConnManager) monitorConn(service string, mc *managedConn) {
+	ready := false
+
+	for {
+		state := mc.conn.GetState()
+
+		switch {
+		case state == connectivity.Shutdown:
+			return
+		case state == connectivity.Ready:
+			ready = true
+		case ready && (state == connectivity.Idle || state == connectivity.TransientFailure):
+			cm.connLost(service, mc, state)
+
+			return
+		}
+
+		if !mc.conn.WaitForStateChange(context.Background(), state) {
+			return
+		}
+
+		if !cm.isCurrent(service, mc) {
+			return
+		}
+	}
+}
+
+// isCurrent reports whether mc still backs the connection of service
+func (cm *ConnManager) isCurrent(service string, mc *managedConn) bool {
+	cur, ok := cm.loadTopology().conns[service]
+
+	return ok && cur.conn == mc.conn
+}
+
+// connLost quarantines the instance behind a lost connection and re-selects
+func (cm *ConnManager) connLost(service string, mc *managedConn, state connectivity.State) {
+	now := time.Now()
+
+	cm.mu.Lock()
+	lost := cm.lostInstances[service]
+	if lost == nil {
+		lost = make(map[instanceRef]time.Time)
+		cm.lostInstances[service] = lost
+	}
+
+	for ref, until := range lost {
+		if now.After(until) {
+			delete(lost, ref)
+		}
+	}
+
+	lost[mc.ref()] = now.Add(cm.lossQuarantine)
+	cm.mu.Unlock()
+
+	cm.logger.Warn("connection lost, re-selecting",
+		zap.String("service", service),
+		zap.String("target", mc.target),
+		zap.String("instance", mc.instanceID),
+		zap.Stringer("state", state),
+	)
+	cm.emit(Event{Type: EventConnLost, Service: service, Target: mc.target, InstanceID: mc.instanceID, Node: mc.node})
+	cm.kick(service)
+}
+
+// withoutLost drops instances of service quarantined after a lost
+// connection, unless all of them are
+func (cm *ConnManager) withoutLost(service string, instances []Instance) []Instance {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	lost := cm.lostInstances[service]
+	if len(lost) == 0 {
+		return instances
+	}
+
+	now := time.Now()
+	out := make([]Instance, 0, len(instances))
+
+	for _, inst := range instances {
+		if until, ok := lost[inst.ref()]; !ok || now.After(until) {
+			out = append(out, inst)
+		}
+	}
+
+	if len(out) == 0 {
+		return instances
+	}
+
+	return out
+}
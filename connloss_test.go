@@ -0,0 +1,127 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+)
+
+// startHealthServer is startGRPCServer returning the server so a test can
+// kill it
+func startHealthServer(t *testing.T) (*grpc.Server, int) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	return srv, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestKeepalive_ReselectsOnConnLoss(t *testing.T) {
+	srvA, portA := startHealthServer(t)
+	srvB, portB := startHealthServer(t)
+
+	fake := newFakeConsul()
+	fake.setInstances("svc", portA, portB)
+
+	rec := &eventRecorder{}
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"},
+		WithWaitTime(time.Minute),
+		WithKeepalive(keepalive.ClientParameters{Time: 10 * time.Second}, time.Minute),
+		WithEventHandler(rec.handle),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	var first string
+	for deadline := time.Now().Add(2 * time.Second); first == ""; {
+		if time.Now().After(deadline) {
+			t.Fatal("no connection")
+		}
+
+		first = connTarget(cm, "svc")
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cctx, ccancel := context.WithTimeout(ctx, 2*time.Second)
+	defer ccancel()
+
+	if err := cm.Invoke(cctx, "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+
+	killed, other := srvA, "127.0.0.1:"+strconv.Itoa(portB)
+	if first == other {
+		killed, other = srvB, "127.0.0.1:"+strconv.Itoa(portA)
+	}
+
+	killed.Stop()
+
+	waitTarget(t, cm, "svc", other)
+
+	if !slices.Contains(rec.types(), EventConnLost) {
+		t.Errorf("events = %v, want conn_lost", rec.types())
+	}
+}
+
+func TestWithoutLost(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithKeepalive(keepalive.ClientParameters{}, time.Minute))
+	instances := instancesFromEntries(testEntries("svc", 9001, 9002))
+
+	cm.lostInstances["svc"] = map[instanceRef]time.Time{testRef("svc-9001"): time.Now().Add(time.Minute)}
+
+	if got := cm.withoutLost("svc", instances); len(got) != 1 || got[0].ID != "svc-9002" {
+		t.Errorf("eligible = %v, want svc-9002 only", got)
+	}
+
+	cm.lostInstances["svc"][testRef("svc-9002")] = time.Now().Add(time.Minute)
+
+	if got := cm.withoutLost("svc", instances); len(got) != 2 {
+		t.Errorf("eligible = %d instances, want all when all are quarantined", len(got))
+	}
+
+	cm.lostInstances["svc"] = map[instanceRef]time.Time{testRef("svc-9001"): time.Now().Add(-time.Second)}
+
+	if got := cm.withoutLost("svc", instances); len(got) != 2 {
+		t.Errorf("eligible = %d instances, want expired quarantine ignored", len(got))
+	}
+
+	if err := WithKeepalive(keepalive.ClientParameters{}, 0)(cm); err == nil {
+		t.Error("zero quarantine accepted")
+	}
+}
+
+func TestWithoutLost_SharedID(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithKeepalive(keepalive.ClientParameters{}, time.Minute))
+	instances := instancesFromEntries(sharedIDEntries("svc", 9001, 9002))
+
+	cm.lostInstances["svc"] = map[instanceRef]time.Time{instances[0].ref(): time.Now().Add(time.Minute)}
+
+	if got := cm.withoutLost("svc", instances); len(got) != 1 || got[0].Node != "node-9002" {
+		t.Errorf("eligible = %v, want the instance on node-9002 only", got)
+	}
+}
@@ -30,90 +30,206 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
-	"net"
+	"io"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/hashicorp/consul/api"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 const (
 	addrTemplate = "%s:%d" // target address format
+
+	// queryTimeoutGrace is added on top of the blocking wait (plus Consul's
+	// WaitTime/16 jitter) when deriving the default per-query timeout
+	queryTimeoutGrace = 5 * time.Second
 )
 
 // ErrConnNotFound is returned when no connection exists for a requested service
 var ErrConnNotFound = errors.New("grpc_connection_not_found")
 
-// Option configures a ConnManager.
-type Option func(*ConnManager) error
-
-// WithLogger injects a structured zap.Logger. Defaults to a no-op logger.
-func WithLogger(l *zap.Logger) Option {
-	return func(cm *ConnManager) error {
-		if l == nil {
-			return errors.New("nil logger")
-		}
-
-		cm.logger = l
-
-		return nil
-	}
-}
-
-// WithRefreshInterval sets the maximum period between Consul blocking queries
-// (lower values == faster reaction, higher == less load). Default: 30 s
-func WithRefreshInterval(d time.Duration) Option {
-	return func(cm *ConnManager) error {
-		if d <= 0 {
-			return errors.New("interval_must_be_positive")
-		}
-
-		cm.refreshInterval = d
-
-		return nil
-	}
-}
-
-// WithDialOptions appends extra grpc.DialOptions
-func WithDialOptions(opts ...grpc.DialOption) Option {
-	return func(cm *ConnManager) error {
-		cm.dialOpts = append(cm.dialOpts, opts...)
-
-		return nil
-	}
-}
-
 // ConnManager maintains gRPC client connections discovered via Consul
 type ConnManager struct {
 	client    *api.Client
 	watchList []string
 
-	// conns
-	mu    sync.RWMutex
-	conns map[string]*managedConn
-
-	logger          *zap.Logger
-	dialOpts        []grpc.DialOption
-	refreshInterval time.Duration
+	// logical -> Consul service names
+	consulNames  map[string]string
+	namePrefix   string
+	nameSuffix   string
+	nameTemplate *template.Template
+	environment  string
+
+	// conns, instances
+	mu            sync.RWMutex
+	conns         map[string]*managedConn
+	instances     map[string][]Instance // last healthy set per service
+	instanceConns map[instanceKey]*managedConn
+	standbys      map[string]*managedConn
+	changed       chan struct{}            // closed and replaced on every conns change
+	topo          atomic.Pointer[topology] // lock-free copy of conns and instances
+	watchStates   map[string]*watchState
+	connWaits     singleflight.Group // GetConnContext misses, keyed by service
+
+	logger        *zap.Logger
+	dialOpts      []grpc.DialOption
+	statsHandlers []StatsHandlerFactory
+	portMetaKey   string
+	targetScheme  string
+	targetBuilder TargetBuilder
+	proxyDial     dialFunc
+	proxyOptions  []string    // options that set proxyDial, for conflict checks
+	tproxy        atomic.Bool // dial virtual addresses, see WithTransparentProxy
+	tproxyAuto    bool        // follow the local sidecar, see runTProxyDetector
+	serverName    ServerNameStrategy
+	correlation   CorrelationExtractor
+	shedder       LoadShedder
+	shedOnGetConn bool
+
+	// per-service settings
+	serviceConfigs  map[string]string // default gRPC service config
+	callOptions     map[string][]grpc.CallOption
+	callTimeouts    map[string]time.Duration
+	minInstanceAge  map[string]time.Duration
+	minSwitch       map[string]time.Duration
+	withStandby     map[string]struct{}
+	nomadServices   map[string]NomadService
+	namedPorts      map[string]map[string]string
+	labels          map[string]map[string]string
+	registered      map[string]string     // self-registered instance ID -> service name
+	pinnedInstances map[string]string     // service -> instance ID
+	samenessGroups  map[string]string     // Enterprise failover groups
+	serviceTokens   map[string]string     // ACL tokens overriding the client's
+	tagPreferences  map[string][]string   // most preferred tag first
+	protocols       map[string]Protocol   // non-gRPC services
+	manualPins      map[string]*manualPin // operator target overrides
+	antiAffinity    [][]string            // groups of services avoiding shared nodes
+	optional        map[string]struct{}
+	selected        map[string]string // targets without a ClientConn (dry run, HTTP services)
+	lastTargets     map[string]string // target held before losing all instances
+	stickyRecovery  bool
+	maintenance     map[string][]maintenanceWindow
+	selectionSeed   string
+	maxConns        int
+	eagerConnect    bool
+	shareConns      bool
+	diffUpdates     bool
+	bulkInitialRead bool
+	sharedCache     Cache
+	preferNodeName  bool
+	dualStack       bool
+	pool            connPool
+	eagerTimeout    time.Duration
+	prewarmIdle     time.Duration
+	callQueue       chan struct{} // reconnect queue slots, see WithReconnectQueue
+	callQueueWait   time.Duration
+	dialSlots       chan struct{} // see WithDialConcurrency
+	dialLocks       sync.Map      // service -> *sync.Mutex serializing its dials
+	swapWindow      time.Duration // see WithSwapWaitForReady
+	swapTimeout     time.Duration
+	swaps           sync.Map // target -> time.Time its swap window ends
+	maxInstances    int
+	cacheSalt       string
+	scorer          Scorer
+	scoreTopN       int
+	signals         signalStore
+	probeInterval   time.Duration // see WithProbe
+	probeMethod     string
+	serviceProxies  map[string]dialFunc
+	peerCreds       map[string]*identityCreds
+	rejectedPeers   map[string]map[instanceRef]struct{} // service -> instances failing identity checks
+	duplicates      map[string]map[instanceRef]struct{} // service -> duplicate instances
+
+	// preferred regions, see WithRegionAffinity
+	regionKey string
+	regions   []string
+
+	// services without passing instances, see WithCriticalPolicy
+	criticalPolicies map[string]CriticalPolicy
+	lastResort       bool
+
+	secondary *secondaryCluster // see WithSecondaryCluster
+
+	// lost connections, see WithKeepalive
+	lostInstances  map[string]map[instanceRef]time.Time // service -> instance -> end of quarantine
+	lossQuarantine time.Duration
+
+	waitTime      time.Duration
+	retryInterval time.Duration
+	forcedRefresh time.Duration
+	queryTimeout  time.Duration
+	queryHold     atomic.Int64 // unix nanos; watchers wait until then after a 429
+	agentMaxWait  atomic.Int64 // agent max_query_time when below waitTime, see blockingWait
+	stuckAfter    time.Duration
+	maxStaleness  time.Duration
+
+	dryRun        bool
+	eventHandlers []EventHandler
+	decorators    []ConnDecorator
+	history       eventHistory // recent events, see SupportBundle
+
+	// load from health check output
+	checkInterpreter CheckInterpreter
+	maxLoad          float64
+
+	// topology KV publication / mirroring
+	publishPrefix string
+	publishQueue  chan Event
+	mirrorPrefix  string
+	mirrored      map[string]instanceRef // service -> published instance
+
+	// spread coordination
+	spreadPrefix string
+	spreadClient string
+	spreadQueue  chan Event
+	spreadCounts map[string]map[instanceRef]int // service -> instance -> other clients
+
+	background []func(context.Context) // started by Start
+	created    time.Time
+
+	// re-selection when a maintenance window ends, see holdForMaintenance
+	maintenanceKicks map[string]*time.Timer
+
+	// lifecycle, see WithAutoCloseOnCancel
+	stopDiscovery context.CancelFunc // set by Start, called by Stop
+	keepOnCancel  bool
+
+	// OpenTelemetry, see WithMeterProvider and WithPeerServiceAttribute
+	otel        bool
+	peerService *bool // nil follows otel
+
+	metrics  fanoutSink
+	closers  []io.Closer    // released by Stop
+	children []*ConnManager // see Child, stopped by Stop
 }
 
 // managedConn couples a connection with its target address for quick comparison
 type managedConn struct {
-	target string
-	conn   *grpc.ClientConn
+	target     string
+	instanceID string
+	node       string
+	conn       *grpc.ClientConn
+	lastUsed   atomic.Int64 // unix nanos, per-instance connections only
+	since      time.Time    // when it became the service connection
+	hooks      []ManagedHooks
+}
+
+func (mc *managedConn) ref() instanceRef {
+	return instanceRef{node: mc.node, id: mc.instanceID}
 }
 
 // New creates a ConnManager watching the given services. It never mutates the
-// supplied Consul client; call Start to begin discovery
+// supplied Consul client, which may be nil only when
+// WithConsulTransportConfig builds one; call Start to begin discovery
 func New(client *api.Client, services []string, opts ...Option) (*ConnManager, error) {
-	if client == nil {
-		return nil, errors.New("nil_consul_client")
-	}
-
 	if len(services) == 0 {
 		return nil, errors.New("empty_service_list")
 	}
@@ -122,21 +238,80 @@ func New(client *api.Client, services []string, opts ...Option) (*ConnManager, e
 		client:          client,
 		watchList:       append([]string(nil), services...),
 		conns:           make(map[string]*managedConn),
+		instances:       make(map[string][]Instance),
+		instanceConns:   make(map[instanceKey]*managedConn),
+		standbys:        make(map[string]*managedConn),
+		changed:         make(chan struct{}),
+		watchStates:     make(map[string]*watchState, len(services)),
+		serviceConfigs:  make(map[string]string),
+		callOptions:     make(map[string][]grpc.CallOption),
+		callTimeouts:    make(map[string]time.Duration),
+		pinnedInstances: make(map[string]string),
+		samenessGroups:  make(map[string]string),
+		serviceTokens:   make(map[string]string),
+		tagPreferences:  make(map[string][]string),
+		minInstanceAge:  make(map[string]time.Duration),
+		minSwitch:       make(map[string]time.Duration),
+		withStandby:     make(map[string]struct{}),
+		nomadServices:   make(map[string]NomadService),
+		namedPorts:      make(map[string]map[string]string),
+		protocols:       make(map[string]Protocol),
+		duplicates:      make(map[string]map[instanceRef]struct{}),
+		manualPins:      make(map[string]*manualPin),
+		optional:        make(map[string]struct{}),
+		selected:        make(map[string]string),
+		lastTargets:     make(map[string]string),
+		stickyRecovery:  true,
+		maintenance:     make(map[string][]maintenanceWindow),
+		cacheSalt:       newCacheSalt(),
+		serviceProxies:  make(map[string]dialFunc),
+		peerCreds:       make(map[string]*identityCreds),
+		rejectedPeers:   make(map[string]map[instanceRef]struct{}),
+		lostInstances:   make(map[string]map[instanceRef]time.Time),
+		registered:      make(map[string]string),
+		created:         time.Now(),
 		logger:          zap.NewNop(),
-		refreshInterval: 30 * time.Second,
+		waitTime:        defaultWaitTime,
+		retryInterval:   5 * time.Second,
 		dialOpts:        []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
 	}
 
+	for _, svc := range cm.watchList {
+		cm.watchStates[svc] = &watchState{}
+	}
+
 	for _, opt := range opts {
 		if err := opt(cm); err != nil {
 			return nil, err
 		}
 	}
 
+	if cm.client == nil {
+		return nil, errors.New("nil_consul_client")
+	}
+
+	if cm.queryTimeout != 0 && cm.queryTimeout <= cm.waitTime {
+		return nil, errors.New("query_timeout_must_exceed_wait_time")
+	}
+
+	if err := cm.validateOptions(); err != nil {
+		return nil, err
+	}
+
+	if cm.eagerConnect && cm.eagerTimeout == 0 {
+		cm.eagerTimeout = defaultEagerConnectTimeout
+	}
+
+	if err := cm.resolveNames(); err != nil {
+		return nil, err
+	}
+
 	return cm, nil
 }
 
-// Start launches background discovery until ctx is canceled
+// Start launches background discovery until ctx is canceled or Stop is
+// called. Canceling ctx also closes every connection unless
+// WithAutoCloseOnCancel(false) was given
 //
 // The implementation issues long-poll (blocking) queries to Consul's /health
 // endpoint. Each response includes X-Consul-Index; we pass that index back as
@@ -144,136 +319,333 @@ func New(client *api.Client, services []string, opts ...Option) (*ConnManager, e
 func (cm *ConnManager) Start(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 
-	// Ensure that connections close when ctx is done.
-	go func() {
-		<-ctx.Done()
-		cm.CloseAll()
-		cancel()
-	}()
+	cm.mu.Lock()
+	cm.stopDiscovery = cancel
+	cm.mu.Unlock()
+
+	if !cm.keepOnCancel {
+		// Ensure that connections close when ctx is done.
+		go func() {
+			<-ctx.Done()
+			cm.CloseAll()
+		}()
+	}
 
-	for _, svc := range cm.watchList {
-		go cm.watchService(ctx, svc)
+	for _, run := range cm.background {
+		go run(ctx)
 	}
+
+	go cm.startWatchers(ctx)
 }
 
-// Stop cancels discovery and closes all active gRPC connections
-func (cm *ConnManager) Stop() { cm.CloseAll() }
+// Stop cancels discovery, closes all active gRPC connections, stops child
+// managers and releases resources owned by options (e.g. metrics sockets)
+func (cm *ConnManager) Stop() {
+	cm.mu.Lock()
+	stop := cm.stopDiscovery
+	cm.stopDiscovery = nil
+
+	for _, t := range cm.maintenanceKicks {
+		t.Stop()
+	}
+	cm.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+
+	cm.stopChildren()
+	cm.CloseAll()
+
+	for _, c := range cm.closers {
+		if err := c.Close(); err != nil {
+			cm.logger.Warn("close resource", zap.Error(err))
+		}
+	}
+
+	cm.closers = nil
+}
 
 // CloseAll is idempotent and threadsafe
 func (cm *ConnManager) CloseAll() {
+	var hooks []ManagedHooks
+	defer func() { closed(hooks) }() // after unlocking
+
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
 	for name, mc := range cm.conns {
-		if err := mc.conn.Close(); err != nil {
+		if err := cm.releaseLocked(mc.conn); err != nil {
 			cm.logger.Warn("close conn", zap.String("service", name), zap.Error(err))
 		}
+
+		hooks = append(hooks, mc.hooks...)
+	}
+
+	for key, mc := range cm.instanceConns {
+		if err := cm.releaseLocked(mc.conn); err != nil {
+			cm.logger.Warn("close instance conn", zap.String("service", key.service), zap.String("instance", key.id), zap.Error(err))
+		}
+	}
+
+	for name, mc := range cm.standbys {
+		if err := cm.releaseLocked(mc.conn); err != nil {
+			cm.logger.Warn("close standby conn", zap.String("service", name), zap.Error(err))
+		}
+	}
+
+	for name, pin := range cm.manualPins {
+		close(pin.stop)
+		delete(cm.manualPins, name)
 	}
 
 	cm.conns = make(map[string]*managedConn)
+	cm.instanceConns = make(map[instanceKey]*managedConn)
+	cm.standbys = make(map[string]*managedConn)
+	cm.storeTopologyLocked()
+	cm.notifyLocked()
 }
 
 // GetConn returns a live *grpc.ClientConn for the requested service
-// Callers should not Close the returned connection
+// Callers should not Close the returned connection. In dry-run mode it always
+// returns ErrConnNotFound. It reads a published snapshot and neither locks
+// nor allocates when the service is connected. Otherwise the error wraps the
+// last discovery or dial failure of the service, e.g. "no healthy instances
+// since 12:01:05"
 func (cm *ConnManager) GetConn(service string) (*grpc.ClientConn, error) {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
+	if cm.shedOnGetConn {
+		if err := cm.shed(context.Background(), service, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return cm.currentConn(service)
+}
 
-	mc, ok := cm.conns[service]
+// GetConnInfo is GetConn returning the connection with its target, instance
+// and state, e.g. to log which backend served a call. When service is not
+// connected the info still counts its healthy instances
+func (cm *ConnManager) GetConnInfo(service string) (ConnInfo, error) {
+	if cm.shedOnGetConn {
+		if err := cm.shed(context.Background(), service, ""); err != nil {
+			return ConnInfo{}, err
+		}
+	}
+
+	info := cm.loadTopology().connInfo(service)
+	if !info.Connected() {
+		return info, cm.connNotFound(service)
+	}
+
+	return info, nil
+}
+
+// currentConn returns the connection of service from the published snapshot
+func (cm *ConnManager) currentConn(service string) (*grpc.ClientConn, error) {
+	mc, ok := cm.loadTopology().conns[service]
 	if !ok {
-		return nil, fmt.Errorf("%w: %s", ErrConnNotFound, service)
+		return nil, cm.connNotFound(service)
 	}
 
 	return mc.conn, nil
 }
 
-// watchService performs a Consul blocking query loop for a single service
-func (cm *ConnManager) watchService(ctx context.Context, service string) {
-	var waitIdx uint64
+// GetConnMap returns the live connections for services. Available
+// connections are always returned; if any are missing the error is a
+// *MissingServicesError listing them (and matching ErrConnNotFound via
+// errors.Is)
+func (cm *ConnManager) GetConnMap(services ...string) (map[string]*grpc.ClientConn, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	out := make(map[string]*grpc.ClientConn, len(services))
+
+	var missing []string
+
+	for _, svc := range services {
+		if mc, ok := cm.conns[svc]; ok {
+			out[svc] = mc.conn
+		} else {
+			missing = append(missing, svc)
+		}
+	}
+
+	if len(missing) > 0 {
+		return out, &MissingServicesError{Services: missing}
+	}
+
+	return out, nil
+}
+
+// GetConnAny returns a connection for the first usable service in the ordered
+// preference list, e.g. a local-region service before its global fallback.
+// A READY connection wins over an earlier non-READY one; otherwise the first
+// connection that is not failing is returned. When none is usable it waits
+// for topology changes until ctx is done, then falls back to any existing
+// connection. The chosen service name is returned with the connection
+func (cm *ConnManager) GetConnAny(ctx context.Context, services ...string) (*grpc.ClientConn, string, error) {
+	if len(services) == 0 {
+		return nil, "", errors.New("empty_service_list")
+	}
 
 	for {
+		cm.mu.RLock()
+		conn, svc, ok := cm.pickPreferredLocked(services, false)
+		changed := cm.changed
+		cm.mu.RUnlock()
+
+		if ok {
+			return conn, svc, nil
+		}
+
 		select {
 		case <-ctx.Done():
-			return
-		default:
-		}
+			cm.mu.RLock()
+			conn, svc, ok = cm.pickPreferredLocked(services, true)
+			cm.mu.RUnlock()
 
-		q := &api.QueryOptions{
-			WaitTime:   cm.refreshInterval,
-			WaitIndex:  waitIdx,
-			AllowStale: false,
-		}
+			if ok {
+				return conn, svc, nil
+			}
 
-		entries, meta, err := cm.client.Health().Service(service, "", true, q)
-		if err != nil {
-			cm.logger.Warn("consul query error", zap.String("service", service), zap.Error(err))
-			time.Sleep(backoff(cm.refreshInterval))
+			return nil, "", fmt.Errorf("%w: %w", ctx.Err(), &MissingServicesError{Services: services})
+		case <-changed:
+		}
+	}
+}
 
+// pickPreferredLocked implements the GetConnAny preference. With anyState it
+// accepts failing connections too. cm.mu must be held
+func (cm *ConnManager) pickPreferredLocked(services []string, anyState bool) (*grpc.ClientConn, string, bool) {
+	var (
+		fallback    *grpc.ClientConn
+		fallbackSvc string
+	)
+
+	for _, svc := range services {
+		mc, ok := cm.conns[svc]
+		if !ok {
 			continue
 		}
 
-		// meta.LastIndex updates only when the result set changes
-		waitIdx = meta.LastIndex
-		if len(entries) == 0 {
-			cm.logger.Warn("no healthy instances", zap.String("service", service))
-			cm.replaceConn(service, nil, "")
-
-			continue
+		switch state := mc.conn.GetState(); {
+		case state == connectivity.Ready:
+			return mc.conn, svc, true
+		case fallback == nil && (anyState || usable(state)):
+			fallback, fallbackSvc = mc.conn, svc
 		}
+	}
 
-		selected := entries[rand.Intn(len(entries))]
-		addr := selected.Service.Address
+	return fallback, fallbackSvc, fallback != nil
+}
 
-		if addr == "" {
-			addr = selected.Node.Address
-		}
+// usable reports whether a connection in state may still serve RPCs soon
+func usable(state connectivity.State) bool {
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+// MissingServicesError lists the services without a connection in a batch
+// lookup
+type MissingServicesError struct {
+	Services []string
+}
+
+func (e *MissingServicesError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrConnNotFound, strings.Join(e.Services, ", "))
+}
 
-		if _, err := net.LookupHost(addr); err != nil {
-			cm.logger.Warn("unresolvable host", zap.String("service", service), zap.String("addr", addr), zap.Error(err))
+// Unwrap makes errors.Is(err, ErrConnNotFound) hold
+func (e *MissingServicesError) Unwrap() error { return ErrConnNotFound }
 
-			continue
+// replaceConn swaps an existing connection atomically. A nil mc removes the
+// service connection
+func (cm *ConnManager) replaceConn(service string, mc *managedConn) error {
+	hooks, swapped, err := cm.swapConn(service, mc)
+	if err != nil || !swapped {
+		return err
+	}
+
+	if len(hooks) > 0 {
+		var next *grpc.ClientConn
+		if mc != nil {
+			next = mc.conn
 		}
 
-		target := fmt.Sprintf(addrTemplate, addr, selected.Service.Port)
+		replaced(hooks, next)
+	}
 
-		conn, err := grpc.NewClient(target, cm.dialOpts...)
-		if err != nil {
-			cm.logger.Warn("dial failed", zap.String("service", service), zap.String("target", target), zap.Error(err))
+	if mc != nil {
+		cm.decorate(service, mc)
 
-			continue
+		if cm.lossQuarantine > 0 {
+			go cm.monitorConn(service, mc)
 		}
 
-		cm.replaceConn(service, conn, target)
+		cm.clearFailure(service)
+		cm.markSwap(mc.target)
+		cm.emit(Event{Type: EventTargetSelected, Service: service, Target: mc.target, InstanceID: mc.instanceID, Node: mc.node})
+	} else {
+		cm.emit(Event{Type: EventConnRemoved, Service: service})
 	}
+
+	return nil
 }
 
-// replaceConn swaps an existing connection atomically
-func (cm *ConnManager) replaceConn(service string, conn *grpc.ClientConn, target string) {
+// swapConn performs the locked part of replaceConn and reports whether the
+// service connection changed, returning the hooks of the replaced one. mc is
+// closed when it does not fit the connection budget
+func (cm *ConnManager) swapConn(service string, mc *managedConn) ([]ManagedHooks, bool, error) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
+	defer cm.storeTopologyLocked()
 
-	if existing, ok := cm.conns[service]; ok && existing.target == target {
-		if conn != nil {
-			_ = conn.Close()
-		}
+	if existing, ok := cm.conns[service]; ok && mc != nil && existing.target == mc.target {
+		_ = cm.releaseLocked(mc.conn)
+
+		// Same target, possibly a different instance behind it (e.g. a VIP);
+		// store a copy so readers holding the old entry never see it change
+		cm.conns[service] = &managedConn{target: existing.target, instanceID: mc.instanceID, node: mc.node, conn: existing.conn, since: existing.since, hooks: existing.hooks}
 
-		return
+		return nil, false, nil
+	}
+
+	old, hadOld := cm.conns[service]
+	if !hadOld && mc != nil {
+		if err := cm.reserveConnLocked(); err != nil {
+			_ = cm.releaseLocked(mc.conn)
+
+			return nil, false, err
+		}
 	}
 
-	if old, ok := cm.conns[service]; ok {
-		_ = old.conn.Close()
+	if hadOld {
+		_ = cm.releaseLocked(old.conn)
 	}
 
-	if conn != nil {
-		cm.conns[service] = &managedConn{target: target, conn: conn}
+	if mc != nil {
+		mc.since = time.Now()
+		cm.conns[service] = mc
+		delete(cm.lastTargets, service)
 	} else {
 		delete(cm.conns, service)
+
+		if hadOld {
+			cm.lastTargets[service] = old.target
+		}
 	}
-}
 
-// backoff returns jittered sleep duration on failures
-func backoff(base time.Duration) time.Duration {
-	delta := base / 2
+	cm.metrics.SetGauge(MetricConnected, float64(boolToInt(mc != nil)), serviceLabel(service))
+
+	if !hadOld && mc == nil {
+		return nil, false, nil
+	}
+
+	cm.metrics.IncrCounter(MetricConnSwaps, 1, serviceLabel(service))
+	cm.notifyLocked()
+
+	if hadOld {
+		return old.hooks, true, nil
+	}
 
-	return base + time.Duration(rand.Int63n(int64(delta)))
+	return nil, true, nil
 }
@@ -0,0 +1,278 @@
+// Package connmock provides a ConnProvider double for unit tests of code
+// depending on consul_service_discovery. A Provider serves the connections
+// in its Conns map, each method can be stubbed through its ...Func field,
+// and every call is recorded for assertions:
+//
+//	p := &connmock.Provider{Conns: map[string]*grpc.ClientConn{"users": conn}}
+//	svc := NewHandler(p)
+//	...
+//	if n := p.CallCount("GetConn"); n != 1 { ... }
+//
+// It has no dependencies beyond this module, so it works with the standard
+// testing package as well as with testify or gomock based suites
+package connmock
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+var _ csd.ConnProvider = (*Provider)(nil)
+
+// Call is a recorded method call
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Provider is a csd.ConnProvider test double. A nil ...Func falls back to
+// the default described on the method. The zero value is ready to use and
+// has no connections
+type Provider struct {
+	// Conns are the connections served by default, by service
+	Conns map[string]*grpc.ClientConn
+	// InstanceSets are the healthy instances returned by default, by service
+	InstanceSets map[string][]csd.Instance
+
+	GetConnFunc        func(service string) (*grpc.ClientConn, error)
+	GetConnContextFunc func(ctx context.Context, service string) (*grpc.ClientConn, error)
+	GetConnInfoFunc    func(service string) (csd.ConnInfo, error)
+	GetConnMapFunc     func(services ...string) (map[string]*grpc.ClientConn, error)
+	GetConnAnyFunc     func(ctx context.Context, services ...string) (*grpc.ClientConn, string, error)
+	InvokeFunc         func(ctx context.Context, service, method string, args, reply any, opts ...grpc.CallOption) error
+	InstancesFunc      func(service string) ([]csd.Instance, error)
+	StatusFunc         func() []csd.ServiceStatus
+	ReadyFunc          func() bool
+	WaitReadyFunc      func(ctx context.Context) error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (p *Provider) record(method string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls = append(p.calls, Call{Method: method, Args: args})
+}
+
+// Calls returns the recorded calls in order
+func (p *Provider) Calls() []Call {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return slices.Clone(p.calls)
+}
+
+// CallCount returns how many times method was called
+func (p *Provider) CallCount(method string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+
+	for _, c := range p.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Reset forgets the recorded calls
+func (p *Provider) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls = nil
+}
+
+func (p *Provider) conn(service string) (*grpc.ClientConn, error) {
+	if conn, ok := p.Conns[service]; ok {
+		return conn, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", csd.ErrConnNotFound, service)
+}
+
+// GetConn returns Conns[service], or an error matching csd.ErrConnNotFound
+func (p *Provider) GetConn(service string) (*grpc.ClientConn, error) {
+	p.record("GetConn", service)
+
+	if p.GetConnFunc != nil {
+		return p.GetConnFunc(service)
+	}
+
+	return p.conn(service)
+}
+
+// GetConnContext returns Conns[service] without waiting, or an error
+// matching csd.ErrConnNotFound
+func (p *Provider) GetConnContext(ctx context.Context, service string) (*grpc.ClientConn, error) {
+	p.record("GetConnContext", service)
+
+	if p.GetConnContextFunc != nil {
+		return p.GetConnContextFunc(ctx, service)
+	}
+
+	return p.conn(service)
+}
+
+// GetConnInfo describes Conns[service] by its target, or returns an error
+// matching csd.ErrConnNotFound
+func (p *Provider) GetConnInfo(service string) (csd.ConnInfo, error) {
+	p.record("GetConnInfo", service)
+
+	if p.GetConnInfoFunc != nil {
+		return p.GetConnInfoFunc(service)
+	}
+
+	conn, err := p.conn(service)
+	if err != nil {
+		return csd.ConnInfo{}, err
+	}
+
+	info := csd.ConnInfo{Conn: conn, Instances: len(p.InstanceSets[service])}
+	if conn != nil {
+		info.Target = conn.Target()
+		info.State = conn.GetState()
+	}
+
+	return info, nil
+}
+
+// GetConnMap returns the Conns of services, with a *csd.MissingServicesError
+// listing the others
+func (p *Provider) GetConnMap(services ...string) (map[string]*grpc.ClientConn, error) {
+	p.record("GetConnMap", toAny(services)...)
+
+	if p.GetConnMapFunc != nil {
+		return p.GetConnMapFunc(services...)
+	}
+
+	out := make(map[string]*grpc.ClientConn, len(services))
+
+	var missing []string
+
+	for _, svc := range services {
+		if conn, ok := p.Conns[svc]; ok {
+			out[svc] = conn
+		} else {
+			missing = append(missing, svc)
+		}
+	}
+
+	if len(missing) > 0 {
+		return out, &csd.MissingServicesError{Services: missing}
+	}
+
+	return out, nil
+}
+
+// GetConnAny returns the first of services found in Conns, without waiting
+func (p *Provider) GetConnAny(ctx context.Context, services ...string) (*grpc.ClientConn, string, error) {
+	p.record("GetConnAny", toAny(services)...)
+
+	if p.GetConnAnyFunc != nil {
+		return p.GetConnAnyFunc(ctx, services...)
+	}
+
+	for _, svc := range services {
+		if conn, ok := p.Conns[svc]; ok {
+			return conn, svc, nil
+		}
+	}
+
+	return nil, "", &csd.MissingServicesError{Services: services}
+}
+
+// Invoke calls method on Conns[service], e.g. a bufconn connection to an
+// in-process server
+func (p *Provider) Invoke(ctx context.Context, service, method string, args, reply any, opts ...grpc.CallOption) error {
+	p.record("Invoke", service, method, args)
+
+	if p.InvokeFunc != nil {
+		return p.InvokeFunc(ctx, service, method, args, reply, opts...)
+	}
+
+	conn, err := p.conn(service)
+	if err != nil {
+		return err
+	}
+
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// Instances returns InstanceSets[service]
+func (p *Provider) Instances(service string) ([]csd.Instance, error) {
+	p.record("Instances", service)
+
+	if p.InstancesFunc != nil {
+		return p.InstancesFunc(service)
+	}
+
+	return slices.Clone(p.InstanceSets[service]), nil
+}
+
+// Status reports every service in Conns as connected, in name order
+func (p *Provider) Status() []csd.ServiceStatus {
+	p.record("Status")
+
+	if p.StatusFunc != nil {
+		return p.StatusFunc()
+	}
+
+	out := make([]csd.ServiceStatus, 0, len(p.Conns))
+
+	for _, svc := range slices.Sorted(maps.Keys(p.Conns)) {
+		st := csd.ServiceStatus{Service: svc, Connected: true}
+
+		if conn := p.Conns[svc]; conn != nil {
+			st.Target = conn.Target()
+			st.State = conn.GetState()
+		}
+
+		out = append(out, st)
+	}
+
+	return out
+}
+
+// Ready returns true
+func (p *Provider) Ready() bool {
+	p.record("Ready")
+
+	if p.ReadyFunc != nil {
+		return p.ReadyFunc()
+	}
+
+	return true
+}
+
+// WaitReady returns nil
+func (p *Provider) WaitReady(ctx context.Context) error {
+	p.record("WaitReady")
+
+	if p.WaitReadyFunc != nil {
+		return p.WaitReadyFunc(ctx)
+	}
+
+	return nil
+}
+
+func toAny(services []string) []any {
+	out := make([]any, len(services))
+	for i, s := range services {
+		out[i] = s
+	}
+
+	return out
+}
@@ -0,0 +1,118 @@
+package connmock_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/connmock"
+)
+
+// handler stands for application code depending on a csd.ConnProvider
+func handler(p csd.ConnProvider) (string, error) {
+	conn, err := p.GetConn("users")
+	if err != nil {
+		return "", err
+	}
+
+	return conn.Target(), nil
+}
+
+func newConn(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+
+	conn, err := grpc.NewClient("passthrough:///users:9000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestProvider_Defaults(t *testing.T) {
+	p := &connmock.Provider{Conns: map[string]*grpc.ClientConn{"users": newConn(t)}}
+
+	target, err := handler(p)
+	if err != nil || target != "passthrough:///users:9000" {
+		t.Fatalf("handler = %q, %v", target, err)
+	}
+
+	if _, err := p.GetConn("orders"); !errors.Is(err, csd.ErrConnNotFound) {
+		t.Errorf("GetConn(orders) err = %v, want ErrConnNotFound", err)
+	}
+
+	conns, err := p.GetConnMap("users", "orders")
+
+	var missing *csd.MissingServicesError
+	if !errors.As(err, &missing) || len(missing.Services) != 1 || len(conns) != 1 {
+		t.Errorf("GetConnMap = %v, %v", conns, err)
+	}
+
+	if _, svc, err := p.GetConnAny(context.Background(), "orders", "users"); err != nil || svc != "users" {
+		t.Errorf("GetConnAny = %q, %v", svc, err)
+	}
+
+	if st := p.Status(); len(st) != 1 || st[0].Service != "users" || !st[0].Connected {
+		t.Errorf("Status = %+v", st)
+	}
+
+	if !p.Ready() || p.WaitReady(context.Background()) != nil {
+		t.Error("not ready by default")
+	}
+
+	if got := p.CallCount("GetConn"); got != 2 {
+		t.Errorf("GetConn calls = %d, want 2", got)
+	}
+}
+
+func TestProvider_Stubs(t *testing.T) {
+	boom := errors.New("boom")
+
+	p := &connmock.Provider{
+		GetConnFunc: func(string) (*grpc.ClientConn, error) { return nil, boom },
+		InvokeFunc: func(_ context.Context, service, method string, _, _ any, _ ...grpc.CallOption) error {
+			if service != "users" || method != "/users.Users/Get" {
+				t.Errorf("invoke %s %s", service, method)
+			}
+
+			return nil
+		},
+	}
+
+	if _, err := handler(p); !errors.Is(err, boom) {
+		t.Errorf("handler err = %v, want the stubbed error", err)
+	}
+
+	if err := p.Invoke(context.Background(), "users", "/users.Users/Get", nil, nil); err != nil {
+		t.Errorf("invoke: %v", err)
+	}
+
+	calls := p.Calls()
+	if len(calls) != 2 || calls[1].Method != "Invoke" || calls[1].Args[1] != "/users.Users/Get" {
+		t.Errorf("calls = %+v", calls)
+	}
+
+	p.Reset()
+
+	if len(p.Calls()) != 0 {
+		t.Error("calls kept after Reset")
+	}
+}
+
+func TestProvider_GetConnInfo(t *testing.T) {
+	p := &connmock.Provider{Conns: map[string]*grpc.ClientConn{"users": newConn(t)}}
+
+	info, err := p.GetConnInfo("users")
+	if err != nil || !info.Connected() || info.Target != "passthrough:///users:9000" {
+		t.Errorf("GetConnInfo = %+v, %v", info, err)
+	}
+
+	if _, err := p.GetConnInfo("orders"); !errors.Is(err, csd.ErrConnNotFound) {
+		t.Errorf("GetConnInfo(orders) err = %v, want ErrConnNotFound", err)
+	}
+}
@@ -0,0 +1,74 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// GetConnContext is GetConn that waits for a connection to service until ctx
+// is done, e.g. right after a restart. Concurrent callers missing the same
+// service share one discovery attempt: the watcher is kicked to re-query
+// Consul and re-select once, and everyone waits on the outcome, so a burst of
+// requests does not turn into a burst of queries and dials. Dry-run and HTTP
+// services fail right away, as with GetConn
+func (cm *ConnManager) GetConnContext(ctx context.Context, service string) (*grpc.ClientConn, error) {
+	if cm.shedOnGetConn {
+		if err := cm.shed(ctx, service, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := cm.currentConn(service)
+	if err == nil || cm.dryRun || cm.isHTTP(service) {
+		return conn, err
+	}
+
+	if err := cm.checkWatched(service); err != nil {
+		return nil, err
+	}
+
+	for {
+		ch := cm.connWaits.DoChan(service, func() (any, error) {
+			return cm.discoverConn(service)
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, cm.wrapCallError(ctx, service, fmt.Errorf("%w: %s: %w", ErrConnNotFound, service, ctx.Err()))
+		case res := <-ch:
+			if res.Err == nil {
+				return res.Val.(*grpc.ClientConn), nil
+			}
+		}
+	}
+}
+
+// discoverConn kicks the watcher of service and waits up to one query
+// timeout for it to connect
+func (cm *ConnManager) discoverConn(service string) (*grpc.ClientConn, error) {
+	cm.metrics.IncrCounter(MetricConnWaits, 1, serviceLabel(service))
+	cm.kick(service)
+
+	timer := time.NewTimer(cm.effectiveQueryTimeout())
+	defer timer.Stop()
+
+	for {
+		cm.mu.RLock()
+		mc, ok := cm.conns[service]
+		changed := cm.changed
+		cm.mu.RUnlock()
+
+		if ok {
+			return mc.conn, nil
+		}
+
+		select {
+		case <-timer.C:
+			return nil, fmt.Errorf("%w: %s", ErrConnNotFound, service)
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type waitCounter struct {
+	waits atomic.Int64
+}
+
+func (c *waitCounter) IncrCounter(name string, value float64, _ ...Label) {
+	if name == MetricConnWaits {
+		c.waits.Add(int64(value))
+	}
+}
+
+func (*waitCounter) SetGauge(string, float64, ...Label)              {}
+func (*waitCounter) ObserveDuration(string, time.Duration, ...Label) {}
+
+func TestGetConnContext_CollapsesWaiters(t *testing.T) {
+	counter := &waitCounter{}
+	cm := newTestManager(t, []string{"svc"}, WithMetrics(counter))
+
+	const callers = 20
+
+	var (
+		wg    sync.WaitGroup
+		ready sync.WaitGroup
+		errs  = make(chan error, callers)
+	)
+
+	ready.Add(callers)
+
+	for range callers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			ready.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := cm.GetConnContext(ctx, "svc")
+			errs <- err
+		}()
+	}
+
+	ready.Wait()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GetConnContext: %v", err)
+		}
+	}
+
+	if n := counter.waits.Load(); n != 1 {
+		t.Errorf("%d discovery attempts for %d waiters, want 1", n, callers)
+	}
+}
+
+func TestGetConnContext_Deadline(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := cm.GetConnContext(ctx, "svc"); !errors.Is(err, ErrConnNotFound) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want ErrConnNotFound and DeadlineExceeded", err)
+	}
+
+	if _, err := cm.GetConnContext(ctx, "other"); !errors.Is(err, errUnknownService) {
+		t.Errorf("err = %v, want errUnknownService", err)
+	}
+}
@@ -0,0 +1,92 @@
+package consultest
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// response is one answer of the health endpoint
+type response struct {
+	entries []*api.ServiceEntry
+	index   uint64
+}
+
+// ResetIndex moves every index back, as after a snapshot restore, and
+// releases blocked queries. Clients must notice the index going backwards
+// and restart their watch
+func (s *Server) ResetIndex() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index = 1
+	for svc := range s.modified {
+		s.modified[svc] = 1
+	}
+
+	// responses from before the restore cannot be served late
+	clear(s.previous)
+	clear(s.stale)
+
+	s.wakeAllLocked()
+}
+
+// SetEntriesSameIndex replaces the entries of service without moving its
+// index and releases blocked queries, so two different responses carry the
+// same index
+func (s *Server) SetEntriesSameIndex(service string, entries []*api.ServiceEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.services[service] = entries
+	s.wakes[service]++
+	s.bumpChangedLocked()
+}
+
+// ServeStale makes the next query of service return the response from
+// before its last change, with that older index, as when a lagging server
+// answers after a newer one
+func (s *Server) ServeStale(service string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.previous[service]; !ok {
+		return
+	}
+
+	s.stale[service] = true
+	s.wakes[service]++
+	s.bumpChangedLocked()
+}
+
+// Restart simulates an agent restart: open connections are dropped and
+// queries fail with 500 for d
+func (s *Server) Restart(d time.Duration) {
+	s.mu.Lock()
+	s.downUntil = time.Now().Add(d)
+	s.wakeAllLocked()
+	s.mu.Unlock()
+
+	s.http.CloseClientConnections()
+}
+
+func (s *Server) restarting() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return time.Now().Before(s.downUntil)
+}
+
+func (s *Server) wakeAllLocked() {
+	for svc := range s.services {
+		s.wakes[svc]++
+	}
+
+	s.bumpChangedLocked()
+}
+
+// bumpChangedLocked wakes blocked queries to re-check their condition
+func (s *Server) bumpChangedLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
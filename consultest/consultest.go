@@ -0,0 +1,208 @@
+// Package consultest provides an in-memory Consul health endpoint with
+// blocking-query support, for testing and benchmarking code built on
+// consul_service_discovery without a Consul agent
+package consultest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Server is a fake Consul agent serving /v1/health/service/<name>. Every
+// change bumps a global index, like Consul's raft index, and a service
+// reports the index of its last change, so blocking queries only return
+// for changes of the queried service
+type Server struct {
+	mu       sync.Mutex
+	index    uint64
+	services map[string][]*api.ServiceEntry
+	modified map[string]uint64 // service -> index of its last change
+	changed  chan struct{}
+
+	// anomaly injection, see anomalies.go
+	previous  map[string]response // service -> response before the last change
+	stale     map[string]bool     // serve previous on the next query
+	wakes     map[string]uint64   // bumped to release blocked queries early
+	downUntil time.Time           // agent restarting until then
+
+	queries atomic.Int64
+	http    *httptest.Server
+}
+
+// NewServer starts a Server on a loopback port. Close it when done
+func NewServer() *Server {
+	s := &Server{
+		index:    1,
+		services: make(map[string][]*api.ServiceEntry),
+		modified: make(map[string]uint64),
+		previous: make(map[string]response),
+		stale:    make(map[string]bool),
+		wakes:    make(map[string]uint64),
+		changed:  make(chan struct{}),
+	}
+
+	s.http = httptest.NewServer(s)
+
+	return s
+}
+
+// URL returns the base URL of the server
+func (s *Server) URL() string {
+	return s.http.URL
+}
+
+// Client returns a Consul API client talking to the server
+func (s *Server) Client() (*api.Client, error) {
+	cfg := api.DefaultConfig()
+	cfg.Address = s.http.URL
+
+	return api.NewClient(cfg)
+}
+
+// Close shuts the server down, unblocking pending queries
+func (s *Server) Close() {
+	s.http.CloseClientConnections()
+	s.http.Close()
+}
+
+// Entries returns health entries for service with one instance per port on
+// 127.0.0.1. Instance IDs are "<service>-<port>", nodes "node-<port>"
+func Entries(service string, ports ...int) []*api.ServiceEntry {
+	entries := make([]*api.ServiceEntry, 0, len(ports))
+
+	for _, p := range ports {
+		entries = append(entries, &api.ServiceEntry{
+			Node: &api.Node{Node: "node-" + strconv.Itoa(p), Address: "127.0.0.1"},
+			Service: &api.AgentService{
+				ID:      service + "-" + strconv.Itoa(p),
+				Service: service,
+				Address: "127.0.0.1",
+				Port:    p,
+			},
+		})
+	}
+
+	return entries
+}
+
+// SetInstances replaces the healthy instances of service with the given
+// ports (see Entries)
+func (s *Server) SetInstances(service string, ports ...int) {
+	s.SetEntries(service, Entries(service, ports...))
+}
+
+// SetEntries replaces the health entries of service and bumps the index
+func (s *Server) SetEntries(service string, entries []*api.ServiceEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.previous[service] = response{s.services[service], s.serviceIndexLocked(service)}
+	s.services[service] = entries
+	s.bumpLocked()
+	s.modified[service] = s.index
+}
+
+// Index returns the current global index
+func (s *Server) Index() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.index
+}
+
+// Queries returns the number of health queries answered so far
+func (s *Server) Queries() int64 {
+	return s.queries.Load()
+}
+
+func (s *Server) bumpLocked() {
+	s.index++
+	s.bumpChangedLocked()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutPrefix(r.URL.Path, "/v1/health/service/")
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if s.restarting() {
+		http.Error(w, "agent restarting", http.StatusInternalServerError)
+
+		return
+	}
+
+	if !s.block(r, name) {
+		return
+	}
+
+	s.mu.Lock()
+	entries, idx := s.services[name], s.serviceIndexLocked(name)
+
+	if s.stale[name] {
+		delete(s.stale, name)
+		entries, idx = s.previous[name].entries, s.previous[name].index
+	}
+	s.mu.Unlock()
+
+	if entries == nil {
+		entries = []*api.ServiceEntry{}
+	}
+
+	s.queries.Add(1)
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(idx, 10))
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// serviceIndexLocked returns the index of the last change of service. Like
+// Consul it is never 0
+func (s *Server) serviceIndexLocked(service string) uint64 {
+	return max(s.modified[service], 1)
+}
+
+// block implements blocking-query semantics for service. It returns false
+// when the client went away
+func (s *Server) block(r *http.Request, service string) bool {
+	waitIdx, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil {
+		wait = 5 * time.Minute
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	s.mu.Lock()
+	wakes := s.wakes[service]
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		idx, changed, woken := s.serviceIndexLocked(service), s.changed, s.wakes[service] != wakes
+		s.mu.Unlock()
+
+		if waitIdx < idx || woken {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return true
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package consultest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestServer_BlockingQuery(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	client, err := srv.Client()
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	srv.SetInstances("users", 9001, 9002)
+
+	entries, meta, err := client.Health().Service("users", "", true, nil)
+	if err != nil || len(entries) != 2 || entries[0].Service.ID != "users-9001" {
+		t.Fatalf("entries = %v, err = %v", entries, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		srv.SetInstances("users", 9003)
+	}()
+
+	began := time.Now()
+
+	entries, next, err := client.Health().Service("users", "", true, &api.QueryOptions{
+		WaitIndex: meta.LastIndex,
+		WaitTime:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("blocking query: %v", err)
+	}
+
+	if time.Since(began) < 10*time.Millisecond || next.LastIndex <= meta.LastIndex {
+		t.Errorf("query did not block for the change (index %d -> %d)", meta.LastIndex, next.LastIndex)
+	}
+
+	if len(entries) != 1 || entries[0].Service.Port != 9003 {
+		t.Errorf("entries after change = %v", entries)
+	}
+
+	if srv.Queries() != 2 {
+		t.Errorf("queries = %d, want 2", srv.Queries())
+	}
+}
+
+func TestServer_IndexPerService(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	client, err := srv.Client()
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	srv.SetInstances("users", 9001)
+
+	_, meta, err := client.Health().Service("users", "", true, nil)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	// changes of other services do not wake a blocked query
+	srv.SetInstances("billing", 9101)
+
+	_, next, err := client.Health().Service("users", "", true, &api.QueryOptions{
+		WaitIndex: meta.LastIndex,
+		WaitTime:  50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("blocking query: %v", err)
+	}
+
+	if next.LastIndex != meta.LastIndex {
+		t.Errorf("index moved %d -> %d on another service's change", meta.LastIndex, next.LastIndex)
+	}
+}
@@ -0,0 +1,231 @@
+package consultest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+// Op is one kind of soak step
+type Op uint8
+
+const (
+	OpChange     Op = iota // new healthy set with an index bump
+	OpSameIndex            // new healthy set under the same index
+	OpStale                // next query answered with the previous response
+	OpResetIndex           // indices go backwards (snapshot restore)
+	OpRestart              // agent restart: connections dropped, 500s for a moment
+
+	numOps
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpChange:
+		return "change"
+	case OpSameIndex:
+		return "same-index"
+	case OpStale:
+		return "stale"
+	case OpResetIndex:
+		return "reset-index"
+	case OpRestart:
+		return "restart"
+	default:
+		return "op(" + strconv.Itoa(int(o)) + ")"
+	}
+}
+
+// Step is one action of a soak run. Ports are used by OpChange and
+// OpSameIndex, Service by every op but OpResetIndex and OpRestart
+type Step struct {
+	Op      Op
+	Service string
+	Ports   []int
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%s %s %v", s.Op, s.Service, s.Ports)
+}
+
+// restartDowntime is how long OpRestart keeps the agent failing
+const restartDowntime = 20 * time.Millisecond
+
+// RandomSteps returns n random steps over services, mostly changes
+func RandomSteps(rng *rand.Rand, services []string, n int) []Step {
+	steps := make([]Step, n)
+
+	for i := range steps {
+		op := OpChange
+		if rng.Intn(2) == 0 {
+			op = Op(rng.Intn(int(numOps)))
+		}
+
+		steps[i] = newStep(op, services[rng.Intn(len(services))], i, 1+rng.Intn(3))
+	}
+
+	return steps
+}
+
+// StepsFromBytes decodes fuzzer input into steps, one per byte: the low
+// bits pick the op, the next the service and the instance count
+func StepsFromBytes(services []string, data []byte) []Step {
+	steps := make([]Step, len(data))
+
+	for i, b := range data {
+		op := Op(b % byte(numOps))
+		b /= byte(numOps)
+		svc := services[int(b)%len(services)]
+
+		steps[i] = newStep(op, svc, i, int(b/byte(len(services)))%3)
+	}
+
+	return steps
+}
+
+// newStep builds step i; the ports are unique per step and may be none
+func newStep(op Op, service string, i, instances int) Step {
+	ports := make([]int, instances)
+	for k := range ports {
+		ports[k] = 20000 + i*3 + k
+	}
+
+	return Step{Op: op, Service: service, Ports: ports}
+}
+
+// SoakConfig configures Soak
+type SoakConfig struct {
+	Services []string
+
+	// NewManager builds the manager under test with the option combination
+	// to check. Soak starts and stops it
+	NewManager func(client *api.Client, services []string) (*csd.ConnManager, error)
+
+	Interval time.Duration // between steps, default 5ms
+	Converge time.Duration // deadline for the final state, default 30s
+}
+
+// Soak runs steps against a fresh Server watched by a manager from
+// cfg.NewManager, then publishes a final healthy set for every service and
+// fails tb unless the manager converges on it within cfg.Converge: its
+// healthy set must match and any target must belong to it
+func Soak(tb testing.TB, cfg SoakConfig, steps []Step) {
+	tb.Helper()
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Millisecond
+	}
+
+	if cfg.Converge <= 0 {
+		cfg.Converge = 30 * time.Second
+	}
+
+	srv := NewServer()
+	defer srv.Close()
+
+	for i, svc := range cfg.Services {
+		srv.SetInstances(svc, 10000+i)
+	}
+
+	client, err := srv.Client()
+	if err != nil {
+		tb.Fatalf("consul client: %v", err)
+	}
+
+	cm, err := cfg.NewManager(client, cfg.Services)
+	if err != nil {
+		tb.Fatalf("new manager: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		cm.Stop()
+	}()
+
+	cm.Start(ctx)
+
+	for _, step := range steps {
+		srv.apply(step)
+		time.Sleep(cfg.Interval)
+	}
+
+	want := make(map[string][]int, len(cfg.Services))
+
+	for i, svc := range cfg.Services {
+		want[svc] = []int{30000 + i*2, 30001 + i*2}
+		srv.SetInstances(svc, want[svc]...)
+	}
+
+	deadline := time.Now().Add(cfg.Converge)
+
+	for {
+		mismatch := converged(cm, want)
+		if mismatch == "" {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			tb.Fatalf("no convergence after %d steps: %s", len(steps), mismatch)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *Server) apply(step Step) {
+	switch step.Op {
+	case OpChange:
+		s.SetInstances(step.Service, step.Ports...)
+	case OpSameIndex:
+		s.SetEntriesSameIndex(step.Service, Entries(step.Service, step.Ports...))
+	case OpStale:
+		s.ServeStale(step.Service)
+	case OpResetIndex:
+		s.ResetIndex()
+	case OpRestart:
+		s.Restart(restartDowntime)
+	}
+}
+
+// converged describes the first service of want the manager disagrees on,
+// or returns ""
+func converged(cm *csd.ConnManager, want map[string][]int) string {
+	view := cm.View()
+
+	for _, svc := range slices.Sorted(maps.Keys(want)) {
+		var ids, targets []string
+
+		for _, p := range want[svc] {
+			ids = append(ids, svc+"-"+strconv.Itoa(p))
+			targets = append(targets, net.JoinHostPort("127.0.0.1", strconv.Itoa(p)))
+		}
+
+		var got []string
+		for _, inst := range view.Instances(svc) {
+			got = append(got, inst.ID)
+		}
+
+		slices.Sort(got)
+
+		if !slices.Equal(got, ids) {
+			return fmt.Sprintf("%s: instances %v, want %v", svc, got, ids)
+		}
+
+		if target, ok := view.Target(svc); ok && !slices.Contains(targets, target) {
+			return fmt.Sprintf("%s: target %s, want one of %v", svc, target, targets)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,71 @@
+package consultest
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+var soakServices = []string{"users", "billing"}
+
+func newSoakManager(client *api.Client, services []string) (*csd.ConnManager, error) {
+	return csd.New(client, services,
+		csd.WithWaitTime(200*time.Millisecond),
+		csd.WithRetryInterval(10*time.Millisecond),
+	)
+}
+
+func TestSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("soak run")
+	}
+
+	steps := RandomSteps(rand.New(rand.NewSource(1)), soakServices, 150)
+
+	Soak(t, SoakConfig{
+		Services:   soakServices,
+		NewManager: newSoakManager,
+		Interval:   2 * time.Millisecond,
+		Converge:   5 * time.Second,
+	}, steps)
+}
+
+func TestSoak_DiffUpdates(t *testing.T) {
+	steps := RandomSteps(rand.New(rand.NewSource(2)), soakServices, 60)
+
+	Soak(t, SoakConfig{
+		Services: soakServices,
+		NewManager: func(client *api.Client, services []string) (*csd.ConnManager, error) {
+			return csd.New(client, services,
+				csd.WithWaitTime(200*time.Millisecond),
+				csd.WithRetryInterval(10*time.Millisecond),
+				csd.WithDiffUpdates(true),
+			)
+		},
+		Interval: 2 * time.Millisecond,
+		Converge: 5 * time.Second,
+	}, steps)
+}
+
+func FuzzSoak(f *testing.F) {
+	f.Add([]byte{0, 1, 2, 3, 4})
+	f.Add([]byte{3, 2, 2, 0, 4, 1, 12, 3})
+	f.Add([]byte{10, 11, 12, 13, 14, 4, 4})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 32 {
+			data = data[:32]
+		}
+
+		Soak(t, SoakConfig{
+			Services:   soakServices,
+			NewManager: newSoakManager,
+			Interval:   time.Millisecond,
+			Converge:   5 * time.Second,
+		}, StepsFromBytes(soakServices, data))
+	})
+}
@@ -0,0 +1,181 @@
+package consul_service_discovery
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ConsulTransport describes how to reach the Consul agent. Empty fields keep
+// the api.DefaultConfig values, which come from the CONSUL_* environment
+type ConsulTransport struct {
+	// host:port, http(s)://host:port or unix:///path/to/agent.sock
+	Address    string
+	Token      string
+	TokenFile  string
+	Datacenter string
+
+	// HTTPS to the agent, turned on by any of these. CertFile and KeyFile
+	// are the client certificate for agents with verify_incoming set;
+	// ServerName is the name the agent certificate is checked against when
+	// it differs from the address host, e.g. server.dc1.consul
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// UnixSocketTransport reaches an agent listening on the unix socket at path
+// (addresses.http = "unix:///..." in the agent config)
+func UnixSocketTransport(path string) ConsulTransport {
+	return ConsulTransport{Address: "unix://" + strings.TrimPrefix(path, "unix://")}
+}
+
+// TLSTransport reaches the agent at address over HTTPS, trusting caFile and
+// presenting the client certificate in certFile and keyFile when set
+func TLSTransport(address, caFile, certFile, keyFile string) ConsulTransport {
+	return ConsulTransport{Address: address, CAFile: caFile, CertFile: certFile, KeyFile: keyFile}
+}
+
+// WithConsulTransportConfig replaces the Consul client given to New, which
+// may then be nil, with one built from t. Files and the socket are checked
+// at New, so a wrong path or certificate fails there instead of as query
+// errors later
+func WithConsulTransportConfig(t ConsulTransport) Option {
+	return func(cm *ConnManager) error {
+		client, err := t.Client()
+		if err != nil {
+			return err
+		}
+
+		cm.client = client
+
+		return nil
+	}
+}
+
+// Client validates t and builds a Consul client from it
+func (t ConsulTransport) Client() (*api.Client, error) {
+	cfg, err := t.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("consul client for %s: %w", cfg.Address, err)
+	}
+
+	return client, nil
+}
+
+// Config validates t and returns the Consul client config it describes
+func (t ConsulTransport) Config() (*api.Config, error) {
+	cfg := api.DefaultConfig()
+
+	if t.Address != "" {
+		cfg.Address = t.Address
+	}
+
+	if t.Token != "" {
+		cfg.Token = t.Token
+	}
+
+	if t.TokenFile != "" {
+		if _, err := os.Stat(t.TokenFile); err != nil {
+			return nil, fmt.Errorf("consul token file: %w", err)
+		}
+
+		cfg.TokenFile = t.TokenFile
+	}
+
+	if t.Datacenter != "" {
+		cfg.Datacenter = t.Datacenter
+	}
+
+	if socket, ok := strings.CutPrefix(cfg.Address, "unix://"); ok {
+		if t.tls() {
+			return nil, errors.New("consul_tls_over_unix_socket")
+		}
+
+		return cfg, checkSocket(socket)
+	}
+
+	if err := checkAgentAddr(cfg.Address); err != nil {
+		return nil, fmt.Errorf("invalid consul address %q: %w", cfg.Address, err)
+	}
+
+	if !t.tls() {
+		return cfg, nil
+	}
+
+	if strings.HasPrefix(cfg.Address, "http://") {
+		return nil, fmt.Errorf("consul address %q is plain http but TLS settings are given", cfg.Address)
+	}
+
+	if err := t.checkTLSFiles(); err != nil {
+		return nil, err
+	}
+
+	cfg.Scheme = "https"
+	cfg.TLSConfig = api.TLSConfig{
+		Address:            t.ServerName,
+		CAFile:             t.CAFile,
+		CertFile:           t.CertFile,
+		KeyFile:            t.KeyFile,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	return cfg, nil
+}
+
+func (t ConsulTransport) tls() bool {
+	return t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" || t.ServerName != "" || t.InsecureSkipVerify
+}
+
+// checkTLSFiles loads the CA and the client key pair the way api.NewClient
+// will, reporting which file is wrong
+func (t ConsulTransport) checkTLSFiles() error {
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return fmt.Errorf("consul CA file: %w", err)
+		}
+
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("consul CA file %s: no PEM certificate", t.CAFile)
+		}
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("consul_client_cert_and_key_must_be_set_together")
+	}
+
+	if t.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			return fmt.Errorf("consul client certificate: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// checkSocket verifies path is a unix socket
+func checkSocket(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("consul socket: %w", err)
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("consul socket %s: not a unix socket", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// writePEM writes blocks of the given type to a file in dir
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+
+	return path
+}
+
+// writeKeyPair writes cert and its ECDSA key as PEM files
+func writeKeyPair(t *testing.T, dir, prefix string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	return writePEM(t, dir, prefix+".crt", "CERTIFICATE", cert.Certificate[0]),
+		writePEM(t, dir, prefix+".key", "EC PRIVATE KEY", key)
+}
+
+func startWatching(t *testing.T, cm *ConnManager) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	cm.Start(ctx)
+}
+
+func TestConsulTransport_UnixSocket(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	// short path: unix socket paths are limited to about 100 bytes
+	dir, err := os.MkdirTemp("", "csd")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	sock := filepath.Join(dir, "agent.sock")
+
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := &http.Server{Handler: fake}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	cm, err := New(nil, []string{"svc"}, WithConsulTransportConfig(UnixSocketTransport(sock)))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	startWatching(t, cm)
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+}
+
+func TestConsulTransport_MutualTLS(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	serverCert, _ := newTestCert(t, []string{"server.dc1.consul"})
+	clientCert, _ := newTestCert(t, []string{"client"})
+
+	var withClientCert atomic.Bool
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		withClientCert.Store(len(r.TLS.PeerCertificates) > 0)
+		fake.ServeHTTP(w, r)
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.crt", "CERTIFICATE", serverCert.Certificate[0])
+	certFile, keyFile := writeKeyPair(t, dir, "client", clientCert)
+
+	tr := TLSTransport(srv.Listener.Addr().String(), caFile, certFile, keyFile)
+	tr.ServerName = "server.dc1.consul"
+
+	cm, err := New(nil, []string{"svc"}, WithConsulTransportConfig(tr))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	startWatching(t, cm)
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if !withClientCert.Load() {
+		t.Error("no client certificate presented")
+	}
+}
+
+func TestConsulTransport_Validation(t *testing.T) {
+	dir := t.TempDir()
+
+	cert, _ := newTestCert(t, []string{"consul"})
+	certFile, keyFile := writeKeyPair(t, dir, "client", cert)
+	notPEM := filepath.Join(dir, "ca.txt")
+
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		tr   ConsulTransport
+		want string
+	}{
+		{"missing socket", UnixSocketTransport(filepath.Join(dir, "none.sock")), "consul socket"},
+		{"socket is a file", UnixSocketTransport(certFile), "not a unix socket"},
+		{"tls over socket", ConsulTransport{Address: "unix://" + certFile, CAFile: certFile}, "consul_tls_over_unix_socket"},
+		{"bad address", ConsulTransport{Address: "consul"}, "invalid consul address"},
+		{"tls with http", TLSTransport("http://127.0.0.1:8501", certFile, "", ""), "plain http"},
+		{"missing CA", TLSTransport("127.0.0.1:8501", filepath.Join(dir, "none.crt"), "", ""), "consul CA file"},
+		{"CA not PEM", TLSTransport("127.0.0.1:8501", notPEM, "", ""), "no PEM certificate"},
+		{"cert without key", TLSTransport("127.0.0.1:8501", "", certFile, ""), "must_be_set_together"},
+		{"key mismatch", TLSTransport("127.0.0.1:8501", "", certFile, certFile), "consul client certificate"},
+		{"missing token file", ConsulTransport{Address: "127.0.0.1:8500", TokenFile: filepath.Join(dir, "token")}, "consul token file"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := New(nil, []string{"svc"}, WithConsulTransportConfig(c.tr))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want one containing %q", err, c.want)
+			}
+		})
+	}
+
+	cfg, err := TLSTransport("127.0.0.1:8501", certFile, certFile, keyFile).Config()
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+
+	if cfg.Scheme != "https" || cfg.TLSConfig.CertFile != certFile {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+func TestNew_NilClientWithoutTransport(t *testing.T) {
+	if _, err := New(nil, []string{"svc"}); err == nil || err.Error() != "nil_consul_client" {
+		t.Errorf("err = %v, want nil_consul_client", err)
+	}
+}
@@ -0,0 +1,113 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// CorrelationExtractor returns the correlation (request) ID carried by ctx,
+// or "" when there is none
+type CorrelationExtractor func(ctx context.Context) string
+
+// CallError wraps a failure of Invoke or GetConnContext made with a
+// correlation ID, recording the topology the manager held for the service at
+// that moment. errors.Is and status.Code see through it
+type CallError struct {
+	CorrelationID string
+	Service       string
+	Target        string // current target, empty when not connected
+	InstanceID    string
+	Instances     int // healthy instances known
+	Err           error
+}
+
+func (e *CallError) Error() string {
+	target := e.Target
+	if target == "" {
+		target = "none"
+	}
+
+	return fmt.Sprintf("%s [correlation id %s, target %s, %d instances]", e.Err, e.CorrelationID, target, e.Instances)
+}
+
+func (e *CallError) Unwrap() error { return e.Err }
+
+// WithCorrelationID makes Invoke, GetConnContext and RPCs on managed
+// connections read a correlation ID from the call context with extract and
+// attach it, with the service's topology at that moment, to their logs and
+// errors (see CallError)
+func WithCorrelationID(extract CorrelationExtractor) Option {
+	return func(cm *ConnManager) error {
+		if extract == nil {
+			return errors.New("nil_correlation_extractor")
+		}
+
+		cm.correlation = extract
+
+		return nil
+	}
+}
+
+// correlationID returns the correlation ID of ctx, if any
+func (cm *ConnManager) correlationID(ctx context.Context) string {
+	if cm.correlation == nil {
+		return ""
+	}
+
+	return cm.correlation(ctx)
+}
+
+// wrapCallError wraps err of a call on service in a *CallError and logs it
+// when ctx carries a correlation ID; otherwise err is returned as is
+func (cm *ConnManager) wrapCallError(ctx context.Context, service string, err error) error {
+	id := cm.correlationID(ctx)
+	if err == nil || id == "" {
+		return err
+	}
+
+	topo := cm.loadTopology()
+	ce := &CallError{CorrelationID: id, Service: service, Instances: len(topo.instances[service]), Err: err}
+
+	if mc, ok := topo.conns[service]; ok {
+		ce.Target = mc.target
+		ce.InstanceID = mc.instanceID
+	}
+
+	cm.logger.Debug("call failed",
+		zap.String("correlation_id", id),
+		zap.String("service", service),
+		zap.String("target", ce.Target),
+		zap.String("instance", ce.InstanceID),
+		zap.Int("instances", ce.Instances),
+		zap.Error(err),
+	)
+
+	return ce
+}
+
+// correlationInterceptor logs failed unary RPCs with their correlation ID
+// and the target and state of the connection they ran on
+func (cm *ConnManager) correlationInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || cc == nil {
+			return err
+		}
+
+		if id := cm.correlationID(ctx); id != "" {
+			cm.logger.Debug("rpc failed",
+				zap.String("correlation_id", id),
+				zap.String("method", method),
+				zap.String("target", cc.Target()),
+				zap.Stringer("state", cc.GetState()),
+				zap.Error(err),
+			)
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,81 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type requestIDKey struct{}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+func TestCorrelationID_NoConn(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithCorrelationID(requestID))
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+
+	err := cm.Invoke(ctx, "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	if !errors.Is(err, ErrConnNotFound) {
+		t.Fatalf("err = %v, want ErrConnNotFound", err)
+	}
+
+	var ce *CallError
+	if !errors.As(err, &ce) {
+		t.Fatalf("err = %v, want *CallError", err)
+	}
+
+	if ce.CorrelationID != "req-1" || ce.Service != "svc" || ce.Target != "" {
+		t.Errorf("call error = %+v", ce)
+	}
+
+	err = cm.Invoke(context.Background(), "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	if errors.As(err, &ce) {
+		t.Errorf("call without a correlation id wrapped: %v", err)
+	}
+}
+
+func TestCorrelationID_RPCFailure(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	cm := newTestManager(t, []string{"svc"}, WithCorrelationID(requestID), WithLogger(zap.New(core)))
+	port := startGRPCServer(t)
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", port)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-2")
+
+	err := cm.Invoke(ctx, "svc", "/grpc.health.v1.Health/Missing", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("code = %s, want Unimplemented", status.Code(err))
+	}
+
+	var ce *CallError
+	if !errors.As(err, &ce) || ce.Target == "" || ce.Instances != 1 {
+		t.Fatalf("err = %v, want *CallError with the current target", err)
+	}
+
+	for _, msg := range []string{"rpc failed", "call failed"} {
+		entries := logs.FilterMessage(msg).All()
+		if len(entries) != 1 || entries[0].ContextMap()["correlation_id"] != "req-2" {
+			t.Errorf("%q logs = %v, want one with the correlation id", msg, entries)
+		}
+	}
+}
+
+func TestCorrelationID_Validation(t *testing.T) {
+	if err := WithCorrelationID(nil)(&ConnManager{}); err == nil {
+		t.Error("nil extractor accepted")
+	}
+}
@@ -0,0 +1,173 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// lastResortQueryTimeout bounds the query for failing instances
+const lastResortQueryTimeout = 5 * time.Second
+
+// CriticalPolicy decides what a service does when Consul reports none of its
+// instances passing, e.g. all critical during a partial outage
+type CriticalPolicy int
+
+const (
+	// CriticalFail drops the connection, so GetConn fails fast (default)
+	CriticalFail CriticalPolicy = iota
+	// CriticalKeepLast keeps the connection to the last selected instance
+	CriticalKeepLast
+	// CriticalLastResort dials an instance with failing checks, except ones
+	// in maintenance mode, keeping the current one while it is still
+	// registered
+	CriticalLastResort
+)
+
+func (p CriticalPolicy) String() string {
+	switch p {
+	case CriticalFail:
+		return "fail"
+	case CriticalKeepLast:
+		return "keep last"
+	case CriticalLastResort:
+		return "last resort"
+	default:
+		return fmt.Sprintf("CriticalPolicy(%d)", int(p))
+	}
+}
+
+// WithCriticalPolicy sets how service degrades when no instance is passing.
+// It overrides WithLastResort for the service
+func WithCriticalPolicy(service string, p CriticalPolicy) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if p < CriticalFail || p > CriticalLastResort {
+			return errors.New("invalid_critical_policy")
+		}
+
+		if cm.criticalPolicies == nil {
+			cm.criticalPolicies = make(map[string]CriticalPolicy)
+		}
+
+		cm.criticalPolicies[service] = p
+
+		return nil
+	}
+}
+
+// WithLastResort applies CriticalLastResort to every service without a
+// policy of its own: rather than failing, connect to an instance whose
+// checks fail and hope it still serves some requests
+func WithLastResort(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.lastResort = enabled
+
+		return nil
+	}
+}
+
+// criticalPolicy returns the effective policy of service
+func (cm *ConnManager) criticalPolicy(service string) CriticalPolicy {
+	if p, ok := cm.criticalPolicies[service]; ok {
+		return p
+	}
+
+	if cm.lastResort {
+		return CriticalLastResort
+	}
+
+	return CriticalFail
+}
+
+// allCritical applies the policy of service to an empty healthy set. It
+// reports false when the connection should be dropped as usual
+func (cm *ConnManager) allCritical(ctx context.Context, service string) (bool, error) {
+	switch cm.criticalPolicy(service) {
+	case CriticalKeepLast:
+		if target, ok := cm.currentTarget(service); ok {
+			cm.logger.Warn("no passing instances, keeping the last target", zap.String("service", service), zap.String("target", target))
+
+			return true, nil
+		}
+	case CriticalLastResort:
+		return cm.dialLastResort(ctx, service)
+	}
+
+	return false, nil
+}
+
+// currentTarget returns the target service is connected to, or selected in
+// dry-run mode and for HTTP services
+func (cm *ConnManager) currentTarget(service string) (string, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if mc, ok := cm.conns[service]; ok {
+		return mc.target, true
+	}
+
+	target, ok := cm.selected[service]
+
+	return target, ok
+}
+
+// dialLastResort selects among the registered instances of service whatever
+// their health, except those put in maintenance mode, keeping the current
+// connection if its instance is one
+func (cm *ConnManager) dialLastResort(ctx context.Context, service string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, lastResortQueryTimeout)
+	defer cancel()
+
+	q := &api.QueryOptions{SamenessGroup: cm.samenessGroups[service], Token: cm.serviceTokens[service]}
+
+	entries, _, err := cm.client.Health().Service(cm.consulName(service), "", false, q.WithContext(ctx))
+	if err != nil {
+		cm.logger.Warn("query failing instances for last resort", zap.String("service", service), zap.Error(err))
+
+		return false, nil
+	}
+
+	entries = slices.DeleteFunc(entries, inMaintenanceMode)
+	failing := instancesFromEntries(entries)
+	cm.applyNomad(service, entries, failing)
+
+	if mc, ok := cm.loadTopology().conns[service]; ok {
+		if _, found := findInstance(failing, mc.ref()); found {
+			return true, nil
+		}
+	}
+
+	selected, ok := cm.selectInstance(service, failing)
+	if !ok {
+		return false, nil
+	}
+
+	cm.logger.Warn("no passing instances, connecting to a failing one as last resort",
+		zap.String("service", service),
+		zap.String("instance", selected.ID),
+	)
+
+	return true, cm.switchTo(service, selected)
+}
+
+// inMaintenanceMode reports whether an operator drained the instance of e or
+// its node with maintenance mode
+func inMaintenanceMode(e *api.ServiceEntry) bool {
+	for _, c := range e.Checks {
+		if c.CheckID == api.NodeMaint || strings.HasPrefix(c.CheckID, api.ServiceMaintPrefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,156 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// criticalEntries returns entries of service failing their checks
+func criticalEntries(service string, ports ...int) []*api.ServiceEntry {
+	entries := testEntries(service, ports...)
+	for _, e := range entries {
+		e.Checks = api.HealthChecks{{Status: api.HealthCritical}}
+	}
+
+	return entries
+}
+
+func TestAllCritical_Policies(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		want string // target once no instance is passing
+	}{
+		{"fail by default", nil, ""},
+		{"keep last", []Option{WithCriticalPolicy("svc", CriticalKeepLast)}, "127.0.0.1:9001"},
+		{"last resort", []Option{WithLastResort(true)}, "127.0.0.1:9002"},
+		{"service policy overrides last resort", []Option{WithLastResort(true), WithCriticalPolicy("svc", CriticalFail)}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeConsul()
+			fake.setEntries("svc", criticalEntries("svc", 9002))
+
+			cm, err := New(newTestClient(t, fake), []string{"svc"}, c.opts...)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			t.Cleanup(cm.Stop)
+
+			if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+				t.Fatalf("refresh without passing instances: %v", err)
+			}
+
+			if got := connTarget(cm, "svc"); got != c.want {
+				t.Errorf("target = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLastResort_KeepsFailingConnection(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setEntries("svc", criticalEntries("svc", 9002, 9003))
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithLastResort(true))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	first, err := cm.GetConn("svc")
+	if err != nil {
+		t.Fatalf("no last-resort connection: %v", err)
+	}
+
+	for range 5 {
+		if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if conn, _ := cm.GetConn("svc"); conn != first {
+			t.Fatal("last-resort connection replaced while its instance is still registered")
+		}
+	}
+
+	// nothing registered at all: the connection goes
+	fake.setEntries("svc", nil)
+
+	if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("svc"); err == nil {
+		t.Error("connection kept without any registered instance")
+	}
+}
+
+func TestLastResort_SkipsMaintenance(t *testing.T) {
+	entries := criticalEntries("svc", 9001, 9002, 9003)
+	entries[0].Checks = append(entries[0].Checks, &api.HealthCheck{CheckID: api.NodeMaint, Status: api.HealthCritical})
+	entries[1].Checks = append(entries[1].Checks, &api.HealthCheck{CheckID: api.ServiceMaintPrefix + "svc-9002", Status: api.HealthCritical})
+
+	fake := newFakeConsul()
+	fake.setEntries("svc", entries)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithLastResort(true))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	for range 10 {
+		if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if got := connTarget(cm, "svc"); got != "127.0.0.1:9003" {
+			t.Fatalf("target = %q, want the instance not in maintenance", got)
+		}
+	}
+}
+
+func TestLastResort_StopsWithWatcher(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setEntries("svc", criticalEntries("svc", 9002))
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithLastResort(true))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if err := cm.refresh(ctx, "svc", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if got := connTarget(cm, "svc"); got != "" {
+		t.Errorf("target = %q, want no last-resort query once the watcher stopped", got)
+	}
+}
+
+func TestWithCriticalPolicy_Validation(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := WithCriticalPolicy("svc", CriticalPolicy(9))(cm); err == nil {
+		t.Error("invalid policy accepted")
+	}
+
+	if err := WithCriticalPolicy("other", CriticalKeepLast)(cm); err == nil {
+		t.Error("unwatched service accepted")
+	}
+}
@@ -0,0 +1,295 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/flew1x/consul-service-discovery/retrypolicy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// errUnknownService is returned by per-service options naming a service that
+// is not in the watch list
+var errUnknownService = errors.New("unknown_service")
+
+// StatsHandlerFactory builds a gRPC stats.Handler for the connection to a
+// given service. Returning nil attaches nothing for that service
+type StatsHandlerFactory func(service string) stats.Handler
+
+// WithStatsHandler attaches a per-service stats.Handler to every connection
+// the manager creates, so instrumentation can be scoped by service without
+// global dial options. It may be given several times
+func WithStatsHandler(factory StatsHandlerFactory) Option {
+	return func(cm *ConnManager) error {
+		if factory == nil {
+			return errors.New("nil_stats_handler_factory")
+		}
+
+		cm.statsHandlers = append(cm.statsHandlers, factory)
+
+		return nil
+	}
+}
+
+// WithServiceConfig sets the default gRPC service config (JSON) for
+// connections to service, e.g. retry and timeout policies
+func WithServiceConfig(service, config string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if config == "" {
+			return errors.New("empty_service_config")
+		}
+
+		cm.serviceConfigs[service] = config
+
+		return nil
+	}
+}
+
+// WithRetryPolicy renders b (see package retrypolicy) and applies it as the
+// default service config for connections to service
+func WithRetryPolicy(service string, b *retrypolicy.Builder) Option {
+	return func(cm *ConnManager) error {
+		if b == nil {
+			return errors.New("nil_retry_policy")
+		}
+
+		config, err := b.JSON()
+		if err != nil {
+			return fmt.Errorf("retry policy for %s: %w", service, err)
+		}
+
+		return WithServiceConfig(service, config)(cm)
+	}
+}
+
+// checkWatched reports an error when service is not watched by cm
+func (cm *ConnManager) checkWatched(service string) error {
+	if !slices.Contains(cm.watchList, service) {
+		return fmt.Errorf("%w: %s", errUnknownService, service)
+	}
+
+	return nil
+}
+
+// dialInstance creates a (lazily connecting) client for inst
+func (cm *ConnManager) dialInstance(service string, inst Instance) (*managedConn, error) {
+	inst = cm.withDialHost(service, inst)
+
+	if cm.resolvesHost(service) {
+		if _, err := net.LookupHost(inst.Address); err != nil {
+			return nil, fmt.Errorf("unresolvable host %s: %w", inst.Address, err)
+		}
+	}
+
+	target, err := cm.targetFor(inst)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cm.poolKey(service, target, inst)
+	if conn, ok := cm.acquireShared(key); ok {
+		return &managedConn{target: target, instanceID: inst.ID, node: inst.Node, conn: conn}, nil
+	}
+
+	var conn *grpc.ClientConn
+
+	release := cm.acquireDial(service)
+
+	dialLabeled(service, target, func() {
+		if conn, err = grpc.NewClient(target, cm.instanceDialOptions(service, inst)...); err != nil {
+			return
+		}
+
+		if err = cm.connectEager(conn); err != nil {
+			_ = conn.Close()
+		}
+	})
+	release()
+
+	if err != nil {
+		cm.metrics.IncrCounter(MetricDialErrors, 1, serviceLabel(service))
+
+		return nil, fmt.Errorf("dial %s: %w", target, err)
+	}
+
+	return &managedConn{target: target, instanceID: inst.ID, node: inst.Node, conn: cm.shareConn(key, conn)}, nil
+}
+
+// WithPortFromMeta dials the port stored under key in the service Meta instead
+// of the registered service port, for services that register one entry with
+// several protocol ports. Instances without the key use the service port
+func WithPortFromMeta(key string) Option {
+	return func(cm *ConnManager) error {
+		if key == "" {
+			return errors.New("empty_meta_key")
+		}
+
+		cm.portMetaKey = key
+
+		return nil
+	}
+}
+
+// TargetBuilder turns a selected instance into a gRPC dial target. The
+// instance Port is already resolved (see WithPortFromMeta)
+type TargetBuilder func(inst Instance) string
+
+// WithTargetScheme prefixes dial targets with a resolver scheme, producing
+// e.g. "dns:///10.0.0.5:9000" or "passthrough:///10.0.0.5:9000" instead of the
+// bare host:port default
+func WithTargetScheme(scheme string) Option {
+	return func(cm *ConnManager) error {
+		if scheme == "" || strings.ContainsAny(scheme, ":/") {
+			return errors.New("invalid_target_scheme")
+		}
+
+		cm.targetScheme = scheme
+
+		return nil
+	}
+}
+
+// WithTargetBuilder replaces target construction entirely, e.g. to route via
+// a proxy or a custom resolver scheme. Hosts are not pre-resolved when a
+// builder is set
+func WithTargetBuilder(b TargetBuilder) Option {
+	return func(cm *ConnManager) error {
+		if b == nil {
+			return errors.New("nil_target_builder")
+		}
+
+		cm.targetBuilder = b
+
+		return nil
+	}
+}
+
+// targetFor builds the dial target for inst
+func (cm *ConnManager) targetFor(inst Instance) (string, error) {
+	port, err := cm.portFor(inst)
+	if err != nil {
+		return "", err
+	}
+
+	inst.Port = port
+
+	if cm.targetBuilder != nil {
+		target := cm.targetBuilder(inst)
+		if target == "" {
+			return "", fmt.Errorf("instance %s: target builder returned empty target", inst.ID)
+		}
+
+		return target, nil
+	}
+
+	target := fmt.Sprintf(addrTemplate, inst.Address, port)
+	if cm.tproxy.Load() && inst.VirtualAddress != "" {
+		target = inst.VirtualAddress
+	}
+
+	if cm.targetScheme != "" {
+		target = cm.targetScheme + ":///" + target
+	}
+
+	return target, nil
+}
+
+// resolvesHost reports whether instance hosts are resolved before dialing.
+// Custom builders and resolver schemes may use names that only their resolver
+// understands, and names behind a proxy may only resolve on its side (see
+// WithProxy)
+func (cm *ConnManager) resolvesHost(service string) bool {
+	if cm.targetBuilder != nil || cm.dialerFor(service) != nil {
+		return false
+	}
+
+	switch cm.targetScheme {
+	case "", "dns", "passthrough":
+		return true
+	default:
+		return false
+	}
+}
+
+// portFor returns the port to dial on inst, honoring WithPortFromMeta
+func (cm *ConnManager) portFor(inst Instance) (int, error) {
+	if cm.portMetaKey == "" {
+		return inst.Port, nil
+	}
+
+	raw, ok := inst.Meta[cm.portMetaKey]
+	if !ok {
+		return inst.Port, nil
+	}
+
+	port, err := strconv.Atoi(raw)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("instance %s: invalid port %q in meta %s", inst.ID, raw, cm.portMetaKey)
+	}
+
+	return port, nil
+}
+
+// dialOptionsFor returns the dial options for a connection to service: the
+// global options followed by per-service additions
+func (cm *ConnManager) dialOptionsFor(service string) []grpc.DialOption {
+	opts := make([]grpc.DialOption, 0, len(cm.dialOpts)+len(cm.statsHandlers))
+	opts = append(opts, cm.dialOpts...)
+
+	for _, factory := range cm.statsHandlers {
+		if h := factory(service); h != nil {
+			opts = append(opts, grpc.WithStatsHandler(h))
+		}
+	}
+
+	if config, ok := cm.serviceConfigs[service]; ok {
+		opts = append(opts, grpc.WithDefaultServiceConfig(config))
+	}
+
+	if callOpts := cm.callOptions[service]; len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+
+	if d, ok := cm.callTimeouts[service]; ok {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(defaultTimeoutInterceptor(d)))
+	}
+
+	if cm.correlation != nil {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(cm.correlationInterceptor()))
+	}
+
+	if cm.shedder != nil {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(cm.shedUnaryInterceptor(service)),
+			grpc.WithChainStreamInterceptor(cm.shedStreamInterceptor(service)))
+	}
+
+	if cm.swapWindow > 0 {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(cm.swapUnaryInterceptor()),
+			grpc.WithChainStreamInterceptor(cm.swapStreamInterceptor()))
+	}
+
+	if dial := cm.dialerFor(service); dial != nil {
+		opts = append(opts, grpc.WithContextDialer(dial))
+	}
+
+	if creds, ok := cm.peerCreds[service]; ok {
+		opts = append(opts, grpc.WithTransportCredentials(creds))
+	}
+
+	if cm.tagsPeerService() {
+		opts = cm.peerServiceOptions(service, opts)
+	}
+
+	return opts
+}
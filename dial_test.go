@@ -0,0 +1,117 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/stats"
+)
+
+type nopStatsHandler struct{}
+
+func (nopStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (nopStatsHandler) HandleRPC(context.Context, stats.RPCStats)                         {}
+func (nopStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (nopStatsHandler) HandleConn(context.Context, stats.ConnStats)                       {}
+
+func TestDialOptionsFor_StatsHandlerPerService(t *testing.T) {
+	var seen []string
+
+	cm := &ConnManager{}
+	err := WithStatsHandler(func(service string) stats.Handler {
+		seen = append(seen, service)
+		if service == "billing" {
+			return nil
+		}
+
+		return nopStatsHandler{}
+	})(cm)
+	if err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	if n := len(cm.dialOptionsFor("users")); n != 1 {
+		t.Errorf("users: got %d dial options, want 1", n)
+	}
+
+	if n := len(cm.dialOptionsFor("billing")); n != 0 {
+		t.Errorf("billing: got %d dial options, want 0", n)
+	}
+
+	if len(seen) != 2 || seen[0] != "users" || seen[1] != "billing" {
+		t.Errorf("factory called with %v", seen)
+	}
+}
+
+func TestWithServiceConfig_UnknownService(t *testing.T) {
+	cm := &ConnManager{watchList: []string{"users"}, serviceConfigs: map[string]string{}}
+
+	if err := WithServiceConfig("billing", `{}`)(cm); !errors.Is(err, errUnknownService) {
+		t.Errorf("err = %v, want errUnknownService", err)
+	}
+
+	if err := WithServiceConfig("users", `{"loadBalancingConfig":[{"round_robin":{}}]}`)(cm); err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	if n := len(cm.dialOptionsFor("users")); n != 1 {
+		t.Errorf("got %d dial options, want 1", n)
+	}
+}
+
+func TestTargetFor_PortFromMeta(t *testing.T) {
+	cm := &ConnManager{}
+	if err := WithPortFromMeta("grpc_port")(cm); err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	cases := []struct {
+		meta    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{map[string]string{"grpc_port": "9090"}, "10.0.0.1:9090", false},
+		{nil, "10.0.0.1:8080", false},
+		{map[string]string{"grpc_port": "http"}, "", true},
+	}
+
+	for _, c := range cases {
+		got, err := cm.targetFor(Instance{ID: "i", Address: "10.0.0.1", Port: 8080, Meta: c.meta})
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("meta %v: got %q, %v; want %q (err=%v)", c.meta, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestTargetFor_SchemeAndBuilder(t *testing.T) {
+	inst := Instance{ID: "i", Node: "n1", Address: "10.0.0.1", Port: 8080}
+
+	cm := &ConnManager{}
+	if err := WithTargetScheme("dns")(cm); err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	if got, _ := cm.targetFor(inst); got != "dns:///10.0.0.1:8080" {
+		t.Errorf("scheme target = %q", got)
+	}
+
+	if err := WithTargetBuilder(func(i Instance) string {
+		return "consul:///" + i.Node + ":" + strconv.Itoa(i.Port)
+	})(cm); err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	if got, _ := cm.targetFor(inst); got != "consul:///n1:8080" {
+		t.Errorf("builder target = %q", got)
+	}
+
+	if cm.resolvesHost("svc") {
+		t.Error("hosts should not be pre-resolved with a custom builder")
+	}
+
+	if err := WithTargetScheme("dns:///")(&ConnManager{}); err == nil {
+		t.Error("expected error for scheme with separators")
+	}
+}
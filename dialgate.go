@@ -0,0 +1,41 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"sync"
+)
+
+// WithDialConcurrency bounds the dials (grpc.NewClient plus the eager
+// connect wait) running at once across services to n and serializes dials
+// of the same service, so a mass topology change does not spike CPU and TLS
+// handshakes all at once. Dials beyond the limit wait for a slot
+func WithDialConcurrency(n int) Option {
+	return func(cm *ConnManager) error {
+		if n <= 0 {
+			return errors.New("dial_concurrency_must_be_positive")
+		}
+
+		cm.dialSlots = make(chan struct{}, n)
+
+		return nil
+	}
+}
+
+// acquireDial waits for the dial turn of service and a global slot. The
+// returned func releases both
+func (cm *ConnManager) acquireDial(service string) func() {
+	if cm.dialSlots == nil {
+		return func() {}
+	}
+
+	v, _ := cm.dialLocks.LoadOrStore(service, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+
+	mu.Lock()
+	cm.dialSlots <- struct{}{}
+
+	return func() {
+		<-cm.dialSlots
+		mu.Unlock()
+	}
+}
@@ -0,0 +1,64 @@
+package consul_service_discovery
+
+import (
+	"testing"
+	"time"
+)
+
+// acquiresWithin reports whether acquireDial(service) gets through within d.
+// The slot is released right away when it does
+func acquiresWithin(cm *ConnManager, service string, d time.Duration) bool {
+	done := make(chan func(), 1)
+
+	go func() { done <- cm.acquireDial(service) }()
+
+	select {
+	case release := <-done:
+		release()
+
+		return true
+	case <-time.After(d):
+		go func() { (<-done)() }()
+
+		return false
+	}
+}
+
+func TestDialConcurrency(t *testing.T) {
+	cm := newTestManager(t, []string{"a", "b", "c"}, WithDialConcurrency(2))
+
+	releaseA := cm.acquireDial("a")
+
+	if acquiresWithin(cm, "a", 30*time.Millisecond) {
+		t.Error("second dial of a ran concurrently with the first")
+	}
+
+	releaseB := cm.acquireDial("b")
+
+	if acquiresWithin(cm, "c", 30*time.Millisecond) {
+		t.Error("third dial ran with a limit of 2")
+	}
+
+	releaseA()
+
+	if !acquiresWithin(cm, "c", time.Second) {
+		t.Error("dial of c still blocked after a slot was freed")
+	}
+
+	releaseB()
+
+	if err := WithDialConcurrency(0)(cm); err == nil {
+		t.Error("expected error for zero concurrency")
+	}
+}
+
+func TestDialConcurrency_Unlimited(t *testing.T) {
+	cm := newTestManager(t, []string{"a"})
+
+	release := cm.acquireDial("a")
+	defer release()
+
+	if !acquiresWithin(cm, "a", time.Second) {
+		t.Error("dials serialized without WithDialConcurrency")
+	}
+}
@@ -0,0 +1,147 @@
+package consul_service_discovery
+
+import (
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+)
+
+// InstanceDiff is the difference between two healthy sets of a service
+type InstanceDiff struct {
+	Added   []Instance
+	Removed []Instance
+	Changed []Instance // new versions of instances whose address, tags or metadata changed
+}
+
+// Empty reports whether the sets were identical
+func (d InstanceDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// affects reports whether the instance identified by ref was removed or
+// changed
+func (d InstanceDiff) affects(ref instanceRef) bool {
+	for _, set := range [][]Instance{d.Removed, d.Changed} {
+		if _, ok := findInstance(set, ref); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DiffInstances compares the previous and current healthy sets by node and
+// instance ID
+func DiffInstances(prev, next []Instance) InstanceDiff {
+	var d InstanceDiff
+
+	old := make(map[instanceRef]Instance, len(prev))
+	for _, inst := range prev {
+		old[inst.ref()] = inst
+	}
+
+	for _, inst := range next {
+		before, ok := old[inst.ref()]
+
+		switch {
+		case !ok:
+			d.Added = append(d.Added, inst)
+		case !sameInstance(before, inst):
+			d.Changed = append(d.Changed, inst)
+		}
+
+		delete(old, inst.ref())
+	}
+
+	for _, inst := range prev {
+		if _, ok := old[inst.ref()]; ok {
+			d.Removed = append(d.Removed, inst)
+		}
+	}
+
+	return d
+}
+
+func sameInstance(a, b Instance) bool {
+	return a.Service == b.Service &&
+		a.Node == b.Node &&
+		a.Address == b.Address &&
+		a.Port == b.Port &&
+		a.Datacenter == b.Datacenter &&
+		a.Partition == b.Partition &&
+		a.Peer == b.Peer &&
+		a.Cluster == b.Cluster &&
+		a.VirtualAddress == b.VirtualAddress &&
+		a.IPv4 == b.IPv4 &&
+		a.IPv6 == b.IPv6 &&
+		slices.Equal(a.Tags, b.Tags) &&
+		maps.Equal(a.Meta, b.Meta) &&
+		maps.Equal(a.NodeMeta, b.NodeMeta)
+}
+
+// WithDiffUpdates makes the manager apply each Consul response as a diff
+// against the previous healthy set: the current connection is kept unless its
+// instance was removed, changed or became ineligible, or an added instance
+// may rank higher under the selection policy (scorer, selection seed, spread
+// coordination or tag preference). Per-instance EventInstanceAdded,
+// EventInstanceRemoved and EventInstanceUpdated events are emitted for every
+// change
+func WithDiffUpdates(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.diffUpdates = enabled
+
+		return nil
+	}
+}
+
+// emitDiff reports every instance change of service
+func (cm *ConnManager) emitDiff(service string, d InstanceDiff) {
+	for _, change := range []struct {
+		typ       EventType
+		instances []Instance
+	}{
+		{EventInstanceAdded, d.Added},
+		{EventInstanceRemoved, d.Removed},
+		{EventInstanceUpdated, d.Changed},
+	} {
+		for _, inst := range change.instances {
+			cm.emit(Event{
+				Type:        change.typ,
+				Service:     service,
+				InstanceID:  inst.ID,
+				Node:        inst.Node,
+				Target:      net.JoinHostPort(inst.Address, strconv.Itoa(inst.Port)),
+				CreateIndex: inst.CreateIndex,
+				ModifyIndex: inst.ModifyIndex,
+				FirstSeen:   inst.FirstSeen,
+			})
+		}
+	}
+}
+
+// keepCurrent reports whether the connection of service can stay on its
+// instance after the healthy set changed by d
+func (cm *ConnManager) keepCurrent(service string, instances []Instance, d InstanceDiff) bool {
+	cm.mu.RLock()
+	mc, ok := cm.conns[service]
+	cm.mu.RUnlock()
+
+	if !ok || mc.instanceID == "" || d.affects(mc.ref()) {
+		return false
+	}
+
+	if len(d.Added)+len(d.Changed) > 0 && cm.ranksInstances(service) {
+		return false
+	}
+
+	_, eligible := findInstance(cm.preferRegion(cm.preferTags(service, cm.eligible(service, instances))), mc.ref())
+
+	return eligible
+}
+
+// ranksInstances reports whether selection orders instances of service, so
+// that a newly added or changed one may be preferred over the current one
+func (cm *ConnManager) ranksInstances(service string) bool {
+	return cm.scorer != nil || cm.selectionSeed != "" || cm.spreadPrefix != "" || len(cm.tagPreferences[service]) > 0 || len(cm.regions) > 0
+}
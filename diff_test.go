@@ -0,0 +1,97 @@
+package consul_service_discovery
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffInstances(t *testing.T) {
+	prev := instancesFromEntries(testEntries("svc", 9001, 9002, 9003))
+	next := instancesFromEntries(testEntries("svc", 9002, 9003, 9004))
+	next[1].Meta = map[string]string{"version": "2"}
+
+	d := DiffInstances(prev, next)
+
+	ids := func(instances []Instance) []string {
+		out := make([]string, 0, len(instances))
+		for _, inst := range instances {
+			out = append(out, inst.ID)
+		}
+
+		return out
+	}
+
+	if got := ids(d.Added); !slices.Equal(got, []string{"svc-9004"}) {
+		t.Errorf("added = %v", got)
+	}
+
+	if got := ids(d.Removed); !slices.Equal(got, []string{"svc-9001"}) {
+		t.Errorf("removed = %v", got)
+	}
+
+	if got := ids(d.Changed); !slices.Equal(got, []string{"svc-9003"}) {
+		t.Errorf("changed = %v", got)
+	}
+
+	if !DiffInstances(next, next).Empty() {
+		t.Error("identical sets should have an empty diff")
+	}
+}
+
+func TestDiffUpdates_KeepsUnaffectedConn(t *testing.T) {
+	rec := &eventRecorder{}
+	cm := newTestManager(t, []string{"svc"}, WithDiffUpdates(true), WithEventHandler(rec.handle))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	before := cm.conns["svc"]
+
+	for _, ports := range [][]int{{9001, 9002, 9003}, {9001, 9002, 9003, 9004}} {
+		if err := cm.refresh(t.Context(), "svc", testEntries("svc", ports...)); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if cm.conns["svc"] != before {
+			t.Fatalf("conn replaced after unrelated change %v", ports)
+		}
+	}
+
+	// the current instance leaves: selection runs again
+	remaining := []int{9003, 9004}
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", remaining...)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if mc := cm.conns["svc"]; mc == before || mc.instanceID == before.instanceID {
+		t.Errorf("conn still on removed instance %s", before.instanceID)
+	}
+
+	var added, removed int
+
+	for _, typ := range rec.types() {
+		switch typ {
+		case EventInstanceAdded:
+			added++
+		case EventInstanceRemoved:
+			removed++
+		}
+	}
+
+	if added != 4 || removed != 2 {
+		t.Errorf("added = %d, removed = %d, want 4 and 2", added, removed)
+	}
+}
+
+func TestDiffInstances_SharedID(t *testing.T) {
+	prev := instancesFromEntries(sharedIDEntries("svc", 9001, 9002))
+	next := instancesFromEntries(sharedIDEntries("svc", 9002, 9003))
+
+	d := DiffInstances(prev, next)
+
+	if len(d.Added) != 1 || d.Added[0].Node != "node-9003" ||
+		len(d.Removed) != 1 || d.Removed[0].Node != "node-9001" || len(d.Changed) != 0 {
+		t.Errorf("diff = %+v, want node-9003 added and node-9001 removed", d)
+	}
+}
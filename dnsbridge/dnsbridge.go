@@ -0,0 +1,288 @@
+// Package dnsbridge serves the instances discovered by a ConnManager as DNS
+// A, AAAA and SRV records on a local UDP port, so processes that don't link
+// the library (legacy binaries, sidecars in the same pod) can consume the
+// same discovery. Nothing listens unless a Server is started.
+//
+// Names follow Consul DNS: users.service.consul for addresses and
+// users.service.consul or _users._tcp.service.consul for SRV records.
+//
+// Example:
+//
+//	srv := dnsbridge.New(mgr, dnsbridge.Config{Addr: "127.0.0.1:8600"})
+//	go srv.ListenAndServe(ctx)
+package dnsbridge
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+// Defaults applied to zero Config fields
+const (
+	DefaultAddr   = "127.0.0.1:8600"
+	DefaultDomain = "consul."
+	DefaultTTL    = 5
+)
+
+const maxUDPSize = 512
+
+// Source provides the healthy instances of a watched service; ConnManager
+// implements it
+type Source interface {
+	Instances(service string) ([]csd.Instance, error)
+}
+
+// Config tunes a Server
+type Config struct {
+	Addr   string // UDP listen address
+	Domain string // zone answered, e.g. "consul."
+	TTL    uint32 // record TTL in seconds
+}
+
+// WithDefaults returns c with zero fields replaced by defaults
+func (c Config) WithDefaults() Config {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+
+	if c.Domain == "" {
+		c.Domain = DefaultDomain
+	}
+
+	c.Domain = strings.ToLower(strings.Trim(c.Domain, ".")) + "."
+
+	if c.TTL == 0 {
+		c.TTL = DefaultTTL
+	}
+
+	return c
+}
+
+// Server answers DNS queries from a Source
+type Server struct {
+	src Source
+	cfg Config
+}
+
+// New creates a Server reading instances from src
+func New(src Source, cfg Config) *Server {
+	return &Server{src: src, cfg: cfg.WithDefaults()}
+}
+
+// ListenAndServe listens on the configured address and serves until ctx is
+// done
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	var lc net.ListenConfig
+
+	pc, err := lc.ListenPacket(ctx, "udp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, pc)
+}
+
+// Serve answers queries arriving on pc until ctx is done. It closes pc
+func (s *Server) Serve(ctx context.Context, pc net.PacketConn) error {
+	stop := context.AfterFunc(ctx, func() { _ = pc.Close() })
+	defer stop()
+
+	buf := make([]byte, maxUDPSize)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			continue
+		}
+
+		resp, err := s.answer(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		_, _ = pc.WriteTo(resp, addr)
+	}
+}
+
+// answer builds the response to one query message
+func (s *Server) answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+
+	hdr, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := dnsmessage.Header{
+		ID:               hdr.ID,
+		Response:         true,
+		Authoritative:    true,
+		RecursionDesired: hdr.RecursionDesired,
+		RCode:            dnsmessage.RCodeSuccess,
+		OpCode:           hdr.OpCode,
+	}
+
+	service, ok := s.serviceName(q.Name.String())
+	if !ok {
+		resp.RCode = dnsmessage.RCodeRefused
+
+		return build(resp, q, nil)
+	}
+
+	instances, err := s.src.Instances(service)
+	if err != nil || len(instances) == 0 {
+		resp.RCode = dnsmessage.RCodeNameError
+
+		return build(resp, q, nil)
+	}
+
+	msg, err := build(resp, q, func(b *dnsmessage.Builder) error {
+		return s.records(b, q, instances)
+	})
+	if err != nil || len(msg) <= maxUDPSize {
+		return msg, err
+	}
+
+	// too large for UDP: signal truncation so the client may retry over TCP
+	resp.Truncated = true
+
+	return build(resp, q, nil)
+}
+
+// serviceName extracts the service from users.service.<domain> or
+// _users._tcp.service.<domain>
+func (s *Server) serviceName(name string) (string, bool) {
+	name = strings.ToLower(name)
+
+	rest, ok := strings.CutSuffix(name, ".service."+s.cfg.Domain)
+	if !ok || rest == "" {
+		return "", false
+	}
+
+	if svc, ok := strings.CutSuffix(rest, "._tcp"); ok {
+		rest = strings.TrimPrefix(svc, "_")
+	}
+
+	return rest, !strings.Contains(rest, ".")
+}
+
+func build(hdr dnsmessage.Header, q dnsmessage.Question, answers func(*dnsmessage.Builder) error) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, maxUDPSize), hdr)
+	b.EnableCompression()
+
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+
+	if answers != nil {
+		if err := answers(&b); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
+
+// records writes the answers for q, and for SRV queries the addresses of the
+// targets as additional records
+func (s *Server) records(b *dnsmessage.Builder, q dnsmessage.Question, instances []csd.Instance) error {
+	if err := b.StartAnswers(); err != nil {
+		return err
+	}
+
+	if q.Type == dnsmessage.TypeSRV {
+		for _, inst := range instances {
+			target, err := dnsmessage.NewName(s.nodeName(inst))
+			if err != nil {
+				return err
+			}
+
+			hdr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: s.cfg.TTL}
+			if err := b.SRVResource(hdr, dnsmessage.SRVResource{Priority: 1, Weight: 1, Port: uint16(inst.Port), Target: target}); err != nil {
+				return err
+			}
+		}
+
+		if err := b.StartAdditionals(); err != nil {
+			return err
+		}
+
+		for _, inst := range instances {
+			name, err := dnsmessage.NewName(s.nodeName(inst))
+			if err != nil {
+				return err
+			}
+
+			if err := s.address(b, name, dnsmessage.TypeALL, inst); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, inst := range instances {
+		if err := s.address(b, q.Name, q.Type, inst); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// address writes the A or AAAA record of inst when it matches typ; hostnames
+// have no address record
+func (s *Server) address(b *dnsmessage.Builder, name dnsmessage.Name, typ dnsmessage.Type, inst csd.Instance) error {
+	ip, err := netip.ParseAddr(inst.Address)
+	if err != nil {
+		return nil
+	}
+
+	hdr := dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: s.cfg.TTL}
+
+	switch {
+	case ip.Is4() && (typ == dnsmessage.TypeA || typ == dnsmessage.TypeALL):
+		return b.AResource(hdr, dnsmessage.AResource{A: ip.As4()})
+	case ip.Is6() && (typ == dnsmessage.TypeAAAA || typ == dnsmessage.TypeALL):
+		return b.AAAAResource(hdr, dnsmessage.AAAAResource{AAAA: ip.As16()})
+	}
+
+	return nil
+}
+
+// nodeName is the SRV target of inst: its instance ID under the addr zone
+func (s *Server) nodeName(inst csd.Instance) string {
+	label := strings.Map(func(r rune) rune {
+		if r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' {
+			return r
+		}
+
+		return '-'
+	}, strings.ToLower(inst.ID))
+
+	return label + ".addr." + s.cfg.Domain
+}
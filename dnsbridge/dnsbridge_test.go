@@ -0,0 +1,121 @@
+package dnsbridge
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+type staticSource map[string][]csd.Instance
+
+func (s staticSource) Instances(service string) ([]csd.Instance, error) {
+	instances, ok := s[service]
+	if !ok {
+		return nil, errors.New("not watched")
+	}
+
+	return instances, nil
+}
+
+// startServer serves src on a local port and returns a resolver using it
+func startServer(t *testing.T, src Source) *net.Resolver {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_ = New(src, Config{}).Serve(ctx, pc)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+
+			return d.DialContext(ctx, "udp", pc.LocalAddr().String())
+		},
+	}
+}
+
+func TestServer_Lookups(t *testing.T) {
+	r := startServer(t, staticSource{
+		"users": {
+			{ID: "users-1", Address: "10.0.0.1", Port: 9001},
+			{ID: "users-2", Address: "10.0.0.2", Port: 9002},
+		},
+		"billing": {},
+	})
+
+	ctx := context.Background()
+
+	addrs, err := r.LookupHost(ctx, "users.service.consul")
+	if err != nil {
+		t.Fatalf("lookup host: %v", err)
+	}
+
+	slices.Sort(addrs)
+
+	if !slices.Equal(addrs, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("addrs = %v", addrs)
+	}
+
+	_, srvs, err := r.LookupSRV(ctx, "users", "tcp", "service.consul")
+	if err != nil {
+		t.Fatalf("lookup srv: %v", err)
+	}
+
+	ports := make([]int, 0, len(srvs))
+	for _, srv := range srvs {
+		ports = append(ports, int(srv.Port))
+	}
+
+	slices.Sort(ports)
+
+	if !slices.Equal(ports, []int{9001, 9002}) {
+		t.Errorf("srv ports = %v", ports)
+	}
+
+	for _, name := range []string{"billing.service.consul", "orders.service.consul"} {
+		var dnsErr *net.DNSError
+		if _, err := r.LookupHost(ctx, name); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("%s: err = %v, want not found", name, err)
+		}
+	}
+}
+
+func TestServer_ServiceName(t *testing.T) {
+	s := New(staticSource{}, Config{Domain: "Cluster.Local"})
+
+	for name, want := range map[string]string{
+		"users.service.cluster.local.":       "users",
+		"_users._tcp.service.cluster.local.": "users",
+		"USERS.service.cluster.local.":       "users",
+		"users.service.consul.":              "",
+		"a.b.service.cluster.local.":         "",
+	} {
+		got, ok := s.serviceName(name)
+		if !ok {
+			got = ""
+		}
+
+		if got != want {
+			t.Errorf("serviceName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
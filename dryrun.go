@@ -0,0 +1,74 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// WithDryRun makes the manager run discovery and selection, emitting events,
+// metrics and Status, without ever opening gRPC connections. Useful for
+// canary-testing discovery configuration and for monitoring-only sidecars.
+// GetConn, GetConnByInstanceID, GetConnFor and Prewarm always fail with
+// ErrConnNotFound in dry-run mode
+func WithDryRun(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.dryRun = enabled
+
+		return nil
+	}
+}
+
+// dryRunConnError is returned by calls that would dial in dry-run mode
+func dryRunConnError(service string) error {
+	return fmt.Errorf("%w: %s: dry run", ErrConnNotFound, service)
+}
+
+// recordSelection stores the target chosen for service in dry-run mode or for
+// HTTP services, which have no ClientConn. A nil inst clears it
+func (cm *ConnManager) recordSelection(service string, inst *Instance) error {
+	target := ""
+
+	if inst != nil {
+		t, err := cm.targetFor(cm.withDialHost(service, *inst))
+		if err != nil {
+			return err
+		}
+
+		target = t
+	}
+
+	cm.mu.Lock()
+
+	if cm.selected[service] == target {
+		cm.mu.Unlock()
+
+		return nil
+	}
+
+	if target == "" {
+		cm.lastTargets[service] = cm.selected[service]
+		delete(cm.selected, service)
+	} else {
+		cm.selected[service] = target
+		delete(cm.lastTargets, service)
+	}
+
+	cm.notifyLocked()
+	cm.mu.Unlock()
+
+	if inst == nil {
+		cm.emit(Event{Type: EventConnRemoved, Service: service})
+
+		return nil
+	}
+
+	if cm.dryRun {
+		cm.logger.Info("dry run: would connect", zap.String("service", service), zap.String("target", target))
+	} else {
+		cm.logger.Info("selected http target", zap.String("service", service), zap.String("target", target))
+	}
+	cm.emit(Event{Type: EventTargetSelected, Service: service, Target: target, InstanceID: inst.ID, Node: inst.Node})
+
+	return nil
+}
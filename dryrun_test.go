@@ -0,0 +1,143 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventRecorder collects events for assertions
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) handle(ev Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, ev)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]EventType, 0, len(r.events))
+	for _, ev := range r.events {
+		out = append(out, ev.Type)
+	}
+
+	return out
+}
+
+func TestDryRun_SelectsWithoutDialing(t *testing.T) {
+	rec := &eventRecorder{}
+	cm := newTestManager(t, []string{"users"}, WithDryRun(true), WithEventHandler(rec.handle))
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("users"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("dry run must not dial, GetConn err = %v", err)
+	}
+
+	if st := cm.Status()[0]; st.Target != "127.0.0.1:9001" || st.Connected {
+		t.Errorf("status = %+v, want selected target without connection", st)
+	}
+
+	if !cm.Ready() {
+		t.Error("dry run should be ready once a target is selected")
+	}
+
+	got := rec.types()
+	if len(got) != 2 || got[0] != EventInstancesChanged || got[1] != EventTargetSelected {
+		t.Fatalf("events = %v", got)
+	}
+
+	if !rec.events[1].DryRun {
+		t.Error("events should be flagged as dry run")
+	}
+
+	if err := cm.refresh(t.Context(), "users", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if got := rec.types(); got[len(got)-1] != EventConnRemoved {
+		t.Errorf("last event = %v, want %v", got[len(got)-1], EventConnRemoved)
+	}
+}
+
+func TestEvents_HandlerMayCallManager(t *testing.T) {
+	var cm *ConnManager
+
+	cm = newTestManager(t, []string{"users"}, WithEventHandler(func(ev Event) {
+		if ev.Type == EventTargetSelected {
+			_, _ = cm.GetConn(ev.Service) // must not deadlock
+		}
+	}))
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+}
+
+// dryRunManager returns a dry-run manager that selected svc-9001, which
+// advertises an admin port
+func dryRunManager(t *testing.T) *ConnManager {
+	t.Helper()
+
+	entries := testEntries("svc", 9001, 9002)
+	entries[0].Service.Meta = map[string]string{"admin_port": "9101"}
+
+	cm := newTestManager(t, []string{"svc"}, WithDryRun(true), WithNamedPort("svc", "admin", "admin_port"))
+
+	if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	return cm
+}
+
+// assertNotDialed checks err is ErrConnNotFound and no per-instance conn exists
+func assertNotDialed(t *testing.T, cm *ConnManager, err error) {
+	t.Helper()
+
+	if !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("err = %v, want ErrConnNotFound", err)
+	}
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if n := len(cm.instanceConns); n != 0 {
+		t.Errorf("dry run dialed %d per-instance conns", n)
+	}
+}
+
+func TestDryRun_GetConnByInstanceID(t *testing.T) {
+	cm := dryRunManager(t)
+
+	_, err := cm.GetConnByInstanceID("svc", "svc-9002")
+	assertNotDialed(t, cm, err)
+}
+
+func TestDryRun_GetConnFor(t *testing.T) {
+	cm := dryRunManager(t)
+
+	_, err := cm.GetConnFor("svc", "admin")
+	assertNotDialed(t, cm, err)
+}
+
+func TestDryRun_Prewarm(t *testing.T) {
+	cm := dryRunManager(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := cm.Prewarm(ctx, []string{"svc"}, 2)
+	assertNotDialed(t, cm, err)
+}
@@ -0,0 +1,138 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+)
+
+const (
+	// happyEyeballsDelay is how long the IPv6 attempt runs alone before IPv4
+	// is tried too, per RFC 8305
+	happyEyeballsDelay = 250 * time.Millisecond
+
+	lanIPv4TaggedAddress = "lan_ipv4"
+	lanIPv6TaggedAddress = "lan_ipv6"
+)
+
+// WithDualStack dials instances registered with both lan_ipv4 and lan_ipv6
+// tagged addresses (on the service, else on the node) with happy eyeballs:
+// IPv6 first, IPv4 after a short delay or as soon as IPv6 fails, and the
+// first connection established wins. Both use the resolved dial port. Other
+// instances, and services reached through a proxy, dial as usual
+func WithDualStack(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.dualStack = enabled
+
+		return nil
+	}
+}
+
+// taggedIPs returns the lan_ipv4 and lan_ipv6 tagged addresses of e
+func taggedIPs(e *api.ServiceEntry) (v4, v6 string) {
+	v4 = e.Service.TaggedAddresses[lanIPv4TaggedAddress].Address
+	v6 = e.Service.TaggedAddresses[lanIPv6TaggedAddress].Address
+
+	if e.Node != nil {
+		if v4 == "" {
+			v4 = e.Node.TaggedAddresses[lanIPv4TaggedAddress]
+		}
+
+		if v6 == "" {
+			v6 = e.Node.TaggedAddresses[lanIPv6TaggedAddress]
+		}
+	}
+
+	return v4, v6
+}
+
+// dualStackOption returns the happy-eyeballs dialer for inst, if it applies
+func (cm *ConnManager) dualStackOption(service string, inst Instance) (grpc.DialOption, bool) {
+	if !cm.dualStack || inst.IPv4 == "" || inst.IPv6 == "" || cm.dialerFor(service) != nil {
+		return nil, false
+	}
+
+	port, err := cm.portFor(inst)
+	if err != nil {
+		return nil, false
+	}
+
+	p := strconv.Itoa(port)
+
+	return grpc.WithContextDialer(happyEyeballs(net.JoinHostPort(inst.IPv6, p), net.JoinHostPort(inst.IPv4, p), happyEyeballsDelay)), true
+}
+
+// happyEyeballs dials primary, and fallback once delay passes or primary
+// fails, returning the first connection established. The target address
+// gRPC passes in is ignored
+func happyEyeballs(primary, fallback string, delay time.Duration) dialFunc {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	return func(ctx context.Context, _ string) (net.Conn, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make(chan result, 2)
+		dial := func(addr string) {
+			var d net.Dialer
+
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			results <- result{conn, err}
+		}
+
+		go dial(primary)
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		var (
+			pending = 1
+			next    = fallback // not yet started
+			errs    []error
+		)
+
+		for {
+			select {
+			case <-timer.C:
+				if next != "" {
+					go dial(next)
+					pending, next = pending+1, ""
+				}
+			case r := <-results:
+				pending--
+
+				if r.err == nil {
+					// close the connection of a slower attempt, if any
+					go func(n int) {
+						for range n {
+							if late := <-results; late.conn != nil {
+								_ = late.conn.Close()
+							}
+						}
+					}(pending)
+
+					return r.conn, nil
+				}
+
+				errs = append(errs, r.err)
+
+				if next != "" {
+					go dial(next)
+					pending, next = pending+1, ""
+				}
+
+				if pending == 0 {
+					return nil, errors.Join(errs...)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func listenLocal(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	return ln
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	a, b := listenLocal(t), listenLocal(t)
+	refused := "127.0.0.1:" + strconv.Itoa(closedPort(t))
+
+	cases := []struct {
+		name              string
+		primary, fallback string
+		want              string
+	}{
+		{"primary wins", a.Addr().String(), b.Addr().String(), a.Addr().String()},
+		{"fallback after primary fails", refused, b.Addr().String(), b.Addr().String()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			start := time.Now()
+
+			conn, err := happyEyeballs(c.primary, c.fallback, time.Hour)(context.Background(), "ignored")
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			if got := conn.RemoteAddr().String(); got != c.want {
+				t.Errorf("connected to %s, want %s", got, c.want)
+			}
+
+			if time.Since(start) > time.Second {
+				t.Error("fallback waited for the delay after the primary failed")
+			}
+		})
+	}
+
+	if _, err := happyEyeballs(refused, refused, time.Hour)(context.Background(), ""); err == nil {
+		t.Error("dial succeeded with both addresses refused")
+	}
+}
+
+func TestTaggedIPs(t *testing.T) {
+	e := testEntries("svc", 9001)[0]
+	e.Node.TaggedAddresses = map[string]string{"lan_ipv4": "10.0.0.5", "lan_ipv6": "fd00::5"}
+	e.Service.TaggedAddresses = map[string]api.ServiceAddress{"lan_ipv6": {Address: "fd00::9", Port: 9001}}
+
+	v4, v6 := taggedIPs(e)
+	if v4 != "10.0.0.5" || v6 != "fd00::9" {
+		t.Errorf("tagged = %s, %s; want node IPv4 and service IPv6", v4, v6)
+	}
+}
+
+func TestDualStack_FallsBackToIPv4(t *testing.T) {
+	port := startGRPCServer(t)
+
+	entries := testEntries("svc", port)
+	entries[0].Service.Address = "127.0.0.2" // the server only listens on 127.0.0.1
+	entries[0].Node.TaggedAddresses = map[string]string{"lan_ipv4": "127.0.0.1", "lan_ipv6": "::1"}
+
+	cm := newTestManager(t, []string{"svc"}, WithDualStack(true))
+
+	if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cm.Invoke(ctx, "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}); err != nil {
+		t.Fatalf("invoke over the dual-stack dialer: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package consul_service_discovery
+
+import (
+	"cmp"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// duplicateIDs returns, for every address:port registered by more than one
+// instance, the instances beyond the first in ID and node order. Such
+// instances are almost always a copy-pasted registration of the same process
+func duplicateIDs(instances []Instance) map[string][]instanceRef {
+	byAddr := make(map[string][]instanceRef)
+
+	for _, inst := range instances {
+		addr := net.JoinHostPort(inst.Address, strconv.Itoa(inst.Port))
+		byAddr[addr] = append(byAddr[addr], inst.ref())
+	}
+
+	out := make(map[string][]instanceRef)
+
+	for addr, refs := range byAddr {
+		if len(refs) < 2 {
+			continue
+		}
+
+		slices.SortFunc(refs, func(a, b instanceRef) int {
+			return cmp.Or(strings.Compare(a.id, b.id), strings.Compare(a.node, b.node))
+		})
+		out[addr] = refs[1:]
+	}
+
+	return out
+}
+
+// reportDuplicates warns about and emits EventDuplicateRegistration for
+// duplicate registrations of service not reported before
+func (cm *ConnManager) reportDuplicates(service string, instances []Instance) {
+	dups := duplicateIDs(instances)
+	seen := make(map[instanceRef]struct{})
+
+	type finding struct {
+		addr string
+		ref  instanceRef
+	}
+
+	var fresh []finding
+
+	cm.mu.Lock()
+	for _, addr := range slices.Sorted(maps.Keys(dups)) {
+		for _, ref := range dups[addr] {
+			seen[ref] = struct{}{}
+
+			if _, known := cm.duplicates[service][ref]; !known {
+				fresh = append(fresh, finding{addr, ref})
+			}
+		}
+	}
+
+	switch {
+	case len(seen) == 0:
+		delete(cm.duplicates, service)
+	case cm.duplicates == nil:
+		cm.duplicates = map[string]map[instanceRef]struct{}{service: seen}
+	default:
+		cm.duplicates[service] = seen
+	}
+	cm.mu.Unlock()
+
+	for _, f := range fresh {
+		cm.logger.Warn("duplicate registration ignored",
+			zap.String("service", service),
+			zap.String("addr", f.addr),
+			zap.String("node", f.ref.node),
+			zap.String("instance", f.ref.id),
+		)
+		cm.emit(Event{Type: EventDuplicateRegistration, Service: service, Target: f.addr, InstanceID: f.ref.id, Node: f.ref.node})
+	}
+}
+
+// withoutDuplicates drops the duplicate registrations found by duplicateIDs
+func (cm *ConnManager) withoutDuplicates(service string, instances []Instance) []Instance {
+	cm.mu.RLock()
+	dups := cm.duplicates[service]
+	cm.mu.RUnlock()
+
+	if len(dups) == 0 {
+		return instances
+	}
+
+	return slices.DeleteFunc(slices.Clone(instances), func(inst Instance) bool {
+		_, dup := dups[inst.ref()]
+
+		return dup
+	})
+}
@@ -0,0 +1,49 @@
+package consul_service_discovery
+
+import (
+	"testing"
+)
+
+func TestDuplicateRegistration(t *testing.T) {
+	rec := &eventRecorder{}
+	cm := newTestManager(t, []string{"svc"}, WithEventHandler(rec.handle))
+
+	// "a" and "b" are the same process registered twice
+	entries := vipEntries("svc", "b", "a")
+	entries = append(entries, testEntries("svc", 9002)...)
+
+	for range 3 {
+		if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+	}
+
+	var dups []Event
+
+	for _, ev := range rec.events {
+		if ev.Type == EventDuplicateRegistration {
+			dups = append(dups, ev)
+		}
+	}
+
+	if len(dups) != 1 || dups[0].InstanceID != "b" || dups[0].Target != "127.0.0.1:9001" {
+		t.Fatalf("duplicate events = %+v, want one for b reported once", dups)
+	}
+
+	instances, _ := cm.Instances("svc")
+
+	for range 20 {
+		if inst, _ := cm.selectInstance("svc", instances); inst.ID == "b" {
+			t.Fatal("duplicate registration selected")
+		}
+	}
+
+	// fixed registration: b is eligible again once it differs
+	if err := cm.refresh(t.Context(), "svc", vipEntries("svc", "b")); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if id := cm.conns["svc"].instanceID; id != "b" {
+		t.Errorf("selected %s, want b after the duplicate is gone", id)
+	}
+}
@@ -0,0 +1,71 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// defaultEagerConnectTimeout bounds the wait for READY in eager mode
+const defaultEagerConnectTimeout = 10 * time.Second
+
+// WithEagerConnect restores grpc.DialContext(WithBlock) semantics: every new
+// connection is connected right away and only used once READY. A connection
+// that is not READY within the timeout (default 10s, see
+// WithEagerConnectTimeout) counts as a failed dial and is retried
+func WithEagerConnect(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.eagerConnect = enabled
+
+		return nil
+	}
+}
+
+// WithEagerConnectTimeout sets how long eager mode waits for READY
+func WithEagerConnectTimeout(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d <= 0 {
+			return errors.New("eager_connect_timeout_must_be_positive")
+		}
+
+		cm.eagerTimeout = d
+
+		return nil
+	}
+}
+
+// connectEager connects conn and waits for READY when eager mode is on
+func (cm *ConnManager) connectEager(conn *grpc.ClientConn) error {
+	if !cm.eagerConnect {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cm.eagerTimeout)
+	defer cancel()
+
+	if err := waitReady(ctx, conn); err != nil {
+		return fmt.Errorf("not ready after %s: %w", cm.eagerTimeout, err)
+	}
+
+	return nil
+}
+
+// waitReady connects conn and waits until it is READY or ctx is done
+func waitReady(ctx context.Context, conn *grpc.ClientConn) error {
+	conn.Connect()
+
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("state %s: %w", state, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package consul_service_discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startGRPCServer serves the gRPC health service without TLS and returns its
+// port
+func startGRPCServer(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// closedPort returns a local port nothing listens on
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	return port
+}
+
+func TestEagerConnect_WaitsForReady(t *testing.T) {
+	cm := newTestManager(t, []string{"users"}, WithEagerConnect(true))
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", startGRPCServer(t))); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	conn, err := cm.GetConn("users")
+	if err != nil {
+		t.Fatalf("get conn: %v", err)
+	}
+
+	if state := conn.GetState(); state != connectivity.Ready {
+		t.Errorf("state = %s, want READY right after selection", state)
+	}
+}
+
+func TestEagerConnect_FailsUnreachable(t *testing.T) {
+	cm := newTestManager(t, []string{"users"},
+		WithEagerConnect(true),
+		WithEagerConnectTimeout(200*time.Millisecond),
+	)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", closedPort(t))); err == nil {
+		t.Fatal("expected eager dial of an unreachable target to fail")
+	}
+
+	if _, err := cm.GetConn("users"); err == nil {
+		t.Error("unreachable target should not be installed")
+	}
+}
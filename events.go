@@ -0,0 +1,104 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"time"
+)
+
+// EventType identifies what happened in an Event
+type EventType string
+
+const (
+	// EventInstancesChanged reports a new healthy instance set for a service
+	EventInstancesChanged EventType = "instances_changed"
+	// EventTargetSelected reports that a service now uses a new target
+	EventTargetSelected EventType = "target_selected"
+	// EventConnRemoved reports that a service lost its connection
+	EventConnRemoved EventType = "conn_removed"
+	// EventQueryError reports a failed Consul query
+	EventQueryError EventType = "query_error"
+	// EventSelectError reports a failure to resolve or dial a selected instance
+	EventSelectError EventType = "select_error"
+	// EventPaused reports that discovery for a service was paused
+	EventPaused EventType = "paused"
+	// EventResumed reports that discovery for a service was resumed
+	EventResumed EventType = "resumed"
+	// EventTargetPinned reports an operator override of a service target
+	EventTargetPinned EventType = "target_pinned"
+	// EventTargetUnpinned reports the end of a manual pin
+	EventTargetUnpinned EventType = "target_unpinned"
+	// EventIdentityMismatch reports a server certificate not matching the
+	// expected peer identity; Target holds the evicted address
+	EventIdentityMismatch EventType = "identity_mismatch"
+	// EventInstanceAdded reports an instance joining the healthy set (see
+	// WithDiffUpdates)
+	EventInstanceAdded EventType = "instance_added"
+	// EventInstanceRemoved reports an instance leaving the healthy set
+	EventInstanceRemoved EventType = "instance_removed"
+	// EventInstanceUpdated reports a change of a healthy instance's address,
+	// tags or metadata
+	EventInstanceUpdated EventType = "instance_updated"
+	// EventDuplicateRegistration reports an instance registered at the same
+	// address:port (Target) as another one; it is ignored by selection
+	EventDuplicateRegistration EventType = "duplicate_registration"
+	// EventRateLimited reports a query Consul rejected with 429; all
+	// watchers hold their queries for the delay
+	EventRateLimited EventType = "rate_limited"
+	// EventConnLost reports the death of an established connection, see
+	// WithKeepalive
+	EventConnLost EventType = "conn_lost"
+	// EventWatcherStuck reports a watcher that made no progress for the
+	// threshold of WithStuckWatcherDetection; it is restarted
+	EventWatcherStuck EventType = "watcher_stuck"
+)
+
+// Event describes a discovery decision or failure
+type Event struct {
+	Type        EventType
+	Service     string
+	Target      string // set for EventTargetSelected and instance events
+	InstanceID  string // set for EventTargetSelected and instance events
+	Node        string // node of InstanceID, which is only unique per node
+	Instances   int    // healthy instances, set for EventInstancesChanged
+	Err         error  // set for error events
+	DryRun      bool   // the decision was not acted upon (see WithDryRun)
+	Maintenance bool   // a maintenance window of the service is active
+	Time        time.Time
+
+	// registration details of the instance, set for instance events
+	CreateIndex uint64
+	ModifyIndex uint64
+	FirstSeen   time.Time
+}
+
+// EventHandler receives events. It runs on watcher goroutines and must not
+// block; hand events off to a channel or queue for slow processing
+type EventHandler func(Event)
+
+// WithEventHandler registers a handler for discovery events. It may be given
+// several times
+func WithEventHandler(h EventHandler) Option {
+	return func(cm *ConnManager) error {
+		if h == nil {
+			return errors.New("nil_event_handler")
+		}
+
+		cm.eventHandlers = append(cm.eventHandlers, h)
+
+		return nil
+	}
+}
+
+// emit stamps ev, keeps it for SupportBundle and delivers it to every
+// handler
+func (cm *ConnManager) emit(ev Event) {
+	ev.Time = time.Now()
+	ev.DryRun = cm.dryRun
+	ev.Maintenance = cm.inMaintenance(ev.Service)
+
+	cm.history.add(ev)
+
+	for _, h := range cm.eventHandlers {
+		h(ev)
+	}
+}
@@ -0,0 +1,272 @@
+// Package eventsink ships discovery events to an external system with
+// at-least-once delivery: queued events are batched and retried until the
+// publisher accepts them. A bounded queue applies backpressure according to
+// the configured overflow policy. Transport adapters live in the kafka and
+// nats sub-packages.
+//
+// Example:
+//
+//	sink, err := kafka.New(producer, "discovery-events", eventsink.Config{})
+//	go sink.Run(ctx)
+//
+//	mgr, err := csd.New(client, services, csd.WithEventHandler(sink.Handle))
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+// Defaults applied to zero Config fields
+const (
+	DefaultQueueSize     = 1024
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultRetryInterval = 500 * time.Millisecond
+	maxRetryInterval     = 30 * time.Second
+	drainTimeout         = 5 * time.Second
+)
+
+// Overflow decides what Handle does when the queue is full
+type Overflow int
+
+const (
+	// DropNewest discards the incoming event (default); Handle never blocks
+	DropNewest Overflow = iota
+	// DropOldest discards the oldest queued event to make room
+	DropOldest
+	// Block waits for room. Handle runs on discovery goroutines, so only use
+	// it when stalling discovery is preferable to losing events
+	Block
+)
+
+// Publisher delivers one batch. A nil error acknowledges every event in it;
+// on error the whole batch is retried
+type Publisher interface {
+	Publish(ctx context.Context, events []csd.Event) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, events []csd.Event) error
+
+// Publish calls f
+func (f PublisherFunc) Publish(ctx context.Context, events []csd.Event) error {
+	return f(ctx, events)
+}
+
+// Encoder renders one event for the wire
+type Encoder func(csd.Event) ([]byte, error)
+
+// JSON encodes events in their stable JSON form
+func JSON(ev csd.Event) ([]byte, error) { return json.Marshal(ev) }
+
+// Proto encodes events as consul_sd.v1.Event protobuf messages
+func Proto(ev csd.Event) ([]byte, error) { return ev.MarshalProto(), nil }
+
+// Config tunes a Sink. Zero fields take the defaults
+type Config struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration // max delay before a partial batch is sent
+	RetryInterval time.Duration // base delay between failed attempts, doubled up to 30s
+	Overflow      Overflow
+	Encoder       Encoder // used by transport adapters; default JSON
+}
+
+// WithDefaults returns c with zero fields replaced by defaults
+func (c Config) WithDefaults() Config {
+	if c.QueueSize <= 0 {
+		c.QueueSize = DefaultQueueSize
+	}
+
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultBatchSize
+	}
+
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultFlushInterval
+	}
+
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultRetryInterval
+	}
+
+	if c.Encoder == nil {
+		c.Encoder = JSON
+	}
+
+	return c
+}
+
+// Sink queues events from Handle and publishes them from Run
+type Sink struct {
+	pub Publisher
+	cfg Config
+
+	mu      sync.Mutex
+	queue   []queued
+	seq     uint64
+	notify  chan struct{} // signalled when events are queued
+	space   chan struct{} // signalled when room frees up, for Block
+	dropped atomic.Uint64
+}
+
+// queued is an event with its position in the stream
+type queued struct {
+	seq uint64
+	ev  csd.Event
+}
+
+// New returns a Sink publishing through pub
+func New(pub Publisher, cfg Config) *Sink {
+	return &Sink{
+		pub:    pub,
+		cfg:    cfg.WithDefaults(),
+		notify: make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+	}
+}
+
+// Handle queues ev; pass it to WithEventHandler
+func (s *Sink) Handle(ev csd.Event) {
+	for {
+		s.mu.Lock()
+
+		if len(s.queue) < s.cfg.QueueSize {
+			s.enqueueLocked(ev)
+			s.mu.Unlock()
+			signal(s.notify)
+
+			return
+		}
+
+		switch s.cfg.Overflow {
+		case DropOldest:
+			s.queue = s.queue[1:]
+			s.enqueueLocked(ev)
+			s.mu.Unlock()
+			s.dropped.Add(1)
+			signal(s.notify)
+
+			return
+		case Block:
+			s.mu.Unlock()
+			<-s.space
+		default:
+			s.mu.Unlock()
+			s.dropped.Add(1)
+
+			return
+		}
+	}
+}
+
+func (s *Sink) enqueueLocked(ev csd.Event) {
+	s.seq++
+	s.queue = append(s.queue, queued{seq: s.seq, ev: ev})
+}
+
+// Dropped returns how many events were discarded because the queue was full
+func (s *Sink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Pending returns how many events are queued or in flight
+func (s *Sink) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queue)
+}
+
+// Run publishes queued events until ctx is done, then tries for a few more
+// seconds to deliver what is left
+func (s *Sink) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+			defer cancel()
+
+			for s.Pending() > 0 {
+				if !s.flush(drainCtx) {
+					break
+				}
+			}
+
+			return
+		case <-s.notify:
+			if s.Pending() < s.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		for s.Pending() > 0 && s.flush(ctx) {
+			if s.Pending() < s.cfg.BatchSize {
+				break
+			}
+		}
+	}
+}
+
+// flush publishes the head of the queue, retrying until it is acknowledged.
+// It reports false when ctx ended first
+func (s *Sink) flush(ctx context.Context) bool {
+	s.mu.Lock()
+	n := min(len(s.queue), s.cfg.BatchSize)
+	batch := make([]csd.Event, 0, n)
+	for _, q := range s.queue[:n] {
+		batch = append(batch, q.ev)
+	}
+	last := s.queue[n-1].seq
+	s.mu.Unlock()
+
+	delay := s.cfg.RetryInterval
+
+	for {
+		if err := s.pub.Publish(ctx, batch); err == nil {
+			break
+		}
+
+		t := time.NewTimer(delay/2 + time.Duration(rand.Int63n(int64(delay))))
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+
+			return false
+		case <-t.C:
+		}
+
+		delay = min(2*delay, maxRetryInterval)
+	}
+
+	s.mu.Lock()
+	// DropOldest may have discarded part of the batch meanwhile
+	for len(s.queue) > 0 && s.queue[0].seq <= last {
+		s.queue = s.queue[1:]
+	}
+	s.mu.Unlock()
+
+	signal(s.space)
+
+	return true
+}
+
+// signal does a non-blocking send on a 1-buffered channel
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
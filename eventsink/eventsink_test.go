@@ -0,0 +1,113 @@
+package eventsink_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/eventsink"
+)
+
+// flakyPublisher fails the first failures attempts, then records batches
+type flakyPublisher struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	events   []csd.Event
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, events []csd.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.attempts++
+	if p.attempts <= p.failures {
+		return errors.New("broker unavailable")
+	}
+
+	p.events = append(p.events, events...)
+
+	return nil
+}
+
+func (p *flakyPublisher) delivered() []csd.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]csd.Event(nil), p.events...)
+}
+
+func TestSink_RetriesUntilDelivered(t *testing.T) {
+	pub := &flakyPublisher{failures: 2}
+	sink := eventsink.New(pub, eventsink.Config{
+		FlushInterval: 10 * time.Millisecond,
+		RetryInterval: 5 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		sink.Run(ctx)
+		close(done)
+	}()
+
+	for _, svc := range []string{"users", "billing", "orders"} {
+		sink.Handle(csd.Event{Type: csd.EventTargetSelected, Service: svc})
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pub.delivered()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	got := pub.delivered()
+	if len(got) != 3 || got[0].Service != "users" || got[2].Service != "orders" {
+		t.Fatalf("delivered = %+v, want all three in order", got)
+	}
+
+	if sink.Pending() != 0 {
+		t.Errorf("pending = %d after delivery", sink.Pending())
+	}
+}
+
+func TestSink_Overflow(t *testing.T) {
+	pub := eventsink.PublisherFunc(func(context.Context, []csd.Event) error { return nil })
+
+	newest := eventsink.New(pub, eventsink.Config{QueueSize: 2})
+	oldest := eventsink.New(pub, eventsink.Config{QueueSize: 2, Overflow: eventsink.DropOldest})
+
+	for _, svc := range []string{"a", "b", "c"} {
+		newest.Handle(csd.Event{Service: svc})
+		oldest.Handle(csd.Event{Service: svc})
+	}
+
+	if newest.Dropped() != 1 || newest.Pending() != 2 {
+		t.Errorf("drop newest: dropped %d, pending %d", newest.Dropped(), newest.Pending())
+	}
+
+	if oldest.Dropped() != 1 || oldest.Pending() != 2 {
+		t.Errorf("drop oldest: dropped %d, pending %d", oldest.Dropped(), oldest.Pending())
+	}
+}
+
+func TestSink_DrainsOnShutdown(t *testing.T) {
+	pub := &flakyPublisher{}
+	sink := eventsink.New(pub, eventsink.Config{FlushInterval: time.Hour})
+
+	sink.Handle(csd.Event{Service: "users"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sink.Run(ctx)
+
+	if len(pub.delivered()) != 1 {
+		t.Errorf("queued event not delivered on shutdown")
+	}
+}
@@ -0,0 +1,75 @@
+// Package kafka publishes discovery events to a Kafka topic, keyed by service
+// so per-service ordering is kept within a partition. It depends only on the
+// small Producer interface; wrap your client of choice (kafka-go, sarama,
+// confluent-kafka-go) in a few lines:
+//
+//	producer := kafka.ProducerFunc(func(ctx context.Context, msgs []kafka.Message) error {
+//		out := make([]kafkago.Message, len(msgs))
+//		for i, m := range msgs {
+//			out[i] = kafkago.Message{Topic: m.Topic, Key: m.Key, Value: m.Value}
+//		}
+//		return writer.WriteMessages(ctx, out...)
+//	})
+//
+// The producer must only return nil once the brokers acknowledged every
+// message (e.g. RequiredAcks = all) for delivery to be at-least-once.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/eventsink"
+)
+
+// Message is one record to produce
+type Message struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// Producer writes a batch of messages synchronously
+type Producer interface {
+	Produce(ctx context.Context, msgs []Message) error
+}
+
+// ProducerFunc adapts a function to the Producer interface
+type ProducerFunc func(ctx context.Context, msgs []Message) error
+
+// Produce calls f
+func (f ProducerFunc) Produce(ctx context.Context, msgs []Message) error {
+	return f(ctx, msgs)
+}
+
+// New returns a sink producing events to topic through p
+func New(p Producer, topic string, cfg eventsink.Config) (*eventsink.Sink, error) {
+	if p == nil {
+		return nil, errors.New("nil_kafka_producer")
+	}
+
+	if topic == "" {
+		return nil, errors.New("empty_kafka_topic")
+	}
+
+	cfg = cfg.WithDefaults()
+
+	pub := eventsink.PublisherFunc(func(ctx context.Context, events []csd.Event) error {
+		msgs := make([]Message, 0, len(events))
+
+		for _, ev := range events {
+			value, err := cfg.Encoder(ev)
+			if err != nil {
+				return fmt.Errorf("encode event: %w", err)
+			}
+
+			msgs = append(msgs, Message{Topic: topic, Key: []byte(ev.Service), Value: value})
+		}
+
+		return p.Produce(ctx, msgs)
+	})
+
+	return eventsink.New(pub, cfg), nil
+}
@@ -0,0 +1,60 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/eventsink"
+	"github.com/flew1x/consul-service-discovery/eventsink/kafka"
+)
+
+func TestNew_ProducesKeyedMessages(t *testing.T) {
+	produced := make(chan []kafka.Message, 1)
+
+	producer := kafka.ProducerFunc(func(_ context.Context, msgs []kafka.Message) error {
+		produced <- msgs
+
+		return nil
+	})
+
+	sink, err := kafka.New(producer, "discovery", eventsink.Config{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go sink.Run(ctx)
+
+	sink.Handle(csd.Event{Type: csd.EventTargetSelected, Service: "users", Target: "10.0.0.5:9000"})
+
+	select {
+	case msgs := <-produced:
+		if len(msgs) != 1 || msgs[0].Topic != "discovery" || string(msgs[0].Key) != "users" {
+			t.Fatalf("messages = %+v", msgs)
+		}
+
+		var ev csd.Event
+		if err := json.Unmarshal(msgs[0].Value, &ev); err != nil || ev.Target != "10.0.0.5:9000" {
+			t.Errorf("value = %s (err %v)", msgs[0].Value, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing produced")
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	noop := kafka.ProducerFunc(func(context.Context, []kafka.Message) error { return nil })
+
+	if _, err := kafka.New(nil, "t", eventsink.Config{}); err == nil {
+		t.Error("expected error for nil producer")
+	}
+
+	if _, err := kafka.New(noop, "", eventsink.Config{}); err == nil {
+		t.Error("expected error for empty topic")
+	}
+}
@@ -0,0 +1,61 @@
+// Package nats publishes discovery events to NATS subjects named
+// <prefix>.<service>. *nats.Conn from github.com/nats-io/nats.go satisfies
+// Conn directly; each batch is flushed so the server has received it before
+// the events are acknowledged. Use a JetStream stream on the subjects for
+// durable at-least-once delivery.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/eventsink"
+)
+
+// Conn is the subset of *nats.Conn used by the sink
+type Conn interface {
+	Publish(subject string, data []byte) error
+	FlushWithContext(ctx context.Context) error
+}
+
+// New returns a sink publishing events to <prefix>.<service> through conn
+func New(conn Conn, prefix string, cfg eventsink.Config) (*eventsink.Sink, error) {
+	if conn == nil {
+		return nil, errors.New("nil_nats_conn")
+	}
+
+	if prefix == "" {
+		return nil, errors.New("empty_nats_subject_prefix")
+	}
+
+	cfg = cfg.WithDefaults()
+
+	pub := eventsink.PublisherFunc(func(ctx context.Context, events []csd.Event) error {
+		for _, ev := range events {
+			data, err := cfg.Encoder(ev)
+			if err != nil {
+				return fmt.Errorf("encode event: %w", err)
+			}
+
+			if err := conn.Publish(Subject(prefix, ev.Service), data); err != nil {
+				return fmt.Errorf("publish event: %w", err)
+			}
+		}
+
+		return conn.FlushWithContext(ctx)
+	})
+
+	return eventsink.New(pub, cfg), nil
+}
+
+// Subject returns the subject events of service are published to. Events
+// without a service go to <prefix>._
+func Subject(prefix, service string) string {
+	if service == "" {
+		service = "_"
+	}
+
+	return prefix + "." + service
+}
@@ -0,0 +1,85 @@
+package nats_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/eventsink"
+	"github.com/flew1x/consul-service-discovery/eventsink/nats"
+)
+
+// fakeConn records published messages
+type fakeConn struct {
+	mu       sync.Mutex
+	subjects []string
+	data     [][]byte
+	flushes  int
+}
+
+func (c *fakeConn) Publish(subject string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subjects = append(c.subjects, subject)
+	c.data = append(c.data, data)
+
+	return nil
+}
+
+func (c *fakeConn) FlushWithContext(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flushes++
+
+	return nil
+}
+
+func (c *fakeConn) published() ([]string, [][]byte, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.subjects...), append([][]byte(nil), c.data...), c.flushes
+}
+
+func TestNew_PublishesPerServiceSubjects(t *testing.T) {
+	conn := &fakeConn{}
+
+	sink, err := nats.New(conn, "discovery", eventsink.Config{BatchSize: 2, Encoder: eventsink.Proto})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go sink.Run(ctx)
+
+	sink.Handle(csd.Event{Type: csd.EventTargetSelected, Service: "users"})
+	sink.Handle(csd.Event{Type: csd.EventQueryError})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		subjects, data, flushes := conn.published()
+		if len(subjects) < 2 || flushes == 0 {
+			time.Sleep(5 * time.Millisecond)
+
+			continue
+		}
+
+		if subjects[0] != "discovery.users" || subjects[1] != "discovery._" {
+			t.Errorf("subjects = %v", subjects)
+		}
+
+		if ev, err := csd.UnmarshalEventProto(data[0]); err != nil || ev.Service != "users" {
+			t.Errorf("decoded %+v (err %v)", ev, err)
+		}
+
+		return
+	}
+
+	t.Fatal("events not published")
+}
@@ -0,0 +1,118 @@
+// Command discovery walks through discovery, failover and draining against a
+// Consul agent (CONSUL_HTTP_ADDR, default 127.0.0.1:8500). It registers
+// three local gRPC backends of the "example-echo" service, calls the service
+// through a ConnManager every second, and every few seconds drains the
+// instance it is connected to, so the manager fails over to another one:
+//
+//	docker run -d -p 8500:8500 hashicorp/consul agent -dev -client 0.0.0.0
+//	go run ./examples/discovery
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	csd "github.com/flew1x/consul-service-discovery"
+	"github.com/flew1x/consul-service-discovery/integration"
+)
+
+const (
+	service    = "example-echo"
+	drainEvery = 5 * time.Second
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger, _ := zap.NewDevelopment()
+	defer func() { _ = logger.Sync() }()
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		log.Fatalf("consul client: %v", err)
+	}
+
+	backends := make(map[string]*integration.Backend)
+
+	for range 3 {
+		b, err := integration.StartBackend(client, service)
+		if err != nil {
+			log.Fatalf("start backend: %v", err)
+		}
+		defer func() { _ = b.Stop() }()
+
+		backends[b.Target()] = b
+	}
+
+	mgr, err := csd.New(client, []string{service},
+		csd.WithLogger(logger),
+		csd.WithWaitTime(5*time.Second),
+	)
+	if err != nil {
+		log.Fatalf("conn manager: %v", err)
+	}
+	defer mgr.Stop()
+
+	mgr.Start(ctx)
+
+	calls := time.NewTicker(time.Second)
+	defer calls.Stop()
+
+	drains := time.NewTicker(drainEvery)
+	defer drains.Stop()
+
+	var drained *integration.Backend
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-calls.C:
+			call(ctx, mgr)
+		case <-drains.C:
+			target, ok := mgr.View().Target(service)
+			if !ok {
+				continue
+			}
+
+			// bring the previously drained backend back before draining the next
+			if drained != nil {
+				_ = drained.Undrain()
+			}
+
+			drained = backends[target]
+			if err := drained.Drain(); err != nil {
+				log.Printf("drain %s: %v", target, err)
+
+				continue
+			}
+
+			log.Printf("drained %s", target)
+		}
+	}
+}
+
+// call invokes the health service of the current instance
+func call(ctx context.Context, mgr *csd.ConnManager) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	target, _ := mgr.View().Target(service)
+
+	var resp healthpb.HealthCheckResponse
+	if err := mgr.Invoke(ctx, service, healthpb.Health_Check_FullMethodName, &healthpb.HealthCheckRequest{}, &resp); err != nil {
+		log.Printf("call failed: %v", err)
+
+		return
+	}
+
+	log.Printf("%s answered %s", target, resp.Status)
+}
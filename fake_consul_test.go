@@ -0,0 +1,363 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// fakeConsul is a minimal in-memory implementation of Consul's health
+// endpoint supporting blocking queries
+type fakeConsul struct {
+	mu       sync.Mutex
+	index    uint64
+	services map[string][]*api.ServiceEntry
+	kv       map[string][]byte
+	changed  chan struct{}
+	calls    map[string]int // endpoint -> requests, e.g. "txn"
+
+	// refuseAcquires is how many lock acquisitions fail next, as when a
+	// key is still held by another session
+	refuseAcquires int
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		index:    1,
+		services: make(map[string][]*api.ServiceEntry),
+		kv:       make(map[string][]byte),
+		changed:  make(chan struct{}),
+		calls:    make(map[string]int),
+	}
+}
+
+// testEntries returns health entries for service with one instance per port
+// on 127.0.0.1. Instance IDs are "<service>-<port>"
+func testEntries(service string, ports ...int) []*api.ServiceEntry {
+	entries := make([]*api.ServiceEntry, 0, len(ports))
+
+	for _, p := range ports {
+		entries = append(entries, &api.ServiceEntry{
+			Node: &api.Node{Node: "node-" + strconv.Itoa(p), Address: "127.0.0.1"},
+			Service: &api.AgentService{
+				ID:      service + "-" + strconv.Itoa(p),
+				Service: service,
+				Address: "127.0.0.1",
+				Port:    p,
+			},
+		})
+	}
+
+	return entries
+}
+
+// sharedIDEntries is testEntries registered without IDs, which Consul
+// defaults to the service name: the instances share it across nodes
+func sharedIDEntries(service string, ports ...int) []*api.ServiceEntry {
+	entries := testEntries(service, ports...)
+	for _, e := range entries {
+		e.Service.ID = service
+	}
+
+	return entries
+}
+
+// testRef returns the identity of the testEntries instance with the given ID
+func testRef(id string) instanceRef {
+	return instanceRef{node: "node-" + id[strings.LastIndex(id, "-")+1:], id: id}
+}
+
+// setInstances replaces the healthy instances of service with the given
+// ports on 127.0.0.1 and bumps the index
+func (f *fakeConsul) setInstances(service string, ports ...int) {
+	f.setEntries(service, testEntries(service, ports...))
+}
+
+// setEntries replaces the health entries of service and bumps the index
+func (f *fakeConsul) setEntries(service string, entries []*api.ServiceEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.services[service] = entries
+	f.bumpLocked()
+}
+
+// getKV returns the stored value of key
+func (f *fakeConsul) getKV(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	v, ok := f.kv[key]
+
+	return v, ok
+}
+
+// putKV stores value under key and bumps the index
+func (f *fakeConsul) putKV(key string, value []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.kv[key] = value
+	f.bumpLocked()
+}
+
+func (f *fakeConsul) bumpLocked() {
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if key, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/"); ok {
+		f.serveKV(w, r, key)
+
+		return
+	}
+
+	if op, ok := strings.CutPrefix(r.URL.Path, "/v1/session/"); ok {
+		f.serveSession(w, op)
+
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/health/state/any":
+		f.count("health/state")
+		f.serveState(w)
+
+		return
+	case "/v1/txn":
+		f.count("txn")
+		f.serveTxn(w, r)
+
+		return
+	}
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/v1/health/service/")
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	f.count("health/service")
+
+	if !f.block(r) {
+		return
+	}
+
+	f.mu.Lock()
+	entries, idx := f.services[name], f.index
+	f.mu.Unlock()
+
+	// with ?passing, entries without checks count as passing
+	out := []*api.ServiceEntry{}
+
+	for _, e := range entries {
+		if _, passing := r.URL.Query()["passing"]; !passing || len(e.Checks) == 0 || e.Checks.AggregatedStatus() == api.HealthPassing {
+			out = append(out, e)
+		}
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(idx, 10))
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeConsul) count(endpoint string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[endpoint]++
+}
+
+// callCount returns the requests served by endpoint
+func (f *fakeConsul) callCount(endpoint string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[endpoint]
+}
+
+// serveState lists the checks of every entry, node checks once per node
+func (f *fakeConsul) serveState(w http.ResponseWriter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	checks := api.HealthChecks{}
+	seen := make(map[string]bool)
+
+	for _, entries := range f.services {
+		for _, e := range entries {
+			for _, c := range e.Checks {
+				key := c.Node + "/" + c.CheckID
+				if !seen[key] {
+					seen[key] = true
+					checks = append(checks, c)
+				}
+			}
+		}
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	_ = json.NewEncoder(w).Encode(checks)
+}
+
+// serveTxn answers node and service get operations from the entries
+func (f *fakeConsul) serveTxn(w http.ResponseWriter, r *http.Request) {
+	var ops api.TxnOps
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resp api.TxnResponse
+
+	for i, op := range ops {
+		var found *api.TxnResult
+
+		for _, entries := range f.services {
+			for _, e := range entries {
+				switch {
+				case op.Node != nil && e.Node.Node == op.Node.Node.Node:
+					found = &api.TxnResult{Node: e.Node}
+				case op.Service != nil && e.Node.Node == op.Service.Node && e.Service.ID == op.Service.Service.ID:
+					found = &api.TxnResult{Service: e.Service}
+				}
+			}
+		}
+
+		if found == nil {
+			resp.Errors = append(resp.Errors, &api.TxnError{OpIndex: i, What: "not found"})
+
+			continue
+		}
+
+		resp.Results = append(resp.Results, found)
+	}
+
+	if len(resp.Errors) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		resp.Results = nil
+	}
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// block implements blocking-query semantics. It returns false when the
+// client went away
+func (f *fakeConsul) block(r *http.Request) bool {
+	waitIdx, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, err := time.ParseDuration(r.URL.Query().Get("wait"))
+	if err != nil {
+		wait = 5 * time.Minute
+	}
+
+	f.mu.Lock()
+	idx, changed := f.index, f.changed
+	f.mu.Unlock()
+
+	if waitIdx >= idx {
+		select {
+		case <-changed:
+		case <-time.After(wait):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+func (f *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case http.MethodPut:
+		if f.refuseAcquire(r) {
+			_, _ = w.Write([]byte("false"))
+
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		f.putKV(key, body)
+		_, _ = w.Write([]byte("true"))
+
+		return
+	case http.MethodDelete:
+		f.mu.Lock()
+		delete(f.kv, key)
+		f.bumpLocked()
+		f.mu.Unlock()
+		_, _ = w.Write([]byte("true"))
+
+		return
+	}
+
+	if !f.block(r) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, recurse := r.URL.Query()["recurse"]
+
+	pairs := api.KVPairs{}
+
+	for k, v := range f.kv {
+		if k == key || (recurse && strings.HasPrefix(k, key)) {
+			pairs = append(pairs, &api.KVPair{Key: k, Value: v, ModifyIndex: f.index})
+		}
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+
+	if len(pairs) == 0 && !recurse {
+		w.WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+// refuseAcquire reports whether the lock acquisition r must fail, see
+// refuseAcquires
+func (f *fakeConsul) refuseAcquire(r *http.Request) bool {
+	if _, ok := r.URL.Query()["acquire"]; !ok {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.refuseAcquires == 0 {
+		return false
+	}
+
+	f.refuseAcquires--
+
+	return true
+}
+
+// serveSession accepts session create/renew/destroy calls without tracking
+// key ownership
+func (f *fakeConsul) serveSession(w http.ResponseWriter, op string) {
+	switch {
+	case op == "create":
+		_, _ = w.Write([]byte(`{"ID":"session-1"}`))
+	case strings.HasPrefix(op, "renew/"):
+		_ = json.NewEncoder(w).Encode([]*api.SessionEntry{{ID: strings.TrimPrefix(op, "renew/"), TTL: "15s"}})
+	default:
+		_, _ = w.Write([]byte("true"))
+	}
+}
@@ -0,0 +1,176 @@
+package consul_service_discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+const (
+	promContentType = "text/plain; version=0.0.4; charset=utf-8"
+	jsonContentType = "application/json"
+)
+
+// ServiceStatus describes the client-side availability of a watched service
+type ServiceStatus struct {
+	Service   string             `json:"service"`
+	Target    string             `json:"target,omitempty"`
+	Connected bool               `json:"connected"`
+	Optional  bool               `json:"optional"`
+	Paused    bool               `json:"paused"`
+	State     connectivity.State `json:"-"`
+
+	CachedInstances int `json:"cached_instances"`
+	CacheBytes      int `json:"cache_bytes"` // estimated
+}
+
+// Up reports whether the dependency has a connection in the READY state
+func (s ServiceStatus) Up() bool {
+	return s.Connected && s.State == connectivity.Ready
+}
+
+// MarshalJSON renders the connectivity state as its string form and adds the
+// derived up flag for dashboards
+func (s ServiceStatus) MarshalJSON() ([]byte, error) {
+	type plain ServiceStatus
+
+	return json.Marshal(struct {
+		plain
+		State string `json:"state"`
+		Up    bool   `json:"up"`
+	}{plain(s), s.stateString(), s.Up()})
+}
+
+func (s ServiceStatus) stateString() string {
+	if !s.Connected {
+		return "NONE"
+	}
+
+	return s.State.String()
+}
+
+// Status returns the availability of every watched service in watch order
+func (cm *ConnManager) Status() []ServiceStatus {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	out := make([]ServiceStatus, 0, len(cm.watchList))
+
+	for _, svc := range cm.watchList {
+		st := ServiceStatus{
+			Service:         svc,
+			Optional:        cm.isOptional(svc),
+			Paused:          cm.Paused(svc),
+			CachedInstances: len(cm.instances[svc]),
+			CacheBytes:      estimateBytes(cm.instances[svc]),
+		}
+
+		if mc, ok := cm.conns[svc]; ok {
+			st.Target = mc.target
+			st.Connected = true
+			st.State = mc.conn.GetState()
+		} else if target, ok := cm.selected[svc]; ok {
+			st.Target = target // dry run or HTTP service
+		}
+
+		out = append(out, st)
+	}
+
+	return out
+}
+
+// HealthHandler returns an http.Handler rendering per-dependency availability.
+// It serves the Prometheus text exposition format by default and JSON when the
+// request carries ?format=json or an Accept header preferring application/json
+func (cm *ConnManager) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := cm.Status()
+
+		if wantsJSON(r) {
+			w.Header().Set("Content-Type", jsonContentType)
+			_ = json.NewEncoder(w).Encode(struct {
+				Dependencies []ServiceStatus `json:"dependencies"`
+			}{status})
+
+			return
+		}
+
+		w.Header().Set("Content-Type", promContentType)
+		_, _ = w.Write(renderPrometheus(status))
+	})
+}
+
+// PushHealth pushes the current dependency availability to a Prometheus
+// Pushgateway under the given job name, replacing previous values for the job.
+// Call it periodically from a ticker to keep the gateway up to date
+func (cm *ConnManager) PushHealth(ctx context.Context, gatewayURL, job string) error {
+	if job == "" {
+		return errors.New("empty_push_job")
+	}
+
+	endpoint := strings.TrimRight(gatewayURL, "/") + "/metrics/job/" + url.PathEscape(job)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(renderPrometheus(cm.Status())))
+	if err != nil {
+		return fmt.Errorf("build push request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", promContentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("push health: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("push health: unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// renderPrometheus formats statuses in the Prometheus text exposition format
+func renderPrometheus(status []ServiceStatus) []byte {
+	var b bytes.Buffer
+
+	b.WriteString("# HELP consul_sd_dependency_up Whether the dependency has a READY gRPC connection.\n")
+	b.WriteString("# TYPE consul_sd_dependency_up gauge\n")
+
+	for _, s := range status {
+		fmt.Fprintf(&b, "consul_sd_dependency_up{service=%q} %d\n", s.Service, boolToInt(s.Up()))
+	}
+
+	b.WriteString("# HELP consul_sd_dependency_connected Whether a gRPC connection exists for the dependency.\n")
+	b.WriteString("# TYPE consul_sd_dependency_connected gauge\n")
+
+	for _, s := range status {
+		fmt.Fprintf(&b, "consul_sd_dependency_connected{service=%q} %d\n", s.Service, boolToInt(s.Connected))
+	}
+
+	return b.Bytes()
+}
+
+// wantsJSON reports whether the request asked for the JSON representation
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+
+	return strings.HasPrefix(r.Header.Get("Accept"), jsonContentType)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
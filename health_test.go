@@ -0,0 +1,105 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newStatusManager returns a manager watching users and billing where only
+// users has a (not yet READY) connection
+func newStatusManager(t *testing.T) *ConnManager {
+	t.Helper()
+
+	conn, err := grpc.NewClient("127.0.0.1:1", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	cm := &ConnManager{
+		watchList:   []string{"users", "billing"},
+		conns:       map[string]*managedConn{"users": {target: "127.0.0.1:1", conn: conn}},
+		lastTargets: map[string]string{},
+	}
+	t.Cleanup(cm.CloseAll)
+
+	return cm
+}
+
+func TestHealthHandler_Prometheus(t *testing.T) {
+	cm := newStatusManager(t)
+
+	rec := httptest.NewRecorder()
+	cm.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		`consul_sd_dependency_up{service="users"} 0`,
+		`consul_sd_dependency_connected{service="users"} 1`,
+		`consul_sd_dependency_connected{service="billing"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
+
+func TestHealthHandler_JSON(t *testing.T) {
+	cm := newStatusManager(t)
+
+	rec := httptest.NewRecorder()
+	cm.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health?format=json", nil))
+
+	var got struct {
+		Dependencies []struct {
+			Service   string `json:"service"`
+			Connected bool   `json:"connected"`
+			State     string `json:"state"`
+			Up        bool   `json:"up"`
+		} `json:"dependencies"`
+	}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(got.Dependencies) != 2 {
+		t.Fatalf("got %d dependencies, want 2", len(got.Dependencies))
+	}
+
+	if d := got.Dependencies[1]; d.Service != "billing" || d.Connected || d.Up || d.State != "NONE" {
+		t.Errorf("unexpected billing status: %+v", d)
+	}
+}
+
+func TestPushHealth(t *testing.T) {
+	cm := newStatusManager(t)
+
+	var path, body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		path, body = r.URL.Path, string(b)
+	}))
+	defer srv.Close()
+
+	if err := cm.PushHealth(context.Background(), srv.URL, "orders"); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	if path != "/metrics/job/orders" {
+		t.Errorf("path = %q", path)
+	}
+
+	if !strings.Contains(body, "consul_sd_dependency_up") {
+		t.Errorf("unexpected body: %s", body)
+	}
+}
@@ -0,0 +1,155 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+)
+
+// maxProxyAttempts bounds the instances one proxied request is tried on
+const maxProxyAttempts = 3
+
+// ProxyDirector returns an httputil.ReverseProxy Director that routes
+// requests to the instance service is connected to, falling back to any
+// eligible instance. Instances are addressed by their registered address
+// and port (see WithPortFromMeta) over plain HTTP. Without eligible instances
+// the URL host is left empty and the proxy answers 502
+func (cm *ConnManager) ProxyDirector(service string) func(*http.Request) {
+	return func(req *http.Request) {
+		req.URL.Scheme = "http"
+		req.URL.Host = ""
+
+		if hosts := cm.proxyHosts(service); len(hosts) > 0 {
+			req.URL.Host = hosts[0]
+		}
+	}
+}
+
+// ReverseProxy returns a reverse proxy for service using ProxyDirector. A
+// request failing to reach an instance is retried on the next eligible one
+// when its body can be replayed and it is idempotent (by method or an
+// Idempotency-Key header) or the instance could not be dialed, so other
+// requests never run twice
+func (cm *ConnManager) ReverseProxy(service string) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director:  cm.ProxyDirector(service),
+		Transport: &proxyTransport{cm: cm, service: service, base: http.DefaultTransport},
+	}
+}
+
+// proxyHosts returns the host:port of the current instance of service
+// followed by the other eligible instances
+func (cm *ConnManager) proxyHosts(service string) []string {
+	topo := cm.loadTopology()
+	instances := cm.eligible(service, topo.instances[service])
+	hosts := make([]string, 0, len(instances))
+
+	var current instanceRef
+	if mc, ok := topo.conns[service]; ok {
+		current = mc.ref()
+	}
+
+	for _, inst := range instances {
+		port, err := cm.portFor(inst)
+		if err != nil {
+			continue
+		}
+
+		host := net.JoinHostPort(inst.Address, strconv.Itoa(port))
+
+		if inst.ref() == current {
+			hosts = append([]string{host}, hosts...)
+		} else {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts
+}
+
+// proxyTransport retries requests that fail to reach an instance on the
+// next eligible one
+type proxyTransport struct {
+	cm      *ConnManager
+	service string
+	base    http.RoundTripper
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrConnNotFound, t.service)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil || !replayable(req) {
+		return resp, err
+	}
+
+	tried := map[string]struct{}{req.URL.Host: {}}
+
+	for _, host := range t.cm.proxyHosts(t.service) {
+		if len(tried) >= maxProxyAttempts || req.Context().Err() != nil || !retryable(req, err) {
+			break
+		}
+
+		if _, ok := tried[host]; ok {
+			continue
+		}
+
+		tried[host] = struct{}{}
+
+		retry, rerr := retryRequest(req, host)
+		if rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+
+		if resp, err = t.base.RoundTrip(retry); err == nil {
+			return resp, nil
+		}
+	}
+
+	return nil, err
+}
+
+// replayable reports whether req can be sent again
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryable reports whether req may be sent to another instance after
+// failing with err: idempotent requests always, others only when they
+// cannot have reached the instance
+func retryable(req *http.Request, err error) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	if req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != "" {
+		return true
+	}
+
+	var opErr *net.OpError
+
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryRequest clones req for host with a fresh body
+func retryRequest(req *http.Request, host string) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	out.URL.Host = host
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		out.Body = body
+	}
+
+	return out, nil
+}
@@ -0,0 +1,158 @@
+package consul_service_discovery
+
+import (
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// startHTTPServer serves a fixed body and returns its port
+func startHTTPServer(t *testing.T, body string) int {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestProxyDirector_CurrentInstance(t *testing.T) {
+	a, b := startHTTPServer(t, "a"), startHTTPServer(t, "b")
+	cm := newTestManager(t, []string{"web"}, WithInstanceID("web", "web-"+strconv.Itoa(b)))
+
+	if err := cm.refresh(t.Context(), "web", testEntries("web", a, b)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	cm.ProxyDirector("web")(req)
+
+	if want := "127.0.0.1:" + strconv.Itoa(b); req.URL.Host != want || req.URL.Scheme != "http" {
+		t.Errorf("url = %s, want http://%s", req.URL, want)
+	}
+}
+
+// startDroppingServer accepts HTTP requests and closes the connection
+// without answering, failing them after they reached the instance
+func startDroppingServer(t *testing.T) (port int, hits *atomic.Int32) {
+	t.Helper()
+
+	hits = &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_ = conn.Close()
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.Listener.Addr().(*net.TCPAddr).Port, hits
+}
+
+// proxyTo sends a request for path with method and body through the
+// transport of the reverse proxy for service, to port first
+func proxyTo(t *testing.T, cm *ConnManager, service string, port int, method, body string, header http.Header) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "http://127.0.0.1:"+strconv.Itoa(port)+"/", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	maps.Copy(req.Header, header)
+
+	resp, err := cm.ReverseProxy(service).Transport.RoundTrip(req)
+	if err == nil {
+		t.Cleanup(func() { _ = resp.Body.Close() })
+	}
+
+	return resp, err
+}
+
+func TestReverseProxy_RetriesNextInstance(t *testing.T) {
+	dead, live := closedPort(t), startHTTPServer(t, "live")
+	cm := newTestManager(t, []string{"web"})
+
+	if err := cm.refresh(t.Context(), "web", testEntries("web", dead, live)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// not dialed: even a POST is safe to send elsewhere
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		resp, err := proxyTo(t, cm, "web", dead, method, "body", nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: response %v, %v; want 200 from the live instance", method, resp, err)
+		}
+	}
+}
+
+func TestReverseProxy_RetriesOnlyIdempotent(t *testing.T) {
+	dropping, hits := startDroppingServer(t)
+	live := startHTTPServer(t, "live")
+	cm := newTestManager(t, []string{"web"})
+
+	if err := cm.refresh(t.Context(), "web", testEntries("web", dropping, live)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := proxyTo(t, cm, "web", dropping, http.MethodPost, "charge", nil); err == nil {
+		t.Error("POST that reached an instance was retried")
+	}
+
+	retried := []struct {
+		method string
+		header http.Header
+	}{
+		{http.MethodPut, nil},
+		{http.MethodPost, http.Header{"Idempotency-Key": {"k1"}}},
+	}
+
+	for _, tc := range retried {
+		resp, err := proxyTo(t, cm, "web", dropping, tc.method, "charge", tc.header)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("%s %v: response %v, %v; want 200 from the live instance", tc.method, tc.header, resp, err)
+		}
+	}
+
+	if n := hits.Load(); n != 3 {
+		t.Errorf("dropping instance got %d requests, want 3", n)
+	}
+}
+
+func TestProxyHosts_EligiblePorts(t *testing.T) {
+	cm := newTestManager(t, []string{"web"}, WithPortFromMeta("http_port"), WithInstanceID("web", "web-9002"))
+
+	entries := testEntries("web", 9001, 9002)
+	for _, e := range entries {
+		e.Service.Meta = map[string]string{"http_port": strconv.Itoa(e.Service.Port + 1000)}
+	}
+
+	if err := cm.refresh(t.Context(), "web", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if hosts := cm.proxyHosts("web"); !slices.Equal(hosts, []string{"127.0.0.1:10002"}) {
+		t.Errorf("hosts = %v, want only the pinned instance on its meta port", hosts)
+	}
+}
+
+func TestReverseProxy_NoInstances(t *testing.T) {
+	cm := newTestManager(t, []string{"web"})
+
+	rec := httptest.NewRecorder()
+	cm.ReverseProxy("web").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("code = %d, want 502", rec.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/credentials"
+)
+
+// ErrPeerIdentityMismatch is returned by handshakes whose server certificate
+// does not carry the identity expected for the service
+var ErrPeerIdentityMismatch = errors.New("peer_identity_mismatch")
+
+// WithPeerIdentity secures connections to service with creds and, after each
+// TLS handshake, requires the server certificate to carry one of ids as a DNS
+// or URI SAN (e.g. "spiffe://example.org/ns/default/svc/users"). On mismatch
+// the handshake fails, EventIdentityMismatch is emitted and the instance is
+// excluded from selection until it leaves the healthy set. This guards
+// against stale entries pointing at recycled IPs now serving another workload
+func WithPeerIdentity(service string, creds credentials.TransportCredentials, ids ...string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if creds == nil {
+			return errors.New("nil_transport_credentials")
+		}
+
+		if len(ids) == 0 {
+			return errors.New("no_peer_identities")
+		}
+
+		cm.peerCreds[service] = &identityCreds{TransportCredentials: creds, cm: cm, service: service, ids: ids}
+
+		return nil
+	}
+}
+
+// identityCreds wraps transport credentials with a peer identity check
+type identityCreds struct {
+	credentials.TransportCredentials
+
+	cm      *ConnManager
+	service string
+	ids     []string
+	inst    instanceRef // dialed instance, zero for pinned targets
+}
+
+// forInstance returns a copy of c attributing mismatches to inst, which
+// the address reached may not identify (proxies, tunnels, node names)
+func (c *identityCreds) forInstance(inst Instance) *identityCreds {
+	bound := *c
+	bound.inst = inst.ref()
+
+	return &bound
+}
+
+func (c *identityCreds) ClientHandshake(ctx context.Context, authority string, raw net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.verify(info); err != nil {
+		_ = conn.Close()
+		c.cm.rejectPeer(c.service, c.inst, raw.RemoteAddr().String(), err)
+
+		return nil, nil, err
+	}
+
+	return conn, info, nil
+}
+
+func (c *identityCreds) Clone() credentials.TransportCredentials {
+	return &identityCreds{TransportCredentials: c.TransportCredentials.Clone(), cm: c.cm, service: c.service, ids: c.ids, inst: c.inst}
+}
+
+// verify checks the leaf certificate SANs against the expected identities
+func (c *identityCreds) verify(info credentials.AuthInfo) error {
+	tlsInfo, ok := info.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return fmt.Errorf("%w: %s: no peer certificate", ErrPeerIdentityMismatch, c.service)
+	}
+
+	leaf := tlsInfo.State.PeerCertificates[0]
+
+	names := slices.Clone(leaf.DNSNames)
+	for _, u := range leaf.URIs {
+		names = append(names, u.String())
+	}
+
+	for _, name := range names {
+		if slices.Contains(c.ids, name) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s: certificate identities %v", ErrPeerIdentityMismatch, c.service, names)
+}
+
+// rejectPeer excludes the dialed instance inst of service, reached at addr,
+// from selection and triggers a new selection. Pinned targets have no
+// instance to exclude and are only reported
+func (cm *ConnManager) rejectPeer(service string, inst instanceRef, addr string, err error) {
+	if inst == (instanceRef{}) {
+		cm.logger.Error("peer identity mismatch", zap.String("service", service), zap.String("addr", addr), zap.Error(err))
+		cm.emit(Event{Type: EventIdentityMismatch, Service: service, Target: addr, Err: err})
+
+		return
+	}
+
+	cm.mu.Lock()
+	if cm.rejectedPeers[service] == nil {
+		cm.rejectedPeers[service] = make(map[instanceRef]struct{})
+	}
+	cm.rejectedPeers[service][inst] = struct{}{}
+	cm.mu.Unlock()
+
+	cm.logger.Error("peer identity mismatch, evicting instance",
+		zap.String("service", service),
+		zap.String("instance", inst.id),
+		zap.String("node", inst.node),
+		zap.String("addr", addr),
+		zap.Error(err),
+	)
+	cm.emit(Event{Type: EventIdentityMismatch, Service: service, Target: addr, InstanceID: inst.id, Node: inst.node, Err: err})
+	cm.kick(service)
+}
+
+// withoutRejected drops instances of service that failed identity checks
+func (cm *ConnManager) withoutRejected(service string, instances []Instance) []Instance {
+	cm.mu.RLock()
+	rejected := cm.rejectedPeers[service]
+	cm.mu.RUnlock()
+
+	if len(rejected) == 0 {
+		return instances
+	}
+
+	out := make([]Instance, 0, len(instances))
+
+	for _, inst := range instances {
+		if _, bad := rejected[inst.ref()]; !bad {
+			out = append(out, inst)
+		}
+	}
+
+	return out
+}
+
+// pruneRejectedLocked forgets rejected instances no longer among instances;
+// callers hold cm.mu
+func (cm *ConnManager) pruneRejectedLocked(service string, instances []Instance) {
+	rejected := cm.rejectedPeers[service]
+	if len(rejected) == 0 {
+		return
+	}
+
+	for ref := range rejected {
+		if _, ok := findInstance(instances, ref); !ok {
+			delete(rejected, ref)
+		}
+	}
+}
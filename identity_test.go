@@ -0,0 +1,114 @@
+package consul_service_discovery
+
+import (
+	"crypto/tls"
+	"errors"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+)
+
+func TestPeerIdentity_EvictsMismatchedInstance(t *testing.T) {
+	good, pool := newTestCert(t, []string{"users.internal"}, "spiffe://test/svc/users")
+	bad, _ := newTestCert(t, []string{"users.internal"}, "spiffe://test/svc/orders")
+	pool.AddCert(bad.Leaf)
+
+	goodPort := startTLSServer(t, good)
+	badPort := startTLSServer(t, bad)
+
+	rec := &eventRecorder{}
+	cm := newTestManager(t, []string{"users"},
+		WithPeerIdentity("users", credentials.NewTLS(&tls.Config{RootCAs: pool}), "spiffe://test/svc/users"),
+		WithServerNameStrategy(ServerNameFixed("users.internal")),
+		WithEventHandler(rec.handle),
+	)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", badPort)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := checkHealth(t, cm, "users"); err == nil {
+		t.Fatal("expected identity mismatch to fail the RPC")
+	}
+
+	var mismatch *Event
+	for _, ev := range rec.events {
+		if ev.Type == EventIdentityMismatch {
+			mismatch = &ev
+		}
+	}
+
+	if mismatch == nil || !errors.Is(mismatch.Err, ErrPeerIdentityMismatch) {
+		t.Fatalf("events = %v, want identity mismatch", rec.types())
+	}
+
+	all := instancesFromEntries(testEntries("users", goodPort, badPort))
+	for range 20 {
+		if inst, ok := cm.selectInstance("users", all); !ok || inst.Port != goodPort {
+			t.Fatalf("selected %+v, want the instance with the expected identity", inst)
+		}
+	}
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", goodPort)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := checkHealth(t, cm, "users"); err != nil {
+		t.Errorf("health check against matching identity: %v", err)
+	}
+
+	if len(cm.rejectedPeers["users"]) != 0 {
+		t.Error("rejected address should be forgotten once it leaves the healthy set")
+	}
+}
+
+func TestPeerIdentity_EvictsDialedInstance(t *testing.T) {
+	good, pool := newTestCert(t, []string{"users.internal"}, "spiffe://test/svc/users")
+	bad, _ := newTestCert(t, []string{"users.internal"}, "spiffe://test/svc/orders")
+	pool.AddCert(bad.Leaf)
+
+	// instances are reached elsewhere than their registered address, as
+	// through a proxy, a tunnel or a node name
+	reached := map[int]int{9001: startTLSServer(t, bad), 9002: startTLSServer(t, good)}
+
+	cm := newTestManager(t, []string{"users"},
+		WithPeerIdentity("users", credentials.NewTLS(&tls.Config{RootCAs: pool}), "spiffe://test/svc/users"),
+		WithServerNameStrategy(ServerNameFixed("users.internal")),
+		WithTargetBuilder(func(inst Instance) string {
+			return "127.0.0.1:" + strconv.Itoa(reached[inst.Port])
+		}),
+	)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := checkHealth(t, cm, "users"); err == nil {
+		t.Fatal("expected identity mismatch to fail the RPC")
+	}
+
+	all := instancesFromEntries(testEntries("users", 9001, 9002))
+	for range 20 {
+		if inst, ok := cm.selectInstance("users", all); !ok || inst.Port != 9002 {
+			t.Fatalf("selected %+v, want the instance with the expected identity", inst)
+		}
+	}
+}
+
+func TestWithPeerIdentity_Validation(t *testing.T) {
+	creds := credentials.NewTLS(&tls.Config{})
+
+	cases := []Option{
+		WithPeerIdentity("other", creds, "spiffe://x"),
+		WithPeerIdentity("users", nil, "spiffe://x"),
+		WithPeerIdentity("users", creds),
+	}
+
+	for i, opt := range cases {
+		cm := newTestManager(t, []string{"users"})
+		if err := opt(cm); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
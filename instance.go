@@ -0,0 +1,346 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// ErrInstanceNotFound is returned when a requested instance is not among the
+// healthy instances of a service
+var ErrInstanceNotFound = errors.New("service_instance_not_found")
+
+// ErrAmbiguousInstanceID is returned when a requested service ID is
+// registered by healthy instances on several nodes; see GetConnByInstance
+var ErrAmbiguousInstanceID = errors.New("ambiguous_service_instance_id")
+
+// Instance is a healthy service instance as last reported by Consul
+type Instance struct {
+	ID         string
+	Service    string
+	Node       string
+	Address    string // service address, falling back to the node address
+	Port       int
+	Tags       []string
+	Meta       map[string]string
+	NodeMeta   map[string]string
+	Datacenter string
+	Partition  string  // Enterprise admin partition, when not the default
+	Peer       string  // cluster peer the instance was imported from
+	Cluster    string  // secondary cluster it was found in, see WithSecondaryCluster
+	Load       float64 // from WithCheckInterpreter, 0 when unknown
+
+	VirtualAddress string // mesh virtual host:port of the service, if assigned
+
+	// lan_ipv4 and lan_ipv6 tagged addresses, from the service or else the
+	// node, if registered; see WithDualStack
+	IPv4 string
+	IPv6 string
+
+	// Raft indices of the registration; CreateIndex changes only when the
+	// instance is registered anew
+	CreateIndex uint64
+	ModifyIndex uint64
+	// FirstSeen is when the manager first saw the instance in the healthy
+	// set, kept across refreshes until the instance leaves it
+	FirstSeen time.Time
+}
+
+// instanceRef identifies an instance. Consul service IDs are only unique
+// per node, and default to the service name when none was registered
+type instanceRef struct {
+	node, id string
+}
+
+func (inst Instance) ref() instanceRef {
+	return instanceRef{node: inst.Node, id: inst.ID}
+}
+
+// instanceKey identifies a per-instance connection
+type instanceKey struct {
+	service string
+	instanceRef
+	port string // named port, see WithNamedPort; empty for the dial port
+}
+
+// WithInstanceID pins a service to the Consul instance with the given service
+// ID, e.g. to replay traffic against one replica while debugging. While the
+// instance is not healthy the service has no connection. When several nodes
+// register the ID, selection picks among them
+func WithInstanceID(service, id string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if id == "" {
+			return errors.New("empty_instance_id")
+		}
+
+		cm.pinnedInstances[service] = id
+
+		return nil
+	}
+}
+
+// Instances returns the healthy instances of service from the last Consul
+// response. The returned slice is a copy
+func (cm *ConnManager) Instances(service string) ([]Instance, error) {
+	if err := cm.checkWatched(service); err != nil {
+		return nil, err
+	}
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return slices.Clone(cm.instances[service]), nil
+}
+
+// GetConnByInstanceID returns a connection to one specific instance of
+// service, dialing it on first use. Such connections are closed once the
+// instance leaves the healthy set. Callers should not Close the returned
+// connection. It fails with ErrAmbiguousInstanceID when healthy instances
+// on several nodes share the ID
+func (cm *ConnManager) GetConnByInstanceID(service, id string) (*grpc.ClientConn, error) {
+	inst, err := instanceByID(cm.loadTopology().instances[service], service, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return cm.instanceConn(instanceKey{service: service, instanceRef: inst.ref()})
+}
+
+// GetConnByInstance is GetConnByInstanceID for inst, as returned by
+// Instances or View, identified by its node and ID
+func (cm *ConnManager) GetConnByInstance(service string, inst Instance) (*grpc.ClientConn, error) {
+	return cm.instanceConn(instanceKey{service: service, instanceRef: inst.ref()})
+}
+
+// instanceConn returns the per-instance connection for key, dialing it on
+// first use
+func (cm *ConnManager) instanceConn(key instanceKey) (*grpc.ClientConn, error) {
+	service, id := key.service, key.id
+
+	if cm.dryRun {
+		return nil, dryRunConnError(service)
+	}
+
+	cm.mu.RLock()
+	if mc, ok := cm.conns[service]; ok && mc.ref() == key.instanceRef && key.port == "" {
+		cm.mu.RUnlock()
+
+		return mc.conn, nil
+	}
+
+	if mc, ok := cm.instanceConns[key]; ok {
+		cm.mu.RUnlock()
+		mc.lastUsed.Store(time.Now().UnixNano())
+
+		return mc.conn, nil
+	}
+
+	inst, found := findInstance(cm.instances[service], key.instanceRef)
+	cm.mu.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("%w: %s/%s", ErrInstanceNotFound, service, id)
+	}
+
+	if key.port != "" {
+		var err error
+		if inst, err = cm.namedPortInstance(service, inst, key.port); err != nil {
+			return nil, err
+		}
+	}
+
+	mc, err := cm.dialInstance(service, inst)
+	if err != nil {
+		return nil, err
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	// Another caller may have won the race, or the instance may have gone
+	if existing, ok := cm.instanceConns[key]; ok {
+		_ = cm.releaseLocked(mc.conn)
+		existing.lastUsed.Store(time.Now().UnixNano())
+
+		return existing.conn, nil
+	}
+
+	if _, ok := findInstance(cm.instances[service], key.instanceRef); !ok {
+		_ = cm.releaseLocked(mc.conn)
+
+		return nil, fmt.Errorf("%w: %s/%s", ErrInstanceNotFound, service, id)
+	}
+
+	if err := cm.reserveConnLocked(); err != nil {
+		_ = cm.releaseLocked(mc.conn)
+
+		return nil, err
+	}
+
+	mc.lastUsed.Store(time.Now().UnixNano())
+	cm.instanceConns[key] = mc
+
+	return mc.conn, nil
+}
+
+// setInstances records the healthy set for service and closes per-instance
+// connections to instances that left it
+func (cm *ConnManager) setInstances(service string, instances []Instance) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cm.instances[service] = instances
+	cm.storeTopologyLocked()
+	cm.metrics.SetGauge(MetricCacheBytes, float64(estimateBytes(instances)), serviceLabel(service))
+	cm.pruneRejectedLocked(service, instances)
+	cm.signals.prune(service, instances)
+
+	for key, mc := range cm.instanceConns {
+		if key.service != service {
+			continue
+		}
+
+		if _, ok := findInstance(instances, key.instanceRef); !ok {
+			if err := cm.releaseLocked(mc.conn); err != nil {
+				cm.logger.Warn("close instance conn", zap.String("service", service), zap.String("instance", key.id), zap.Error(err))
+			}
+
+			delete(cm.instanceConns, key)
+		}
+	}
+}
+
+// eligible returns the instances selection may choose from
+func (cm *ConnManager) eligible(service string, instances []Instance) []Instance {
+	if id, ok := cm.pinnedInstances[service]; ok {
+		if pinned := withID(instances, id); len(pinned) > 0 {
+			return pinned
+		}
+
+		cm.logger.Warn("pinned instance not healthy", zap.String("service", service), zap.String("instance", id))
+
+		return nil
+	}
+
+	instances = cm.withoutRejected(service, instances)
+	instances = cm.withoutLost(service, instances)
+	instances = cm.withoutDuplicates(service, instances)
+	instances = cm.withoutOverloaded(service, instances)
+
+	if inst, ok := cm.mirroredInstance(service, instances); ok {
+		return []Instance{inst}
+	}
+
+	return instances
+}
+
+func instancesFromEntries(entries []*api.ServiceEntry) []Instance {
+	out := make([]Instance, 0, len(entries))
+
+	for _, e := range entries {
+		out = append(out, instanceFromEntry(e))
+	}
+
+	return out
+}
+
+func instanceFromEntry(e *api.ServiceEntry) Instance {
+	inst := Instance{
+		ID:        e.Service.ID,
+		Service:   e.Service.Service,
+		Address:   e.Service.Address,
+		Port:      e.Service.Port,
+		Tags:      e.Service.Tags,
+		Meta:      e.Service.Meta,
+		Partition: e.Service.Partition,
+		Peer:      e.Service.PeerName,
+
+		VirtualAddress: virtualAddress(e),
+
+		CreateIndex: e.Service.CreateIndex,
+		ModifyIndex: e.Service.ModifyIndex,
+	}
+
+	inst.IPv4, inst.IPv6 = taggedIPs(e)
+
+	if e.Node != nil {
+		inst.Node = e.Node.Node
+		inst.NodeMeta = e.Node.Meta
+		inst.Datacenter = e.Node.Datacenter
+
+		if inst.Address == "" {
+			inst.Address = e.Node.Address
+		}
+	}
+
+	return inst
+}
+
+// carryFirstSeen sets FirstSeen of next from the matching instance in prev,
+// or to now for instances new to the healthy set
+func carryFirstSeen(prev, next []Instance, now time.Time) {
+	seen := make(map[instanceRef]time.Time, len(prev))
+	for _, inst := range prev {
+		seen[inst.ref()] = inst.FirstSeen
+	}
+
+	for i := range next {
+		if t, ok := seen[next[i].ref()]; ok && !t.IsZero() {
+			next[i].FirstSeen = t
+		} else {
+			next[i].FirstSeen = now
+		}
+	}
+}
+
+// findInstance returns the instance of instances identified by ref
+func findInstance(instances []Instance, ref instanceRef) (Instance, bool) {
+	for _, inst := range instances {
+		if inst.ref() == ref {
+			return inst, true
+		}
+	}
+
+	return Instance{}, false
+}
+
+// withID returns the instances registered under the service ID id, on any
+// node
+func withID(instances []Instance, id string) []Instance {
+	var out []Instance
+
+	for _, inst := range instances {
+		if inst.ID == id {
+			out = append(out, inst)
+		}
+	}
+
+	return out
+}
+
+// instanceByID returns the only instance of service registered under id
+func instanceByID(instances []Instance, service, id string) (Instance, error) {
+	switch found := withID(instances, id); len(found) {
+	case 0:
+		return Instance{}, fmt.Errorf("%w: %s/%s", ErrInstanceNotFound, service, id)
+	case 1:
+		return found[0], nil
+	default:
+		nodes := make([]string, len(found))
+		for i, inst := range found {
+			nodes[i] = inst.Node
+		}
+
+		return Instance{}, fmt.Errorf("%w: %s/%s on nodes %s", ErrAmbiguousInstanceID, service, id, strings.Join(nodes, ", "))
+	}
+}
@@ -0,0 +1,241 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func newTestManager(t testing.TB, services []string, opts ...Option) *ConnManager {
+	t.Helper()
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatalf("consul client: %v", err)
+	}
+
+	cm, err := New(client, services, opts...)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	t.Cleanup(cm.Stop)
+
+	return cm
+}
+
+func TestRefresh_PinnedInstance(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithInstanceID("svc", "svc-9002"))
+
+	for range 10 {
+		if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9002, 9003)); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if mc := cm.conns["svc"]; mc == nil || mc.instanceID != "svc-9002" {
+			t.Fatalf("selected %+v, want pinned svc-9002", mc)
+		}
+	}
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9003)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("svc"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("expected no conn while pinned instance is unhealthy, got %v", err)
+	}
+}
+
+func TestRefresh_RegistrationAge(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	entries := testEntries("svc", 9001)
+	entries[0].Service.CreateIndex = 10
+	entries[0].Service.ModifyIndex = 12
+
+	if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	instances, _ := cm.Instances("svc")
+	first := instances[0]
+
+	if first.CreateIndex != 10 || first.ModifyIndex != 12 || first.FirstSeen.IsZero() {
+		t.Fatalf("instance = %+v, want indices and FirstSeen", first)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if err := cm.refresh(t.Context(), "svc", append(entries, testEntries("svc", 9002)...)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	instances, _ = cm.Instances("svc")
+
+	if !instances[0].FirstSeen.Equal(first.FirstSeen) {
+		t.Errorf("FirstSeen of a known instance moved to %v", instances[0].FirstSeen)
+	}
+
+	if !instances[1].FirstSeen.After(first.FirstSeen) {
+		t.Errorf("FirstSeen of a new instance = %v, want after %v", instances[1].FirstSeen, first.FirstSeen)
+	}
+}
+
+func TestGetConnByInstanceID(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithInstanceID("svc", "svc-9001"))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	primary, _ := cm.GetConn("svc")
+
+	if conn, err := cm.GetConnByInstanceID("svc", "svc-9001"); err != nil || conn != primary {
+		t.Errorf("selected instance should reuse the service conn: %v", err)
+	}
+
+	conn, err := cm.GetConnByInstanceID("svc", "svc-9002")
+	if err != nil {
+		t.Fatalf("get by instance: %v", err)
+	}
+
+	if again, _ := cm.GetConnByInstanceID("svc", "svc-9002"); again != conn {
+		t.Error("instance conn should be cached")
+	}
+
+	if _, err := cm.GetConnByInstanceID("svc", "svc-9999"); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("err = %v, want ErrInstanceNotFound", err)
+	}
+
+	// instance leaves the healthy set: its conn is closed and forgotten
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, ok := cm.instanceConns[instanceKey{service: "svc", instanceRef: testRef("svc-9002")}]; ok {
+		t.Error("instance conn should be pruned")
+	}
+
+	if got, _ := cm.Instances("svc"); len(got) != 1 || got[0].ID != "svc-9001" {
+		t.Errorf("instances = %+v", got)
+	}
+}
+
+func TestGetConnMap_PartialResults(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing", "orders"})
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	conns, err := cm.GetConnMap("users", "billing", "orders")
+	if len(conns) != 1 || conns["users"] == nil {
+		t.Errorf("conns = %v, want only users", conns)
+	}
+
+	var missing *MissingServicesError
+	if !errors.As(err, &missing) || len(missing.Services) != 2 {
+		t.Fatalf("err = %v, want MissingServicesError for 2 services", err)
+	}
+
+	if !errors.Is(err, ErrConnNotFound) {
+		t.Error("MissingServicesError should match ErrConnNotFound")
+	}
+}
+
+func TestGetConnAny_Preference(t *testing.T) {
+	cm := newTestManager(t, []string{"users-local", "users-global"})
+
+	if err := cm.refresh(t.Context(), "users-global", testEntries("users-global", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, svc, err := cm.GetConnAny(ctx, "users-local", "users-global")
+	if err != nil || svc != "users-global" {
+		t.Fatalf("got %q, %v; want users-global fallback", svc, err)
+	}
+
+	if err := cm.refresh(t.Context(), "users-local", testEntries("users-local", 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, svc, _ = cm.GetConnAny(ctx, "users-local", "users-global"); svc != "users-local" {
+		t.Errorf("got %q, want preferred users-local", svc)
+	}
+}
+
+func TestGetConnAny_WaitsForConnection(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = cm.refresh(t.Context(), "users", testEntries("users", 9001))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, _, err := cm.GetConnAny(ctx, "users"); err != nil {
+		t.Errorf("get any: %v", err)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+
+	if _, _, err := cm.GetConnAny(short, "billing"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("err = %v, want ErrConnNotFound", err)
+	}
+}
+
+func TestGetConnByInstance_SharedID(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := cm.refresh(t.Context(), "svc", sharedIDEntries("svc", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConnByInstanceID("svc", "svc"); !errors.Is(err, ErrAmbiguousInstanceID) {
+		t.Errorf("err = %v, want ErrAmbiguousInstanceID", err)
+	}
+
+	instances, _ := cm.Instances("svc")
+	conns := make(map[string]bool)
+
+	for _, inst := range instances {
+		conn, err := cm.GetConnByInstance("svc", inst)
+		if err != nil {
+			t.Fatalf("get %s on %s: %v", inst.ID, inst.Node, err)
+		}
+
+		conns[conn.Target()] = true
+	}
+
+	if len(conns) != 2 {
+		t.Errorf("conns = %v, want one per node", conns)
+	}
+
+	if _, ok := cm.View().GetInstance("svc", "svc"); ok {
+		t.Error("View.GetInstance should not pick among nodes")
+	}
+}
+
+func TestCarryFirstSeen_SharedID(t *testing.T) {
+	earlier := time.Now().Add(-time.Hour)
+	now := time.Now()
+
+	prev := instancesFromEntries(sharedIDEntries("svc", 9001))
+	prev[0].FirstSeen = earlier
+
+	next := instancesFromEntries(sharedIDEntries("svc", 9001, 9002))
+	carryFirstSeen(prev, next, now)
+
+	if !next[0].FirstSeen.Equal(earlier) || !next[1].FirstSeen.Equal(now) {
+		t.Errorf("first seen = %v, %v; want the instance on the new node to be new", next[0].FirstSeen, next[1].FirstSeen)
+	}
+}
@@ -0,0 +1,116 @@
+// Package integration runs consul_service_discovery end to end against a
+// real Consul agent. Backend registers a small gRPC health server with a TTL
+// check, and Harness wires backends and managers into a test. The agent
+// comes from CONSUL_HTTP_ADDR, so it can be started any way, e.g.
+//
+//	docker run -d -p 8500:8500 hashicorp/consul agent -dev -client 0.0.0.0
+//	CONSUL_HTTP_ADDR=127.0.0.1:8500 go test -tags integration ./integration
+//
+// or, with integration/containers, a separate module, by testcontainers-go.
+// Run takes the harness constructor so both share the suite. TTL checks keep
+// the agent from having to reach backends running on the host, which a
+// containerized agent usually cannot
+package integration
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// backendTTL is the TTL of a backend check. Backends never let it lapse
+// while passing: Pass, Fail and Drain set their state explicitly
+const backendTTL = 10 * time.Minute
+
+// Backend is a gRPC health server on 127.0.0.1 registered with the agent
+type Backend struct {
+	ID      string
+	Service string
+	Port    int
+
+	client *api.Client
+	srv    *grpc.Server
+}
+
+// StartBackend serves the gRPC health service on a loopback port and
+// registers it as an instance of service with a passing TTL check
+func StartBackend(client *api.Client, service string) (*Backend, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	b := &Backend{
+		Service: service,
+		Port:    ln.Addr().(*net.TCPAddr).Port,
+		client:  client,
+		srv:     grpc.NewServer(),
+	}
+	b.ID = service + "-" + strconv.Itoa(b.Port)
+
+	healthpb.RegisterHealthServer(b.srv, health.NewServer())
+
+	go func() { _ = b.srv.Serve(ln) }()
+
+	err = client.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		ID:      b.ID,
+		Name:    service,
+		Address: "127.0.0.1",
+		Port:    b.Port,
+		Check: &api.AgentServiceCheck{
+			CheckID: b.checkID(),
+			TTL:     backendTTL.String(),
+			Status:  api.HealthPassing,
+		},
+	})
+	if err != nil {
+		b.srv.Stop()
+
+		return nil, fmt.Errorf("register %s: %w", b.ID, err)
+	}
+
+	return b, nil
+}
+
+func (b *Backend) checkID() string {
+	return b.ID + ":ttl"
+}
+
+// Target returns the address the manager dials for the backend
+func (b *Backend) Target() string {
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(b.Port))
+}
+
+// Pass marks the backend healthy
+func (b *Backend) Pass() error {
+	return b.client.Agent().UpdateTTL(b.checkID(), "", api.HealthPassing)
+}
+
+// Fail marks the backend critical; the gRPC server keeps serving, as a
+// process failing its health check would
+func (b *Backend) Fail() error {
+	return b.client.Agent().UpdateTTL(b.checkID(), "", api.HealthCritical)
+}
+
+// Drain puts the backend into maintenance mode
+func (b *Backend) Drain() error {
+	return b.client.Agent().EnableServiceMaintenance(b.ID, "draining")
+}
+
+// Undrain takes the backend out of maintenance mode
+func (b *Backend) Undrain() error {
+	return b.client.Agent().DisableServiceMaintenance(b.ID)
+}
+
+// Stop deregisters the backend and stops its server
+func (b *Backend) Stop() error {
+	defer b.srv.Stop()
+
+	return b.client.Agent().ServiceDeregister(b.ID)
+}
@@ -0,0 +1,63 @@
+// Package containers supplies the integration suite with a Consul agent
+// started by testcontainers-go, so it runs wherever Docker does without an
+// agent set up beforehand:
+//
+//	go test -tags integration ./...
+//
+// It is a module of its own so neither the library nor the integration
+// package depend on testcontainers-go
+package containers
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/consul"
+
+	"github.com/flew1x/consul-service-discovery/integration"
+)
+
+// consulImage is the agent started when CONSUL_HTTP_ADDR is not set
+const consulImage = "hashicorp/consul:1.20"
+
+// Client returns a client for the agent at CONSUL_HTTP_ADDR or, when it is
+// not set, for a dev agent in a container terminated when tb ends
+func Client(tb testing.TB) *api.Client {
+	tb.Helper()
+
+	cfg := api.DefaultConfig()
+
+	if os.Getenv(api.HTTPAddrEnvName) == "" {
+		ctx := context.Background()
+
+		ctr, err := consul.Run(ctx, consulImage)
+		testcontainers.CleanupContainer(tb, ctr)
+
+		if err != nil {
+			tb.Fatalf("start consul container: %v", err)
+		}
+
+		cfg.Address, err = ctr.ApiEndpoint(ctx)
+		if err != nil {
+			tb.Fatalf("consul container endpoint: %v", err)
+		}
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		tb.Fatalf("consul client: %v", err)
+	}
+
+	return client
+}
+
+// NewHarness is integration.NewHarness, starting the agent in a container
+// instead of skipping when CONSUL_HTTP_ADDR is not set
+func NewHarness(tb testing.TB) *integration.Harness {
+	tb.Helper()
+
+	return integration.NewHarnessWithClient(tb, Client(tb))
+}
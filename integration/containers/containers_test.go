@@ -0,0 +1,17 @@
+//go:build integration
+
+package containers
+
+import (
+	"testing"
+
+	"github.com/flew1x/consul-service-discovery/integration"
+)
+
+func TestSuite(t *testing.T) {
+	client := Client(t) // one agent for the whole suite
+
+	integration.Run(t, func(tb testing.TB) *integration.Harness {
+		return integration.NewHarnessWithClient(tb, client)
+	})
+}
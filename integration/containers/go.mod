@@ -0,0 +1,12 @@
+module github.com/flew1x/consul-service-discovery/integration/containers
+
+go 1.24.2
+
+require (
+	github.com/flew1x/consul-service-discovery v0.0.0
+	github.com/hashicorp/consul/api v1.32.1
+	github.com/testcontainers/testcontainers-go v0.37.0
+	github.com/testcontainers/testcontainers-go/modules/consul v0.37.0
+)
+
+replace github.com/flew1x/consul-service-discovery => ../..
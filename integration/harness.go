@@ -0,0 +1,115 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+// waitTimeout bounds how long WaitTarget waits for the manager to converge
+const waitTimeout = 30 * time.Second
+
+// serviceSeq keeps service names unique within a run
+var serviceSeq atomic.Int64
+
+// Harness ties backends and managers to the lifetime of a test
+type Harness struct {
+	tb     testing.TB
+	Client *api.Client
+}
+
+// NewHarness connects to the agent at CONSUL_HTTP_ADDR, skipping tb when it
+// is not set. containers.NewHarness starts one in a container instead
+func NewHarness(tb testing.TB) *Harness {
+	tb.Helper()
+
+	if os.Getenv(api.HTTPAddrEnvName) == "" {
+		tb.Skip(api.HTTPAddrEnvName + " not set, no Consul agent to test against (integration/containers starts one)")
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		tb.Fatalf("consul client: %v", err)
+	}
+
+	return NewHarnessWithClient(tb, client)
+}
+
+// NewHarnessWithClient uses client, e.g. pointed at a container started by
+// the test itself
+func NewHarnessWithClient(tb testing.TB, client *api.Client) *Harness {
+	return &Harness{tb: tb, Client: client}
+}
+
+// Service returns a service name unique to this run, so tests sharing an
+// agent do not see each other's backends
+func (h *Harness) Service(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, os.Getpid(), serviceSeq.Add(1))
+}
+
+// Backend starts a backend of service, stopped when the test ends
+func (h *Harness) Backend(service string) *Backend {
+	h.tb.Helper()
+
+	b, err := StartBackend(h.Client, service)
+	if err != nil {
+		h.tb.Fatalf("start backend: %v", err)
+	}
+
+	h.tb.Cleanup(func() { _ = b.Stop() })
+
+	return b
+}
+
+// Manager starts a manager watching services with opts, stopped when the
+// test ends
+func (h *Harness) Manager(services []string, opts ...csd.Option) *csd.ConnManager {
+	h.tb.Helper()
+
+	cm, err := csd.New(h.Client, services, opts...)
+	if err != nil {
+		h.tb.Fatalf("new manager: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.tb.Cleanup(func() {
+		cancel()
+		cm.Stop()
+	})
+
+	cm.Start(ctx)
+
+	return cm
+}
+
+// WaitTarget waits until cm is connected to one of the backends of service
+// and returns it
+func (h *Harness) WaitTarget(cm *csd.ConnManager, service string, backends ...*Backend) *Backend {
+	h.tb.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+
+	for {
+		target, ok := cm.View().Target(service)
+		if ok {
+			for _, b := range backends {
+				if b.Target() == target {
+					return b
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			h.tb.Fatalf("%s: target %q after %s, want one of %d backends", service, target, waitTimeout, len(backends))
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,32 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestNewHarness_SkipsWithoutAgent(t *testing.T) {
+	var skipped bool
+
+	t.Run("no agent", func(t *testing.T) {
+		t.Setenv(api.HTTPAddrEnvName, "")
+		defer func() { skipped = t.Skipped() }()
+
+		NewHarness(t)
+	})
+
+	if !skipped {
+		t.Error("harness ran without CONSUL_HTTP_ADDR")
+	}
+}
+
+func TestHarness_ServiceIsUnique(t *testing.T) {
+	h := NewHarnessWithClient(t, nil)
+
+	a, b := h.Service("users"), h.Service("users")
+	if a == b || !strings.HasPrefix(a, "users-") {
+		t.Errorf("services = %q, %q; want distinct users-* names", a, b)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build integration
+
+package integration
+
+import "testing"
+
+func TestSuite(t *testing.T) {
+	Run(t, NewHarness)
+}
@@ -0,0 +1,113 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	csd "github.com/flew1x/consul-service-discovery"
+)
+
+// Run runs the suite: discovery, failover on a critical check, maintenance
+// and deregistration, and recovery. newHarness supplies the agent, e.g.
+// NewHarness or one backed by a container
+func Run(t *testing.T, newHarness func(testing.TB) *Harness) {
+	t.Run("discovery", func(t *testing.T) { testDiscovery(t, newHarness) })
+	t.Run("failover", func(t *testing.T) { testFailover(t, newHarness) })
+	t.Run("recovery", func(t *testing.T) { testRecovery(t, newHarness) })
+}
+
+var fastWatch = []csd.Option{
+	csd.WithWaitTime(time.Second),
+	csd.WithRetryInterval(100 * time.Millisecond),
+}
+
+func testDiscovery(t *testing.T, newHarness func(testing.TB) *Harness) {
+	h := newHarness(t)
+	svc := h.Service("discovery")
+	b := h.Backend(svc)
+
+	cm := h.Manager([]string{svc}, fastWatch...)
+	h.WaitTarget(cm, svc, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var resp healthpb.HealthCheckResponse
+	if err := cm.Invoke(ctx, svc, healthpb.Health_Check_FullMethodName, &healthpb.HealthCheckRequest{}, &resp); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %s, want SERVING", resp.Status)
+	}
+}
+
+// other returns the backend of pair that is not b
+func other(pair [2]*Backend, b *Backend) *Backend {
+	if pair[0] == b {
+		return pair[1]
+	}
+
+	return pair[0]
+}
+
+func testFailover(t *testing.T, newHarness func(testing.TB) *Harness) {
+	cases := []struct {
+		name  string
+		evict func(*Backend) error
+	}{
+		{"critical check", (*Backend).Fail},
+		{"maintenance", (*Backend).Drain},
+		{"deregistered", (*Backend).Stop},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newHarness(t)
+			svc := h.Service("failover")
+			pair := [2]*Backend{h.Backend(svc), h.Backend(svc)}
+
+			cm := h.Manager([]string{svc}, fastWatch...)
+			current := h.WaitTarget(cm, svc, pair[0], pair[1])
+
+			if err := c.evict(current); err != nil {
+				t.Fatalf("evict %s: %v", current.ID, err)
+			}
+
+			h.WaitTarget(cm, svc, other(pair, current))
+		})
+	}
+}
+
+func testRecovery(t *testing.T, newHarness func(testing.TB) *Harness) {
+	h := newHarness(t)
+	svc := h.Service("recovery")
+	b := h.Backend(svc)
+
+	cm := h.Manager([]string{svc}, fastWatch...)
+	h.WaitTarget(cm, svc, b)
+
+	if err := b.Fail(); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+
+	deadline := time.Now().Add(waitTimeout)
+	for cm.Unavailability(svc) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("still connected after the only backend failed")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if err := b.Pass(); err != nil {
+		t.Fatalf("pass: %v", err)
+	}
+
+	h.WaitTarget(cm, svc, b)
+}
@@ -0,0 +1,56 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// WithDefaultCallOptions applies call options (e.g. grpc.WaitForReady,
+// grpc.MaxCallRecvMsgSize) to every RPC made over the connection to service
+func WithDefaultCallOptions(service string, opts ...grpc.CallOption) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		cm.callOptions[service] = append(cm.callOptions[service], opts...)
+
+		return nil
+	}
+}
+
+// WithDefaultTimeout gives every unary RPC to service a deadline of d unless
+// the caller's context already carries one. Streams are left untouched since
+// their lifetime is usually unbounded
+func WithDefaultTimeout(service string, d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if d <= 0 {
+			return errors.New("timeout_must_be_positive")
+		}
+
+		cm.callTimeouts[service] = d
+
+		return nil
+	}
+}
+
+// defaultTimeoutInterceptor applies d to calls whose context has no deadline
+func defaultTimeoutInterceptor(d time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,38 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestDefaultTimeoutInterceptor(t *testing.T) {
+	var got time.Time
+
+	invoker := func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		got, _ = ctx.Deadline()
+
+		return nil
+	}
+
+	interceptor := defaultTimeoutInterceptor(time.Second)
+
+	start := time.Now()
+	_ = interceptor(context.Background(), "/svc/M", nil, nil, nil, invoker)
+
+	if got.IsZero() || got.Sub(start) > time.Second+100*time.Millisecond {
+		t.Errorf("default deadline not applied: %v", got)
+	}
+
+	want := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.Background(), want)
+	defer cancel()
+
+	_ = interceptor(ctx, "/svc/M", nil, nil, nil, invoker)
+
+	if !got.Equal(want) {
+		t.Errorf("caller deadline overridden: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,81 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// WithReconnectQueue makes Invoke ride out short topology transitions: a call
+// made while service has no connection, e.g. between dropping a target and
+// dialing the next, waits up to maxWait (or its deadline, if sooner) for one
+// instead of failing. At most maxQueued calls wait at a time; calls beyond
+// that fail right away with ErrConnNotFound
+func WithReconnectQueue(maxQueued int, maxWait time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if maxQueued <= 0 {
+			return errors.New("reconnect_queue_size_must_be_positive")
+		}
+
+		if maxWait <= 0 {
+			return errors.New("reconnect_wait_must_be_positive")
+		}
+
+		cm.callQueue = make(chan struct{}, maxQueued)
+		cm.callQueueWait = maxWait
+
+		return nil
+	}
+}
+
+// Invoke performs a unary RPC on the current connection of service. With
+// WithReconnectQueue it waits for a connection while the service is
+// switching targets; otherwise it fails with ErrConnNotFound. See
+// WithCorrelationID for tracing failures
+func (cm *ConnManager) Invoke(ctx context.Context, service, method string, args, reply any, opts ...grpc.CallOption) error {
+	conn, err := cm.currentConn(service) // a load shedder checks the call itself
+	if err != nil && cm.callQueue != nil {
+		conn, err = cm.awaitConn(ctx, service)
+	}
+
+	if err != nil {
+		return cm.wrapCallError(ctx, service, err)
+	}
+
+	return cm.wrapCallError(ctx, service, conn.Invoke(ctx, method, args, reply, opts...))
+}
+
+// awaitConn waits in the reconnect queue for a connection to service
+func (cm *ConnManager) awaitConn(ctx context.Context, service string) (*grpc.ClientConn, error) {
+	select {
+	case cm.callQueue <- struct{}{}:
+		defer func() { <-cm.callQueue }()
+	default:
+		return nil, fmt.Errorf("%w: %s (reconnect queue full)", ErrConnNotFound, service)
+	}
+
+	timer := time.NewTimer(cm.callQueueWait)
+	defer timer.Stop()
+
+	for {
+		cm.mu.RLock()
+		mc, ok := cm.conns[service]
+		changed := cm.changed
+		cm.mu.RUnlock()
+
+		if ok {
+			return mc.conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s: %w", ErrConnNotFound, service, ctx.Err())
+		case <-timer.C:
+			return nil, fmt.Errorf("%w: %s (none after %s)", ErrConnNotFound, service, cm.callQueueWait)
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const healthCheckMethod = "/grpc.health.v1.Health/Check"
+
+func TestInvoke_NoConn(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	err := cm.Invoke(context.Background(), "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	if !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("err = %v, want ErrConnNotFound", err)
+	}
+}
+
+func TestInvoke_QueuesDuringSwitch(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithReconnectQueue(4, 5*time.Second))
+	port := startGRPCServer(t)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = cm.refresh(t.Context(), "svc", testEntries("svc", port))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reply := &healthpb.HealthCheckResponse{}
+	if err := cm.Invoke(ctx, "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, reply); err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+
+	if reply.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %s, want SERVING", reply.GetStatus())
+	}
+}
+
+func TestInvoke_QueueBounds(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithReconnectQueue(1, 200*time.Millisecond))
+
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- cm.Invoke(context.Background(), "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	}()
+
+	// wait for the first call to take the only slot
+	for len(cm.callQueue) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	err := cm.Invoke(context.Background(), "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+
+	if !errors.Is(err, ErrConnNotFound) || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("err = %v after %s, want immediate ErrConnNotFound with a full queue", err, time.Since(start))
+	}
+
+	if err := <-waiting; !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("queued call err = %v, want ErrConnNotFound after max wait", err)
+	}
+}
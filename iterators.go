@@ -0,0 +1,108 @@
+package consul_service_discovery
+
+import (
+	"iter"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ConnInfo describes the connection of a service
+type ConnInfo struct {
+	Conn       *grpc.ClientConn // nil when not connected
+	Target     string
+	InstanceID string
+	Node       string
+	Instances  int // healthy instances
+
+	// of the connection, zero when not connected
+	State          connectivity.State // at the time of the call
+	ConnectedSince time.Time          // when it became the service connection
+}
+
+// Connected reports whether the service had a connection
+func (c ConnInfo) Connected() bool {
+	return c.Conn != nil
+}
+
+// connInfo describes service in the topology
+func (t *topology) connInfo(service string) ConnInfo {
+	info := ConnInfo{Instances: len(t.instances[service])}
+
+	if mc, ok := t.conns[service]; ok {
+		info.Conn = mc.conn
+		info.Target = mc.target
+		info.InstanceID = mc.instanceID
+		info.Node = mc.node
+		info.State = mc.conn.GetState()
+		info.ConnectedSince = mc.since
+	}
+
+	return info
+}
+
+// All yields every watched service with its connection in watch order,
+// unconnected ones included, from one snapshot
+func (cm *ConnManager) All() iter.Seq2[string, ConnInfo] {
+	return cm.View().All()
+}
+
+// Services yields the watched services in watch order
+func (cm *ConnManager) Services() iter.Seq[string] {
+	return cm.View().Services()
+}
+
+// AllInstances yields every healthy instance with its service, from one
+// snapshot
+func (cm *ConnManager) AllInstances() iter.Seq2[string, Instance] {
+	return cm.View().AllInstances()
+}
+
+// All yields every watched service with its connection in watch order
+func (v View) All() iter.Seq2[string, ConnInfo] {
+	return func(yield func(string, ConnInfo) bool) {
+		for _, svc := range v.topo.services {
+			if !yield(svc, v.topo.connInfo(svc)) {
+				return
+			}
+		}
+	}
+}
+
+// Services yields the watched services in watch order
+func (v View) Services() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, svc := range v.topo.services {
+			if !yield(svc) {
+				return
+			}
+		}
+	}
+}
+
+// ServiceInstances yields the healthy instances of service without copying
+// the set. Their maps are shared and must not be modified
+func (v View) ServiceInstances(service string) iter.Seq[Instance] {
+	return func(yield func(Instance) bool) {
+		for _, inst := range v.topo.instances[service] {
+			if !yield(inst) {
+				return
+			}
+		}
+	}
+}
+
+// AllInstances yields every healthy instance with its service, services in
+// watch order. Instance maps are shared and must not be modified
+func (v View) AllInstances() iter.Seq2[string, Instance] {
+	return func(yield func(string, Instance) bool) {
+		for _, svc := range v.topo.services {
+			for _, inst := range v.topo.instances[svc] {
+				if !yield(svc, inst) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestAll_YieldsEveryServiceInWatchOrder(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing", "audit"})
+
+	if err := cm.refresh(t.Context(), "billing", testEntries("billing", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	var services []string
+
+	for svc, info := range cm.All() {
+		services = append(services, svc)
+
+		switch svc {
+		case "billing":
+			if !info.Connected() || info.Instances != 2 || info.InstanceID == "" || info.Target == "" {
+				t.Errorf("billing = %+v, want a connection among 2 instances", info)
+			}
+		default:
+			if info.Connected() || info.Instances != 0 {
+				t.Errorf("%s = %+v, want no connection", svc, info)
+			}
+		}
+	}
+
+	if want := []string{"users", "billing", "audit"}; !slices.Equal(services, want) {
+		t.Errorf("services = %v, want %v", services, want)
+	}
+
+	if got := slices.Collect(cm.Services()); !slices.Equal(got, services) {
+		t.Errorf("Services() = %v, want %v", got, services)
+	}
+}
+
+func TestAllInstances(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"})
+
+	for svc, ports := range map[string][]int{"users": {9001}, "billing": {9002, 9003}} {
+		if err := cm.refresh(t.Context(), svc, testEntries(svc, ports...)); err != nil {
+			t.Fatalf("refresh %s: %v", svc, err)
+		}
+	}
+
+	var got []string
+	for svc, inst := range cm.AllInstances() {
+		got = append(got, svc+"/"+inst.ID)
+	}
+
+	if want := []string{"users/users-9001", "billing/billing-9002", "billing/billing-9003"}; !slices.Equal(got, want) {
+		t.Errorf("instances = %v, want %v", got, want)
+	}
+
+	ids := maps.Collect(func(yield func(string, int) bool) {
+		for inst := range cm.View().ServiceInstances("billing") {
+			if !yield(inst.ID, inst.Port) {
+				return
+			}
+		}
+	})
+
+	if len(ids) != 2 || ids["billing-9003"] != 9003 {
+		t.Errorf("billing instances = %v", ids)
+	}
+}
+
+func TestAll_StopsEarly(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"})
+
+	n := 0
+	for range cm.All() {
+		n++
+
+		break
+	}
+
+	if n != 1 {
+		t.Errorf("iterations = %d, want 1", n)
+	}
+}
+
+func TestGetConnInfo(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"})
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	info, err := cm.GetConnInfo("users")
+	if err != nil {
+		t.Fatalf("GetConnInfo: %v", err)
+	}
+
+	if info.Conn == nil || info.Target != "127.0.0.1:9001" || info.InstanceID != "users-9001" || info.ConnectedSince.IsZero() {
+		t.Errorf("info = %+v", info)
+	}
+
+	since := info.ConnectedSince
+
+	// same target again: the connection and its age are kept
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if info, _ := cm.GetConnInfo("users"); !info.ConnectedSince.Equal(since) {
+		t.Errorf("connected since %v, want %v", info.ConnectedSince, since)
+	}
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if info, _ := cm.GetConnInfo("users"); !info.ConnectedSince.After(since) {
+		t.Errorf("connected since %v after a switch, want later than %v", info.ConnectedSince, since)
+	}
+
+	info, err = cm.GetConnInfo("billing")
+	if !errors.Is(err, ErrConnNotFound) || info.Connected() {
+		t.Errorf("billing = %+v, %v; want ErrConnNotFound", info, err)
+	}
+}
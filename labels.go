@@ -0,0 +1,140 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// ErrInvalidSelector is returned for a label selector that does not parse
+var ErrInvalidSelector = errors.New("invalid_label_selector")
+
+// WithLabels attaches labels to service, e.g. {"tier": "critical"}, for
+// GetConnsByLabel and ServicesByLabel. It may be given several times; later
+// values win
+func WithLabels(service string, labels map[string]string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		for k := range labels {
+			if k == "" || strings.ContainsAny(k, "=!, ") {
+				return fmt.Errorf("invalid_label_key: %q", k)
+			}
+		}
+
+		if cm.labels == nil {
+			cm.labels = make(map[string]map[string]string)
+		}
+
+		if cm.labels[service] == nil {
+			cm.labels[service] = make(map[string]string, len(labels))
+		}
+
+		maps.Copy(cm.labels[service], labels)
+
+		return nil
+	}
+}
+
+// Labels returns a copy of the labels of service
+func (cm *ConnManager) Labels(service string) map[string]string {
+	return maps.Clone(cm.labels[service])
+}
+
+// labelTerm is one requirement of a selector
+type labelTerm struct {
+	key, value string
+	negate     bool // key!=value
+	exists     bool // bare key
+}
+
+func (t labelTerm) matches(labels map[string]string) bool {
+	v, ok := labels[t.key]
+
+	switch {
+	case t.exists:
+		return ok
+	case t.negate:
+		return v != t.value
+	default:
+		return ok && v == t.value
+	}
+}
+
+// parseSelector parses comma-separated terms, all of which must match:
+// "key=value", "key!=value" (also true without the label) and "key" (label
+// present). An empty selector matches every service
+func parseSelector(selector string) ([]labelTerm, error) {
+	var terms []labelTerm
+
+	for raw := range strings.SplitSeq(selector, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			if strings.TrimSpace(selector) == "" {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("%w: empty term in %q", ErrInvalidSelector, selector)
+		}
+
+		var t labelTerm
+
+		if k, v, ok := strings.Cut(raw, "!="); ok {
+			t = labelTerm{key: k, value: v, negate: true}
+		} else if k, v, ok := strings.Cut(raw, "="); ok {
+			t = labelTerm{key: k, value: v}
+		} else {
+			t = labelTerm{key: raw, exists: true}
+		}
+
+		t.key, t.value = strings.TrimSpace(t.key), strings.TrimSpace(t.value)
+		if t.key == "" || strings.ContainsAny(t.key, "=! ") || strings.Contains(t.value, "=") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidSelector, raw)
+		}
+
+		terms = append(terms, t)
+	}
+
+	return terms, nil
+}
+
+// ServicesByLabel returns the watched services matching selector, in watch
+// order. See GetConnsByLabel for the syntax
+func (cm *ConnManager) ServicesByLabel(selector string) ([]string, error) {
+	terms, err := parseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+
+	for _, svc := range cm.watchList {
+		labels := cm.labels[svc]
+
+		if !slices.ContainsFunc(terms, func(t labelTerm) bool { return !t.matches(labels) }) {
+			out = append(out, svc)
+		}
+	}
+
+	return out, nil
+}
+
+// GetConnsByLabel returns the connections of the services matching
+// selector, comma-separated terms that must all hold: "tier=critical",
+// "tier!=critical" or "tier" (label present). Like GetConnMap, available
+// connections are always returned and missing ones are listed in a
+// *MissingServicesError
+func (cm *ConnManager) GetConnsByLabel(selector string) (map[string]*grpc.ClientConn, error) {
+	services, err := cm.ServicesByLabel(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return cm.GetConnMap(services...)
+}
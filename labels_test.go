@@ -0,0 +1,84 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestServicesByLabel(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing", "audit", "search"},
+		WithLabels("users", map[string]string{"tier": "critical", "team": "core"}),
+		WithLabels("billing", map[string]string{"tier": "critical"}),
+		WithLabels("audit", map[string]string{"tier": "batch"}),
+	)
+
+	cases := []struct {
+		selector string
+		want     []string
+	}{
+		{"tier=critical", []string{"users", "billing"}},
+		{"tier = critical, team=core", []string{"users"}},
+		{"tier!=critical", []string{"audit", "search"}},
+		{"tier", []string{"users", "billing", "audit"}},
+		{"", []string{"users", "billing", "audit", "search"}},
+		{"team=payments", nil},
+	}
+
+	for _, c := range cases {
+		got, err := cm.ServicesByLabel(c.selector)
+		if err != nil {
+			t.Errorf("%q: %v", c.selector, err)
+
+			continue
+		}
+
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%q = %v, want %v", c.selector, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"tier=critical,", "=critical", "a=b=c", "tier critical"} {
+		if _, err := cm.ServicesByLabel(bad); !errors.Is(err, ErrInvalidSelector) {
+			t.Errorf("%q: err = %v, want ErrInvalidSelector", bad, err)
+		}
+	}
+}
+
+func TestGetConnsByLabel(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing", "audit"},
+		WithLabels("users", map[string]string{"tier": "critical"}),
+		WithLabels("billing", map[string]string{"tier": "critical"}),
+	)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	conns, err := cm.GetConnsByLabel("tier=critical")
+
+	var missing *MissingServicesError
+	if !errors.As(err, &missing) || !slices.Equal(missing.Services, []string{"billing"}) {
+		t.Errorf("err = %v, want billing missing", err)
+	}
+
+	if got := slices.Sorted(maps.Keys(conns)); !slices.Equal(got, []string{"users"}) {
+		t.Errorf("conns for %v, want users", got)
+	}
+}
+
+func TestWithLabels_Merges(t *testing.T) {
+	cm := newTestManager(t, []string{"users"},
+		WithLabels("users", map[string]string{"tier": "batch", "team": "core"}),
+		WithLabels("users", map[string]string{"tier": "critical"}),
+	)
+
+	if got := cm.Labels("users"); got["tier"] != "critical" || got["team"] != "core" {
+		t.Errorf("labels = %v", got)
+	}
+
+	if err := WithLabels("users", map[string]string{"a=b": "c"})(cm); err == nil {
+		t.Error("invalid key accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errNoHealthyInstances is the failure recorded when selection finds no
+// eligible instance
+var errNoHealthyInstances = errors.New("no healthy instances")
+
+// discoveryFailure is the most recent reason a service has no connection
+type discoveryFailure struct {
+	cause Cause
+	err   error
+	since time.Time // start of the current run of failures with cause
+}
+
+// noteFailure records err as the reason service is not connected. Repeated
+// failures of the same cause keep the time the first one happened
+func (cm *ConnManager) noteFailure(service string, cause Cause, err error) {
+	ws, ok := cm.watchStates[service]
+	if !ok || err == nil {
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	since := time.Now()
+	if ws.failure != nil && ws.failure.cause == cause {
+		since = ws.failure.since
+	}
+
+	ws.failure = &discoveryFailure{cause: cause, err: err, since: since}
+}
+
+// clearFailure forgets the failure of service once it is connected
+func (cm *ConnManager) clearFailure(service string) {
+	ws, ok := cm.watchStates[service]
+	if !ok {
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.failure = nil
+}
+
+// connNotFound returns the GetConn error for service, wrapping its last
+// discovery or dial failure when one is known
+func (cm *ConnManager) connNotFound(service string) error {
+	ws, ok := cm.watchStates[service]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrConnNotFound, service)
+	}
+
+	ws.mu.Lock()
+	f := ws.failure
+	ws.mu.Unlock()
+
+	if f == nil {
+		return fmt.Errorf("%w: %s", ErrConnNotFound, service)
+	}
+
+	return fmt.Errorf("%w: %s: %w since %s", ErrConnNotFound, service, f.err, f.since.Format(time.TimeOnly))
+}
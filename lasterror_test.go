@@ -0,0 +1,89 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetConn_WrapsLastFailure(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if _, err := cm.GetConn("svc"); err == nil || strings.Contains(err.Error(), "since") {
+		t.Errorf("err before any discovery = %v, want a bare ErrConnNotFound", err)
+	}
+
+	if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	_, err := cm.GetConn("svc")
+	if !errors.Is(err, ErrConnNotFound) || !errors.Is(err, errNoHealthyInstances) {
+		t.Fatalf("err = %v, want ErrConnNotFound wrapping no healthy instances", err)
+	}
+
+	if !strings.Contains(err.Error(), "no healthy instances since") {
+		t.Errorf("err = %q, want the time of the failure", err)
+	}
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("svc"); err != nil {
+		t.Fatalf("get conn: %v", err)
+	}
+
+	if cm.watchStates["svc"].failure != nil {
+		t.Error("failure kept after connecting")
+	}
+}
+
+func TestGetConn_FailureKeepsFirstTime(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	cm.noteFailure("svc", CauseDialFailing, errNoHealthyInstances)
+	first := cm.watchStates["svc"].failure.since
+
+	time.Sleep(10 * time.Millisecond)
+
+	refused := errors.New("dial refused")
+	cm.noteFailure("svc", CauseDialFailing, refused)
+
+	f := cm.watchStates["svc"].failure
+	if f.err != refused || !f.since.Equal(first) {
+		t.Errorf("failure = %v since %v, want latest error since %v", f.err, f.since, first)
+	}
+}
+
+func TestGetConn_WrapsQueryError(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "agent unavailable", http.StatusInternalServerError)
+	}))
+
+	cm, err := New(client, []string{"svc"}, WithRetryInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := cm.GetConn("svc"); err != nil && strings.Contains(err.Error(), "consul query") {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, err = cm.GetConn("svc")
+	t.Errorf("err = %v, want the consul query error", err)
+}
@@ -0,0 +1,14 @@
+package consul_service_discovery
+
+// WithAutoCloseOnCancel sets whether canceling the context given to Start
+// also closes every connection (the default). Disabled, the context only
+// bounds discovery: connections stay open on their last targets, and Stop
+// is the only teardown, which suits a context shared with other components
+// that is canceled before the manager's users are done
+func WithAutoCloseOnCancel(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.keepOnCancel = !enabled
+
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStart_ClosesOnCancel(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cm.Start(ctx)
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	cancel()
+	waitTarget(t, cm, "svc", "")
+}
+
+func TestWithAutoCloseOnCancel_Disabled(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithAutoCloseOnCancel(false))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cm.Start(ctx)
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := cm.GetConn("svc"); err != nil {
+		t.Fatalf("connection closed with the start context: %v", err)
+	}
+
+	// discovery stopped with the context
+	fake.setInstances("svc", 9002)
+	time.Sleep(100 * time.Millisecond)
+
+	if got := connTarget(cm, "svc"); got != "127.0.0.1:9001" {
+		t.Errorf("target = %q after cancel, want it frozen", got)
+	}
+
+	cm.Stop()
+
+	if got := connTarget(cm, "svc"); got != "" {
+		t.Errorf("target = %q after Stop, want none", got)
+	}
+}
+
+func TestStop_StopsDiscovery(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	cm.Start(context.Background())
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	cm.Stop()
+
+	fake.setInstances("svc", 9002)
+	time.Sleep(100 * time.Millisecond)
+
+	if got := connTarget(cm, "svc"); got != "" {
+		t.Errorf("target = %q after Stop, want discovery stopped", got)
+	}
+}
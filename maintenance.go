@@ -0,0 +1,166 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MaintenanceWindow is a recurring period of planned maintenance, e.g. every
+// Sunday from 02:00 for two hours in Europe/Berlin
+type MaintenanceWindow struct {
+	Days     []time.Weekday // days the window starts on; empty means every day
+	Start    string         // wall-clock start time, "15:04"
+	Duration time.Duration
+	Location *time.Location // nil means UTC
+}
+
+// maintenanceWindow is a validated MaintenanceWindow
+type maintenanceWindow struct {
+	days     []time.Weekday
+	start    time.Duration // since midnight
+	duration time.Duration
+	loc      *time.Location
+}
+
+// WithMaintenanceWindow declares a recurring maintenance window for service.
+// While it is active the current connection is kept even when the healthy set
+// changes, avoiding failover churn, and events carry Maintenance so alerting
+// can downgrade them to warnings. It may be given several times
+func WithMaintenanceWindow(service string, w MaintenanceWindow) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		mw, err := w.compile()
+		if err != nil {
+			return err
+		}
+
+		cm.maintenance[service] = append(cm.maintenance[service], mw)
+
+		return nil
+	}
+}
+
+func (w MaintenanceWindow) compile() (maintenanceWindow, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return maintenanceWindow{}, fmt.Errorf("invalid_maintenance_start: %w", err)
+	}
+
+	if w.Duration <= 0 || w.Duration > 7*24*time.Hour {
+		return maintenanceWindow{}, errors.New("invalid_maintenance_duration")
+	}
+
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return maintenanceWindow{
+		days:     slices.Clone(w.Days),
+		start:    time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		duration: w.Duration,
+		loc:      loc,
+	}, nil
+}
+
+// active reports whether t falls in an occurrence of the window, including
+// ones that started on a previous day
+func (w maintenanceWindow) active(t time.Time) bool {
+	_, ok := w.endOf(t)
+
+	return ok
+}
+
+// endOf returns the end of the occurrence of the window t falls in
+func (w maintenanceWindow) endOf(t time.Time) (time.Time, bool) {
+	t = t.In(w.loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.loc)
+
+	for back := 0; time.Duration(back)*24*time.Hour < w.start+w.duration; back++ {
+		day := midnight.AddDate(0, 0, -back)
+		if len(w.days) > 0 && !slices.Contains(w.days, day.Weekday()) {
+			continue
+		}
+
+		begin := time.Date(day.Year(), day.Month(), day.Day(), int(w.start/time.Hour), int(w.start%time.Hour/time.Minute), 0, 0, w.loc)
+		if end := begin.Add(w.duration); !t.Before(begin) && t.Before(end) {
+			return end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// inMaintenance reports whether a maintenance window of service is active
+func (cm *ConnManager) inMaintenance(service string) bool {
+	_, ok := cm.maintenanceEnd(service)
+
+	return ok
+}
+
+// maintenanceEnd returns when the active maintenance windows of service
+// end, the latest one when they overlap
+func (cm *ConnManager) maintenanceEnd(service string) (time.Time, bool) {
+	var (
+		now    = time.Now()
+		latest time.Time
+	)
+
+	for _, w := range cm.maintenance[service] {
+		if end, ok := w.endOf(now); ok && end.After(latest) {
+			latest = end
+		}
+	}
+
+	return latest, !latest.IsZero()
+}
+
+// holdForMaintenance reports whether refresh should keep the current target
+// of service because a maintenance window is active. The hold may mask a
+// removal Consul won't report again, so the watcher is kicked to re-select
+// when the window ends
+func (cm *ConnManager) holdForMaintenance(service string, instances int) bool {
+	end, ok := cm.maintenanceEnd(service)
+	if !ok {
+		return false
+	}
+
+	cm.mu.RLock()
+	mc, connected := cm.conns[service]
+	selected := cm.selected[service]
+	cm.mu.RUnlock()
+
+	target := selected
+	if connected {
+		target = mc.target
+	}
+
+	if target == "" {
+		return false
+	}
+
+	cm.logger.Info("maintenance window active, keeping current target",
+		zap.String("service", service),
+		zap.String("target", target),
+		zap.Int("instances", instances),
+	)
+
+	cm.mu.Lock()
+	if t, ok := cm.maintenanceKicks[service]; ok {
+		t.Stop()
+	} else if cm.maintenanceKicks == nil {
+		cm.maintenanceKicks = make(map[string]*time.Timer)
+	}
+
+	cm.maintenanceKicks[service] = time.AfterFunc(time.Until(end), func() { cm.kick(service) })
+	cm.mu.Unlock()
+
+	return true
+}
@@ -0,0 +1,112 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow_Active(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+
+	w, err := MaintenanceWindow{
+		Days:     []time.Weekday{time.Sunday},
+		Start:    "23:00",
+		Duration: 2 * time.Hour,
+		Location: berlin,
+	}.compile()
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+
+	cases := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 4, 23, 30, 0, 0, berlin), true}, // Sunday
+		{time.Date(2026, 10, 5, 0, 30, 0, 0, berlin), true},  // spills into Monday
+		{time.Date(2026, 10, 5, 1, 0, 0, 0, berlin), false},
+		{time.Date(2026, 10, 5, 23, 30, 0, 0, berlin), false},  // Monday
+		{time.Date(2026, 10, 4, 21, 30, 0, 0, time.UTC), true}, // 23:30 in Berlin
+	}
+
+	for _, c := range cases {
+		if got := w.active(c.at); got != c.want {
+			t.Errorf("active(%v) = %v, want %v", c.at, got, c.want)
+		}
+	}
+}
+
+func TestMaintenanceWindow_Validation(t *testing.T) {
+	for _, w := range []MaintenanceWindow{
+		{Start: "25:00", Duration: time.Hour},
+		{Start: "02:00"},
+		{Start: "02:00", Duration: 8 * 24 * time.Hour},
+	} {
+		if _, err := w.compile(); err == nil {
+			t.Errorf("expected error for %+v", w)
+		}
+	}
+}
+
+func TestMaintenanceWindow_KeepsTarget(t *testing.T) {
+	rec := &eventRecorder{}
+	cm := newTestManager(t, []string{"users"},
+		WithMaintenanceWindow("users", MaintenanceWindow{Start: "00:00", Duration: 24 * time.Hour}),
+		WithEventHandler(rec.handle),
+	)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if got := connTarget(cm, "users"); got != "127.0.0.1:9001" {
+		t.Errorf("target = %q, want it kept during maintenance", got)
+	}
+
+	for _, ev := range rec.events {
+		if !ev.Maintenance {
+			t.Errorf("event %s not flagged as maintenance", ev.Type)
+		}
+	}
+}
+
+func TestMaintenanceWindow_ReselectsAtEnd(t *testing.T) {
+	now := time.Now().UTC()
+	start := now.Truncate(time.Minute)
+
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"users"},
+		WithMaintenanceWindow("users", MaintenanceWindow{
+			Start:    start.Format("15:04"),
+			Duration: now.Sub(start) + 300*time.Millisecond,
+		}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	cm.Start(ctx)
+
+	waitTarget(t, cm, "users", "127.0.0.1:9001")
+
+	// 9001 leaves during the window: held, and Consul won't report it again
+	fake.setInstances("users", 9002)
+	time.Sleep(100 * time.Millisecond)
+
+	if got := connTarget(cm, "users"); got != "127.0.0.1:9001" {
+		t.Fatalf("target = %q, want it kept during maintenance", got)
+	}
+
+	waitTarget(t, cm, "users", "127.0.0.1:9002")
+}
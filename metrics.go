@@ -0,0 +1,77 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"time"
+)
+
+// Metric names emitted by ConnManager. Sinks may add their own prefix
+const (
+	MetricQueries      = "consul_sd_queries_total"        // counter{service,result}
+	MetricQueryLatency = "consul_sd_query_duration"       // timing{service}
+	MetricInstances    = "consul_sd_healthy_instances"    // gauge{service}
+	MetricDialErrors   = "consul_sd_dial_errors_total"    // counter{service}
+	MetricConnSwaps    = "consul_sd_conn_swaps_total"     // counter{service}
+	MetricConnected    = "consul_sd_dependency_connected" // gauge{service}
+	MetricCacheBytes   = "consul_sd_cache_bytes"          // gauge{service}
+	MetricConnWaits    = "consul_sd_conn_waits_total"     // counter{service}, shared GetConnContext misses
+	MetricRateLimited  = "consul_sd_rate_limited_total"   // counter{service}, queries rejected with 429
+	MetricProbeRTT     = "consul_sd_probe_rtt"            // timing{service}, see WithProbe
+	MetricWatcherAge   = "consul_sd_watcher_success_age"  // gauge{service}, seconds since the last successful query
+	MetricWatcherStuck = "consul_sd_stuck_watchers_total" // counter{service}, stuck watchers restarted
+	MetricShedCalls    = "consul_sd_shed_calls_total"     // counter{service,reason}, see WithLoadShedder
+	MetricStaleReads   = "consul_sd_stale_reads_total"    // counter{service}, reads discarded by WithMaxStaleness
+)
+
+// Label is a metric dimension
+type Label struct {
+	Name  string
+	Value string
+}
+
+// MetricsSink receives discovery metrics. Implementations must be safe for
+// concurrent use; calls happen on the watcher goroutines and should not block
+type MetricsSink interface {
+	IncrCounter(name string, value float64, labels ...Label)
+	SetGauge(name string, value float64, labels ...Label)
+	ObserveDuration(name string, d time.Duration, labels ...Label)
+}
+
+// WithMetrics adds a metrics sink. It may be given several times; every sink
+// receives every metric
+func WithMetrics(sink MetricsSink) Option {
+	return func(cm *ConnManager) error {
+		if sink == nil {
+			return errors.New("nil_metrics_sink")
+		}
+
+		cm.metrics = append(cm.metrics, sink)
+
+		return nil
+	}
+}
+
+// fanoutSink forwards every metric to all sinks
+type fanoutSink []MetricsSink
+
+func (f fanoutSink) IncrCounter(name string, value float64, labels ...Label) {
+	for _, s := range f {
+		s.IncrCounter(name, value, labels...)
+	}
+}
+
+func (f fanoutSink) SetGauge(name string, value float64, labels ...Label) {
+	for _, s := range f {
+		s.SetGauge(name, value, labels...)
+	}
+}
+
+func (f fanoutSink) ObserveDuration(name string, d time.Duration, labels ...Label) {
+	for _, s := range f {
+		s.ObserveDuration(name, d, labels...)
+	}
+}
+
+func serviceLabel(service string) Label {
+	return Label{Name: "service", Value: service}
+}
@@ -0,0 +1,228 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// ClusterPolicy decides how the instances a service has in a secondary
+// Consul cluster combine with those of the primary one
+type ClusterPolicy int
+
+const (
+	// ClusterFailover uses the secondary cluster only while the primary one
+	// has no healthy instance (default)
+	ClusterFailover ClusterPolicy = iota
+	// ClusterMerge uses the instances of both clusters, the primary copy
+	// winning when an instance is registered in both
+	ClusterMerge
+	// ClusterPreferSecondary uses the primary cluster only while the
+	// secondary one has no healthy instance, e.g. once a migration is cut
+	// over
+	ClusterPreferSecondary
+)
+
+func (p ClusterPolicy) String() string {
+	switch p {
+	case ClusterFailover:
+		return "failover"
+	case ClusterMerge:
+		return "merge"
+	case ClusterPreferSecondary:
+		return "prefer secondary"
+	default:
+		return fmt.Sprintf("ClusterPolicy(%d)", int(p))
+	}
+}
+
+// secondaryCluster is a second Consul cluster watched alongside the primary
+// one, see WithSecondaryCluster
+type secondaryCluster struct {
+	name     string
+	client   *api.Client
+	policy   ClusterPolicy
+	services []string
+
+	mu        sync.Mutex
+	instances map[string][]Instance // service -> last healthy set
+}
+
+// WithSecondaryCluster also watches services (every watched service when
+// none is given) under the same names in the Consul cluster reached by
+// client, for the time services migrate between clusters. policy decides how
+// the healthy sets of both clusters combine before selection; instances
+// found through client carry name as Instance.Cluster. While the secondary
+// cluster cannot be queried, its last healthy set is kept
+func WithSecondaryCluster(name string, client *api.Client, policy ClusterPolicy, services ...string) Option {
+	return func(cm *ConnManager) error {
+		if cm.secondary != nil {
+			return errors.New("secondary_cluster_already_set")
+		}
+
+		if name == "" {
+			return errors.New("empty_cluster_name")
+		}
+
+		if client == nil {
+			return errors.New("nil_cluster_client")
+		}
+
+		if policy < ClusterFailover || policy > ClusterPreferSecondary {
+			return errors.New("invalid_cluster_policy")
+		}
+
+		for _, svc := range services {
+			if err := cm.checkWatched(svc); err != nil {
+				return err
+			}
+		}
+
+		if len(services) == 0 {
+			services = cm.watchList
+		}
+
+		cm.secondary = &secondaryCluster{
+			name:      name,
+			client:    client,
+			policy:    policy,
+			services:  slices.Clone(services),
+			instances: make(map[string][]Instance),
+		}
+		cm.background = append(cm.background, cm.runSecondary)
+
+		return nil
+	}
+}
+
+// runSecondary watches the services covered by the secondary cluster
+func (cm *ConnManager) runSecondary(ctx context.Context) {
+	for _, svc := range cm.secondary.services {
+		go cm.watchSecondary(ctx, svc)
+	}
+}
+
+// watchSecondary runs a blocking query loop for service against the
+// secondary cluster, storing its healthy set and making the primary watcher
+// re-select on every change
+func (cm *ConnManager) watchSecondary(ctx context.Context, service string) {
+	var (
+		sc      = cm.secondary
+		waitIdx uint64
+		digest  uint64
+	)
+
+	for {
+		q := &api.QueryOptions{WaitTime: cm.waitTime, WaitIndex: waitIdx}
+
+		qctx, qcancel := context.WithTimeout(ctx, cm.effectiveQueryTimeout())
+		entries, meta, err := sc.client.Health().Service(cm.consulName(service), "", true, q.WithContext(qctx))
+
+		qcancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			cm.logger.Warn("secondary cluster query error",
+				zap.String("cluster", sc.name),
+				zap.String("service", service),
+				zap.Error(err),
+			)
+
+			waitIdx = 0
+
+			if !sleepCtx(ctx, backoff(cm.retryInterval)) {
+				return
+			}
+
+			continue
+		}
+
+		waitIdx = nextWaitIndex(waitIdx, meta.LastIndex)
+
+		prevDigest := digest
+		if digest = entriesDigest(entries); digest == prevDigest && prevDigest != 0 {
+			continue
+		}
+
+		instances := instancesFromEntries(entries)
+		cm.applyLoad(entries, instances)
+
+		for i := range instances {
+			instances[i].Cluster = sc.name
+		}
+
+		sc.mu.Lock()
+		sc.instances[service] = instances
+		sc.mu.Unlock()
+
+		cm.kick(service)
+	}
+}
+
+// withSecondary combines the primary healthy set of service with the one
+// of the secondary cluster according to its policy
+func (cm *ConnManager) withSecondary(service string, primary []Instance) []Instance {
+	sc := cm.secondary
+	if sc == nil || !slices.Contains(sc.services, service) {
+		return primary
+	}
+
+	sc.mu.Lock()
+	secondary := slices.Clone(sc.instances[service])
+	sc.mu.Unlock()
+
+	switch sc.policy {
+	case ClusterMerge:
+		return mergeInstances(primary, secondary)
+	case ClusterPreferSecondary:
+		if len(secondary) > 0 {
+			return secondary
+		}
+
+		return primary
+	default:
+		if len(primary) > 0 {
+			return primary
+		}
+
+		return secondary
+	}
+}
+
+// mergeInstances appends to preferred the instances of other registered
+// under another node and ID, and address
+func mergeInstances(preferred, other []Instance) []Instance {
+	ids := make(map[instanceRef]struct{}, len(preferred))
+	endpoints := make(map[string]struct{}, len(preferred))
+
+	for _, inst := range preferred {
+		ids[inst.ref()] = struct{}{}
+		endpoints[net.JoinHostPort(inst.Address, strconv.Itoa(inst.Port))] = struct{}{}
+	}
+
+	out := slices.Clip(preferred)
+
+	for _, inst := range other {
+		if _, ok := ids[inst.ref()]; ok {
+			continue
+		}
+
+		if _, ok := endpoints[net.JoinHostPort(inst.Address, strconv.Itoa(inst.Port))]; ok {
+			continue
+		}
+
+		out = append(out, inst)
+	}
+
+	return out
+}
@@ -0,0 +1,115 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSecondaryCluster_Failover(t *testing.T) {
+	primary, secondary := newFakeConsul(), newFakeConsul()
+	secondary.setInstances("svc", 9102)
+
+	cm, err := New(newTestClient(t, primary), []string{"svc"},
+		WithSecondaryCluster("old", newTestClient(t, secondary), ClusterFailover))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	cm.Start(ctx)
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9102")
+
+	primary.setInstances("svc", 9101)
+	waitTarget(t, cm, "svc", "127.0.0.1:9101")
+
+	primary.setInstances("svc")
+	waitTarget(t, cm, "svc", "127.0.0.1:9102")
+
+	instances, err := cm.Instances("svc")
+	if err != nil || len(instances) != 1 || instances[0].Cluster != "old" {
+		t.Errorf("instances = %+v, %v; want one from cluster old", instances, err)
+	}
+}
+
+func TestSecondaryCluster_Policies(t *testing.T) {
+	primary := instancesFromEntries(testEntries("svc", 9001, 9002))
+	secondary := instancesFromEntries(testEntries("svc", 9002, 9003))
+	secondary[1].ID, secondary[1].Node = "svc-9001", "node-9001" // same instance, other address
+
+	for i := range secondary {
+		secondary[i].Cluster = "new"
+	}
+
+	cases := []struct {
+		policy        ClusterPolicy
+		primary, want []string
+	}{
+		{ClusterFailover, []string{"svc-9001", "svc-9002"}, []string{"svc-9001", "svc-9002"}},
+		{ClusterFailover, nil, []string{"svc-9002", "svc-9001"}},
+		{ClusterMerge, []string{"svc-9001", "svc-9002"}, []string{"svc-9001", "svc-9002"}},
+		{ClusterPreferSecondary, []string{"svc-9001", "svc-9002"}, []string{"svc-9002", "svc-9001"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			cm := newTestManager(t, []string{"svc"}, WithSecondaryCluster("new", newTestClient(t, newFakeConsul()), c.policy))
+			cm.secondary.instances["svc"] = secondary
+
+			var prim []Instance
+			if c.primary != nil {
+				prim = primary
+			}
+
+			got := cm.withSecondary("svc", prim)
+			if len(got) != len(c.want) {
+				t.Fatalf("got %d instances, want %v", len(got), c.want)
+			}
+
+			for i, id := range c.want {
+				if got[i].ID != id {
+					t.Errorf("instance %d = %s, want %s", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeInstances(t *testing.T) {
+	preferred := instancesFromEntries(testEntries("svc", 9001))
+	other := instancesFromEntries(testEntries("svc", 9001, 9002))
+	other[0].ID = "moved" // same endpoint, registered under another ID
+
+	got := mergeInstances(preferred, other)
+	if len(got) != 2 || got[0].ID != "svc-9001" || got[1].ID != "svc-9002" {
+		t.Errorf("merged = %+v", got)
+	}
+}
+
+func TestWithSecondaryCluster_Validation(t *testing.T) {
+	client := newTestClient(t, newFakeConsul())
+
+	cases := []struct {
+		name string
+		opt  Option
+	}{
+		{"empty name", WithSecondaryCluster("", client, ClusterMerge)},
+		{"nil client", WithSecondaryCluster("old", nil, ClusterMerge)},
+		{"bad policy", WithSecondaryCluster("old", client, ClusterPolicy(7))},
+		{"unknown service", WithSecondaryCluster("old", client, ClusterMerge, "nope")},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.opt(newTestManager(t, []string{"svc"})); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	cm := newTestManager(t, []string{"svc"}, WithSecondaryCluster("old", client, ClusterMerge))
+	if err := WithSecondaryCluster("other", client, ClusterMerge)(cm); err == nil {
+		t.Error("expected an error for a second cluster")
+	}
+}
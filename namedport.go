@@ -0,0 +1,94 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+
+	"google.golang.org/grpc"
+)
+
+// ErrUnknownPort is returned by GetConnFor for a port name not declared with
+// WithNamedPort, or one the selected instance does not carry
+var ErrUnknownPort = errors.New("unknown_named_port")
+
+// WithNamedPort declares a logical port of service, e.g. "admin", whose
+// number instances register under metaKey in their service Meta. It is
+// dialed with GetConnFor alongside the main connection, through the same
+// discovery, selection and dial options. It may be given several times
+func WithNamedPort(service, name, metaKey string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if name == "" {
+			return errors.New("empty_port_name")
+		}
+
+		if metaKey == "" {
+			return errors.New("empty_meta_key")
+		}
+
+		if cm.namedPorts[service] == nil {
+			cm.namedPorts[service] = make(map[string]string)
+		}
+
+		cm.namedPorts[service][name] = metaKey
+
+		return nil
+	}
+}
+
+// GetConnFor returns a connection to the named port of the instance service
+// is currently connected to, dialing it on first use; an empty name returns
+// GetConn. It follows the main connection: after a switch it returns a
+// connection to the new instance. Connections to named ports are closed
+// once their instance leaves the healthy set. Callers should not Close the
+// returned connection
+func (cm *ConnManager) GetConnFor(service, portName string) (*grpc.ClientConn, error) {
+	if cm.dryRun {
+		return nil, dryRunConnError(service)
+	}
+
+	if portName == "" {
+		return cm.GetConn(service)
+	}
+
+	if _, ok := cm.namedPorts[service][portName]; !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrUnknownPort, service, portName)
+	}
+
+	mc, ok := cm.loadTopology().conns[service]
+	if !ok {
+		return nil, cm.connNotFound(service)
+	}
+
+	return cm.instanceConn(instanceKey{service: service, instanceRef: mc.ref(), port: portName})
+}
+
+// namedPortInstance returns inst set up to dial its named port. The port
+// meta key of WithPortFromMeta is dropped so it does not override the port
+func (cm *ConnManager) namedPortInstance(service string, inst Instance, name string) (Instance, error) {
+	key := cm.namedPorts[service][name]
+
+	raw, ok := inst.Meta[key]
+	if !ok {
+		return Instance{}, fmt.Errorf("%w: instance %s has no %s port in meta %s", ErrUnknownPort, inst.ID, name, key)
+	}
+
+	port, err := strconv.Atoi(raw)
+	if err != nil || port <= 0 || port > 65535 {
+		return Instance{}, fmt.Errorf("instance %s: invalid %s port %q in meta %s", inst.ID, name, raw, key)
+	}
+
+	inst.Port = port
+
+	if _, ok := inst.Meta[cm.portMetaKey]; ok {
+		inst.Meta = maps.Clone(inst.Meta)
+		delete(inst.Meta, cm.portMetaKey)
+	}
+
+	return inst, nil
+}
@@ -0,0 +1,90 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestGetConnFor(t *testing.T) {
+	admin := startGRPCServer(t)
+
+	entries := testEntries("svc", 9001, 9002)
+	entries[0].Service.Meta = map[string]string{"admin_port": strconv.Itoa(admin), "grpc_port": "9101"}
+
+	cm := newTestManager(t, []string{"svc"},
+		WithNamedPort("svc", "admin", "admin_port"),
+		WithPortFromMeta("grpc_port"),
+		WithInstanceID("svc", "svc-9001"),
+	)
+
+	if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	main, _ := cm.GetConn("svc")
+
+	conn, err := cm.GetConnFor("svc", "admin")
+	if err != nil {
+		t.Fatalf("get admin conn: %v", err)
+	}
+
+	if want := "127.0.0.1:" + strconv.Itoa(admin); conn.Target() != want || main.Target() != "127.0.0.1:9101" {
+		t.Errorf("targets = %s (main), %s (admin); want 127.0.0.1:9101, %s", main.Target(), conn.Target(), want)
+	}
+
+	if again, _ := cm.GetConnFor("svc", "admin"); again != conn {
+		t.Error("named port conn should be cached")
+	}
+
+	if same, _ := cm.GetConnFor("svc", ""); same != main {
+		t.Error("empty port name should return the main connection")
+	}
+
+	if _, err := cm.GetConnFor("svc", "debug"); !errors.Is(err, ErrUnknownPort) {
+		t.Errorf("undeclared port: err = %v, want ErrUnknownPort", err)
+	}
+
+	// the instance leaves the healthy set: its named port conn goes with it
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, ok := cm.instanceConns[instanceKey{service: "svc", instanceRef: testRef("svc-9001"), port: "admin"}]; ok {
+		t.Error("named port conn should be pruned")
+	}
+}
+
+func TestGetConnFor_InstanceWithoutPort(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithNamedPort("svc", "admin", "admin_port"))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConnFor("svc", "admin"); !errors.Is(err, ErrUnknownPort) {
+		t.Errorf("err = %v, want ErrUnknownPort", err)
+	}
+}
+
+func TestGetConnFor_NotConnected(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithNamedPort("svc", "admin", "admin_port"))
+
+	if _, err := cm.GetConnFor("svc", "admin"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("err = %v, want ErrConnNotFound", err)
+	}
+}
+
+func TestWithNamedPort_Validation(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	for _, opt := range []Option{
+		WithNamedPort("svc", "", "admin_port"),
+		WithNamedPort("svc", "admin", ""),
+		WithNamedPort("other", "admin", "admin_port"),
+	} {
+		if err := opt(cm); err == nil {
+			t.Error("expected an option error")
+		}
+	}
+}
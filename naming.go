@@ -0,0 +1,104 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// NameData is the data available to WithNameTemplate
+type NameData struct {
+	Env  string // set with WithEnvironment
+	Name string // logical service name as passed to New
+}
+
+// WithServiceNamePrefix prepends prefix to every watched service name when
+// querying Consul (e.g. "staging-"). GetConn and all other APIs keep using the
+// logical names passed to New
+func WithServiceNamePrefix(prefix string) Option {
+	return func(cm *ConnManager) error {
+		cm.namePrefix = prefix
+
+		return nil
+	}
+}
+
+// WithServiceNameSuffix appends suffix to every watched service name when
+// querying Consul
+func WithServiceNameSuffix(suffix string) Option {
+	return func(cm *ConnManager) error {
+		cm.nameSuffix = suffix
+
+		return nil
+	}
+}
+
+// WithNameTemplate derives the Consul service name from a text/template
+// rendered with NameData, e.g. "{{.Env}}-{{.Name}}". It cannot be combined
+// with a prefix or suffix
+func WithNameTemplate(tmpl string) Option {
+	return func(cm *ConnManager) error {
+		t, err := template.New("service-name").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return fmt.Errorf("parse name template: %w", err)
+		}
+
+		cm.nameTemplate = t
+
+		return nil
+	}
+}
+
+// WithEnvironment sets the Env value available to WithNameTemplate
+func WithEnvironment(env string) Option {
+	return func(cm *ConnManager) error {
+		cm.environment = env
+
+		return nil
+	}
+}
+
+// resolveNames computes the Consul name of every watched service. It runs in
+// New once all options are applied
+func (cm *ConnManager) resolveNames() error {
+	if cm.nameTemplate != nil && (cm.namePrefix != "" || cm.nameSuffix != "") {
+		return errors.New("name_template_conflicts_with_prefix_or_suffix")
+	}
+
+	cm.consulNames = make(map[string]string, len(cm.watchList))
+
+	for _, svc := range cm.watchList {
+		name := cm.namePrefix + svc + cm.nameSuffix
+
+		if cm.nameTemplate != nil {
+			var b strings.Builder
+			if err := cm.nameTemplate.Execute(&b, NameData{Env: cm.environment, Name: svc}); err != nil {
+				return fmt.Errorf("render name template for %s: %w", svc, err)
+			}
+
+			name = b.String()
+		}
+
+		if name == "" {
+			return fmt.Errorf("empty consul name for service %s", svc)
+		}
+
+		if ns, ok := cm.nomadServices[svc]; ok && ns.Sidecar {
+			name = NomadSidecarName(name)
+		}
+
+		cm.consulNames[svc] = name
+	}
+
+	return nil
+}
+
+// consulName returns the name service is registered under in Consul
+func (cm *ConnManager) consulName(service string) string {
+	if name, ok := cm.consulNames[service]; ok {
+		return name
+	}
+
+	return service
+}
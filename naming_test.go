@@ -0,0 +1,53 @@
+package consul_service_discovery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveNames(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"plain", nil, "users"},
+		{"prefix suffix", []Option{WithServiceNamePrefix("staging-"), WithServiceNameSuffix("-grpc")}, "staging-users-grpc"},
+		{"template", []Option{WithNameTemplate("{{.Env}}.{{.Name}}"), WithEnvironment("prod")}, "prod.users"},
+	}
+
+	for _, c := range cases {
+		cm := newTestManager(t, []string{"users"}, c.opts...)
+
+		if got := cm.consulName("users"); got != c.want {
+			t.Errorf("%s: consul name = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestResolveNames_TemplateConflictsWithPrefix(t *testing.T) {
+	cm := &ConnManager{watchList: []string{"users"}}
+	_ = WithNameTemplate("{{.Name}}")(cm)
+	_ = WithServiceNamePrefix("x-")(cm)
+
+	if err := cm.resolveNames(); err == nil {
+		t.Error("expected conflict error")
+	}
+}
+
+func TestWatchService_QueriesPrefixedName(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("staging-users", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"users"},
+		WithServiceNamePrefix("staging-"),
+		WithWaitTime(20*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if targets := watchTargets(t, cm, "users", 100*time.Millisecond); len(targets) != 1 || targets[0] != "127.0.0.1:9001" {
+		t.Errorf("targets = %v, want [127.0.0.1:9001]", targets)
+	}
+}
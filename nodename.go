@@ -0,0 +1,48 @@
+package consul_service_discovery
+
+import (
+	"net"
+)
+
+// hostnameMetaKey is the service or node Meta key holding a DNS name for an
+// instance, see WithPreferNodeName
+const hostnameMetaKey = "hostname"
+
+// WithPreferNodeName dials instances by DNS name instead of IP when one is
+// available: the "hostname" service Meta, then the "hostname" node Meta,
+// then the Consul node name. Dialing names lets TLS verify certificates
+// against the host and rides out IP reassignments. A name that does not
+// resolve (when hosts are resolved before dialing) falls back to the next
+// candidate and finally the registered address
+func WithPreferNodeName(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.preferNodeName = enabled
+
+		return nil
+	}
+}
+
+// withDialHost returns inst with Address replaced by the host to dial
+func (cm *ConnManager) withDialHost(service string, inst Instance) Instance {
+	if !cm.preferNodeName {
+		return inst
+	}
+
+	for _, host := range []string{inst.Meta[hostnameMetaKey], inst.NodeMeta[hostnameMetaKey], inst.Node} {
+		if host == "" || host == inst.Address {
+			continue
+		}
+
+		if cm.resolvesHost(service) {
+			if _, err := net.LookupHost(host); err != nil {
+				continue
+			}
+		}
+
+		inst.Address = host
+
+		return inst
+	}
+
+	return inst
+}
@@ -0,0 +1,47 @@
+package consul_service_discovery
+
+import (
+	"testing"
+)
+
+func TestPreferNodeName_MetaHostname(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithPreferNodeName(true))
+
+	entries := testEntries("svc", 9001)
+	entries[0].Service.Meta = map[string]string{"hostname": "localhost"}
+
+	if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if got := connTarget(cm, "svc"); got != "localhost:9001" {
+		t.Errorf("target = %q, want localhost:9001", got)
+	}
+}
+
+func TestPreferNodeName_Candidates(t *testing.T) {
+	inst := instancesFromEntries(testEntries("svc", 9001))[0]
+
+	off := newTestManager(t, []string{"svc"})
+	if got := off.withDialHost("svc", inst).Address; got != "127.0.0.1" {
+		t.Errorf("address without the option = %q", got)
+	}
+
+	// node-9001 does not resolve, so the IP is kept
+	cm := newTestManager(t, []string{"svc"}, WithPreferNodeName(true))
+	if got := cm.withDialHost("svc", inst).Address; got != "127.0.0.1" {
+		t.Errorf("address with an unresolvable node name = %q, want the IP", got)
+	}
+
+	inst.NodeMeta = map[string]string{"hostname": "localhost"}
+	if got := cm.withDialHost("svc", inst).Address; got != "localhost" {
+		t.Errorf("address = %q, want the node meta hostname", got)
+	}
+
+	// custom resolver schemes resolve names themselves
+	custom := newTestManager(t, []string{"svc"}, WithPreferNodeName(true), WithTargetScheme("custom"))
+	inst.NodeMeta = nil
+	if got := custom.withDialHost("svc", inst).Address; got != "node-9001" {
+		t.Errorf("address = %q, want the node name", got)
+	}
+}
@@ -0,0 +1,99 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	// nomadSidecarSuffix is appended by Nomad to the names of Connect
+	// sidecar services it registers
+	nomadSidecarSuffix = "-sidecar-proxy"
+	// nomadProxyTaskPrefix prefixes the Nomad task (and port label) running
+	// a service's Connect sidecar
+	nomadProxyTaskPrefix = "connect-proxy-"
+)
+
+// NomadAddressMode selects which address of a Nomad registration is dialed,
+// after the address_mode of Nomad service blocks
+type NomadAddressMode int
+
+const (
+	// NomadAddressAuto dials the address Nomad registered (default)
+	NomadAddressAuto NomadAddressMode = iota
+	// NomadAddressHost dials the node address, for services registered with
+	// address_mode "driver" or "alloc" whose address is only reachable on
+	// their host. Pair it with PortMetaKey holding the host port
+	NomadAddressHost
+)
+
+// NomadService describes how Nomad registers a service in Consul
+type NomadService struct {
+	// Sidecar watches the Connect sidecar Nomad registers for the service,
+	// "<name>-sidecar-proxy", and dials its port. A name given as the
+	// sidecar task name, "connect-proxy-<name>", is mapped the same way
+	Sidecar bool
+	// PortMetaKey names the service Meta entry holding the port to dial,
+	// e.g. a job setting meta { grpc_port = "${NOMAD_HOST_PORT_grpc}" } for
+	// its dynamic port label. Instances without a valid value keep the
+	// registered port
+	PortMetaKey string
+	AddressMode NomadAddressMode
+}
+
+// WithNomadService applies Nomad's Consul registration conventions to
+// service, so jobs scheduled by Nomad need no custom target builder
+func WithNomadService(service string, ns NomadService) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		switch ns.AddressMode {
+		case NomadAddressAuto, NomadAddressHost:
+		default:
+			return errors.New("invalid_nomad_address_mode")
+		}
+
+		cm.nomadServices[service] = ns
+
+		return nil
+	}
+}
+
+// NomadSidecarName returns the Consul name of the Connect sidecar Nomad
+// registers for service. service may be the service name or the name of its
+// connect-proxy task
+func NomadSidecarName(service string) string {
+	if strings.HasSuffix(service, nomadSidecarSuffix) {
+		return service
+	}
+
+	return strings.TrimPrefix(service, nomadProxyTaskPrefix) + nomadSidecarSuffix
+}
+
+// applyNomad rewrites instances of a Nomad service to the address and port
+// its settings select. instances[i] must come from entries[i]
+func (cm *ConnManager) applyNomad(service string, entries []*api.ServiceEntry, instances []Instance) {
+	ns, ok := cm.nomadServices[service]
+	if !ok {
+		return
+	}
+
+	for i, e := range entries {
+		if ns.AddressMode == NomadAddressHost && e.Node != nil && e.Node.Address != "" {
+			instances[i].Address = e.Node.Address
+		}
+
+		if ns.PortMetaKey == "" {
+			continue
+		}
+
+		if port, err := strconv.Atoi(instances[i].Meta[ns.PortMetaKey]); err == nil && port > 0 && port <= 65535 {
+			instances[i].Port = port
+		}
+	}
+}
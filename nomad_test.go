@@ -0,0 +1,83 @@
+package consul_service_discovery
+
+import (
+	"testing"
+)
+
+func TestNomadSidecarName(t *testing.T) {
+	cases := map[string]string{
+		"api":                   "api-sidecar-proxy",
+		"connect-proxy-api":     "api-sidecar-proxy",
+		"api-sidecar-proxy":     "api-sidecar-proxy",
+		"staging-api":           "staging-api-sidecar-proxy",
+		"connect-proxy-web-api": "web-api-sidecar-proxy",
+	}
+
+	for in, want := range cases {
+		if got := NomadSidecarName(in); got != want {
+			t.Errorf("NomadSidecarName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNomadService_SidecarName(t *testing.T) {
+	cm := newTestManager(t, []string{"api", "web"},
+		WithServiceNamePrefix("staging-"),
+		WithNomadService("api", NomadService{Sidecar: true}))
+
+	if got := cm.consulName("api"); got != "staging-api-sidecar-proxy" {
+		t.Errorf("consul name = %q, want staging-api-sidecar-proxy", got)
+	}
+
+	if got := cm.consulName("web"); got != "staging-web" {
+		t.Errorf("consul name of non-nomad service = %q", got)
+	}
+}
+
+func TestNomadService_HostAddressAndMetaPort(t *testing.T) {
+	cm := newTestManager(t, []string{"api"}, WithNomadService("api", NomadService{
+		PortMetaKey: "grpc_port",
+		AddressMode: NomadAddressHost,
+	}))
+
+	entries := testEntries("api", 9001, 9002)
+	for _, e := range entries {
+		e.Service.Address = "172.17.0.2"
+	}
+	entries[0].Service.Meta = map[string]string{"grpc_port": "21000"}
+	entries[1].Service.Meta = map[string]string{"grpc_port": "not-a-port"}
+
+	if err := cm.refresh(t.Context(), "api", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	instances, err := cm.Instances("api")
+	if err != nil {
+		t.Fatalf("instances: %v", err)
+	}
+
+	got := make(map[string]Instance)
+	for _, inst := range instances {
+		got[inst.ID] = inst
+	}
+
+	if inst := got["api-9001"]; inst.Address != "127.0.0.1" || inst.Port != 21000 {
+		t.Errorf("api-9001 = %s:%d, want 127.0.0.1:21000", inst.Address, inst.Port)
+	}
+
+	if inst := got["api-9002"]; inst.Address != "127.0.0.1" || inst.Port != 9002 {
+		t.Errorf("api-9002 = %s:%d, want registered port on the node address", inst.Address, inst.Port)
+	}
+}
+
+func TestNomadService_Validation(t *testing.T) {
+	cm := newTestManager(t, []string{"api"})
+
+	if err := WithNomadService("api", NomadService{AddressMode: 7})(cm); err == nil {
+		t.Error("invalid address mode accepted")
+	}
+
+	if err := WithNomadService("other", NomadService{})(cm); err == nil {
+		t.Error("unwatched service accepted")
+	}
+}
@@ -0,0 +1,110 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// Option configures a ConnManager.
+type Option func(*ConnManager) error
+
+// WithLogger injects a structured zap.Logger. Defaults to a no-op logger.
+func WithLogger(l *zap.Logger) Option {
+	return func(cm *ConnManager) error {
+		if l == nil {
+			return errors.New("nil logger")
+		}
+
+		cm.logger = l
+
+		return nil
+	}
+}
+
+// WithRefreshInterval sets the maximum period between Consul blocking queries
+// (lower values == faster reaction, higher == less load). Default: 30 s
+//
+// Deprecated: use WithWaitTime, WithRetryInterval and WithForcedRefresh, which
+// control the three behaviors this knob used to conflate.
+func WithRefreshInterval(d time.Duration) Option {
+	return WithWaitTime(d)
+}
+
+// WithWaitTime sets the maximum time a Consul blocking query waits for a
+// change before returning (lower values == more queries, higher == less
+// load), up to MaxWaitTime. Consul adds up to d/16 of jitter, which the
+// default query timeout allows for; a Consul client whose http.Client has a
+// Timeout must allow as much. Above the default, Start reads the agent's
+// max_query_time and waits no longer than that. Default: 30 s
+func WithWaitTime(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d <= 0 {
+			return errors.New("interval_must_be_positive")
+		}
+
+		if d > MaxWaitTime {
+			return fmt.Errorf("wait_time_exceeds_max: %s > %s", d, MaxWaitTime)
+		}
+
+		cm.waitTime = d
+
+		return nil
+	}
+}
+
+// WithRetryInterval sets the base delay before retrying a failed Consul query.
+// The actual delay is jittered up to +50%. Default: 5 s
+func WithRetryInterval(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d <= 0 {
+			return errors.New("retry_interval_must_be_positive")
+		}
+
+		cm.retryInterval = d
+
+		return nil
+	}
+}
+
+// WithForcedRefresh re-runs instance selection at least every d even when
+// Consul reports no change, e.g. to rebalance across instances. Zero disables
+// forced refreshes (the default): selection then runs only on changes
+func WithForcedRefresh(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d < 0 {
+			return errors.New("forced_refresh_must_not_be_negative")
+		}
+
+		cm.forcedRefresh = d
+
+		return nil
+	}
+}
+
+// WithQueryTimeout sets a hard deadline for a single Consul blocking query,
+// protecting watchers from hung agents. It must exceed the blocking wait time.
+// Default: wait time + wait time/16 + 5 s
+func WithQueryTimeout(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d <= 0 {
+			return errors.New("query_timeout_must_be_positive")
+		}
+
+		cm.queryTimeout = d
+
+		return nil
+	}
+}
+
+// WithDialOptions appends extra grpc.DialOptions
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(cm *ConnManager) error {
+		cm.dialOpts = append(cm.dialOpts, opts...)
+
+		return nil
+	}
+}
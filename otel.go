@@ -0,0 +1,183 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// otelScope is the instrumentation scope name reported to the MeterProvider
+const otelScope = "github.com/flew1x/consul-service-discovery"
+
+// otelInstrument maps an internal metric name to its OpenTelemetry name, unit
+// and description
+type otelInstrument struct {
+	name, unit, desc string
+}
+
+var otelInstruments = map[string]otelInstrument{
+	MetricQueries:      {"consul.sd.queries", "{query}", "Consul health queries issued by watchers."},
+	MetricQueryLatency: {"consul.sd.query.duration", "s", "Duration of Consul health queries, including blocking time."},
+	MetricInstances:    {"consul.sd.healthy_instances", "{instance}", "Healthy instances returned by the last query."},
+	MetricDialErrors:   {"consul.sd.dial.errors", "{error}", "Failed attempts to create a gRPC client."},
+	MetricConnSwaps:    {"consul.sd.connection.swaps", "{swap}", "Replacements of the managed gRPC connection."},
+	MetricConnected:    {"consul.sd.dependency.connected", "1", "Whether a gRPC connection exists for the dependency."},
+	MetricCacheBytes:   {"consul.sd.cache.size", "By", "Estimated memory held by cached query results."},
+	MetricConnWaits:    {"consul.sd.connection.waits", "{wait}", "Calls waiting for a connection to be established."},
+	MetricRateLimited:  {"consul.sd.rate_limited_queries", "{query}", "Consul queries rejected with 429 Too Many Requests."},
+	MetricProbeRTT:     {"consul.sd.probe.duration", "s", "Round-trip time of instance probes."},
+	MetricWatcherAge:   {"consul.sd.watcher.success_age", "s", "Time since the last successful query of a watcher."},
+	MetricWatcherStuck: {"consul.sd.watcher.restarts", "{restart}", "Stuck watchers restarted."},
+	MetricShedCalls:    {"consul.sd.calls.shed", "{call}", "Calls rejected by the load shedder."},
+	MetricStaleReads:   {"consul.sd.reads.stale", "{read}", "Query results discarded as too stale."},
+}
+
+// otelAttributeNames maps label names to semantic-convention attribute keys;
+// unknown labels are namespaced under consul.sd
+var otelAttributeNames = map[string]string{
+	"service": "peer.service",
+}
+
+// WithMeterProvider exports discovery and connection metrics through
+// OpenTelemetry instruments created from mp, and enables the peer.service
+// attribute on RPC spans (see WithPeerServiceAttribute)
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(cm *ConnManager) error {
+		if mp == nil {
+			return errors.New("nil_meter_provider")
+		}
+
+		cm.metrics = append(cm.metrics, NewOtelSink(mp.Meter(otelScope)))
+		cm.otel = true
+
+		return nil
+	}
+}
+
+// OtelSink is a MetricsSink recording through an OpenTelemetry Meter.
+// Instruments are created lazily on first use
+type OtelSink struct {
+	meter metric.Meter
+
+	mu         sync.Mutex
+	counters   map[string]metric.Float64Counter
+	gauges     map[string]metric.Float64Gauge
+	histograms map[string]metric.Float64Histogram
+}
+
+// NewOtelSink returns a sink recording through meter
+func NewOtelSink(meter metric.Meter) *OtelSink {
+	return &OtelSink{
+		meter:      meter,
+		counters:   make(map[string]metric.Float64Counter),
+		gauges:     make(map[string]metric.Float64Gauge),
+		histograms: make(map[string]metric.Float64Histogram),
+	}
+}
+
+func (s *OtelSink) IncrCounter(name string, value float64, labels ...Label) {
+	if c := s.counter(name); c != nil {
+		c.Add(context.Background(), value, metric.WithAttributes(otelAttributes(labels)...))
+	}
+}
+
+func (s *OtelSink) SetGauge(name string, value float64, labels ...Label) {
+	if g := s.gauge(name); g != nil {
+		g.Record(context.Background(), value, metric.WithAttributes(otelAttributes(labels)...))
+	}
+}
+
+func (s *OtelSink) ObserveDuration(name string, d time.Duration, labels ...Label) {
+	if h := s.histogram(name); h != nil {
+		h.Record(context.Background(), d.Seconds(), metric.WithAttributes(otelAttributes(labels)...))
+	}
+}
+
+func (s *OtelSink) counter(name string) metric.Float64Counter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.counters[name]; ok {
+		return c
+	}
+
+	in := describeOtel(name)
+
+	c, err := s.meter.Float64Counter(in.name, metric.WithUnit(in.unit), metric.WithDescription(in.desc))
+	if err != nil {
+		return nil
+	}
+
+	s.counters[name] = c
+
+	return c
+}
+
+func (s *OtelSink) gauge(name string) metric.Float64Gauge {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g, ok := s.gauges[name]; ok {
+		return g
+	}
+
+	in := describeOtel(name)
+
+	g, err := s.meter.Float64Gauge(in.name, metric.WithUnit(in.unit), metric.WithDescription(in.desc))
+	if err != nil {
+		return nil
+	}
+
+	s.gauges[name] = g
+
+	return g
+}
+
+func (s *OtelSink) histogram(name string) metric.Float64Histogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h, ok := s.histograms[name]; ok {
+		return h
+	}
+
+	in := describeOtel(name)
+
+	h, err := s.meter.Float64Histogram(in.name, metric.WithUnit(in.unit), metric.WithDescription(in.desc))
+	if err != nil {
+		return nil
+	}
+
+	s.histograms[name] = h
+
+	return h
+}
+
+// describeOtel returns the instrument description for name, falling back to
+// the internal name for metrics without a mapping
+func describeOtel(name string) otelInstrument {
+	if in, ok := otelInstruments[name]; ok {
+		return in
+	}
+
+	return otelInstrument{name: name}
+}
+
+func otelAttributes(labels []Label) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+
+	for _, l := range labels {
+		key, ok := otelAttributeNames[l.Name]
+		if !ok {
+			key = "consul.sd." + l.Name
+		}
+
+		attrs = append(attrs, attribute.String(key, l.Value))
+	}
+
+	return attrs
+}
@@ -0,0 +1,94 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// fakeMeter records counter additions by instrument name
+type fakeMeter struct {
+	noop.Meter
+	adds map[string][]attribute.Set
+}
+
+type fakeCounter struct {
+	noop.Float64Counter
+	name  string
+	meter *fakeMeter
+}
+
+func (m *fakeMeter) Float64Counter(name string, _ ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	return &fakeCounter{name: name, meter: m}, nil
+}
+
+func (c *fakeCounter) Add(_ context.Context, _ float64, opts ...metric.AddOption) {
+	c.meter.adds[c.name] = append(c.meter.adds[c.name], metric.NewAddConfig(opts).Attributes())
+}
+
+func TestOtelSink_CounterNamesAndAttributes(t *testing.T) {
+	meter := &fakeMeter{adds: map[string][]attribute.Set{}}
+	sink := NewOtelSink(meter)
+
+	sink.IncrCounter(MetricQueries, 1, serviceLabel("users"), Label{"result", "ok"})
+	sink.IncrCounter(MetricQueries, 1, serviceLabel("users"), Label{"result", "error"})
+
+	adds := meter.adds["consul.sd.queries"]
+	if len(adds) != 2 {
+		t.Fatalf("got %d additions to consul.sd.queries, want 2", len(adds))
+	}
+
+	if v, ok := adds[0].Value("peer.service"); !ok || v.AsString() != "users" {
+		t.Errorf("peer.service = %v, want users", v.AsString())
+	}
+
+	if v, ok := adds[1].Value("consul.sd.result"); !ok || v.AsString() != "error" {
+		t.Errorf("consul.sd.result = %v, want error", v.AsString())
+	}
+}
+
+func TestOtelInstruments_CoverMetrics(t *testing.T) {
+	metrics := []string{
+		MetricQueries,
+		MetricQueryLatency,
+		MetricInstances,
+		MetricDialErrors,
+		MetricConnSwaps,
+		MetricConnected,
+		MetricCacheBytes,
+		MetricConnWaits,
+		MetricRateLimited,
+		MetricProbeRTT,
+		MetricWatcherAge,
+		MetricWatcherStuck,
+		MetricShedCalls,
+		MetricStaleReads,
+	}
+
+	seen := map[string]string{}
+
+	for _, m := range metrics {
+		in, ok := otelInstruments[m]
+		if !ok || in.unit == "" || in.desc == "" {
+			t.Errorf("%s: instrument %+v, want a name, unit and description", m, in)
+
+			continue
+		}
+
+		if other, dup := seen[in.name]; dup {
+			t.Errorf("%s and %s both map to %s", m, other, in.name)
+		}
+
+		seen[in.name] = m
+	}
+
+	seconds := []string{MetricQueryLatency, MetricProbeRTT, MetricWatcherAge}
+	for _, m := range seconds {
+		if unit := otelInstruments[m].unit; unit != "s" {
+			t.Errorf("%s unit = %q, want s", m, unit)
+		}
+	}
+}
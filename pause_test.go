@@ -0,0 +1,102 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// connTarget returns the current target of service, or "" when unconnected
+func connTarget(cm *ConnManager, service string) string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	if mc, ok := cm.conns[service]; ok {
+		return mc.target
+	}
+
+	return ""
+}
+
+// waitTarget polls until service is connected to want or the deadline passes
+func waitTarget(t *testing.T, cm *ConnManager, service, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if connTarget(cm, service) == want {
+			return
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("target = %q, want %q", connTarget(cm, service), want)
+}
+
+func TestPause_FreezesConnection(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	rec := &eventRecorder{}
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"},
+		WithWaitTime(50*time.Millisecond),
+		WithEventHandler(rec.handle),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer cm.CloseAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if err := cm.Pause("svc"); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	if !cm.Paused("svc") || !cm.Status()[0].Paused {
+		t.Error("service should report paused")
+	}
+
+	fake.setInstances("svc", 9002)
+	time.Sleep(150 * time.Millisecond)
+
+	if got := connTarget(cm, "svc"); got != "127.0.0.1:9001" {
+		t.Fatalf("paused service switched to %q", got)
+	}
+
+	if err := cm.Resume("svc"); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9002")
+
+	var paused, resumed bool
+	for _, typ := range rec.types() {
+		paused = paused || typ == EventPaused
+		resumed = resumed || typ == EventResumed
+	}
+
+	if !paused || !resumed {
+		t.Errorf("events = %v, want paused and resumed", rec.types())
+	}
+}
+
+func TestPause_UnknownService(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := cm.Pause("other"); !errors.Is(err, errUnknownService) {
+		t.Errorf("pause err = %v, want unknown service", err)
+	}
+
+	if err := cm.Resume("svc"); err != nil {
+		t.Errorf("resume of running service should be a no-op, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package consul_service_discovery
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// WithPeerServiceAttribute sets whether RPC spans on managed connections get
+// the peer.service attribute, the Consul name of the service called. It is
+// enabled by default along with WithMeterProvider
+//
+// Spans are started by the application's tracing stats handler, e.g.
+// otelgrpc.NewClientHandler given through WithDialOptions or
+// WithStatsHandler; the attribute is only set on a span started for the RPC,
+// never on the caller's span
+func WithPeerServiceAttribute(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.peerService = &enabled
+
+		return nil
+	}
+}
+
+// tagsPeerService reports whether connections carry the peer.service
+// handlers
+func (cm *ConnManager) tagsPeerService() bool {
+	if cm.peerService != nil {
+		return *cm.peerService
+	}
+
+	return cm.otel
+}
+
+// peerServiceOptions wraps the dial options of service so RPC spans started
+// by their stats handlers get peer.service
+func (cm *ConnManager) peerServiceOptions(service string, opts []grpc.DialOption) []grpc.DialOption {
+	out := make([]grpc.DialOption, 0, len(opts)+2)
+	out = append(out, grpc.WithStatsHandler(callerSpan{}))
+	out = append(out, opts...)
+
+	return append(out, grpc.WithStatsHandler(peerServiceTagger{
+		attr: attribute.String("peer.service", cm.consulName(service)),
+	}))
+}
+
+type callerSpanKey struct{}
+
+// callerSpan runs before the other stats handlers and remembers the span
+// current when the RPC began
+type callerSpan struct{ nopHandler }
+
+func (callerSpan) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, callerSpanKey{}, trace.SpanContextFromContext(ctx).SpanID())
+}
+
+// peerServiceTagger runs after the other stats handlers and sets attr on
+// the span one of them started for the RPC
+type peerServiceTagger struct {
+	nopHandler
+
+	attr attribute.KeyValue
+}
+
+func (h peerServiceTagger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return ctx
+	}
+
+	if caller, _ := ctx.Value(callerSpanKey{}).(trace.SpanID); caller == span.SpanContext().SpanID() {
+		return ctx // no span started for this RPC
+	}
+
+	span.SetAttributes(h.attr)
+
+	return ctx
+}
+
+// nopHandler is a stats.Handler doing nothing, embedded by handlers using
+// only TagRPC
+type nopHandler struct{}
+
+func (nopHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (nopHandler) HandleRPC(context.Context, stats.RPCStats)                         {}
+func (nopHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (nopHandler) HandleConn(context.Context, stats.ConnStats)                       {}
@@ -0,0 +1,163 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+)
+
+// fakeSpan is a recording span keeping its attributes
+type fakeSpan struct {
+	tracenoop.Span
+
+	sc trace.SpanContext
+
+	mu    sync.Mutex
+	attrs []attribute.KeyValue
+}
+
+func newFakeSpan(id byte) *fakeSpan {
+	return &fakeSpan{sc: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{id},
+	})}
+}
+
+func (s *fakeSpan) IsRecording() bool              { return true }
+func (s *fakeSpan) SpanContext() trace.SpanContext { return s.sc }
+
+func (s *fakeSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *fakeSpan) attr(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, kv := range s.attrs {
+		if string(kv.Key) == key {
+			return kv.Value.AsString(), true
+		}
+	}
+
+	return "", false
+}
+
+// spanStarter is a tracing stats handler starting a span per RPC, like
+// otelgrpc's client handler
+type spanStarter struct {
+	nopStatsHandler
+
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (h *spanStarter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	span := newFakeSpan(byte(len(h.spans) + 2))
+	h.spans = append(h.spans, span)
+
+	return trace.ContextWithSpan(ctx, span)
+}
+
+// callTraced dials the health server on port with the options cm uses for
+// service and calls it once under ctx
+func callTraced(t *testing.T, ctx context.Context, cm *ConnManager, service string, port int) {
+	t.Helper()
+
+	conn, err := grpc.NewClient("127.0.0.1:"+strconv.Itoa(port), cm.dialOptionsFor(service)...)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+}
+
+func TestPeerService_TagsRPCSpan(t *testing.T) {
+	port := startGRPCServer(t)
+	tracer := &spanStarter{}
+
+	cm := newTestManager(t, []string{"users"},
+		WithServiceNamePrefix("prod-"),
+		WithMeterProvider(metricnoop.NewMeterProvider()),
+		WithDialOptions(grpc.WithStatsHandler(tracer)))
+
+	caller := newFakeSpan(1)
+	callTraced(t, trace.ContextWithSpan(context.Background(), caller), cm, "users", port)
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("got %d RPC spans, want 1", len(tracer.spans))
+	}
+
+	if v, ok := tracer.spans[0].attr("peer.service"); !ok || v != "prod-users" {
+		t.Errorf("peer.service = %q (%v), want prod-users", v, ok)
+	}
+
+	if _, ok := caller.attr("peer.service"); ok {
+		t.Error("caller span tagged")
+	}
+}
+
+func TestPeerService_CallerSpanUntouched(t *testing.T) {
+	port := startGRPCServer(t)
+
+	cm := newTestManager(t, []string{"users"}, WithMeterProvider(metricnoop.NewMeterProvider()))
+
+	caller := newFakeSpan(1)
+	callTraced(t, trace.ContextWithSpan(context.Background(), caller), cm, "users", port)
+
+	if _, ok := caller.attr("peer.service"); ok {
+		t.Error("caller span tagged without an RPC span")
+	}
+}
+
+func TestPeerService_Enablement(t *testing.T) {
+	mp := WithMeterProvider(metricnoop.NewMeterProvider())
+
+	cases := []struct {
+		name string
+		opts []Option
+		want bool
+	}{
+		{"default", nil, false},
+		{"meter provider", []Option{mp}, true},
+		{"disabled", []Option{mp, WithPeerServiceAttribute(false)}, false},
+		{"enabled", []Option{WithPeerServiceAttribute(true)}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := newTestManager(t, []string{"users"}, tc.opts...)
+
+			if got := cm.tagsPeerService(); got != tc.want {
+				t.Errorf("tagsPeerService = %v, want %v", got, tc.want)
+			}
+
+			child, err := cm.Child([]string{"billing"})
+			if err != nil {
+				t.Fatalf("child: %v", err)
+			}
+
+			if got := child.tagsPeerService(); got != tc.want {
+				t.Errorf("child tagsPeerService = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package consul_service_discovery
+
+import (
+	"google.golang.org/grpc"
+)
+
+// connPool shares one ClientConn between connections that reach the same
+// target: instances of a service behind a VIP, or different services
+// co-hosted on one host:port. Conns are reference counted and closed when
+// their last user releases them. Guarded by cm.mu
+type connPool struct {
+	byKey map[string]*grpc.ClientConn
+	refs  map[*grpc.ClientConn]int
+	keys  map[*grpc.ClientConn]string
+}
+
+// WithConnSharing makes connections that resolve to the same target (and TLS
+// server name) reuse one ClientConn instead of dialing duplicates. Services
+// with their own dial settings (service config, call options, timeouts,
+// proxies, peer identity, stats handlers or a scorer) only share within the
+// service. Latency and failure signals of a shared conn are attributed to the
+// instance that dialed it
+func WithConnSharing(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.shareConns = enabled
+
+		return nil
+	}
+}
+
+// poolKey identifies connections to inst of service that may share a conn
+func (cm *ConnManager) poolKey(service, target string, inst Instance) string {
+	key := target
+	if cm.hasServiceDialOptions(service) {
+		key = service + "|" + target
+	}
+
+	if cm.serverName != nil {
+		key += "|" + cm.serverName(inst)
+	}
+
+	return key
+}
+
+// hasServiceDialOptions reports whether conns of service are dialed with
+// settings other services don't share, so they must not be pooled across
+// services. Shedding and span tagging bind the service into their
+// interceptors and handlers
+func (cm *ConnManager) hasServiceDialOptions(service string) bool {
+	if len(cm.statsHandlers) > 0 || cm.scorer != nil {
+		return true
+	}
+
+	if cm.shedder != nil || cm.tagsPeerService() {
+		return true
+	}
+
+	if _, ok := cm.serviceConfigs[service]; ok {
+		return true
+	}
+
+	if _, ok := cm.callTimeouts[service]; ok {
+		return true
+	}
+
+	if _, ok := cm.serviceProxies[service]; ok {
+		return true
+	}
+
+	if _, ok := cm.peerCreds[service]; ok {
+		return true
+	}
+
+	return len(cm.callOptions[service]) > 0
+}
+
+// acquireShared returns a pooled conn for key, taking a reference
+func (cm *ConnManager) acquireShared(key string) (*grpc.ClientConn, bool) {
+	if !cm.shareConns {
+		return nil, false
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	conn, ok := cm.pool.byKey[key]
+	if ok {
+		cm.pool.refs[conn]++
+	}
+
+	return conn, ok
+}
+
+// shareConn registers a freshly dialed conn under key and returns the conn to
+// use: conn itself, or the pooled one if another dial won the race
+func (cm *ConnManager) shareConn(key string, conn *grpc.ClientConn) *grpc.ClientConn {
+	if !cm.shareConns {
+		return conn
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if existing, ok := cm.pool.byKey[key]; ok {
+		_ = conn.Close()
+		cm.pool.refs[existing]++
+
+		return existing
+	}
+
+	if cm.pool.byKey == nil {
+		cm.pool = connPool{
+			byKey: make(map[string]*grpc.ClientConn),
+			refs:  make(map[*grpc.ClientConn]int),
+			keys:  make(map[*grpc.ClientConn]string),
+		}
+	}
+
+	cm.pool.byKey[key] = conn
+	cm.pool.refs[conn] = 1
+	cm.pool.keys[conn] = key
+
+	return conn
+}
+
+// releaseLocked drops one reference to conn and closes it once unused;
+// unpooled conns are closed right away. Callers hold cm.mu
+func (cm *ConnManager) releaseLocked(conn *grpc.ClientConn) error {
+	if refs, ok := cm.pool.refs[conn]; ok {
+		if refs > 1 {
+			cm.pool.refs[conn] = refs - 1
+
+			return nil
+		}
+
+		delete(cm.pool.byKey, cm.pool.keys[conn])
+		delete(cm.pool.refs, conn)
+		delete(cm.pool.keys, conn)
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,172 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"google.golang.org/grpc/connectivity"
+)
+
+// vipEntries returns instances of service with distinct IDs that all
+// advertise the same address, like replicas behind a load balancer
+func vipEntries(service string, ids ...string) []*api.ServiceEntry {
+	entries := make([]*api.ServiceEntry, 0, len(ids))
+
+	for _, id := range ids {
+		entries = append(entries, &api.ServiceEntry{
+			Node: &api.Node{Node: "node-" + id, Address: "127.0.0.1"},
+			Service: &api.AgentService{
+				ID:      id,
+				Service: service,
+				Address: "127.0.0.1",
+				Port:    9001,
+			},
+		})
+	}
+
+	return entries
+}
+
+func TestConnSharing_ReusesTarget(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithConnSharing(true), WithInstanceID("svc", "a"))
+
+	if err := cm.refresh(t.Context(), "svc", vipEntries("svc", "a", "b")); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	primary, err := cm.GetConn("svc")
+	if err != nil {
+		t.Fatalf("get conn: %v", err)
+	}
+
+	other, err := cm.GetConnByInstanceID("svc", "b")
+	if err != nil {
+		t.Fatalf("get by instance: %v", err)
+	}
+
+	if other != primary {
+		t.Fatal("instances with the same target should share a conn")
+	}
+
+	if refs := cm.pool.refs[primary]; refs != 2 {
+		t.Errorf("refs = %d, want 2", refs)
+	}
+
+	// b leaves: the shared conn stays open for the service
+	if err := cm.refresh(t.Context(), "svc", vipEntries("svc", "a")); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if state := primary.GetState(); state == connectivity.Shutdown {
+		t.Fatal("shared conn closed while still in use")
+	}
+
+	if refs := cm.pool.refs[primary]; refs != 1 {
+		t.Errorf("refs = %d, want 1", refs)
+	}
+
+	cm.CloseAll()
+
+	if state := primary.GetState(); state != connectivity.Shutdown {
+		t.Errorf("state = %s, want SHUTDOWN after last release", state)
+	}
+
+	if len(cm.pool.byKey) != 0 {
+		t.Errorf("pool not empty: %v", cm.pool.byKey)
+	}
+}
+
+func TestConnSharing_DisabledByDefault(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithInstanceID("svc", "a"))
+
+	if err := cm.refresh(t.Context(), "svc", vipEntries("svc", "a", "b")); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	primary, _ := cm.GetConn("svc")
+
+	if other, _ := cm.GetConnByInstanceID("svc", "b"); other == primary {
+		t.Error("conns should not be shared without WithConnSharing")
+	}
+}
+
+func TestConnSharing_AcrossServices(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"}, WithConnSharing(true))
+
+	// both services are co-hosted on 127.0.0.1:9001
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := cm.refresh(t.Context(), "billing", testEntries("billing", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	users, _ := cm.GetConn("users")
+	billing, _ := cm.GetConn("billing")
+
+	if users == nil || users != billing {
+		t.Fatal("co-hosted services should share a conn")
+	}
+
+	// users moves away: billing keeps the conn
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if state := billing.GetState(); state == connectivity.Shutdown {
+		t.Error("shared conn closed while billing still uses it")
+	}
+}
+
+func TestConnSharing_ServiceDialOptions(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"},
+		WithConnSharing(true),
+		WithDefaultTimeout("billing", time.Second),
+	)
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := cm.refresh(t.Context(), "billing", testEntries("billing", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	users, _ := cm.GetConn("users")
+
+	if billing, _ := cm.GetConn("billing"); billing == users {
+		t.Error("service with its own dial options should not share across services")
+	}
+}
+
+func TestConnSharing_PerServiceInterceptors(t *testing.T) {
+	shedder := LoadShedderFunc(func(context.Context, string, string) (ShedReason, bool) { return "", false })
+
+	cases := map[string]Option{
+		"load shedder": WithLoadShedder(shedder, false),
+		"peer.service": WithPeerServiceAttribute(true),
+	}
+
+	for name, opt := range cases {
+		t.Run(name, func(t *testing.T) {
+			cm := newTestManager(t, []string{"users", "billing"}, WithConnSharing(true), opt)
+
+			if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			if err := cm.refresh(t.Context(), "billing", testEntries("billing", 9001)); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			users, _ := cm.GetConn("users")
+
+			if billing, _ := cm.GetConn("billing"); billing == users {
+				t.Error("conn bound to a service should not be shared across services")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultPrewarmIdle is how long prewarmed connections are kept unused
+const defaultPrewarmIdle = 5 * time.Minute
+
+// WithPrewarmIdle sets how long connections opened by Prewarm may stay unused
+// before they are closed (default 5m)
+func WithPrewarmIdle(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d <= 0 {
+			return errors.New("prewarm_idle_must_be_positive")
+		}
+
+		cm.prewarmIdle = d
+
+		return nil
+	}
+}
+
+// Prewarm connects ahead of anticipated load, e.g. before a scheduled batch
+// job, so TLS handshakes don't land on the first requests: for each service
+// the current connection and per-instance connections (see
+// GetConnByInstanceID) to up to n healthy instances in total are dialed and
+// awaited until READY. Per-instance connections still unused after the
+// prewarm idle period are closed again. Failures are joined per instance; the
+// others stay warm
+func (cm *ConnManager) Prewarm(ctx context.Context, services []string, n int) error {
+	if n <= 0 {
+		return errors.New("prewarm_conns_must_be_positive")
+	}
+
+	if cm.dryRun {
+		return dryRunConnError(strings.Join(services, ", "))
+	}
+
+	var (
+		errs []error
+		keys []instanceKey
+	)
+
+	for _, service := range services {
+		if err := cm.checkWatched(service); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		for _, inst := range cm.prewarmTargets(service, n) {
+			conn, err := cm.GetConnByInstance(service, inst)
+			if err == nil {
+				err = waitReady(ctx, conn)
+			}
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("prewarm %s/%s: %w", service, inst.ID, err))
+
+				continue
+			}
+
+			keys = append(keys, instanceKey{service: service, instanceRef: inst.ref()})
+		}
+	}
+
+	if len(keys) > 0 {
+		go cm.reapPrewarmed(keys)
+	}
+
+	return errors.Join(errs...)
+}
+
+// prewarmTargets returns up to n healthy instances of service, the one of the
+// service connection first
+func (cm *ConnManager) prewarmTargets(service string, n int) []Instance {
+	topo := cm.loadTopology()
+	instances := topo.instances[service]
+	out := make([]Instance, 0, min(n, len(instances)))
+
+	if mc, ok := topo.conns[service]; ok {
+		if inst, found := findInstance(instances, mc.ref()); found {
+			out = append(out, inst)
+		}
+	}
+
+	for _, inst := range instances {
+		if len(out) == n {
+			break
+		}
+
+		if len(out) > 0 && inst.ref() == out[0].ref() {
+			continue
+		}
+
+		out = append(out, inst)
+	}
+
+	return out
+}
+
+// reapPrewarmed closes the per-instance connections in keys once idle for
+// the prewarm period. It returns when none of them is left
+func (cm *ConnManager) reapPrewarmed(keys []instanceKey) {
+	idle := cm.prewarmIdle
+	if idle == 0 {
+		idle = defaultPrewarmIdle
+	}
+
+	ticker := time.NewTicker(idle / 4)
+	defer ticker.Stop()
+
+	for len(keys) > 0 {
+		<-ticker.C
+
+		cutoff := time.Now().Add(-idle).UnixNano()
+		kept := keys[:0]
+
+		cm.mu.Lock()
+		for _, key := range keys {
+			mc, ok := cm.instanceConns[key]
+			if !ok {
+				continue
+			}
+
+			if mc.lastUsed.Load() > cutoff {
+				kept = append(kept, key)
+
+				continue
+			}
+
+			delete(cm.instanceConns, key)
+
+			if err := cm.releaseLocked(mc.conn); err != nil {
+				cm.logger.Warn("close instance conn", zap.String("service", key.service), zap.String("instance", key.id), zap.Error(err))
+			}
+
+			cm.logger.Debug("closed idle prewarmed conn", zap.String("service", key.service), zap.String("instance", key.id))
+		}
+		cm.mu.Unlock()
+
+		keys = kept
+	}
+}
@@ -0,0 +1,90 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestPrewarm_ConnectsAndReleases(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithPrewarmIdle(100*time.Millisecond))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", startGRPCServer(t), startGRPCServer(t), startGRPCServer(t))); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cm.Prewarm(ctx, []string{"svc"}, 2); err != nil {
+		t.Fatalf("prewarm: %v", err)
+	}
+
+	primary, _ := cm.GetConn("svc")
+	if state := primary.GetState(); state != connectivity.Ready {
+		t.Errorf("service conn state = %s, want READY", state)
+	}
+
+	cm.mu.RLock()
+	warm := len(cm.instanceConns)
+	cm.mu.RUnlock()
+
+	if warm != 1 {
+		t.Fatalf("prewarmed instance conns = %d, want 1 besides the service conn", warm)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cm.mu.RLock()
+		left := len(cm.instanceConns)
+		cm.mu.RUnlock()
+
+		if left == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("idle prewarmed conn was not released")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestPrewarm_SharedID(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := cm.refresh(t.Context(), "svc", sharedIDEntries("svc", startGRPCServer(t), startGRPCServer(t), startGRPCServer(t))); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cm.Prewarm(ctx, []string{"svc"}, 3); err != nil {
+		t.Fatalf("prewarm: %v", err)
+	}
+
+	cm.mu.RLock()
+	warm := len(cm.instanceConns)
+	cm.mu.RUnlock()
+
+	if warm != 2 {
+		t.Errorf("prewarmed instance conns = %d, want one per node besides the service conn", warm)
+	}
+}
+
+func TestPrewarm_Errors(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := cm.Prewarm(context.Background(), []string{"svc"}, 0); err == nil {
+		t.Error("expected error for non-positive count")
+	}
+
+	if err := cm.Prewarm(context.Background(), []string{"other"}, 1); !errors.Is(err, errUnknownService) {
+		t.Errorf("err = %v, want unknown service", err)
+	}
+}
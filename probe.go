@@ -0,0 +1,83 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// WithProbe invokes method with an empty request on every service connection
+// each interval, so mostly idle connections still yield a round-trip time.
+// Any response from the server counts, including an error status such as
+// Unimplemented: a method the server does not serve works as a ping. The RTT
+// is reported as MetricProbeRTT and kept as Signals.ProbeRTT for a Scorer;
+// unavailable or timed out probes count as failures. An empty method probes
+// the standard gRPC health service
+func WithProbe(interval time.Duration, method string) Option {
+	return func(cm *ConnManager) error {
+		if interval <= 0 {
+			return errors.New("probe_interval_must_be_positive")
+		}
+
+		if method == "" {
+			method = healthpb.Health_Check_FullMethodName
+		}
+
+		cm.probeInterval = interval
+		cm.probeMethod = method
+		cm.background = append(cm.background, cm.runProbes)
+
+		return nil
+	}
+}
+
+// runProbes probes the service connections every interval until ctx is done
+func (cm *ConnManager) runProbes(ctx context.Context) {
+	ticker := time.NewTicker(cm.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for service, mc := range cm.loadTopology().conns {
+			cm.probe(ctx, service, mc)
+		}
+	}
+}
+
+// probe measures one round trip over mc, bounded by the probe interval
+func (cm *ConnManager) probe(ctx context.Context, service string, mc *managedConn) {
+	ctx, cancel := context.WithTimeout(ctx, cm.probeInterval)
+	defer cancel()
+
+	start := time.Now()
+	err := mc.conn.Invoke(ctx, cm.probeMethod, &emptypb.Empty{}, &emptypb.Empty{})
+	rtt := time.Since(start)
+
+	if ctx.Err() == context.Canceled {
+		return
+	}
+
+	key := instanceKey{service: service, instanceRef: mc.ref()}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		cm.signals.failed(key)
+		cm.logger.Debug("probe failed", zap.String("service", service), zap.String("target", mc.target), zap.Error(err))
+
+		return
+	}
+
+	cm.signals.probed(key, rtt)
+	cm.metrics.ObserveDuration(MetricProbeRTT, rtt, serviceLabel(service))
+}
@@ -0,0 +1,64 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// durationSink records observed durations by metric name
+type durationSink struct {
+	recordingSink
+	durations map[string][]time.Duration
+}
+
+func (d *durationSink) ObserveDuration(name string, v time.Duration, _ ...Label) {
+	d.durations[name] = append(d.durations[name], v)
+}
+
+func TestProbe_RecordsRTT(t *testing.T) {
+	for _, method := range []string{"", "/probe.Ping/Ping"} {
+		t.Run("method="+method, func(t *testing.T) {
+			sink := &durationSink{recordingSink: *newRecordingSink(), durations: map[string][]time.Duration{}}
+			cm := newTestManager(t, []string{"svc"}, WithProbe(time.Second, method), WithMetrics(sink))
+
+			if err := cm.refresh(t.Context(), "svc", testEntries("svc", startGRPCServer(t))); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			mc := cm.loadTopology().conns["svc"]
+			cm.probe(context.Background(), "svc", mc)
+
+			sig := cm.signals.get(instanceKey{service: "svc", instanceRef: mc.ref()})
+			if sig.ProbeRTT <= 0 {
+				t.Errorf("ProbeRTT = %s, want a round trip", sig.ProbeRTT)
+			}
+
+			if len(sink.durations[MetricProbeRTT]) != 1 {
+				t.Errorf("probe RTT observations = %d, want 1", len(sink.durations[MetricProbeRTT]))
+			}
+		})
+	}
+}
+
+func TestProbe_UnreachableCountsAsFailure(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithProbe(200*time.Millisecond, ""))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", closedPort(t))); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	mc := cm.loadTopology().conns["svc"]
+	cm.probe(context.Background(), "svc", mc)
+
+	sig := cm.signals.get(instanceKey{service: "svc", instanceRef: mc.ref()})
+	if sig.Failures != 1 || sig.ProbeRTT != 0 {
+		t.Errorf("signals = %+v, want one failure and no RTT", sig)
+	}
+}
+
+func TestWithProbe_RejectsNonPositiveInterval(t *testing.T) {
+	if err := WithProbe(0, "")(&ConnManager{}); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
@@ -0,0 +1,32 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// pprof label keys set on discovery goroutines, so CPU and goroutine
+// profiles (e.g. `go tool pprof -tagfocus consul_sd_service=users`)
+// attribute work per watched service
+const (
+	ProfileLabelService = "consul_sd_service"
+	ProfileLabelTarget  = "consul_sd_target" // set while dialing
+)
+
+// watchLabeled runs the watcher of service with its pprof label. Goroutines
+// it starts, e.g. Consul HTTP requests, inherit the label
+func (cm *ConnManager) watchLabeled(ctx context.Context, service string) {
+	pprof.Do(ctx, pprof.Labels(ProfileLabelService, service), func(ctx context.Context) {
+		cm.watchService(ctx, service)
+	})
+}
+
+// dialLabeled runs dial with the service and target pprof labels, which
+// also tag the resolver and transport goroutines gRPC starts during it
+func dialLabeled(service, target string, dial func()) {
+	labels := pprof.Labels(ProfileLabelService, service, ProfileLabelTarget, target)
+
+	pprof.Do(context.Background(), labels, func(context.Context) {
+		dial()
+	})
+}
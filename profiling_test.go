@@ -0,0 +1,58 @@
+package consul_service_discovery
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+// goroutineLabels returns the debug=1 goroutine profile, which lists the
+// labels of each goroutine group
+func goroutineLabels(t *testing.T) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		t.Fatalf("goroutine profile: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestProfileLabels_Watcher(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithWaitTime(time.Minute))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.Start(ctx)
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if profile := goroutineLabels(t); !strings.Contains(profile, `"consul_sd_service":"svc"`) {
+		t.Errorf("no goroutine labeled with the service:\n%s", profile)
+	}
+}
+
+func TestProfileLabels_Dial(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	dialLabeled("users", "10.0.0.1:9000", func() {
+		go func() { <-release }() // stands in for a gRPC transport goroutine
+	})
+
+	profile := goroutineLabels(t)
+
+	if !strings.Contains(profile, `"consul_sd_target":"10.0.0.1:9000"`) || !strings.Contains(profile, `"consul_sd_service":"users"`) {
+		t.Errorf("dial goroutine not labeled:\n%s", profile)
+	}
+}
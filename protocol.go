@@ -0,0 +1,117 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Protocol is how a service is consumed
+type Protocol string
+
+const (
+	// ProtocolGRPC dials a gRPC ClientConn (default)
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolHTTP exposes a plain HTTP base URL instead of a ClientConn
+	ProtocolHTTP Protocol = "http"
+	// ProtocolHTTPS is ProtocolHTTP over TLS
+	ProtocolHTTPS Protocol = "https"
+	// ProtocolGRPCWeb exposes a base URL for gRPC-Web clients
+	ProtocolGRPCWeb Protocol = "grpc-web"
+	// ProtocolGRPCWebTLS is ProtocolGRPCWeb over TLS
+	ProtocolGRPCWebTLS Protocol = "grpc-web+tls"
+)
+
+// scheme returns the URL scheme of an HTTP-based protocol
+func (p Protocol) scheme() string {
+	switch p {
+	case ProtocolHTTPS, ProtocolGRPCWebTLS:
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// WithServiceProtocol sets how service is consumed. For HTTP and gRPC-Web
+// services no ClientConn is dialed: the selected instance is exposed through
+// GetBaseURL and HTTPClient instead, e.g. for a BFF calling both gRPC and
+// HTTP upstreams. GetConn fails for them
+func WithServiceProtocol(service string, p Protocol) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		switch p {
+		case ProtocolGRPC:
+			delete(cm.protocols, service)
+		case ProtocolHTTP, ProtocolHTTPS, ProtocolGRPCWeb, ProtocolGRPCWebTLS:
+			cm.protocols[service] = p
+		default:
+			return fmt.Errorf("unsupported protocol %q", p)
+		}
+
+		return nil
+	}
+}
+
+// isHTTP reports whether service is consumed over HTTP rather than gRPC
+func (cm *ConnManager) isHTTP(service string) bool {
+	_, ok := cm.protocols[service]
+
+	return ok
+}
+
+// GetBaseURL returns the base URL of the selected instance of an HTTP or
+// gRPC-Web service, e.g. http://10.0.0.5:8080
+func (cm *ConnManager) GetBaseURL(service string) (*url.URL, error) {
+	p, ok := cm.protocols[service]
+	if !ok {
+		return nil, errors.New("not_an_http_service")
+	}
+
+	cm.mu.RLock()
+	target, selected := cm.selected[service]
+	cm.mu.RUnlock()
+
+	if !selected {
+		return nil, fmt.Errorf("%w: %s", ErrConnNotFound, service)
+	}
+
+	// base URLs carry the host only, not a gRPC resolver scheme
+	if _, host, found := strings.Cut(target, ":///"); found {
+		target = host
+	}
+
+	return &url.URL{Scheme: p.scheme(), Host: target}, nil
+}
+
+// HTTPClient returns a client for an HTTP or gRPC-Web service that sends
+// every request to the currently selected instance: the scheme and host of
+// request URLs are replaced with those of GetBaseURL
+func (cm *ConnManager) HTTPClient(service string) *http.Client {
+	return &http.Client{Transport: &baseURLTransport{cm: cm, service: service, base: http.DefaultTransport}}
+}
+
+// baseURLTransport routes requests to the base URL of a service
+type baseURLTransport struct {
+	cm      *ConnManager
+	service string
+	base    http.RoundTripper
+}
+
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := t.cm.GetBaseURL(t.service)
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme = u.Scheme
+	out.URL.Host = u.Host
+	out.Host = ""
+
+	return t.base.RoundTrip(out)
+}
@@ -0,0 +1,63 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestServiceProtocol_HTTP(t *testing.T) {
+	port := startHTTPServer(t, "hello")
+	cm := newTestManager(t, []string{"web", "users"},
+		WithServiceProtocol("web", ProtocolHTTP),
+		WithTargetScheme("dns"),
+	)
+
+	if err := cm.refresh(t.Context(), "web", testEntries("web", port)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("web"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("http service should have no ClientConn, err = %v", err)
+	}
+
+	u, err := cm.GetBaseURL("web")
+	if err != nil {
+		t.Fatalf("base url: %v", err)
+	}
+
+	if want := "http://127.0.0.1:" + strconv.Itoa(port); u.String() != want {
+		t.Errorf("base url = %s, want %s", u, want)
+	}
+
+	resp, err := cm.HTTPClient("web").Get("http://web/greeting")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello" {
+		t.Errorf("body = %q", body)
+	}
+
+	if _, err := cm.GetBaseURL("users"); err == nil {
+		t.Error("gRPC service should have no base URL")
+	}
+}
+
+func TestServiceProtocol_NoInstances(t *testing.T) {
+	cm := newTestManager(t, []string{"web"}, WithServiceProtocol("web", ProtocolGRPCWebTLS))
+
+	if _, err := cm.GetBaseURL("web"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("err = %v, want ErrConnNotFound", err)
+	}
+
+	if _, err := cm.HTTPClient("web").Get("http://web/"); !errors.Is(err, ErrConnNotFound) {
+		t.Errorf("err = %v, want ErrConnNotFound", err)
+	}
+
+	if err := WithServiceProtocol("web", Protocol("ftp"))(cm); err == nil {
+		t.Error("expected error for unsupported protocol")
+	}
+}
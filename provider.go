@@ -0,0 +1,26 @@
+package consul_service_discovery
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// ConnProvider is the part of ConnManager application code uses while
+// serving. Depend on it rather than on *ConnManager to unit test that code
+// without a running manager, e.g. with connmock.Provider or a gomock or
+// testify mock of it
+type ConnProvider interface {
+	GetConn(service string) (*grpc.ClientConn, error)
+	GetConnContext(ctx context.Context, service string) (*grpc.ClientConn, error)
+	GetConnInfo(service string) (ConnInfo, error)
+	GetConnMap(services ...string) (map[string]*grpc.ClientConn, error)
+	GetConnAny(ctx context.Context, services ...string) (*grpc.ClientConn, string, error)
+	Invoke(ctx context.Context, service, method string, args, reply any, opts ...grpc.CallOption) error
+	Instances(service string) ([]Instance, error)
+	Status() []ServiceStatus
+	Ready() bool
+	WaitReady(ctx context.Context) error
+}
+
+var _ ConnProvider = (*ConnManager)(nil)
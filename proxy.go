@@ -0,0 +1,188 @@
+package consul_service_discovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialFunc is the signature accepted by grpc.WithContextDialer
+type dialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// WithProxy tunnels every connection through a proxy. Supported URL schemes
+// are socks5/socks5h and http/https (HTTP CONNECT); credentials in the URL
+// are used for proxy authentication. Host names are still resolved locally by
+// gRPC's default dns resolver, so the proxy is asked for the resulting
+// addresses; combine with WithTargetScheme("passthrough") to have the proxy
+// resolve them instead, e.g. for names only known on its side
+func WithProxy(rawURL string) Option {
+	return func(cm *ConnManager) error {
+		d, err := proxyDialer(rawURL)
+		if err != nil {
+			return err
+		}
+
+		cm.proxyDial = d
+		cm.proxyOptions = append(cm.proxyOptions, "WithProxy")
+
+		return nil
+	}
+}
+
+// WithServiceProxy tunnels connections to one service through a proxy,
+// overriding WithProxy for that service. See WithProxy for supported URLs
+func WithServiceProxy(service, rawURL string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		d, err := proxyDialer(rawURL)
+		if err != nil {
+			return err
+		}
+
+		cm.serviceProxies[service] = d
+
+		return nil
+	}
+}
+
+// dialerFor returns the custom dialer for service, or nil for direct dialing
+func (cm *ConnManager) dialerFor(service string) dialFunc {
+	if d, ok := cm.serviceProxies[service]; ok {
+		return d
+	}
+
+	return cm.proxyDial
+}
+
+func proxyDialer(rawURL string) (dialFunc, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy url: %w", err)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("proxy_url_missing_host")
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return httpConnectDialer(u), nil
+	case "socks5", "socks5h":
+		return socksDialer(u)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+func socksDialer(u *url.URL) (dialFunc, error) {
+	d, err := proxy.FromURL(u, proxy.Direct)
+	if err != nil {
+		return nil, fmt.Errorf("socks proxy: %w", err)
+	}
+
+	cd, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("socks proxy: dialer lacks context support")
+	}
+
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return cd.DialContext(ctx, "tcp", addr)
+	}, nil
+}
+
+// httpConnectDialer opens a tunnel with an HTTP CONNECT request
+func httpConnectDialer(u *url.URL) dialFunc {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("dial proxy %s: %w", u.Host, err)
+		}
+
+		if u.Scheme == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+
+				return nil, fmt.Errorf("proxy tls handshake: %w", err)
+			}
+
+			conn = tlsConn
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		tunnel, err := connectTunnel(conn, u, addr)
+		if err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+
+		_ = conn.SetDeadline(time.Time{})
+
+		return tunnel, nil
+	}
+}
+
+// connectTunnel issues CONNECT addr over conn and returns the tunneled conn
+func connectTunnel(conn net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("write connect request: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("read connect response: %w", err)
+	}
+
+	// A successful CONNECT has no body; on failure the caller closes conn, so
+	// there is no need to drain a possibly close-delimited error body
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy connect %s: %s", addr, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn replays bytes the proxy sent right after its CONNECT response
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
@@ -0,0 +1,119 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startEcho serves a TCP echo server and returns its address
+func startEcho(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// connectProxy is a minimal HTTP CONNECT proxy requiring basic auth
+func connectProxy(t *testing.T, user, pass string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := parseProxyAuth(r); !ok || u != user || p != pass {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		client, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+
+		defer upstream.Close()
+		defer client.Close()
+
+		go func() { _, _ = io.Copy(client, upstream) }()
+		_, _ = io.Copy(upstream, client)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func parseProxyAuth(r *http.Request) (string, string, bool) {
+	r2 := &http.Request{Header: http.Header{"Authorization": r.Header["Proxy-Authorization"]}}
+
+	return r2.BasicAuth()
+}
+
+func TestHTTPConnectDialer(t *testing.T) {
+	echo := startEcho(t)
+	proxySrv := connectProxy(t, "alice", "secret")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	dial, err := proxyDialer("http://alice:secret@" + proxySrv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("proxy dialer: %v", err)
+	}
+
+	conn, err := dial(ctx, echo)
+	if err != nil {
+		t.Fatalf("dial through proxy: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo through tunnel = %q, %v", buf, err)
+	}
+
+	bad, _ := proxyDialer("http://alice:wrong@" + proxySrv.Listener.Addr().String())
+	if _, err := bad(ctx, echo); err == nil {
+		t.Error("expected error for rejected proxy credentials")
+	}
+}
+
+func TestProxyDialer_RejectsUnknownScheme(t *testing.T) {
+	if _, err := proxyDialer("ftp://proxy:21"); err == nil {
+		t.Error("expected error for ftp proxy")
+	}
+}
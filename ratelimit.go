@@ -0,0 +1,136 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// maxRetryAfter caps a Retry-After delay, so a bogus header cannot stall
+// discovery indefinitely
+const maxRetryAfter = 5 * time.Minute
+
+// ErrConsulRateLimited is matched (via errors.Is) by *RateLimitError
+var ErrConsulRateLimited = errors.New("consul_rate_limited")
+
+// RateLimitError reports a Consul request rejected with 429 Too Many
+// Requests and a Retry-After header, see RateLimitTransport
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrConsulRateLimited, e.RetryAfter)
+}
+
+// Unwrap makes errors.Is(err, ErrConsulRateLimited) hold
+func (e *RateLimitError) Unwrap() error { return ErrConsulRateLimited }
+
+// RateLimitTransport wraps base (http.DefaultTransport when nil) so that 429
+// responses carrying Retry-After fail with *RateLimitError. The Consul API
+// client drops response headers from errors; install the transport in the
+// client's api.Config.HttpClient to let watchers honor the server's delay.
+// Without it, a 429 backs off for the retry interval. 429s without the
+// header, such as agent health endpoints reporting a warning, pass through
+func RateLimitTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return rateLimitTransport{base: base}
+}
+
+type rateLimitTransport struct {
+	base http.RoundTripper
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return resp, nil
+	}
+
+	_ = resp.Body.Close()
+
+	return nil, &RateLimitError{RetryAfter: delay}
+}
+
+// parseRetryAfter reads a Retry-After value in seconds or as an HTTP date
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return min(time.Duration(secs)*time.Second, maxRetryAfter), true
+	}
+
+	if at, err := http.ParseTime(v); err == nil {
+		return min(max(at.Sub(now), 0), maxRetryAfter), true
+	}
+
+	return 0, false
+}
+
+// rateLimitDelay reports whether err is a Consul rate-limit rejection and
+// how long to hold queries because of it
+func (cm *ConnManager) rateLimitDelay(err error) (time.Duration, bool) {
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		if rle.RetryAfter > 0 {
+			return rle.RetryAfter, true
+		}
+
+		return backoff(cm.retryInterval), true
+	}
+
+	var se api.StatusError
+	if errors.As(err, &se) && se.Code == http.StatusTooManyRequests {
+		return backoff(cm.retryInterval), true
+	}
+
+	return 0, false
+}
+
+// holdQueries stops every watcher of cm from querying Consul for d, since
+// agent rate limits apply to the client as a whole
+func (cm *ConnManager) holdQueries(service string, d time.Duration, err error) {
+	until := time.Now().Add(d).UnixNano()
+
+	for {
+		cur := cm.queryHold.Load()
+		if cur >= until || cm.queryHold.CompareAndSwap(cur, until) {
+			break
+		}
+	}
+
+	cm.metrics.IncrCounter(MetricRateLimited, 1, serviceLabel(service))
+	cm.emit(Event{Type: EventRateLimited, Service: service, Err: err})
+
+	cm.logger.Warn("consul rate limited; holding all queries",
+		zap.String("service", service),
+		zap.Duration("retry_after", d),
+	)
+}
+
+// waitQueryHold sleeps out a hold set by holdQueries. It reports false when
+// ctx is done first
+func (cm *ConnManager) waitQueryHold(ctx context.Context) bool {
+	d := time.Until(time.Unix(0, cm.queryHold.Load()))
+	if d <= 0 {
+		return true
+	}
+
+	return sleepCtx(ctx, d)
+}
@@ -0,0 +1,191 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// rateLimitedConsul answers the first health query with 429 and Retry-After
+// and records when every health query arrived
+type rateLimitedConsul struct {
+	*fakeConsul
+
+	mu       sync.Mutex
+	limited  bool
+	limitAt  time.Time
+	arrivals []time.Time
+}
+
+func (f *rateLimitedConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/v1/health/service/") {
+		f.mu.Lock()
+		now := time.Now()
+		f.arrivals = append(f.arrivals, now)
+		first := !f.limited
+		if first {
+			f.limited, f.limitAt = true, now
+		}
+		f.mu.Unlock()
+
+		if first {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+
+			return
+		}
+	}
+
+	f.fakeConsul.ServeHTTP(w, r)
+}
+
+func TestWatch_RateLimitHoldsAllWatchers(t *testing.T) {
+	fake := &rateLimitedConsul{fakeConsul: newFakeConsul()}
+	fake.setInstances("a", 9001)
+	fake.setInstances("b", 9002)
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = srv.URL
+	cfg.HttpClient = &http.Client{Transport: RateLimitTransport(nil)}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("new consul client: %v", err)
+	}
+
+	rec := &eventRecorder{}
+
+	cm, err := New(client, []string{"a", "b"},
+		WithWaitTime(20*time.Millisecond),
+		WithRetryInterval(10*time.Millisecond),
+		WithEventHandler(rec.handle),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "a")
+	waitTarget(t, cm, "a", "127.0.0.1:9001")
+
+	go cm.watchService(ctx, "b")
+	waitTarget(t, cm, "b", "127.0.0.1:9002")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	for _, at := range fake.arrivals[1:] {
+		if d := at.Sub(fake.limitAt); d < 900*time.Millisecond {
+			t.Fatalf("query %s after the 429, want none before Retry-After", d)
+		}
+	}
+
+	var limited bool
+	for _, typ := range rec.types() {
+		limited = limited || typ == EventRateLimited
+	}
+
+	if !limited {
+		t.Error("no rate limited event")
+	}
+}
+
+func TestHoldQueries_KeepsLongestHold(t *testing.T) {
+	sink := newRecordingSink()
+	cm := newTestManager(t, []string{"svc"})
+	cm.metrics = fanoutSink{sink}
+
+	cm.holdQueries("svc", time.Hour, ErrConsulRateLimited)
+	long := cm.queryHold.Load()
+
+	cm.holdQueries("svc", time.Second, ErrConsulRateLimited)
+
+	if cm.queryHold.Load() != long {
+		t.Error("shorter hold replaced a longer one")
+	}
+
+	if sink.counters[MetricRateLimited] != 2 {
+		t.Errorf("rate limited = %v, want 2", sink.counters[MetricRateLimited])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if cm.waitQueryHold(ctx) {
+		t.Error("wait returned true for a canceled context during a hold")
+	}
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	cm := &ConnManager{retryInterval: time.Second}
+
+	if d, ok := cm.rateLimitDelay(&RateLimitError{RetryAfter: 3 * time.Second}); !ok || d != 3*time.Second {
+		t.Errorf("retry after delay = %s, %v", d, ok)
+	}
+
+	if d, ok := cm.rateLimitDelay(api.StatusError{Code: http.StatusTooManyRequests}); !ok || d < time.Second {
+		t.Errorf("bare 429 delay = %s, %v", d, ok)
+	}
+
+	if _, ok := cm.rateLimitDelay(api.StatusError{Code: http.StatusInternalServerError}); ok {
+		t.Error("500 treated as rate limited")
+	}
+
+	if !errors.Is(&RateLimitError{}, ErrConsulRateLimited) {
+		t.Error("RateLimitError does not match ErrConsulRateLimited")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"junk", 0, false},
+		{"7", 7 * time.Second, true},
+		{"86400", maxRetryAfter, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+
+	for _, c := range cases {
+		got, ok := parseRetryAfter(c.in, now)
+		if got != c.want || ok != c.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", c.in, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestRateLimitTransport_PassesBare429(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := (&http.Client{Transport: RateLimitTransport(nil)}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429 passed through", resp.StatusCode)
+	}
+}
@@ -0,0 +1,91 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithOptionalServices marks watched services as soft dependencies: they are
+// discovered and connected as usual, but their absence does not affect Ready
+// or WaitReady. All other watched services are required
+func WithOptionalServices(names ...string) Option {
+	return func(cm *ConnManager) error {
+		for _, name := range names {
+			if err := cm.checkWatched(name); err != nil {
+				return err
+			}
+
+			cm.optional[name] = struct{}{}
+		}
+
+		return nil
+	}
+}
+
+// Ready reports whether every required service has a connection (in dry-run
+// mode: a selected target)
+func (cm *ConnManager) Ready() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return len(cm.missingRequiredLocked()) == 0
+}
+
+// WaitReady blocks until every required service has a connection or ctx is
+// done. On timeout the error wraps ctx.Err() and names the missing services
+func (cm *ConnManager) WaitReady(ctx context.Context) error {
+	for {
+		cm.mu.RLock()
+		missing := cm.missingRequiredLocked()
+		changed := cm.changed
+		cm.mu.RUnlock()
+
+		if len(missing) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait ready: %w: %w", ctx.Err(), &MissingServicesError{Services: missing})
+		case <-changed:
+		}
+	}
+}
+
+// isOptional reports whether service was marked with WithOptionalServices
+func (cm *ConnManager) isOptional(service string) bool {
+	_, ok := cm.optional[service]
+
+	return ok
+}
+
+// missingRequiredLocked lists required services without a connection. cm.mu
+// must be held
+func (cm *ConnManager) missingRequiredLocked() []string {
+	var missing []string
+
+	for _, svc := range cm.watchList {
+		if cm.isOptional(svc) {
+			continue
+		}
+
+		_, connected := cm.conns[svc]
+		_, selected := cm.selected[svc]
+
+		if !connected && !selected {
+			missing = append(missing, svc)
+		}
+	}
+
+	return missing
+}
+
+// notifyLocked wakes everything waiting for a connection change. cm.mu must
+// be held for writing
+func (cm *ConnManager) notifyLocked() {
+	if cm.changed != nil {
+		close(cm.changed)
+	}
+
+	cm.changed = make(chan struct{})
+}
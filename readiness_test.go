@@ -0,0 +1,56 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReady_IgnoresOptionalServices(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "recommendations"}, WithOptionalServices("recommendations"))
+
+	if cm.Ready() {
+		t.Fatal("ready before required service is connected")
+	}
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if !cm.Ready() {
+		t.Error("missing optional service should not affect readiness")
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := cm.WaitReady(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrConnNotFound) {
+		t.Fatalf("err = %v, want deadline exceeded naming missing services", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = cm.refresh(t.Context(), "users", testEntries("users", 9001))
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := cm.WaitReady(ctx); err != nil {
+		t.Errorf("wait ready: %v", err)
+	}
+}
+
+func TestWithOptionalServices_UnknownService(t *testing.T) {
+	cm := &ConnManager{watchList: []string{"users"}, optional: map[string]struct{}{}}
+
+	if err := WithOptionalServices("billing")(cm); !errors.Is(err, errUnknownService) {
+		t.Errorf("err = %v, want errUnknownService", err)
+	}
+}
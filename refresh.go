@@ -0,0 +1,91 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrServicePaused is returned by Refresh for a paused service
+var ErrServicePaused = errors.New("service_discovery_paused")
+
+// Refresh interrupts the blocking query of service, re-reads its healthy set
+// from Consul without waiting for a change and re-runs selection. It returns
+// once that round is done, with its query or selection error, or when ctx
+// is done. The manager must be started; concurrent calls may share a round
+func (cm *ConnManager) Refresh(ctx context.Context, service string) error {
+	if err := cm.checkWatched(service); err != nil {
+		return err
+	}
+
+	if cm.Paused(service) {
+		return fmt.Errorf("%w: %s", ErrServicePaused, service)
+	}
+
+	ws := cm.watchStates[service]
+	gen := ws.request()
+
+	for {
+		done, err, ch := ws.served(gen)
+		if done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("refresh %s: %w", service, ctx.Err())
+		case <-ch:
+		}
+	}
+}
+
+// request records a Refresh call and kicks the watcher, returning the
+// generation the caller waits for
+func (ws *watchState) request() uint64 {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.refreshReq++
+	ws.kicked = true
+
+	if ws.cancel != nil {
+		ws.cancel()
+	}
+
+	return ws.refreshReq
+}
+
+// finish records that a round whose query began at generation gen ended
+// with err, and reports whether later requests still wait for a round
+func (ws *watchState) finish(gen uint64, err error) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if gen > ws.refreshDone {
+		ws.refreshDone, ws.refreshErr = gen, err
+
+		if ws.refreshed != nil {
+			close(ws.refreshed)
+			ws.refreshed = nil
+		}
+	}
+
+	return ws.refreshReq > gen
+}
+
+// served reports whether generation gen has been answered and with which
+// error; otherwise it returns a channel closed on the next answer
+func (ws *watchState) served(gen uint64) (bool, error, <-chan struct{}) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.refreshDone >= gen {
+		return true, ws.refreshErr, nil
+	}
+
+	if ws.refreshed == nil {
+		ws.refreshed = make(chan struct{})
+	}
+
+	return false, nil, ws.refreshed
+}
@@ -0,0 +1,90 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRefresh_InterruptsBlockingQuery(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithWaitTime(10*time.Minute))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	// change content without bumping the index, so the blocking query
+	// would not return on its own
+	fake.mu.Lock()
+	fake.services["svc"] = testEntries("svc", 9002)
+	fake.mu.Unlock()
+
+	rctx, rcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer rcancel()
+
+	if err := cm.Refresh(rctx, "svc"); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if got := connTarget(cm, "svc"); got != "127.0.0.1:9002" {
+		t.Errorf("target after refresh = %q, want 127.0.0.1:9002", got)
+	}
+}
+
+func TestRefresh_Errors(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := cm.Refresh(context.Background(), "other"); err == nil {
+		t.Error("refresh of an unwatched service succeeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := cm.Refresh(ctx, "svc"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("refresh without a watcher = %v, want deadline exceeded", err)
+	}
+
+	if err := cm.Pause("svc"); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	if err := cm.Refresh(context.Background(), "svc"); !errors.Is(err, ErrServicePaused) {
+		t.Errorf("refresh while paused = %v, want ErrServicePaused", err)
+	}
+}
+
+func TestWatchState_RefreshGenerations(t *testing.T) {
+	ws := &watchState{}
+
+	first := ws.request()
+	second := ws.request()
+
+	if !ws.finish(first, nil) {
+		t.Error("pending second request not reported")
+	}
+
+	if done, _, _ := ws.served(second); done {
+		t.Error("second request answered by an earlier round")
+	}
+
+	want := errors.New("boom")
+	if ws.finish(second, want) {
+		t.Error("no request should be pending")
+	}
+
+	if done, err, _ := ws.served(first); !done || err != want {
+		t.Errorf("served = %v, %v; want the latest round's error", done, err)
+	}
+}
@@ -0,0 +1,62 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"slices"
+)
+
+// DatacenterRegion is the WithRegionAffinity key matching regions against
+// the Consul datacenter of the instance's node instead of metadata
+const DatacenterRegion = ""
+
+// WithRegionAffinity makes selection prefer instances in the earliest listed
+// region, falling back down the list only when no eligible instance is in
+// it, and to every instance when none is in any. The region of an instance
+// is its service Meta value for metaKey, else its node Meta value, or its
+// datacenter for DatacenterRegion. It suits flat topologies where a region
+// is a metadata label rather than a separate datacenter
+func WithRegionAffinity(metaKey string, preferred []string) Option {
+	return func(cm *ConnManager) error {
+		if len(preferred) == 0 || slices.Contains(preferred, "") {
+			return errors.New("empty_region_preference")
+		}
+
+		cm.regionKey = metaKey
+		cm.regions = slices.Clone(preferred)
+
+		return nil
+	}
+}
+
+// preferRegion narrows candidates to the instances in the most preferred
+// region any of them is in
+func (cm *ConnManager) preferRegion(candidates []Instance) []Instance {
+	for _, region := range cm.regions {
+		var out []Instance
+
+		for _, inst := range candidates {
+			if cm.regionOf(inst) == region {
+				out = append(out, inst)
+			}
+		}
+
+		if len(out) > 0 {
+			return out
+		}
+	}
+
+	return candidates
+}
+
+// regionOf returns the region of inst, see WithRegionAffinity
+func (cm *ConnManager) regionOf(inst Instance) string {
+	if cm.regionKey == DatacenterRegion {
+		return inst.Datacenter
+	}
+
+	if region, ok := inst.Meta[cm.regionKey]; ok {
+		return region
+	}
+
+	return inst.NodeMeta[cm.regionKey]
+}
@@ -0,0 +1,87 @@
+package consul_service_discovery
+
+import (
+	"testing"
+)
+
+// regionInstances returns one instance per region, the region set in the
+// service Meta, the node Meta and as datacenter
+func regionInstances(regions ...string) []Instance {
+	out := make([]Instance, 0, len(regions))
+
+	for i, r := range regions {
+		out = append(out, Instance{
+			ID:         "svc-" + r,
+			Address:    "127.0.0.1",
+			Port:       9001 + i,
+			Meta:       map[string]string{"region": r},
+			NodeMeta:   map[string]string{"zone": r},
+			Datacenter: r,
+		})
+	}
+
+	return out
+}
+
+func TestRegionAffinity(t *testing.T) {
+	cases := []struct {
+		name      string
+		key       string
+		preferred []string
+		regions   []string
+		want      string
+	}{
+		{"first preferred", "region", []string{"eu", "us"}, []string{"us", "eu", "ap"}, "svc-eu"},
+		{"falls back down the list", "region", []string{"eu", "us"}, []string{"us", "ap"}, "svc-us"},
+		{"node meta", "zone", []string{"ap"}, []string{"us", "ap"}, "svc-ap"},
+		{"datacenter", DatacenterRegion, []string{"us"}, []string{"eu", "us"}, "svc-us"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cm := newTestManager(t, []string{"svc"}, WithRegionAffinity(c.key, c.preferred))
+
+			for range 20 {
+				inst, ok := cm.selectInstance("svc", regionInstances(c.regions...))
+				if !ok || inst.ID != c.want {
+					t.Fatalf("selected %q, want %q", inst.ID, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegionAffinity_NoMatchUsesAll(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithRegionAffinity("region", []string{"eu"}))
+
+	seen := make(map[string]bool)
+	for range 100 {
+		inst, ok := cm.selectInstance("svc", regionInstances("us", "ap"))
+		if !ok {
+			t.Fatal("no instance selected")
+		}
+
+		seen[inst.ID] = true
+	}
+
+	if len(seen) != 2 {
+		t.Errorf("selected %v, want both instances", seen)
+	}
+}
+
+func TestRegionAffinity_ServiceMetaWins(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithRegionAffinity("region", []string{"eu"}))
+
+	inst := Instance{Meta: map[string]string{"region": "us"}, NodeMeta: map[string]string{"region": "eu"}}
+	if got := cm.regionOf(inst); got != "us" {
+		t.Errorf("region = %q, want the service meta value", got)
+	}
+}
+
+func TestWithRegionAffinity_Validation(t *testing.T) {
+	for _, preferred := range [][]string{nil, {"eu", ""}} {
+		if err := WithRegionAffinity("region", preferred)(newTestManager(t, []string{"svc"})); err == nil {
+			t.Errorf("%q: expected an error", preferred)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// defaultCheckInterval applies to HTTP and gRPC checks without an interval
+const defaultCheckInterval = 10 * time.Second
+
+// Registration describes this process's own service instance for Register
+type Registration struct {
+	ID      string
+	Name    string
+	Address string
+	Port    int
+	Tags    []string
+	Meta    map[string]string
+	Checks  []CheckSpec
+}
+
+// CheckSpec declares one health check of a Registration. Exactly one of HTTP,
+// GRPC, TTL and AliasService must be set
+type CheckSpec struct {
+	ID           string // defaults to "service:<registration ID>:<n>", n from 1
+	Name         string
+	HTTP         string // URL polled every Interval
+	GRPC         string // host:port[/service] of a gRPC health server
+	GRPCUseTLS   bool
+	TTL          time.Duration // the process reports status itself
+	AliasService string        // mirrors the health of another service
+
+	Interval                time.Duration // HTTP and gRPC, default 10s
+	Timeout                 time.Duration
+	DeregisterCriticalAfter time.Duration
+}
+
+// checkType returns the agent's type name of the check
+func (c CheckSpec) checkType() (string, error) {
+	var kinds []string
+
+	if c.HTTP != "" {
+		kinds = append(kinds, "http")
+	}
+
+	if c.GRPC != "" {
+		kinds = append(kinds, "grpc")
+	}
+
+	if c.TTL > 0 {
+		kinds = append(kinds, "ttl")
+	}
+
+	if c.AliasService != "" {
+		kinds = append(kinds, "alias")
+	}
+
+	if len(kinds) != 1 {
+		return "", fmt.Errorf("check %q: exactly one of HTTP, GRPC, TTL and AliasService must be set", c.ID)
+	}
+
+	return kinds[0], nil
+}
+
+// interval returns the effective polling interval, zero for TTL and alias
+// checks
+func (c CheckSpec) interval() time.Duration {
+	if c.HTTP == "" && c.GRPC == "" {
+		return 0
+	}
+
+	if c.Interval > 0 {
+		return c.Interval
+	}
+
+	return defaultCheckInterval
+}
+
+// Register registers the instance of this process with the local agent,
+// reconciling its checks with the declared ones: checks whose definition
+// drifted (e.g. edited by hand) are updated and unknown checks of the
+// instance are removed, instead of failing. Drift is logged
+func (cm *ConnManager) Register(ctx context.Context, reg Registration) error {
+	if reg.ID == "" || reg.Name == "" {
+		return errors.New("empty_registration_id_or_name")
+	}
+
+	checks := slices.Clone(reg.Checks)
+	for i := range checks {
+		if checks[i].ID == "" {
+			checks[i].ID = "service:" + reg.ID + ":" + strconv.Itoa(i+1)
+		}
+
+		if _, err := checks[i].checkType(); err != nil {
+			return err
+		}
+	}
+
+	q := (&api.QueryOptions{}).WithContext(ctx)
+
+	existing, err := cm.client.Agent().ChecksWithFilterOpts(fmt.Sprintf("ServiceID == %q", reg.ID), q)
+	if err != nil {
+		return fmt.Errorf("list checks of %s: %w", reg.ID, err)
+	}
+
+	for _, d := range checkDrift(existing, checks) {
+		cm.logger.Info("reconciling check", zap.String("service", reg.Name), zap.String("id", reg.ID), zap.String("check", d))
+	}
+
+	svc := &api.AgentServiceRegistration{
+		ID:      reg.ID,
+		Name:    reg.Name,
+		Address: reg.Address,
+		Port:    reg.Port,
+		Tags:    reg.Tags,
+		Meta:    reg.Meta,
+		Checks:  agentChecks(checks),
+	}
+
+	opts := api.ServiceRegisterOpts{ReplaceExistingChecks: true}.WithContext(ctx)
+	if err := cm.client.Agent().ServiceRegisterOpts(svc, opts); err != nil {
+		return fmt.Errorf("register %s: %w", reg.ID, err)
+	}
+
+	cm.mu.Lock()
+	cm.registered[reg.ID] = reg.Name
+	cm.mu.Unlock()
+
+	return nil
+}
+
+// Deregister removes the instance id of this process from the local agent
+func (cm *ConnManager) Deregister(ctx context.Context, id string) error {
+	if err := cm.client.Agent().ServiceDeregisterOpts(id, (&api.QueryOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("deregister %s: %w", id, err)
+	}
+
+	cm.mu.Lock()
+	delete(cm.registered, id)
+	cm.mu.Unlock()
+
+	return nil
+}
+
+func agentChecks(checks []CheckSpec) api.AgentServiceChecks {
+	out := make(api.AgentServiceChecks, 0, len(checks))
+
+	for _, c := range checks {
+		ac := &api.AgentServiceCheck{
+			CheckID:      c.ID,
+			Name:         c.Name,
+			HTTP:         c.HTTP,
+			GRPC:         c.GRPC,
+			GRPCUseTLS:   c.GRPCUseTLS,
+			AliasService: c.AliasService,
+		}
+
+		if d := c.interval(); d > 0 {
+			ac.Interval = d.String()
+		}
+
+		if c.Timeout > 0 {
+			ac.Timeout = c.Timeout.String()
+		}
+
+		if c.TTL > 0 {
+			ac.TTL = c.TTL.String()
+		}
+
+		if c.DeregisterCriticalAfter > 0 {
+			ac.DeregisterCriticalServiceAfter = c.DeregisterCriticalAfter.String()
+		}
+
+		out = append(out, ac)
+	}
+
+	return out
+}
+
+// checkDrift describes how the registered checks differ from the declared
+// ones, one entry per check
+func checkDrift(existing map[string]*api.AgentCheck, declared []CheckSpec) []string {
+	var out []string
+
+	for _, c := range declared {
+		got, ok := existing[c.ID]
+		if !ok {
+			out = append(out, c.ID+": missing")
+
+			continue
+		}
+
+		typ, _ := c.checkType()
+		def := got.Definition
+
+		switch {
+		case got.Type != "" && got.Type != typ:
+			out = append(out, fmt.Sprintf("%s: type %s, want %s", c.ID, got.Type, typ))
+		case def.HTTP != c.HTTP || def.GRPC != c.GRPC:
+			out = append(out, c.ID+": target changed")
+		case c.interval() > 0 && def.IntervalDuration != c.interval():
+			out = append(out, fmt.Sprintf("%s: interval %s, want %s", c.ID, def.IntervalDuration, c.interval()))
+		case c.Timeout > 0 && def.TimeoutDuration != c.Timeout:
+			out = append(out, fmt.Sprintf("%s: timeout %s, want %s", c.ID, def.TimeoutDuration, c.Timeout))
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(existing)) {
+		if strings.HasPrefix(id, api.ServiceMaintPrefix) {
+			continue // maintenance mode is not a check definition
+		}
+
+		if !slices.ContainsFunc(declared, func(c CheckSpec) bool { return c.ID == id }) {
+			out = append(out, id+": not declared, removing")
+		}
+	}
+
+	return out
+}
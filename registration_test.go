@@ -0,0 +1,95 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestCheckDrift(t *testing.T) {
+	existing := map[string]*api.AgentCheck{
+		"http":                           {CheckID: "http", Type: "http", Definition: api.HealthCheckDefinition{HTTP: "http://127.0.0.1:8080/health", IntervalDuration: 30 * time.Second}},
+		"ttl":                            {CheckID: "ttl", Type: "ttl"},
+		"old":                            {CheckID: "old", Type: "tcp"},
+		api.ServiceMaintPrefix + "api-1": {CheckID: api.ServiceMaintPrefix + "api-1"},
+	}
+
+	declared := []CheckSpec{
+		{ID: "http", HTTP: "http://127.0.0.1:8080/health"},
+		{ID: "ttl", TTL: time.Minute},
+		{ID: "grpc", GRPC: "127.0.0.1:9000"},
+	}
+
+	want := []string{
+		"http: interval 30s, want 10s",
+		"grpc: missing",
+		"old: not declared, removing",
+	}
+
+	if got := checkDrift(existing, declared); !slices.Equal(got, want) {
+		t.Errorf("drift = %q, want %q", got, want)
+	}
+}
+
+func TestRegister_ReplacesChecks(t *testing.T) {
+	var (
+		registered api.AgentServiceRegistration
+		replace    string
+	)
+
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/agent/checks":
+			_ = json.NewEncoder(w).Encode(map[string]*api.AgentCheck{})
+		case "/v1/agent/service/register":
+			replace = r.URL.Query().Get("replace-existing-checks")
+			_ = json.NewDecoder(r.Body).Decode(&registered)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	cm, err := New(client, []string{"users"})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	err = cm.Register(context.Background(), Registration{
+		ID:   "api-1",
+		Name: "api",
+		Port: 9000,
+		Checks: []CheckSpec{
+			{GRPC: "127.0.0.1:9000", Interval: 5 * time.Second},
+			{AliasService: "api-sidecar-proxy"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if replace != "true" {
+		t.Errorf("replace-existing-checks = %q, want true", replace)
+	}
+
+	if len(registered.Checks) != 2 || registered.Checks[0].CheckID != "service:api-1:1" || registered.Checks[0].Interval != "5s" {
+		t.Errorf("checks = %+v", registered.Checks)
+	}
+}
+
+func TestRegister_InvalidCheck(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+
+	err := cm.Register(context.Background(), Registration{
+		ID:     "api-1",
+		Name:   "api",
+		Checks: []CheckSpec{{HTTP: "http://x", TTL: time.Second}},
+	})
+	if err == nil {
+		t.Error("expected error for a check with two kinds")
+	}
+}
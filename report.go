@@ -0,0 +1,333 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ConfigReport describes the effective configuration of a ConnManager after
+// all options were applied, for startup logs and support tickets. It
+// marshals to JSON as is; Markdown renders it for humans
+type ConfigReport struct {
+	Services      []ServiceConfigReport `json:"services"`
+	WaitTime      string                `json:"wait_time"`
+	RetryInterval string                `json:"retry_interval"`
+	ForcedRefresh string                `json:"forced_refresh,omitempty"`
+	QueryTimeout  string                `json:"query_timeout"`
+	TLS           string                `json:"tls"`
+	Selection     []string              `json:"selection"`
+	Connections   []string              `json:"connections,omitempty"`
+	Features      []string              `json:"features,omitempty"`
+}
+
+// ServiceConfigReport is the per-service part of a ConfigReport
+type ServiceConfigReport struct {
+	Name         string   `json:"name"`
+	ConsulName   string   `json:"consul_name"`
+	Optional     bool     `json:"optional,omitempty"`
+	Settings     []string `json:"settings,omitempty"`
+	PeerIdentity bool     `json:"peer_identity,omitempty"`
+}
+
+// ConfigReport returns the effective configuration
+func (cm *ConnManager) ConfigReport() ConfigReport {
+	r := ConfigReport{
+		WaitTime:      cm.waitTime.String(),
+		RetryInterval: cm.retryInterval.String(),
+		QueryTimeout:  cm.effectiveQueryTimeout().String(),
+		TLS:           cm.tlsMode(),
+		Selection:     cm.selectionReport(),
+		Connections:   cm.connectionsReport(),
+		Features:      cm.featuresReport(),
+	}
+
+	if cm.forcedRefresh > 0 {
+		r.ForcedRefresh = cm.forcedRefresh.String()
+	}
+
+	for _, svc := range cm.watchList {
+		_, identity := cm.peerCreds[svc]
+
+		r.Services = append(r.Services, ServiceConfigReport{
+			Name:         svc,
+			ConsulName:   cm.consulName(svc),
+			Optional:     cm.isOptional(svc),
+			Settings:     cm.serviceSettings(svc),
+			PeerIdentity: identity,
+		})
+	}
+
+	return r
+}
+
+// tlsMode summarizes the transport credentials of service connections. Dial
+// options are opaque, so extra ones are reported as custom
+func (cm *ConnManager) tlsMode() string {
+	mode := "insecure"
+	if len(cm.dialOpts) > 1 {
+		mode = "custom dial options"
+	}
+
+	if len(cm.peerCreds) > 0 {
+		mode += ", peer identity for some services"
+	}
+
+	return mode
+}
+
+func (cm *ConnManager) selectionReport() []string {
+	var out []string
+
+	if cm.checkInterpreter != nil {
+		out = append(out, fmt.Sprintf("avoid load >= %g", cm.maxLoad))
+	}
+
+	if cm.stickyRecovery {
+		out = append(out, "sticky recovery")
+	}
+
+	if len(cm.regions) > 0 {
+		key := cm.regionKey
+		if key == DatacenterRegion {
+			key = "datacenter"
+		}
+
+		out = append(out, fmt.Sprintf("region affinity by %s: %s", key, strings.Join(cm.regions, " > ")))
+	}
+
+	if len(cm.antiAffinity) > 0 {
+		out = append(out, fmt.Sprintf("node anti-affinity (%d groups)", len(cm.antiAffinity)))
+	}
+
+	if cm.spreadPrefix != "" {
+		out = append(out, "spread coordination at "+cm.spreadPrefix)
+	}
+
+	if cm.scorer != nil {
+		out = append(out, fmt.Sprintf("scorer top %d", cm.scoreTopN))
+	}
+
+	if cm.selectionSeed != "" {
+		out = append(out, "rendezvous hash")
+	} else {
+		out = append(out, "random")
+	}
+
+	return out
+}
+
+func (cm *ConnManager) connectionsReport() []string {
+	var out []string
+
+	if cm.eagerConnect {
+		out = append(out, "eager connect, timeout "+cm.eagerTimeout.String())
+	}
+
+	if cm.shareConns {
+		out = append(out, "shared by target")
+	}
+
+	if cm.maxConns > 0 {
+		out = append(out, fmt.Sprintf("max %d total", cm.maxConns))
+	}
+
+	if cm.swapWindow > 0 {
+		out = append(out, fmt.Sprintf("wait for ready %s after target swaps", cm.swapWindow))
+	}
+
+	if cm.probeInterval > 0 {
+		out = append(out, fmt.Sprintf("probe %s every %s", cm.probeMethod, cm.probeInterval))
+	}
+
+	if cm.dialSlots != nil {
+		out = append(out, fmt.Sprintf("max %d concurrent dials", cap(cm.dialSlots)))
+	}
+
+	if cm.callQueue != nil {
+		out = append(out, fmt.Sprintf("reconnect queue %d, wait %s", cap(cm.callQueue), cm.callQueueWait))
+	}
+
+	if cm.proxyDial != nil {
+		out = append(out, "proxied")
+	}
+
+	if cm.tproxy.Load() {
+		out = append(out, "virtual addresses (transparent proxy)")
+	}
+
+	if cm.targetScheme != "" {
+		out = append(out, "target scheme "+cm.targetScheme)
+	}
+
+	if cm.targetBuilder != nil {
+		out = append(out, "custom target builder")
+	}
+
+	if cm.portMetaKey != "" {
+		out = append(out, "port from meta "+cm.portMetaKey)
+	}
+
+	if cm.serverName != nil {
+		out = append(out, "server name strategy")
+	}
+
+	return out
+}
+
+func (cm *ConnManager) featuresReport() []string {
+	var out []string
+
+	flags := []struct {
+		on   bool
+		name string
+	}{
+		{cm.dryRun, "dry run"},
+		{cm.diffUpdates, "diff updates"},
+		{cm.bulkInitialRead, "bulk initial read"},
+		{cm.sharedCache != nil, "shared cache"},
+		{cm.preferNodeName, "prefer node names"},
+		{cm.dualStack, "dual-stack happy eyeballs"},
+		{cm.stuckAfter > 0, "restart watchers stuck for " + cm.stuckAfter.String()},
+		{cm.shedder != nil, "load shedding"},
+		{cm.maxStaleness > 0, "stale reads up to " + cm.maxStaleness.String()},
+		{cm.keepOnCancel, "connections kept until Stop"},
+		{cm.maxInstances > 0, fmt.Sprintf("max %d cached instances per service", cm.maxInstances)},
+		{cm.publishPrefix != "", "topology publisher at " + cm.publishPrefix},
+		{cm.mirrorPrefix != "", "topology mirror of " + cm.mirrorPrefix},
+		{len(cm.metrics) > 0, fmt.Sprintf("%d metrics sinks", len(cm.metrics))},
+		{cm.tagsPeerService(), "peer.service on RPC spans"},
+		{len(cm.eventHandlers) > 0, fmt.Sprintf("%d event handlers", len(cm.eventHandlers))},
+		{len(cm.decorators) > 0, fmt.Sprintf("%d connection decorators", len(cm.decorators))},
+	}
+
+	for _, f := range flags {
+		if f.on {
+			out = append(out, f.name)
+		}
+	}
+
+	if sc := cm.secondary; sc != nil {
+		out = append(out, fmt.Sprintf("secondary cluster %s (%s)", sc.name, sc.policy))
+	}
+
+	return out
+}
+
+func (cm *ConnManager) serviceSettings(service string) []string {
+	var out []string
+
+	if id, ok := cm.pinnedInstances[service]; ok {
+		out = append(out, "pinned to "+id)
+	}
+
+	if group, ok := cm.samenessGroups[service]; ok {
+		out = append(out, "sameness group "+group)
+	}
+
+	if _, ok := cm.serviceTokens[service]; ok {
+		out = append(out, "own ACL token")
+	}
+
+	if tags := cm.tagPreferences[service]; len(tags) > 0 {
+		out = append(out, "prefers tags "+strings.Join(tags, " > "))
+	}
+
+	if d, ok := cm.minSwitch[service]; ok {
+		out = append(out, "min switch interval "+d.String())
+	}
+
+	if d, ok := cm.minInstanceAge[service]; ok {
+		out = append(out, "min instance age "+d.String())
+	}
+
+	if _, ok := cm.withStandby[service]; ok {
+		out = append(out, "standby connection")
+	}
+
+	if ns, ok := cm.nomadServices[service]; ok {
+		if ns.Sidecar {
+			out = append(out, "nomad sidecar")
+		} else {
+			out = append(out, "nomad")
+		}
+	}
+
+	if labels := cm.labels[service]; len(labels) > 0 {
+		pairs := make([]string, 0, len(labels))
+		for _, k := range slices.Sorted(maps.Keys(labels)) {
+			pairs = append(pairs, k+"="+labels[k])
+		}
+
+		out = append(out, "labels "+strings.Join(pairs, ", "))
+	}
+
+	if p := cm.criticalPolicy(service); p != CriticalFail {
+		out = append(out, "all critical: "+p.String())
+	}
+
+	if ports := cm.namedPorts[service]; len(ports) > 0 {
+		out = append(out, "named ports "+strings.Join(slices.Sorted(maps.Keys(ports)), ", "))
+	}
+
+	if p, ok := cm.protocols[service]; ok {
+		out = append(out, "protocol "+string(p))
+	}
+
+	if _, ok := cm.serviceConfigs[service]; ok {
+		out = append(out, "service config")
+	}
+
+	if len(cm.callOptions[service]) > 0 {
+		out = append(out, "call options")
+	}
+
+	if d, ok := cm.callTimeouts[service]; ok {
+		out = append(out, "default timeout "+d.String())
+	}
+
+	if _, ok := cm.serviceProxies[service]; ok {
+		out = append(out, "service proxy")
+	}
+
+	if n := len(cm.maintenance[service]); n > 0 {
+		out = append(out, fmt.Sprintf("%d maintenance windows", n))
+	}
+
+	return out
+}
+
+// Markdown renders the report as a Markdown document
+func (r ConfigReport) Markdown() string {
+	var b strings.Builder
+
+	b.WriteString("# Consul service discovery configuration\n\n")
+	fmt.Fprintf(&b, "- Wait time: %s\n", r.WaitTime)
+	fmt.Fprintf(&b, "- Retry interval: %s\n", r.RetryInterval)
+
+	if r.ForcedRefresh != "" {
+		fmt.Fprintf(&b, "- Forced refresh: %s\n", r.ForcedRefresh)
+	}
+
+	fmt.Fprintf(&b, "- Query timeout: %s\n", r.QueryTimeout)
+	fmt.Fprintf(&b, "- TLS: %s\n", r.TLS)
+	fmt.Fprintf(&b, "- Selection: %s\n", strings.Join(r.Selection, " → "))
+
+	if len(r.Connections) > 0 {
+		fmt.Fprintf(&b, "- Connections: %s\n", strings.Join(r.Connections, "; "))
+	}
+
+	if len(r.Features) > 0 {
+		fmt.Fprintf(&b, "- Features: %s\n", strings.Join(r.Features, "; "))
+	}
+
+	b.WriteString("\n| Service | Consul name | Optional | Peer identity | Settings |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+
+	for _, s := range r.Services {
+		fmt.Fprintf(&b, "| %s | %s | %t | %t | %s |\n", s.Name, s.ConsulName, s.Optional, s.PeerIdentity, strings.Join(s.Settings, "; "))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigReport(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"},
+		WithOptionalServices("billing"),
+		WithDefaultTimeout("users", 2*time.Second),
+		WithSelectionSeed("host-1"),
+		WithEagerConnect(true),
+		WithWaitTime(10*time.Second),
+	)
+
+	r := cm.ConfigReport()
+
+	if r.WaitTime != "10s" || r.TLS != "insecure" {
+		t.Errorf("report = %+v", r)
+	}
+
+	if !slices.Contains(r.Selection, "rendezvous hash") || !slices.Contains(r.Selection, "sticky recovery") {
+		t.Errorf("selection = %v", r.Selection)
+	}
+
+	if len(r.Services) != 2 || !r.Services[1].Optional || !slices.Contains(r.Services[0].Settings, "default timeout 2s") {
+		t.Errorf("services = %+v", r.Services)
+	}
+
+	raw, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	if !strings.Contains(string(raw), `"wait_time":"10s"`) {
+		t.Errorf("json = %s", raw)
+	}
+
+	md := r.Markdown()
+	for _, want := range []string{"- Wait time: 10s", "| users | users | false | false | default timeout 2s |", "eager connect"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+)
+
+// consulDomain is the DNS suffix stripped from lookup names, so names meant
+// for Consul DNS resolve from the watched topology instead
+const consulDomain = ".service.consul"
+
+// Resolver answers host and SRV lookups from the watched topology with the
+// same signatures as net.Resolver, for libraries that only accept a resolver
+// or a lookup function. Only watched services resolve; names may carry a
+// ".service.consul" suffix
+type Resolver struct {
+	cm *ConnManager
+}
+
+// Resolver returns a lookup layer backed by the manager's instance cache
+func (cm *ConnManager) Resolver() *Resolver {
+	return &Resolver{cm: cm}
+}
+
+// LookupHost returns the distinct addresses of the healthy instances of host
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	instances, err := r.instances(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(instances))
+	for _, inst := range instances {
+		if !slices.Contains(addrs, inst.Address) {
+			addrs = append(addrs, inst.Address)
+		}
+	}
+
+	return addrs, nil
+}
+
+// LookupSRV returns one record per healthy instance of a watched service. As
+// with net.Resolver it looks up _service._proto.name, or name directly when
+// service and proto are both empty. Names in Consul's RFC 2782 form
+// (_service._proto.service.consul, name being "service.consul" or empty)
+// resolve service, whatever proto; other names resolve as in LookupHost
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	if service != "" || proto != "" {
+		name = "_" + service + "._" + proto + "." + name
+	}
+
+	host, ok := srvHost(name)
+	if !ok {
+		return "", nil, notFound(name)
+	}
+
+	instances, err := r.instances(ctx, host)
+	if err != nil {
+		return "", nil, err
+	}
+
+	srvs := make([]*net.SRV, 0, len(instances))
+	for _, inst := range instances {
+		port, err := r.cm.portFor(inst)
+		if err != nil {
+			continue
+		}
+
+		srvs = append(srvs, &net.SRV{Target: inst.Address, Port: uint16(port), Weight: 1})
+	}
+
+	if len(srvs) == 0 {
+		return "", nil, notFound(name)
+	}
+
+	return name, srvs, nil
+}
+
+// instances returns the cached healthy instances behind a lookup name
+func (r *Resolver) instances(ctx context.Context, name string) ([]Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	service := strings.TrimSuffix(strings.TrimSuffix(name, "."), consulDomain)
+
+	instances, err := r.cm.Instances(service)
+	if err != nil || len(instances) == 0 {
+		return nil, notFound(name)
+	}
+
+	return instances, nil
+}
+
+// srvHost returns the host an SRV name resolves: the service of an RFC 2782
+// name, or the name itself
+func srvHost(name string) (string, bool) {
+	if !strings.HasPrefix(name, "_") {
+		return name, true
+	}
+
+	labels := strings.SplitN(strings.TrimSuffix(name, "."), ".", 3)
+	if len(labels) < 2 || !strings.HasPrefix(labels[1], "_") ||
+		len(labels) == 3 && "."+labels[2] != consulDomain {
+		return "", false
+	}
+
+	return labels[0][1:], true
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
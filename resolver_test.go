@@ -0,0 +1,92 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestResolver_Lookups(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+	cm.setInstances("users", instancesFromEntries(testEntries("users", 9001, 9002)))
+
+	r := cm.Resolver()
+	ctx := context.Background()
+
+	addrs, err := r.LookupHost(ctx, "users.service.consul.")
+	if err != nil {
+		t.Fatalf("lookup host: %v", err)
+	}
+
+	if !slices.Equal(addrs, []string{"127.0.0.1"}) {
+		t.Errorf("addrs = %v, want deduplicated [127.0.0.1]", addrs)
+	}
+
+	_, srvs, err := r.LookupSRV(ctx, "", "", "users")
+	if err != nil {
+		t.Fatalf("lookup srv: %v", err)
+	}
+
+	var ports []uint16
+	for _, srv := range srvs {
+		ports = append(ports, srv.Port)
+	}
+
+	slices.Sort(ports)
+
+	if !slices.Equal(ports, []uint16{9001, 9002}) {
+		t.Errorf("srv ports = %v", ports)
+	}
+}
+
+func TestResolver_LookupSRVName(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+	cm.setInstances("users", instancesFromEntries(testEntries("users", 9001)))
+
+	r := cm.Resolver()
+
+	cases := []struct {
+		service, proto, name string
+		cname                string
+	}{
+		{"users", "tcp", "service.consul", "_users._tcp.service.consul"},
+		{"users", "tcp", "service.consul.", "_users._tcp.service.consul."},
+		{"users", "grpc", "", "_users._grpc."},
+		{"", "", "_users._tcp.service.consul", "_users._tcp.service.consul"},
+		{"", "", "users.service.consul", "users.service.consul"},
+	}
+
+	for _, tc := range cases {
+		cname, srvs, err := r.LookupSRV(context.Background(), tc.service, tc.proto, tc.name)
+		if err != nil || len(srvs) != 1 || srvs[0].Port != 9001 || cname != tc.cname {
+			t.Errorf("LookupSRV(%q, %q, %q) = %q, %v, %v; want %q with port 9001",
+				tc.service, tc.proto, tc.name, cname, srvs, err, tc.cname)
+		}
+	}
+
+	// service and proto name labels in front of name, not the service
+	for _, name := range []string{"users", "other.consul"} {
+		_, _, err := r.LookupSRV(context.Background(), "grpc", "tcp", name)
+
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("LookupSRV(grpc, tcp, %q) err = %v, want not found DNS error", name, err)
+		}
+	}
+}
+
+func TestResolver_NotFound(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+	r := cm.Resolver()
+
+	for _, name := range []string{"users", "orders"} {
+		_, err := r.LookupHost(context.Background(), name)
+
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			t.Errorf("LookupHost(%q) err = %v, want not found DNS error", name, err)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Package retrypolicy builds gRPC service-config JSON with per-method retry,
+// hedging and timeout settings from Go values, so callers never hand-write
+// the JSON.
+//
+// Example:
+//
+//	cfg, err := retrypolicy.New().
+//		Service("users.v1.Users").
+//		Timeout(2 * time.Second).
+//		Retry(retrypolicy.Retry{
+//			MaxAttempts:    4,
+//			InitialBackoff: 100 * time.Millisecond,
+//			MaxBackoff:     time.Second,
+//			Multiplier:     2,
+//			Codes:          []codes.Code{codes.Unavailable},
+//		}).
+//		Method("users.v1.Users", "Create").
+//		WaitForReady(true).
+//		JSON()
+package retrypolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Retry configures automatic retries of a failed RPC
+type Retry struct {
+	MaxAttempts    int // total attempts including the original, >= 2
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Codes          []codes.Code // retryable status codes
+}
+
+// Hedge configures sending parallel attempts of an RPC
+type Hedge struct {
+	MaxAttempts   int // total attempts including the original, >= 2
+	Delay         time.Duration
+	NonFatalCodes []codes.Code
+}
+
+// Builder accumulates method configs. The zero value is not usable; call New
+type Builder struct {
+	methods    []*methodConfig
+	throttling *throttling
+	err        error
+}
+
+type methodConfig struct {
+	names        []name
+	timeout      time.Duration
+	waitForReady *bool
+	retry        *Retry
+	hedge        *Hedge
+}
+
+type name struct {
+	service, method string
+}
+
+type throttling struct {
+	maxTokens  int
+	tokenRatio float64
+}
+
+// New returns an empty Builder
+func New() *Builder { return &Builder{} }
+
+// Service starts a method config applying to every method of the fully
+// qualified gRPC service (e.g. "users.v1.Users")
+func (b *Builder) Service(service string) *Builder {
+	return b.add(name{service: service})
+}
+
+// Method starts a method config applying to a single method
+func (b *Builder) Method(service, method string) *Builder {
+	if method == "" {
+		b.fail(fmt.Errorf("empty method name for service %q", service))
+	}
+
+	return b.add(name{service: service, method: method})
+}
+
+// Default starts a method config applying to all methods of all services
+func (b *Builder) Default() *Builder {
+	b.methods = append(b.methods, &methodConfig{names: []name{{}}})
+
+	return b
+}
+
+// Timeout sets the default deadline for the current method config
+func (b *Builder) Timeout(d time.Duration) *Builder {
+	if d <= 0 {
+		b.fail(errors.New("timeout must be positive"))
+	}
+
+	b.current().timeout = d
+
+	return b
+}
+
+// WaitForReady sets the wait-for-ready default for the current method config
+func (b *Builder) WaitForReady(v bool) *Builder {
+	b.current().waitForReady = &v
+
+	return b
+}
+
+// Retry sets the retry policy for the current method config
+func (b *Builder) Retry(r Retry) *Builder {
+	b.current().retry = &r
+
+	return b
+}
+
+// Hedge sets the hedging policy for the current method config
+func (b *Builder) Hedge(h Hedge) *Builder {
+	b.current().hedge = &h
+
+	return b
+}
+
+// Throttle enables client-side retry throttling for the whole channel
+func (b *Builder) Throttle(maxTokens int, tokenRatio float64) *Builder {
+	b.throttling = &throttling{maxTokens: maxTokens, tokenRatio: tokenRatio}
+
+	return b
+}
+
+// JSON validates the accumulated configuration and renders it as gRPC
+// service-config JSON
+func (b *Builder) JSON() (string, error) {
+	if err := b.validate(); err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(b.document())
+	if err != nil {
+		return "", fmt.Errorf("marshal service config: %w", err)
+	}
+
+	return string(out), nil
+}
+
+func (b *Builder) add(n name) *Builder {
+	if n.service == "" {
+		b.fail(errors.New("empty service name"))
+	}
+
+	b.methods = append(b.methods, &methodConfig{names: []name{n}})
+
+	return b
+}
+
+// current returns the method config being built; setters called before any
+// Service/Method/Default record an error
+func (b *Builder) current() *methodConfig {
+	if len(b.methods) == 0 {
+		b.fail(errors.New("setter called before Service, Method or Default"))
+		b.methods = append(b.methods, &methodConfig{})
+	}
+
+	return b.methods[len(b.methods)-1]
+}
+
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *Builder) validate() error {
+	if b.err != nil {
+		return b.err
+	}
+
+	if len(b.methods) == 0 {
+		return errors.New("no method configs")
+	}
+
+	for _, m := range b.methods {
+		if m.retry != nil && m.hedge != nil {
+			return fmt.Errorf("%s: retry and hedging are mutually exclusive", m.names[0])
+		}
+
+		if r := m.retry; r != nil {
+			switch {
+			case r.MaxAttempts < 2:
+				return fmt.Errorf("%s: retry max attempts must be >= 2", m.names[0])
+			case r.InitialBackoff <= 0 || r.MaxBackoff <= 0:
+				return fmt.Errorf("%s: retry backoffs must be positive", m.names[0])
+			case r.MaxBackoff < r.InitialBackoff:
+				return fmt.Errorf("%s: retry max backoff below initial backoff", m.names[0])
+			case r.Multiplier <= 0:
+				return fmt.Errorf("%s: retry multiplier must be positive", m.names[0])
+			case len(r.Codes) == 0:
+				return fmt.Errorf("%s: retry needs at least one retryable code", m.names[0])
+			}
+		}
+
+		if h := m.hedge; h != nil {
+			if h.MaxAttempts < 2 {
+				return fmt.Errorf("%s: hedging max attempts must be >= 2", m.names[0])
+			}
+
+			if h.Delay < 0 {
+				return fmt.Errorf("%s: hedging delay must not be negative", m.names[0])
+			}
+		}
+	}
+
+	if t := b.throttling; t != nil {
+		if t.maxTokens <= 0 || t.maxTokens > 1000 {
+			return errors.New("throttling max tokens must be in (0, 1000]")
+		}
+
+		if t.tokenRatio <= 0 {
+			return errors.New("throttling token ratio must be positive")
+		}
+	}
+
+	return nil
+}
+
+func (n name) String() string {
+	switch {
+	case n.service == "":
+		return "default"
+	case n.method == "":
+		return n.service
+	default:
+		return n.service + "/" + n.method
+	}
+}
+
+// JSON document types following the gRPC service config schema
+
+type document struct {
+	MethodConfig    []methodDoc    `json:"methodConfig"`
+	RetryThrottling *throttlingDoc `json:"retryThrottling,omitempty"`
+}
+
+type methodDoc struct {
+	Name          []nameDoc `json:"name"`
+	WaitForReady  *bool     `json:"waitForReady,omitempty"`
+	Timeout       string    `json:"timeout,omitempty"`
+	RetryPolicy   *retryDoc `json:"retryPolicy,omitempty"`
+	HedgingPolicy *hedgeDoc `json:"hedgingPolicy,omitempty"`
+}
+
+type nameDoc struct {
+	Service string `json:"service,omitempty"`
+	Method  string `json:"method,omitempty"`
+}
+
+type retryDoc struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type hedgeDoc struct {
+	MaxAttempts         int      `json:"maxAttempts"`
+	HedgingDelay        string   `json:"hedgingDelay,omitempty"`
+	NonFatalStatusCodes []string `json:"nonFatalStatusCodes,omitempty"`
+}
+
+type throttlingDoc struct {
+	MaxTokens  int     `json:"maxTokens"`
+	TokenRatio float64 `json:"tokenRatio"`
+}
+
+func (b *Builder) document() document {
+	doc := document{MethodConfig: make([]methodDoc, 0, len(b.methods))}
+
+	for _, m := range b.methods {
+		md := methodDoc{WaitForReady: m.waitForReady}
+
+		for _, n := range m.names {
+			md.Name = append(md.Name, nameDoc{Service: n.service, Method: n.method})
+		}
+
+		if m.timeout > 0 {
+			md.Timeout = formatDuration(m.timeout)
+		}
+
+		if r := m.retry; r != nil {
+			md.RetryPolicy = &retryDoc{
+				MaxAttempts:          r.MaxAttempts,
+				InitialBackoff:       formatDuration(r.InitialBackoff),
+				MaxBackoff:           formatDuration(r.MaxBackoff),
+				BackoffMultiplier:    r.Multiplier,
+				RetryableStatusCodes: codeNames(r.Codes),
+			}
+		}
+
+		if h := m.hedge; h != nil {
+			md.HedgingPolicy = &hedgeDoc{
+				MaxAttempts:         h.MaxAttempts,
+				NonFatalStatusCodes: codeNames(h.NonFatalCodes),
+			}
+
+			if h.Delay > 0 {
+				md.HedgingPolicy.HedgingDelay = formatDuration(h.Delay)
+			}
+		}
+
+		doc.MethodConfig = append(doc.MethodConfig, md)
+	}
+
+	if t := b.throttling; t != nil {
+		doc.RetryThrottling = &throttlingDoc{MaxTokens: t.maxTokens, TokenRatio: t.tokenRatio}
+	}
+
+	return doc
+}
+
+// formatDuration renders d in the protobuf JSON Duration form ("1.5s")
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// codeNames converts status codes to the UPPER_SNAKE names the service config
+// schema expects
+func codeNames(cs []codes.Code) []string {
+	if len(cs) == 0 {
+		return nil
+	}
+
+	out := make([]string, len(cs))
+
+	for i, c := range cs {
+		out[i] = codeName(c)
+	}
+
+	return out
+}
+
+func codeName(c codes.Code) string {
+	if n, ok := statusNames[c]; ok {
+		return n
+	}
+
+	return strconv.FormatUint(uint64(c), 10)
+}
+
+var statusNames = map[codes.Code]string{
+	codes.OK:                 "OK",
+	codes.Canceled:           "CANCELLED",
+	codes.Unknown:            "UNKNOWN",
+	codes.InvalidArgument:    "INVALID_ARGUMENT",
+	codes.DeadlineExceeded:   "DEADLINE_EXCEEDED",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.PermissionDenied:   "PERMISSION_DENIED",
+	codes.ResourceExhausted:  "RESOURCE_EXHAUSTED",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "ABORTED",
+	codes.OutOfRange:         "OUT_OF_RANGE",
+	codes.Unimplemented:      "UNIMPLEMENTED",
+	codes.Internal:           "INTERNAL",
+	codes.Unavailable:        "UNAVAILABLE",
+	codes.DataLoss:           "DATA_LOSS",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+}
@@ -0,0 +1,81 @@
+package retrypolicy_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/flew1x/consul-service-discovery/retrypolicy"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestJSON_RetryAndMethodOverride(t *testing.T) {
+	cfg, err := retrypolicy.New().
+		Service("users.v1.Users").
+		Timeout(1500*time.Millisecond).
+		Retry(retrypolicy.Retry{
+			MaxAttempts:    3,
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     time.Second,
+			Multiplier:     2,
+			Codes:          []codes.Code{codes.Unavailable, codes.Canceled},
+		}).
+		Method("users.v1.Users", "Create").
+		WaitForReady(true).
+		Throttle(10, 0.1).
+		JSON()
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(cfg), &doc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	methods := doc["methodConfig"].([]any)
+	if len(methods) != 2 {
+		t.Fatalf("got %d method configs, want 2", len(methods))
+	}
+
+	first := methods[0].(map[string]any)
+	if first["timeout"] != "1.5s" {
+		t.Errorf("timeout = %v, want 1.5s", first["timeout"])
+	}
+
+	codesJSON := first["retryPolicy"].(map[string]any)["retryableStatusCodes"].([]any)
+	if codesJSON[0] != "UNAVAILABLE" || codesJSON[1] != "CANCELLED" {
+		t.Errorf("codes = %v", codesJSON)
+	}
+
+	// gRPC must accept the rendered config
+	conn, err := grpc.NewClient("127.0.0.1:1",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(cfg),
+	)
+	if err != nil {
+		t.Fatalf("grpc rejected service config: %v", err)
+	}
+
+	_ = conn.Close()
+}
+
+func TestJSON_Validation(t *testing.T) {
+	cases := map[string]*retrypolicy.Builder{
+		"empty":        retrypolicy.New(),
+		"setter first": retrypolicy.New().Timeout(time.Second),
+		"one attempt":  retrypolicy.New().Default().Retry(retrypolicy.Retry{MaxAttempts: 1}),
+		"no codes":     retrypolicy.New().Default().Retry(retrypolicy.Retry{MaxAttempts: 2, InitialBackoff: 1, MaxBackoff: 1, Multiplier: 1}),
+		"retry and hedge": retrypolicy.New().Default().
+			Retry(retrypolicy.Retry{MaxAttempts: 2, InitialBackoff: 1, MaxBackoff: 1, Multiplier: 1, Codes: []codes.Code{codes.Unavailable}}).
+			Hedge(retrypolicy.Hedge{MaxAttempts: 2}),
+	}
+
+	for name, b := range cases {
+		if _, err := b.JSON(); err == nil {
+			t.Errorf("%s: expected validation error", name)
+		}
+	}
+}
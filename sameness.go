@@ -0,0 +1,24 @@
+package consul_service_discovery
+
+import "errors"
+
+// WithSamenessGroup makes health queries for service honor a Consul
+// Enterprise sameness group: when no instance is healthy in the local
+// partition, Consul answers with instances from the group's members in its
+// failover order. Instance.Partition and Instance.Peer tell where an
+// instance lives
+func WithSamenessGroup(service, group string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if group == "" {
+			return errors.New("empty_sameness_group")
+		}
+
+		cm.samenessGroups[service] = group
+
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func TestWithSamenessGroup_Query(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		groups []string
+	)
+
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		groups = append(groups, r.URL.Query().Get("sameness-group"))
+		mu.Unlock()
+
+		entries := testEntries("users", 9001)
+		entries[0].Service.PeerName = "dc2-peer"
+
+		w.Header().Set("X-Consul-Index", "7")
+		_ = json.NewEncoder(w).Encode(entries)
+	}))
+
+	cm, err := New(client, []string{"users"}, WithSamenessGroup("users", "prod"), WithWaitTime(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	cm.watchService(ctx, "users")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(groups) == 0 || groups[0] != "prod" {
+		t.Errorf("sameness-group params = %v, want prod", groups)
+	}
+
+	if inst, _ := cm.View().GetInstance("users", "users-9001"); inst.Peer != "dc2-peer" {
+		t.Errorf("peer = %q, want dc2-peer", inst.Peer)
+	}
+}
+
+func TestWithSamenessGroup_Invalid(t *testing.T) {
+	client, _ := api.NewClient(api.DefaultConfig())
+
+	if _, err := New(client, []string{"users"}, WithSamenessGroup("users", "")); err == nil {
+		t.Error("expected error for empty group")
+	}
+
+	if _, err := New(client, []string{"users"}, WithSamenessGroup("billing", "prod")); err == nil {
+		t.Error("expected error for unwatched service")
+	}
+}
@@ -0,0 +1,334 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// eventJSON is the stable JSON form of Event; field names match
+// proto/events.proto
+type eventJSON struct {
+	Type         EventType `json:"type"`
+	Service      string    `json:"service,omitempty"`
+	Target       string    `json:"target,omitempty"`
+	InstanceID   string    `json:"instance_id,omitempty"`
+	Node         string    `json:"node,omitempty"`
+	Instances    int       `json:"instances,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	DryRun       bool      `json:"dry_run,omitempty"`
+	Maintenance  bool      `json:"maintenance,omitempty"`
+	TimeUnixNano int64     `json:"time_unix_nano"`
+
+	CreateIndex       uint64 `json:"create_index,omitempty"`
+	ModifyIndex       uint64 `json:"modify_index,omitempty"`
+	FirstSeenUnixNano int64  `json:"first_seen_unix_nano,omitempty"`
+}
+
+func (ev Event) toJSON() eventJSON {
+	out := eventJSON{
+		Type:         ev.Type,
+		Service:      ev.Service,
+		Target:       ev.Target,
+		InstanceID:   ev.InstanceID,
+		Node:         ev.Node,
+		Instances:    ev.Instances,
+		DryRun:       ev.DryRun,
+		Maintenance:  ev.Maintenance,
+		TimeUnixNano: unixNano(ev.Time),
+
+		CreateIndex:       ev.CreateIndex,
+		ModifyIndex:       ev.ModifyIndex,
+		FirstSeenUnixNano: unixNano(ev.FirstSeen),
+	}
+
+	if ev.Err != nil {
+		out.Error = ev.Err.Error()
+	}
+
+	return out
+}
+
+func (e eventJSON) event() Event {
+	ev := Event{
+		Type:        e.Type,
+		Service:     e.Service,
+		Target:      e.Target,
+		InstanceID:  e.InstanceID,
+		Node:        e.Node,
+		Instances:   e.Instances,
+		DryRun:      e.DryRun,
+		Maintenance: e.Maintenance,
+		CreateIndex: e.CreateIndex,
+		ModifyIndex: e.ModifyIndex,
+	}
+
+	if e.TimeUnixNano != 0 {
+		ev.Time = time.Unix(0, e.TimeUnixNano)
+	}
+
+	if e.FirstSeenUnixNano != 0 {
+		ev.FirstSeen = time.Unix(0, e.FirstSeenUnixNano)
+	}
+
+	if e.Error != "" {
+		ev.Err = errors.New(e.Error)
+	}
+
+	return ev
+}
+
+// MarshalJSON renders ev in the stable schema of proto/events.proto
+func (ev Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ev.toJSON())
+}
+
+// UnmarshalJSON parses the form written by MarshalJSON. Err only keeps the
+// message
+func (ev *Event) UnmarshalJSON(data []byte) error {
+	var e eventJSON
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+
+	*ev = e.event()
+
+	return nil
+}
+
+// MarshalProto encodes ev as a consul_sd.v1.Event message
+func (ev Event) MarshalProto() []byte {
+	e := ev.toJSON()
+
+	var b []byte
+	b = appendString(b, 1, string(e.Type))
+	b = appendString(b, 2, e.Service)
+	b = appendString(b, 3, e.Target)
+	b = appendString(b, 4, e.InstanceID)
+	b = appendVarint(b, 5, uint64(e.Instances))
+	b = appendString(b, 6, e.Error)
+	b = appendVarint(b, 7, protowire.EncodeBool(e.DryRun))
+	b = appendVarint(b, 8, protowire.EncodeBool(e.Maintenance))
+	b = appendVarint(b, 9, uint64(e.TimeUnixNano))
+	b = appendVarint(b, 10, e.CreateIndex)
+	b = appendVarint(b, 11, e.ModifyIndex)
+	b = appendVarint(b, 12, uint64(e.FirstSeenUnixNano))
+	b = appendString(b, 13, e.Node)
+
+	return b
+}
+
+// UnmarshalEventProto decodes a consul_sd.v1.Event message. Unknown fields
+// are skipped
+func UnmarshalEventProto(b []byte) (Event, error) {
+	var e eventJSON
+
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch {
+		case typ == protowire.BytesType:
+			s, n := protowire.ConsumeString(v)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			switch num {
+			case 1:
+				e.Type = EventType(s)
+			case 2:
+				e.Service = s
+			case 3:
+				e.Target = s
+			case 4:
+				e.InstanceID = s
+			case 6:
+				e.Error = s
+			case 13:
+				e.Node = s
+			}
+		case typ == protowire.VarintType:
+			x, n := protowire.ConsumeVarint(v)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			switch num {
+			case 5:
+				e.Instances = int(int64(x))
+			case 7:
+				e.DryRun = protowire.DecodeBool(x)
+			case 8:
+				e.Maintenance = protowire.DecodeBool(x)
+			case 9:
+				e.TimeUnixNano = int64(x)
+			case 10:
+				e.CreateIndex = x
+			case 11:
+				e.ModifyIndex = x
+			case 12:
+				e.FirstSeenUnixNano = int64(x)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Event{}, fmt.Errorf("decode event: %w", err)
+	}
+
+	return e.event(), nil
+}
+
+// MarshalEventBatch encodes events as a consul_sd.v1.EventBatch message
+func MarshalEventBatch(events []Event) []byte {
+	var b []byte
+	for _, ev := range events {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, ev.MarshalProto())
+	}
+
+	return b
+}
+
+// UnmarshalEventBatch decodes a consul_sd.v1.EventBatch message
+func UnmarshalEventBatch(b []byte) ([]Event, error) {
+	var events []Event
+
+	err := consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+
+		raw, n := protowire.ConsumeBytes(v)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		ev, err := UnmarshalEventProto(raw)
+		if err != nil {
+			return err
+		}
+
+		events = append(events, ev)
+
+		return nil
+	})
+
+	return events, err
+}
+
+// MarshalProto encodes the view as a consul_sd.v1.Snapshot message
+func (v View) MarshalProto() []byte {
+	var b []byte
+
+	for _, svc := range v.topo.services {
+		var s []byte
+		s = appendString(s, 1, svc)
+
+		if mc, ok := v.topo.conns[svc]; ok {
+			s = appendString(s, 2, mc.target)
+			s = appendString(s, 3, mc.instanceID)
+		}
+
+		for _, inst := range v.topo.instances[svc] {
+			s = protowire.AppendTag(s, 4, protowire.BytesType)
+			s = protowire.AppendBytes(s, marshalInstance(inst))
+		}
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+
+	return appendVarint(b, 2, uint64(unixNano(v.topo.taken)))
+}
+
+func marshalInstance(inst Instance) []byte {
+	var b []byte
+	b = appendString(b, 1, inst.ID)
+	b = appendString(b, 2, inst.Service)
+	b = appendString(b, 3, inst.Node)
+	b = appendString(b, 4, inst.Address)
+	b = appendVarint(b, 5, uint64(inst.Port))
+
+	for _, tag := range inst.Tags {
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+
+	// sorted keys keep the encoding deterministic
+	for _, k := range slices.Sorted(maps.Keys(inst.Meta)) {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, inst.Meta[k])
+
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	b = appendString(b, 8, inst.Datacenter)
+	b = appendVarint(b, 9, inst.CreateIndex)
+	b = appendVarint(b, 10, inst.ModifyIndex)
+
+	return appendVarint(b, 11, uint64(unixNano(inst.FirstSeen)))
+}
+
+// unixNano returns t in Unix nanoseconds, with the zero time as 0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+// appendString appends a string field, omitting the proto3 default
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+
+	return protowire.AppendString(b, s)
+}
+
+// appendVarint appends a varint field, omitting the proto3 default
+func appendVarint(b []byte, num protowire.Number, x uint64) []byte {
+	if x == 0 {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+
+	return protowire.AppendVarint(b, x)
+}
+
+// consumeFields calls fn for every top-level field of b with the field's
+// value bytes (tag stripped)
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		b = b[n:]
+
+		m := protowire.ConsumeFieldValue(num, typ, b)
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+
+		if err := fn(num, typ, b[:m]); err != nil {
+			return err
+		}
+
+		b = b[m:]
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package consul_service_discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func sampleEvent() Event {
+	return Event{
+		Type:        EventSelectError,
+		Service:     "users",
+		Target:      "10.0.0.5:9000",
+		InstanceID:  "users-1",
+		Node:        "node-a",
+		Instances:   3,
+		Err:         errors.New("dial failed"),
+		Maintenance: true,
+		Time:        time.Unix(1700000000, 42),
+		CreateIndex: 7,
+		ModifyIndex: 9,
+		FirstSeen:   time.Unix(1690000000, 0),
+	}
+}
+
+func sameEvent(a, b Event) bool {
+	return a.Type == b.Type && a.Service == b.Service && a.Target == b.Target &&
+		a.InstanceID == b.InstanceID && a.Node == b.Node && a.Instances == b.Instances &&
+		a.Err.Error() == b.Err.Error() && a.DryRun == b.DryRun &&
+		a.Maintenance == b.Maintenance && a.Time.Equal(b.Time) &&
+		a.CreateIndex == b.CreateIndex && a.ModifyIndex == b.ModifyIndex &&
+		a.FirstSeen.Equal(b.FirstSeen)
+}
+
+func TestEvent_JSONRoundTrip(t *testing.T) {
+	ev := sampleEvent()
+
+	raw, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatalf("unmarshal map: %v", err)
+	}
+
+	if fields["type"] != "select_error" || fields["error"] != "dial failed" || fields["instance_id"] != "users-1" {
+		t.Errorf("json = %s", raw)
+	}
+
+	var back Event
+	if err := json.Unmarshal(raw, &back); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !sameEvent(ev, back) {
+		t.Errorf("round trip = %+v, want %+v", back, ev)
+	}
+}
+
+func TestEvent_ProtoRoundTrip(t *testing.T) {
+	ev := sampleEvent()
+
+	back, err := UnmarshalEventProto(ev.MarshalProto())
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if !sameEvent(ev, back) {
+		t.Errorf("round trip = %+v, want %+v", back, ev)
+	}
+
+	// unknown fields from a newer schema are skipped
+	extended := protowire.AppendTag(ev.MarshalProto(), 99, protowire.BytesType)
+	extended = protowire.AppendString(extended, "future")
+
+	if _, err := UnmarshalEventProto(extended); err != nil {
+		t.Errorf("unknown field: %v", err)
+	}
+
+	batch, err := UnmarshalEventBatch(MarshalEventBatch([]Event{ev, ev}))
+	if err != nil || len(batch) != 2 || !sameEvent(batch[1], ev) {
+		t.Errorf("batch = %+v, err %v", batch, err)
+	}
+
+	if _, err := UnmarshalEventProto([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("expected error for truncated message")
+	}
+}
+
+func TestView_MarshalProto(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+
+	entries := testEntries("users", 9001)
+	entries[0].Service.Meta = map[string]string{"b": "2", "a": "1"}
+
+	if err := cm.refresh(t.Context(), "users", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	b := cm.View().MarshalProto()
+
+	var services int
+	err := consumeFields(b, func(num protowire.Number, _ protowire.Type, v []byte) error {
+		if num == 1 {
+			services++
+		}
+
+		return nil
+	})
+	if err != nil || services != 1 {
+		t.Errorf("snapshot services = %d, err %v", services, err)
+	}
+
+	inst := instancesFromEntries(entries)[0]
+	for range 10 {
+		if string(marshalInstance(inst)) != string(marshalInstance(inst)) {
+			t.Fatal("instance encoding is not deterministic")
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"hash/maphash"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// latencyAlpha is the weight of the newest sample in the latency EWMA
+	latencyAlpha = 0.3
+
+	// signalShards is the number of independently locked maps the signal
+	// store is spread over
+	signalShards = 16
+
+	// evictionSample is how many entries eviction compares, so evicting
+	// approximates LRU in bounded time
+	evictionSample = 8
+)
+
+// Signals are the observations the manager collected about an instance. They
+// are only gathered while a Scorer is configured, or WithProbe for ProbeRTT
+type Signals struct {
+	LatencyEWMA time.Duration // of unary RPCs; zero until one completed
+	ProbeRTT    time.Duration // EWMA of WithProbe round trips; zero until one completed
+	Failures    int           // consecutive failed dials and unavailable RPCs
+}
+
+// Scorer rates an instance for selection; higher is better. Locality is
+// available from the instance itself (Datacenter, Node, NodeMeta)
+type Scorer interface {
+	Score(service string, inst Instance, s Signals) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface
+type ScorerFunc func(service string, inst Instance, s Signals) float64
+
+// Score calls f
+func (f ScorerFunc) Score(service string, inst Instance, s Signals) float64 {
+	return f(service, inst, s)
+}
+
+// WithScorer ranks eligible instances with s and selects among the best n,
+// replacing the uniform random choice. Latency and failure signals are
+// collected with a unary interceptor on every connection
+func WithScorer(s Scorer, n int) Option {
+	return func(cm *ConnManager) error {
+		if s == nil {
+			return errors.New("nil_scorer")
+		}
+
+		if n <= 0 {
+			return errors.New("top_n_must_be_positive")
+		}
+
+		cm.scorer = s
+		cm.scoreTopN = n
+
+		return nil
+	}
+}
+
+// signalSeed hashes instance keys to signal shards
+var signalSeed = maphash.MakeSeed()
+
+// signalStore holds per-instance signals. RPCs look up their entry under a
+// shard read lock and update it under its own lock, so they contend neither
+// on the manager lock nor with RPCs to other instances
+type signalStore struct {
+	shards [signalShards]signalShard
+	seq    atomic.Uint64 // update sequence, for eviction
+	size   atomic.Int64
+	limit  int // 0 = unlimited
+}
+
+type signalShard struct {
+	mu      sync.RWMutex
+	entries map[instanceKey]*signalEntry
+}
+
+type signalEntry struct {
+	mu      sync.Mutex
+	sig     Signals
+	touched atomic.Uint64 // sequence of the last update
+}
+
+func (s *signalStore) shard(key instanceKey) *signalShard {
+	return &s.shards[maphash.Comparable(signalSeed, key)%signalShards]
+}
+
+func (s *signalStore) get(key instanceKey) Signals {
+	sh := s.shard(key)
+
+	sh.mu.RLock()
+	e, ok := sh.entries[key]
+	sh.mu.RUnlock()
+
+	if !ok {
+		return Signals{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.sig
+}
+
+func (s *signalStore) update(key instanceKey, fn func(*Signals)) {
+	e := s.entry(key)
+
+	e.mu.Lock()
+	fn(&e.sig)
+	e.mu.Unlock()
+
+	e.touched.Store(s.seq.Add(1))
+
+	for s.limit > 0 && s.size.Load() > int64(s.limit) {
+		if !s.evict() {
+			break
+		}
+	}
+}
+
+// entry returns the entry of key, creating it if needed
+func (s *signalStore) entry(key instanceKey) *signalEntry {
+	sh := s.shard(key)
+
+	sh.mu.RLock()
+	e, ok := sh.entries[key]
+	sh.mu.RUnlock()
+
+	if ok {
+		return e
+	}
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if e, ok := sh.entries[key]; ok {
+		return e
+	}
+
+	if sh.entries == nil {
+		sh.entries = make(map[instanceKey]*signalEntry)
+	}
+
+	e = &signalEntry{}
+	e.touched.Store(s.seq.Add(1))
+	sh.entries[key] = e
+	s.size.Add(1)
+
+	return e
+}
+
+// evict drops the least recently updated of up to evictionSample entries,
+// taken from the shards in turn starting at a random one, reporting whether
+// there was one
+func (s *signalStore) evict() bool {
+	var (
+		oldest    *signalShard
+		oldestKey instanceKey
+		oldestSeq uint64
+		seen      int
+	)
+
+	first := rand.Intn(signalShards)
+
+	for i := 0; i < signalShards && seen < evictionSample; i++ {
+		sh := &s.shards[(first+i)%signalShards]
+
+		sh.mu.RLock()
+		for key, e := range sh.entries {
+			if seq := e.touched.Load(); oldest == nil || seq < oldestSeq {
+				oldest, oldestKey, oldestSeq = sh, key, seq
+			}
+
+			if seen++; seen == evictionSample {
+				break
+			}
+		}
+		sh.mu.RUnlock()
+	}
+
+	if oldest == nil {
+		return false
+	}
+
+	oldest.mu.Lock()
+	defer oldest.mu.Unlock()
+
+	// a concurrent eviction may have dropped it already
+	if _, ok := oldest.entries[oldestKey]; ok {
+		delete(oldest.entries, oldestKey)
+		s.size.Add(-1)
+	}
+
+	return true
+}
+
+// observe records the outcome of one RPC
+func (s *signalStore) observe(key instanceKey, took time.Duration, err error) {
+	s.update(key, func(sig *Signals) {
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			sig.Failures++
+
+			return
+		}
+
+		sig.Failures = 0
+
+		if sig.LatencyEWMA == 0 {
+			sig.LatencyEWMA = took
+		} else {
+			sig.LatencyEWMA = time.Duration(latencyAlpha*float64(took) + (1-latencyAlpha)*float64(sig.LatencyEWMA))
+		}
+	})
+}
+
+// probed records the round-trip time of a successful probe
+func (s *signalStore) probed(key instanceKey, rtt time.Duration) {
+	s.update(key, func(sig *Signals) {
+		sig.Failures = 0
+
+		if sig.ProbeRTT == 0 {
+			sig.ProbeRTT = rtt
+		} else {
+			sig.ProbeRTT = time.Duration(latencyAlpha*float64(rtt) + (1-latencyAlpha)*float64(sig.ProbeRTT))
+		}
+	})
+}
+
+// failed records a failed dial or probe
+func (s *signalStore) failed(key instanceKey) {
+	s.update(key, func(sig *Signals) { sig.Failures++ })
+}
+
+// prune drops signals of instances of service no longer in instances
+func (s *signalStore) prune(service string, instances []Instance) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+
+		sh.mu.Lock()
+		for key := range sh.entries {
+			if key.service != service {
+				continue
+			}
+
+			if _, ok := findInstance(instances, key.instanceRef); !ok {
+				delete(sh.entries, key)
+				s.size.Add(-1)
+			}
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// signalInterceptor feeds RPC outcomes over a connection to key into the
+// signal store
+func (cm *ConnManager) signalInterceptor(key instanceKey) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cm.signals.observe(key, time.Since(start), err)
+
+		return err
+	}
+}
+
+// bestScored keeps the n best scored candidates when a scorer is set
+func (cm *ConnManager) bestScored(service string, candidates []Instance) []Instance {
+	if cm.scorer == nil || len(candidates) <= cm.scoreTopN {
+		return candidates
+	}
+
+	type scored struct {
+		inst  Instance
+		score float64
+	}
+
+	ranked := make([]scored, 0, len(candidates))
+	for _, inst := range candidates {
+		sig := cm.signals.get(instanceKey{service: service, instanceRef: inst.ref()})
+		ranked = append(ranked, scored{inst: inst, score: cm.scorer.Score(service, inst, sig)})
+	}
+
+	// shuffle first so equal scores do not always favor the same instances
+	rand.Shuffle(len(ranked), func(i, j int) { ranked[i], ranked[j] = ranked[j], ranked[i] })
+	slices.SortStableFunc(ranked, func(a, b scored) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+
+		return 0
+	})
+
+	out := make([]Instance, 0, cm.scoreTopN)
+	for _, r := range ranked[:cm.scoreTopN] {
+		out = append(out, r.inst)
+	}
+
+	return out
+}
@@ -0,0 +1,79 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithScorer_PicksBestN(t *testing.T) {
+	byPort := ScorerFunc(func(_ string, inst Instance, _ Signals) float64 { return float64(inst.Port) })
+	cm := newTestManager(t, []string{"users"}, WithScorer(byPort, 2))
+
+	instances := instancesFromEntries(testEntries("users", 9001, 9002, 9003, 9004))
+	seen := map[int]struct{}{}
+
+	for range 100 {
+		inst, ok := cm.selectInstance("users", instances)
+		if !ok || inst.Port < 9003 {
+			t.Fatalf("selected %+v, want one of the two best", inst)
+		}
+
+		seen[inst.Port] = struct{}{}
+	}
+
+	if len(seen) != 2 {
+		t.Errorf("selection should spread over the best 2, saw %v", seen)
+	}
+}
+
+func TestWithScorer_UsesCollectedSignals(t *testing.T) {
+	fewestFailures := ScorerFunc(func(_ string, _ Instance, s Signals) float64 { return -float64(s.Failures) })
+	cm := newTestManager(t, []string{"users"}, WithScorer(fewestFailures, 1))
+
+	bad := instanceKey{service: "users", instanceRef: testRef("users-9001")}
+	cm.signals.observe(bad, time.Millisecond, status.Error(codes.Unavailable, "down"))
+
+	instances := instancesFromEntries(testEntries("users", 9001, 9002))
+
+	for range 20 {
+		if inst, _ := cm.selectInstance("users", instances); inst.ID != "users-9002" {
+			t.Fatalf("selected %s, want the instance without failures", inst.ID)
+		}
+	}
+}
+
+func TestSignalStore_Observe(t *testing.T) {
+	var s signalStore
+
+	key := instanceKey{service: "users", instanceRef: instanceRef{id: "a"}}
+
+	s.observe(key, 100*time.Millisecond, nil)
+	s.observe(key, 200*time.Millisecond, nil)
+
+	if got := s.get(key).LatencyEWMA; got != 130*time.Millisecond {
+		t.Errorf("ewma = %v, want 130ms", got)
+	}
+
+	s.observe(key, 0, status.Error(codes.DeadlineExceeded, "slow"))
+	s.observe(key, 0, status.Error(codes.Unavailable, "down"))
+
+	if got := s.get(key).Failures; got != 2 {
+		t.Errorf("failures = %d, want 2", got)
+	}
+
+	s.observe(key, time.Millisecond, errors.New("application error"))
+
+	if got := s.get(key).Failures; got != 0 {
+		t.Errorf("failures after non-transport error = %d, want reset", got)
+	}
+
+	s.prune("users", nil)
+
+	if got := s.get(key); got != (Signals{}) {
+		t.Errorf("signals after prune = %+v", got)
+	}
+}
@@ -0,0 +1,282 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithNodeAntiAffinity makes selection for each listed service avoid Consul
+// nodes already serving another service of the group, when alternatives
+// exist, reducing correlated failure domains. It may be given several times
+// for independent groups
+func WithNodeAntiAffinity(services []string) Option {
+	return func(cm *ConnManager) error {
+		if len(services) < 2 {
+			return errors.New("anti_affinity_needs_two_services")
+		}
+
+		for _, svc := range services {
+			if err := cm.checkWatched(svc); err != nil {
+				return err
+			}
+		}
+
+		cm.antiAffinity = append(cm.antiAffinity, slices.Clone(services))
+
+		return nil
+	}
+}
+
+// WithTagPreference makes selection for service prefer instances carrying
+// the earliest listed tag, falling back down the list only when no instance
+// has it, e.g. []string{"v2", "v1"} during a protocol migration. When no
+// instance has any of the tags all are eligible
+func WithTagPreference(service string, tags []string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if len(tags) == 0 || slices.Contains(tags, "") {
+			return errors.New("empty_tag_preference")
+		}
+
+		cm.tagPreferences[service] = slices.Clone(tags)
+
+		return nil
+	}
+}
+
+// WithMinInstanceAge keeps instances of service that joined the healthy set
+// less than d ago out of selection, so that fresh registrations passing their
+// first check are not stormed before they are warmed up. When no instance is
+// old enough the longest-seen ones are used, which covers the instances
+// found at startup
+func WithMinInstanceAge(service string, d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if d <= 0 {
+			return errors.New("invalid_min_instance_age")
+		}
+
+		cm.minInstanceAge[service] = d
+
+		return nil
+	}
+}
+
+// WithStickyRecovery controls whether a service that lost all instances
+// reconnects to its previous target when it reappears, instead of picking at
+// random, to keep caches and sessions warm (default: enabled)
+func WithStickyRecovery(enabled bool) Option {
+	return func(cm *ConnManager) error {
+		cm.stickyRecovery = enabled
+
+		return nil
+	}
+}
+
+// selectInstance chooses the instance service should connect to. It reports
+// false when no instance is eligible
+func (cm *ConnManager) selectInstance(service string, instances []Instance) (Instance, bool) {
+	candidates := cm.eligible(service, instances)
+	candidates = cm.preferTags(service, candidates)
+	candidates = cm.preferRegion(candidates)
+	candidates = cm.matureInstances(service, candidates, time.Now())
+
+	if inst, ok := cm.warmInstance(service, candidates); ok {
+		return inst, true
+	}
+
+	candidates = cm.preferOtherNodes(service, candidates)
+	candidates = cm.leastChosen(service, candidates)
+	candidates = cm.bestScored(service, candidates)
+
+	if len(candidates) == 0 {
+		return Instance{}, false
+	}
+
+	return cm.pick(candidates), true
+}
+
+// WithSelectionSeed makes selection deterministic per client: each instance
+// is ranked by a hash of seed (e.g. the hostname), its node and ID, and the
+// highest ranked one wins. Clients with different seeds spread across
+// instances and do not all converge on the same one after a simultaneous
+// change
+func WithSelectionSeed(seed string) Option {
+	return func(cm *ConnManager) error {
+		if seed == "" {
+			return errors.New("empty_selection_seed")
+		}
+
+		cm.selectionSeed = seed
+
+		return nil
+	}
+}
+
+// pick returns one of the non-empty candidates: at random, or by rendezvous
+// hashing when a selection seed is set
+func (cm *ConnManager) pick(candidates []Instance) Instance {
+	if cm.selectionSeed == "" {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	best, bestScore := candidates[0], uint64(0)
+
+	for i, inst := range candidates {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(cm.selectionSeed))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(inst.Node))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(inst.ID))
+
+		if score := h.Sum64(); i == 0 || score > bestScore {
+			best, bestScore = inst, score
+		}
+	}
+
+	return best
+}
+
+// preferOtherNodes drops candidates on nodes used by anti-affinity peers of
+// service, unless that would leave nothing
+func (cm *ConnManager) preferOtherNodes(service string, candidates []Instance) []Instance {
+	used := cm.peerNodes(service)
+	if len(used) == 0 {
+		return candidates
+	}
+
+	out := make([]Instance, 0, len(candidates))
+
+	for _, inst := range candidates {
+		if _, taken := used[inst.Node]; !taken {
+			out = append(out, inst)
+		}
+	}
+
+	if len(out) == 0 {
+		cm.logger.Debug("anti-affinity not satisfiable, ignoring", zap.String("service", service))
+
+		return candidates
+	}
+
+	return out
+}
+
+// preferTags narrows candidates to the instances with the most preferred tag
+// any of them carries
+func (cm *ConnManager) preferTags(service string, candidates []Instance) []Instance {
+	for _, tag := range cm.tagPreferences[service] {
+		var out []Instance
+
+		for _, inst := range candidates {
+			if slices.Contains(inst.Tags, tag) {
+				out = append(out, inst)
+			}
+		}
+
+		if len(out) > 0 {
+			return out
+		}
+	}
+
+	return candidates
+}
+
+// matureInstances narrows candidates to the instances seen for at least the
+// minimum age of service, or else to the longest-seen ones
+func (cm *ConnManager) matureInstances(service string, candidates []Instance, now time.Time) []Instance {
+	minAge, ok := cm.minInstanceAge[service]
+	if !ok || len(candidates) == 0 {
+		return candidates
+	}
+
+	var mature, oldest []Instance
+
+	for _, inst := range candidates {
+		if now.Sub(inst.FirstSeen) >= minAge {
+			mature = append(mature, inst)
+		}
+
+		switch {
+		case len(oldest) == 0 || inst.FirstSeen.Before(oldest[0].FirstSeen):
+			oldest = []Instance{inst}
+		case inst.FirstSeen.Equal(oldest[0].FirstSeen):
+			oldest = append(oldest, inst)
+		}
+	}
+
+	if len(mature) > 0 {
+		return mature
+	}
+
+	return oldest
+}
+
+// peerNodes returns the nodes currently serving services that share an
+// anti-affinity group with service
+func (cm *ConnManager) peerNodes(service string) map[string]struct{} {
+	if len(cm.antiAffinity) == 0 {
+		return nil
+	}
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	used := make(map[string]struct{})
+
+	for _, group := range cm.antiAffinity {
+		if !slices.Contains(group, service) {
+			continue
+		}
+
+		for _, peer := range group {
+			if peer == service {
+				continue
+			}
+
+			if mc, ok := cm.conns[peer]; ok && mc.node != "" {
+				used[mc.node] = struct{}{}
+			}
+		}
+	}
+
+	return used
+}
+
+// warmInstance returns the candidate at the target service used before it
+// lost all instances, when sticky recovery is enabled
+func (cm *ConnManager) warmInstance(service string, candidates []Instance) (Instance, bool) {
+	if !cm.stickyRecovery {
+		return Instance{}, false
+	}
+
+	cm.mu.RLock()
+	last, ok := cm.lastTargets[service]
+	cm.mu.RUnlock()
+
+	if !ok {
+		return Instance{}, false
+	}
+
+	for _, inst := range candidates {
+		if target, err := cm.targetFor(cm.withDialHost(service, inst)); err == nil && target == last {
+			cm.logger.Debug("recovering previous target", zap.String("service", service), zap.String("target", target))
+
+			return inst, true
+		}
+	}
+
+	return Instance{}, false
+}
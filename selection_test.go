@@ -0,0 +1,169 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSelectInstance_NodeAntiAffinity(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"}, WithNodeAntiAffinity([]string{"users", "billing"}))
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	// testEntries places each port on its own node ("node-<port>")
+	instances := instancesFromEntries(testEntries("billing", 9001, 9002))
+
+	for range 20 {
+		inst, ok := cm.selectInstance("billing", instances)
+		if !ok || inst.Node != "node-9002" {
+			t.Fatalf("selected %+v, want instance on node-9002", inst)
+		}
+	}
+
+	// only the shared node is available: fall back instead of failing
+	inst, ok := cm.selectInstance("billing", instances[:1])
+	if !ok || inst.Node != "node-9001" {
+		t.Errorf("selected %+v, want fallback to node-9001", inst)
+	}
+}
+
+func TestSelectInstance_StickyRecovery(t *testing.T) {
+	ports := []int{9001, 9002, 9003, 9004, 9005, 9006, 9007, 9008, 9009, 9010}
+	cm := newTestManager(t, []string{"users"})
+
+	if err := cm.refresh(t.Context(), "users", testEntries("users", ports...)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	before := connTarget(cm, "users")
+
+	for range 5 {
+		if err := cm.refresh(t.Context(), "users", nil); err != nil {
+			t.Fatalf("refresh empty: %v", err)
+		}
+
+		if err := cm.refresh(t.Context(), "users", testEntries("users", ports...)); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if got := connTarget(cm, "users"); got != before {
+			t.Fatalf("recovered to %q, want previous target %q", got, before)
+		}
+	}
+}
+
+func TestSelectInstance_StickyRecoveryDisabled(t *testing.T) {
+	cm := newTestManager(t, []string{"users"}, WithStickyRecovery(false))
+	cm.lastTargets["users"] = "127.0.0.1:9001"
+
+	if _, ok := cm.warmInstance("users", instancesFromEntries(testEntries("users", 9001))); ok {
+		t.Error("sticky recovery disabled but previous target was preferred")
+	}
+}
+
+func TestSelectInstance_Seeded(t *testing.T) {
+	ports := []int{9001, 9002, 9003, 9004, 9005, 9006, 9007, 9008, 9009, 9010}
+	instances := instancesFromEntries(testEntries("users", ports...))
+	reversed := slices.Clone(instances)
+	slices.Reverse(reversed)
+
+	picked := map[string]struct{}{}
+
+	for i := range 50 {
+		cm := newTestManager(t, []string{"users"}, WithSelectionSeed(fmt.Sprintf("host-%d", i)))
+
+		first, _ := cm.selectInstance("users", instances)
+		again, _ := cm.selectInstance("users", reversed)
+
+		if first.ID != again.ID {
+			t.Fatalf("seed host-%d: picked %s then %s", i, first.ID, again.ID)
+		}
+
+		picked[first.ID] = struct{}{}
+	}
+
+	if len(picked) < 5 {
+		t.Errorf("50 seeds only spread over %d instances", len(picked))
+	}
+}
+
+func TestSelectInstance_SeededSharedID(t *testing.T) {
+	instances := instancesFromEntries(sharedIDEntries("users", 9001, 9002, 9003, 9004, 9005))
+	picked := map[string]struct{}{}
+
+	for i := range 50 {
+		cm := newTestManager(t, []string{"users"}, WithSelectionSeed(fmt.Sprintf("host-%d", i)))
+
+		inst, _ := cm.selectInstance("users", instances)
+		picked[inst.Node] = struct{}{}
+	}
+
+	if len(picked) < 3 {
+		t.Errorf("50 seeds only spread over %d nodes", len(picked))
+	}
+}
+
+func TestSelectInstance_TagPreference(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithTagPreference("svc", []string{"v2", "v1"}))
+
+	instances := instancesFromEntries(testEntries("svc", 9001, 9002, 9003))
+	instances[0].Tags = []string{"v1"}
+	instances[1].Tags = []string{"v2"}
+
+	for range 20 {
+		if inst, _ := cm.selectInstance("svc", instances); inst.ID != "svc-9002" {
+			t.Fatalf("selected %s, want the v2 instance", inst.ID)
+		}
+	}
+
+	// no v2 left: fall back to v1
+	instances[1].Tags = nil
+
+	for range 20 {
+		if inst, _ := cm.selectInstance("svc", instances); inst.ID != "svc-9001" {
+			t.Fatalf("selected %s, want the v1 instance", inst.ID)
+		}
+	}
+
+	// none tagged: everyone is eligible
+	instances[0].Tags = nil
+
+	if _, ok := cm.selectInstance("svc", instances); !ok {
+		t.Error("untagged instances should stay eligible")
+	}
+
+	if err := WithTagPreference("svc", nil)(cm); err == nil {
+		t.Error("expected error for empty preference")
+	}
+}
+
+func TestSelectInstance_MinInstanceAge(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithMinInstanceAge("svc", time.Minute))
+
+	now := time.Now()
+	instances := instancesFromEntries(testEntries("svc", 9001, 9002, 9003))
+	instances[0].FirstSeen = now.Add(-2 * time.Minute)
+	instances[1].FirstSeen = now.Add(-10 * time.Second)
+	instances[2].FirstSeen = now
+
+	for range 20 {
+		if inst, _ := cm.selectInstance("svc", instances); inst.ID != "svc-9001" {
+			t.Fatalf("selected %s, want the only instance older than a minute", inst.ID)
+		}
+	}
+
+	// found together at startup: none old enough, the startup set is used
+	instances[0].FirstSeen = instances[1].FirstSeen
+
+	if got := cm.matureInstances("svc", instances, now); len(got) != 2 || got[0].ID != "svc-9001" || got[1].ID != "svc-9002" {
+		t.Errorf("fallback = %+v, want the two longest-seen instances", got)
+	}
+
+	if err := WithMinInstanceAge("svc", 0)(cm); err == nil {
+		t.Error("expected error for zero age")
+	}
+}
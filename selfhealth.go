@@ -0,0 +1,100 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// DrainReason tells why this process's own instance should stop taking work
+type DrainReason string
+
+const (
+	// DrainCritical reports a critical health check
+	DrainCritical DrainReason = "critical"
+	// DrainMaintenance reports service or node maintenance mode
+	DrainMaintenance DrainReason = "maintenance"
+	// DrainDeregistered reports that the instance is no longer registered
+	DrainDeregistered DrainReason = "deregistered"
+)
+
+// WatchSelf watches the health of this process's own instance (service name
+// and registered ID) with blocking queries and calls onDrain when it turns
+// critical, enters maintenance or disappears, e.g. to stop accepting work and
+// shut down gracefully. onDrain runs once per transition out of a serving
+// state; recovery is logged. WatchSelf blocks until ctx is done
+func (cm *ConnManager) WatchSelf(ctx context.Context, service, id string, onDrain func(DrainReason)) error {
+	if service == "" || id == "" {
+		return errors.New("empty_self_service_or_id")
+	}
+
+	if onDrain == nil {
+		return errors.New("nil_drain_callback")
+	}
+
+	var (
+		waitIdx  uint64
+		draining bool
+	)
+
+	for ctx.Err() == nil {
+		q := &api.QueryOptions{
+			WaitTime:  cm.waitTime,
+			WaitIndex: waitIdx,
+			Filter:    fmt.Sprintf("Service.ID == %q", id),
+		}
+
+		qctx, cancel := context.WithTimeout(ctx, cm.effectiveQueryTimeout())
+		entries, meta, err := cm.client.Health().Service(service, "", false, q.WithContext(qctx))
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			cm.logger.Warn("self health query error", zap.String("service", service), zap.String("id", id), zap.Error(err))
+			sleepCtx(ctx, backoff(cm.retryInterval))
+
+			continue
+		}
+
+		waitIdx = nextWaitIndex(waitIdx, meta.LastIndex)
+		reason, drain := selfDrainReason(entries, id)
+
+		switch {
+		case drain && !draining:
+			cm.logger.Warn("own instance draining", zap.String("service", service), zap.String("id", id), zap.String("reason", string(reason)))
+			onDrain(reason)
+		case !drain && draining:
+			cm.logger.Info("own instance serving again", zap.String("service", service), zap.String("id", id))
+		}
+
+		draining = drain
+	}
+
+	return nil
+}
+
+// selfDrainReason inspects the health entry of instance id
+func selfDrainReason(entries []*api.ServiceEntry, id string) (DrainReason, bool) {
+	for _, e := range entries {
+		if e.Service == nil || e.Service.ID != id {
+			continue
+		}
+
+		switch e.Checks.AggregatedStatus() {
+		case api.HealthMaint:
+			return DrainMaintenance, true
+		case api.HealthCritical:
+			return DrainCritical, true
+		}
+
+		return "", false
+	}
+
+	return DrainDeregistered, true
+}
@@ -0,0 +1,85 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// selfEntries returns the health entry of api-9001 with one service check
+// in the given status
+func selfEntries(checkID, status string) []*api.ServiceEntry {
+	entries := testEntries("api", 9001)
+	entries[0].Checks = api.HealthChecks{
+		{CheckID: "serfHealth", Status: api.HealthPassing},
+		{CheckID: checkID, ServiceID: "api-9001", Status: status},
+	}
+
+	return entries
+}
+
+func TestWatchSelf_Drain(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setEntries("api", selfEntries("service:api-9001", api.HealthPassing))
+
+	cm, err := New(newTestClient(t, fake), []string{"users"}, WithWaitTime(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reasons := make(chan DrainReason, 4)
+	done := make(chan error, 1)
+
+	go func() { done <- cm.WatchSelf(ctx, "api", "api-9001", func(r DrainReason) { reasons <- r }) }()
+
+	expect := func(want DrainReason) {
+		t.Helper()
+
+		select {
+		case got := <-reasons:
+			if got != want {
+				t.Fatalf("reason = %s, want %s", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no drain callback, want %s", want)
+		}
+	}
+
+	fake.setEntries("api", selfEntries("service:api-9001", api.HealthCritical))
+	expect(DrainCritical)
+
+	fake.setEntries("api", selfEntries("service:api-9001", api.HealthPassing))
+	time.Sleep(100 * time.Millisecond)
+
+	fake.setEntries("api", selfEntries(api.ServiceMaintPrefix+"api-9001", api.HealthCritical))
+	expect(DrainMaintenance)
+
+	fake.setEntries("api", selfEntries("service:api-9001", api.HealthPassing))
+	time.Sleep(100 * time.Millisecond)
+
+	fake.setEntries("api", []*api.ServiceEntry{})
+	expect(DrainDeregistered)
+
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Errorf("watch self: %v", err)
+	}
+}
+
+func TestWatchSelf_Invalid(t *testing.T) {
+	cm := newTestManager(t, []string{"users"})
+
+	if err := cm.WatchSelf(context.Background(), "api", "", func(DrainReason) {}); err == nil {
+		t.Error("expected error for empty id")
+	}
+
+	if err := cm.WatchSelf(context.Background(), "api", "api-1", nil); err == nil {
+		t.Error("expected error for nil callback")
+	}
+}
@@ -0,0 +1,76 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// ErrNotRegistered is returned by WaitForSelfVisible when Register was not
+// called, or every registration was removed with Deregister
+var ErrNotRegistered = errors.New("no_self_registration")
+
+// WaitForSelfVisible blocks until every instance registered with Register
+// shows up as passing in health queries answered by the Consul leader
+// (consistent reads), i.e. other managers can discover it, or ctx is done.
+// Instances with checks become visible once their checks pass
+func (cm *ConnManager) WaitForSelfVisible(ctx context.Context) error {
+	cm.mu.RLock()
+	byName := make(map[string][]string)
+	for id, name := range cm.registered {
+		byName[name] = append(byName[name], id)
+	}
+	cm.mu.RUnlock()
+
+	if len(byName) == 0 {
+		return ErrNotRegistered
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		if err := cm.waitVisible(ctx, name, byName[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitVisible watches the passing instances of name with consistent
+// blocking queries until all ids are among them
+func (cm *ConnManager) waitVisible(ctx context.Context, name string, ids []string) error {
+	var waitIdx uint64
+
+	for {
+		q := &api.QueryOptions{RequireConsistent: true, WaitIndex: waitIdx, WaitTime: cm.waitTime}
+
+		entries, meta, err := cm.client.Health().Service(name, "", true, q.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%s not visible in %s: %w", strings.Join(ids, ", "), name, ctx.Err())
+			}
+
+			if !sleepCtx(ctx, backoff(cm.retryInterval)) {
+				return fmt.Errorf("%s not visible in %s: %w", strings.Join(ids, ", "), name, ctx.Err())
+			}
+
+			waitIdx = 0
+
+			continue
+		}
+
+		ids = slices.DeleteFunc(ids, func(id string) bool {
+			return slices.ContainsFunc(entries, func(e *api.ServiceEntry) bool { return e.Service.ID == id })
+		})
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		waitIdx = nextWaitIndex(waitIdx, meta.LastIndex)
+	}
+}
@@ -0,0 +1,84 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// agentFake serves agent registrations on top of a fakeConsul, making each
+// registered instance visible in health queries after delay
+func agentFake(fake *fakeConsul, delay time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/agent/checks":
+			_ = json.NewEncoder(w).Encode(map[string]*api.AgentCheck{})
+		case "/v1/agent/service/register":
+			var reg api.AgentServiceRegistration
+			_ = json.NewDecoder(r.Body).Decode(&reg)
+
+			time.AfterFunc(delay, func() {
+				entries := testEntries(reg.Name, reg.Port)
+				entries[0].Service.ID = reg.ID
+				fake.setEntries(reg.Name, entries)
+			})
+		default:
+			fake.ServeHTTP(w, r)
+		}
+	})
+}
+
+func TestWaitForSelfVisible(t *testing.T) {
+	fake := newFakeConsul()
+
+	cm, err := New(newTestClient(t, agentFake(fake, 50*time.Millisecond)), []string{"users"}, WithWaitTime(time.Second))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cm.WaitForSelfVisible(ctx); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("before Register: err = %v, want ErrNotRegistered", err)
+	}
+
+	if err := cm.Register(ctx, Registration{ID: "api-1", Name: "api", Port: 9000}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	began := time.Now()
+
+	if err := cm.WaitForSelfVisible(ctx); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	if time.Since(began) < 40*time.Millisecond {
+		t.Error("returned before the registration was visible")
+	}
+}
+
+func TestWaitForSelfVisible_ContextDone(t *testing.T) {
+	fake := newFakeConsul()
+
+	cm, err := New(newTestClient(t, agentFake(fake, time.Hour)), []string{"users"}, WithWaitTime(time.Second))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if err := cm.Register(context.Background(), Registration{ID: "api-1", Name: "api", Port: 9000}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := cm.WaitForSelfVisible(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+}
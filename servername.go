@@ -0,0 +1,82 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"net"
+
+	"google.golang.org/grpc"
+)
+
+// ServerNameStrategy picks the TLS server name for a connection to inst. It
+// is sent as the :authority, which gRPC transport credentials verify the
+// server certificate against. Returning "" keeps the default, the dial
+// target host, which for discovered IP targets rarely matches a certificate
+type ServerNameStrategy func(inst Instance) string
+
+// ServerNameFromService uses the Consul service name
+func ServerNameFromService() ServerNameStrategy {
+	return func(inst Instance) string { return inst.Service }
+}
+
+// ServerNameFromMeta uses the value of the instance Meta key
+func ServerNameFromMeta(key string) ServerNameStrategy {
+	return func(inst Instance) string { return inst.Meta[key] }
+}
+
+// ServerNameFixed uses name for every instance
+func ServerNameFixed(name string) ServerNameStrategy {
+	return func(Instance) string { return name }
+}
+
+// ServerNameFromHostname uses the instance address when it is a hostname and
+// the Consul node name otherwise
+func ServerNameFromHostname() ServerNameStrategy {
+	return func(inst Instance) string {
+		if net.ParseIP(inst.Address) == nil {
+			return inst.Address
+		}
+
+		return inst.Node
+	}
+}
+
+// WithServerNameStrategy sets how the TLS server name of each connection is
+// chosen, e.g. WithServerNameStrategy(ServerNameFromMeta("tls-name"))
+func WithServerNameStrategy(strategy ServerNameStrategy) Option {
+	return func(cm *ConnManager) error {
+		if strategy == nil {
+			return errors.New("nil_server_name_strategy")
+		}
+
+		cm.serverName = strategy
+
+		return nil
+	}
+}
+
+// instanceDialOptions returns the dial options for a connection to inst of
+// service: the per-service options plus the chosen server name, identity
+// checks attributed to inst, the dual-stack dialer and signal collection
+func (cm *ConnManager) instanceDialOptions(service string, inst Instance) []grpc.DialOption {
+	opts := cm.dialOptionsFor(service)
+
+	if cm.serverName != nil {
+		if name := cm.serverName(inst); name != "" {
+			opts = append(opts, grpc.WithAuthority(name))
+		}
+	}
+
+	if creds, ok := cm.peerCreds[service]; ok {
+		opts = append(opts, grpc.WithTransportCredentials(creds.forInstance(inst)))
+	}
+
+	if opt, ok := cm.dualStackOption(service, inst); ok {
+		opts = append(opts, opt)
+	}
+
+	if cm.scorer != nil {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(cm.signalInterceptor(instanceKey{service: service, instanceRef: inst.ref()})))
+	}
+
+	return opts
+}
@@ -0,0 +1,160 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// newTestCert returns a self-signed certificate for the given DNS names and
+// URI SANs together with a pool trusting it
+func newTestCert(t *testing.T, dnsNames []string, uris ...string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              dnsNames,
+	}
+
+	for _, raw := range uris {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("parse uri: %v", err)
+		}
+
+		tmpl.URIs = append(tmpl.URIs, u)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+// startTLSServer serves the gRPC health service over TLS with cert and
+// returns its port
+func startTLSServer(t *testing.T, cert tls.Certificate) int {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// checkHealth issues one health check over the current connection of service
+func checkHealth(t *testing.T, cm *ConnManager, service string) error {
+	t.Helper()
+
+	conn, err := cm.GetConn(service)
+	if err != nil {
+		t.Fatalf("get conn: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+
+	return err
+}
+
+func TestServerNameStrategy_VerifiesAgainstChosenName(t *testing.T) {
+	cert, pool := newTestCert(t, []string{"users.internal"})
+	port := startTLSServer(t, cert)
+	creds := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool}))
+
+	entries := testEntries("users", port)
+	entries[0].Service.Meta = map[string]string{"tls-name": "users.internal"}
+
+	plain := newTestManager(t, []string{"users"}, WithDialOptions(creds))
+	if err := plain.refresh(t.Context(), "users", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := checkHealth(t, plain, "users"); err == nil {
+		t.Error("expected hostname verification to fail against the IP target")
+	}
+
+	cm := newTestManager(t, []string{"users"},
+		WithDialOptions(creds),
+		WithServerNameStrategy(ServerNameFromMeta("tls-name")),
+	)
+	if err := cm.refresh(t.Context(), "users", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := checkHealth(t, cm, "users"); err != nil {
+		t.Errorf("health check with meta server name: %v", err)
+	}
+}
+
+func TestServerNameStrategies(t *testing.T) {
+	inst := Instance{Service: "users", Node: "node-1", Address: "10.0.0.5", Meta: map[string]string{"sni": "u.example"}}
+
+	cases := []struct {
+		name     string
+		strategy ServerNameStrategy
+		want     string
+	}{
+		{"service", ServerNameFromService(), "users"},
+		{"meta", ServerNameFromMeta("sni"), "u.example"},
+		{"fixed", ServerNameFixed("api.example"), "api.example"},
+		{"ip falls back to node", ServerNameFromHostname(), "node-1"},
+	}
+
+	for _, c := range cases {
+		if got := c.strategy(inst); got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	inst.Address = "users-1.internal"
+	if got := ServerNameFromHostname()(inst); got != "users-1.internal" {
+		t.Errorf("hostname: got %q", got)
+	}
+}
@@ -0,0 +1,23 @@
+package consul_service_discovery
+
+import "errors"
+
+// WithServiceToken queries the health of service with its own ACL token
+// instead of the client's, for setups granting read access to each upstream
+// through a separate token. The token only applies to discovery queries of
+// service; registration and KV features keep the client token
+func WithServiceToken(service, token string) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if token == "" {
+			return errors.New("empty_service_token")
+		}
+
+		cm.serviceTokens[service] = token
+
+		return nil
+	}
+}
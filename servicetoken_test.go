@@ -0,0 +1,74 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithServiceToken(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001)
+	fake.setInstances("billing", 9002)
+
+	var (
+		mu     sync.Mutex
+		tokens = make(map[string]string) // service -> last token seen
+	)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if svc, ok := strings.CutPrefix(r.URL.Path, "/v1/health/service/"); ok {
+			mu.Lock()
+			tokens[svc] = r.Header.Get("X-Consul-Token")
+			mu.Unlock()
+		}
+
+		fake.ServeHTTP(w, r)
+	})
+
+	cm, err := New(newTestClient(t, h), []string{"users", "billing"}, WithServiceToken("users", "users-read"))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	cm.Start(ctx)
+
+	waitTarget(t, cm, "users", "127.0.0.1:9001")
+	waitTarget(t, cm, "billing", "127.0.0.1:9002")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if tokens["users"] != "users-read" {
+		t.Errorf("users queried with token %q, want users-read", tokens["users"])
+	}
+
+	if tokens["billing"] == "users-read" {
+		t.Error("billing queried with the users token")
+	}
+}
+
+func TestWithServiceToken_Validation(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := WithServiceToken("svc", "")(cm); err == nil {
+		t.Error("expected an error for an empty token")
+	}
+
+	if err := WithServiceToken("other", "t")(cm); err == nil {
+		t.Error("expected an error for an unwatched service")
+	}
+}
+
+func TestWithServiceToken_LeavesACLRuleToToken(t *testing.T) {
+	cm := newTestManager(t, []string{"users", "billing"}, WithServiceToken("users", "users-read"))
+
+	policy := cm.RequiredACLPolicy()
+	if strings.Contains(policy, `"users"`) || !strings.Contains(policy, `"billing"`) {
+		t.Errorf("policy = %s, want billing only", policy)
+	}
+}
@@ -0,0 +1,135 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// sharedCacheTTL is how long a shared cache entry lives; watchers
+	// rewrite entries every half TTL even when nothing changed
+	sharedCacheTTL = 2 * time.Minute
+	// sharedCacheTimeout bounds one shared cache call
+	sharedCacheTimeout = time.Second
+	// sharedCachePrefix prefixes the keys of shared cache entries
+	sharedCachePrefix = "consul-sd/"
+)
+
+// Cache is an external key-value store shared by a fleet of managers, such
+// as Redis or memcached. Get returns nil, nil for a missing key. A go-redis
+// client adapts in a few lines:
+//
+//	func (c redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+//		b, err := c.rdb.Get(ctx, key).Bytes()
+//		if errors.Is(err, redis.Nil) {
+//			return nil, nil
+//		}
+//		return b, err
+//	}
+//
+//	func (c redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+//		return c.rdb.Set(ctx, key, value, ttl).Err()
+//	}
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// WithSharedCache shares the healthy instances of watched services through
+// c: watchers write every Consul response they act on, and Start connects
+// services from the cached entries before the first Consul query returns,
+// so short-lived workers (lambdas, batch jobs) get targets right away. Each
+// watcher's first response only re-selects if it differs from the cache.
+// Entries are keyed by Consul service name and expire after two minutes
+// without a writer. Cache failures are logged and otherwise ignored
+func WithSharedCache(c Cache) Option {
+	return func(cm *ConnManager) error {
+		if c == nil {
+			return errors.New("nil_shared_cache")
+		}
+
+		cm.sharedCache = c
+
+		return nil
+	}
+}
+
+// sharedCacheKey returns the shared cache key of service
+func (cm *ConnManager) sharedCacheKey(service string) string {
+	return sharedCachePrefix + cm.consulName(service)
+}
+
+// seedFromSharedCache refreshes every service found in the shared cache and
+// records the digest its watcher compares the first response against. It
+// returns how many services were seeded
+func (cm *ConnManager) seedFromSharedCache(ctx context.Context) int {
+	seeded := 0
+
+	for _, svc := range cm.watchList {
+		entries, ok := cm.loadShared(ctx, svc)
+		if !ok {
+			continue
+		}
+
+		if err := cm.refresh(ctx, svc, entries); err != nil {
+			cm.logger.Warn("select instance", zap.String("service", svc), zap.Error(err))
+
+			continue
+		}
+
+		cm.watchStates[svc].seed(entriesDigest(entries))
+		seeded++
+	}
+
+	cm.logger.Debug("seeded from shared cache", zap.Int("services", seeded))
+
+	return seeded
+}
+
+// loadShared reads the cached entries of service
+func (cm *ConnManager) loadShared(ctx context.Context, service string) ([]*api.ServiceEntry, bool) {
+	ctx, cancel := context.WithTimeout(ctx, sharedCacheTimeout)
+	defer cancel()
+
+	b, err := cm.sharedCache.Get(ctx, cm.sharedCacheKey(service))
+	if err != nil {
+		cm.logger.Warn("read shared cache", zap.String("service", service), zap.Error(err))
+
+		return nil, false
+	}
+
+	if b == nil {
+		return nil, false
+	}
+
+	var entries []*api.ServiceEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		cm.logger.Warn("decode shared cache entry", zap.String("service", service), zap.Error(err))
+
+		return nil, false
+	}
+
+	return entries, true
+}
+
+// storeShared writes the entries of service to the shared cache
+func (cm *ConnManager) storeShared(ctx context.Context, service string, entries []*api.ServiceEntry) {
+	b, err := json.Marshal(entries)
+	if err != nil {
+		cm.logger.Warn("encode shared cache entry", zap.String("service", service), zap.Error(err))
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sharedCacheTimeout)
+	defer cancel()
+
+	if err := cm.sharedCache.Set(ctx, cm.sharedCacheKey(service), b, sharedCacheTTL); err != nil {
+		cm.logger.Warn("write shared cache", zap.String("service", service), zap.Error(err))
+	}
+}
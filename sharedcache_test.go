@@ -0,0 +1,111 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	ttls    map[string]time.Duration
+	err     error
+}
+
+func newMemCache() *memCache {
+	return &memCache{entries: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (c *memCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries[key], c.err
+}
+
+func (c *memCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key], c.ttls[key] = value, ttl
+
+	return c.err
+}
+
+func (c *memCache) has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries[key] != nil
+}
+
+// hangingConsul never answers, like an overloaded or unreachable agent
+var hangingConsul = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+})
+
+func TestSharedCache_BootstrapsOtherWorkers(t *testing.T) {
+	cache := newMemCache()
+
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	writer, err := New(newTestClient(t, fake), []string{"svc"}, WithSharedCache(cache), WithWaitTime(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(writer.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer.Start(ctx)
+	waitTarget(t, writer, "svc", "127.0.0.1:9001")
+
+	for deadline := time.Now().Add(2 * time.Second); !cache.has("consul-sd/svc"); {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not write the shared cache")
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if ttl := cache.ttls["consul-sd/svc"]; ttl != sharedCacheTTL {
+		t.Errorf("ttl = %s, want %s", ttl, sharedCacheTTL)
+	}
+
+	reader, err := New(newTestClient(t, hangingConsul), []string{"svc"}, WithSharedCache(cache))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(reader.Stop)
+
+	reader.Start(ctx)
+	waitTarget(t, reader, "svc", "127.0.0.1:9001")
+}
+
+func TestSharedCache_FailuresIgnored(t *testing.T) {
+	cache := newMemCache()
+	cache.err = errors.New("connection refused")
+
+	cm := newTestManager(t, []string{"svc"}, WithSharedCache(cache))
+
+	if n := cm.seedFromSharedCache(context.Background()); n != 0 {
+		t.Errorf("seeded %d services from a failing cache", n)
+	}
+
+	cache.err = nil
+	cache.entries["consul-sd/svc"] = []byte("not json")
+
+	if n := cm.seedFromSharedCache(context.Background()); n != 0 {
+		t.Errorf("seeded %d services from a corrupt entry", n)
+	}
+
+	if err := WithSharedCache(nil)(cm); err == nil {
+		t.Error("nil cache accepted")
+	}
+}
@@ -0,0 +1,301 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// heapSampleInterval is how long a heap reading of ThresholdShedder is reused
+	heapSampleInterval = 100 * time.Millisecond
+	heapMetric         = "/memory/classes/heap/objects:bytes"
+
+	defaultShedWindow   = 10 * time.Second
+	defaultShedMinCalls = 20
+)
+
+// ErrLoadShed is matched (via errors.Is) by *ShedError
+var ErrLoadShed = errors.New("load_shed")
+
+// ShedReason is the typed cause of a shed call
+type ShedReason string
+
+const (
+	ShedCPU       ShedReason = "cpu"
+	ShedMemory    ShedReason = "memory"
+	ShedErrorRate ShedReason = "error_rate" // of the downstream service
+)
+
+// ShedError is returned for calls a LoadShedder rejected. Its gRPC status is
+// RESOURCE_EXHAUSTED, so status.Code sees it like a server-side rejection
+type ShedError struct {
+	Service string
+	Method  string // empty for GetConn
+	Reason  ShedReason
+}
+
+func (e *ShedError) Error() string {
+	return fmt.Sprintf("%s: %s %s: %s", ErrLoadShed, e.Service, e.Method, e.Reason)
+}
+
+// Unwrap makes errors.Is(err, ErrLoadShed) hold
+func (e *ShedError) Unwrap() error { return ErrLoadShed }
+
+// GRPCStatus reports the error as RESOURCE_EXHAUSTED
+func (e *ShedError) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// LoadShedder admits or rejects calls to services under resource pressure.
+// It runs on every call and must be cheap and safe for concurrent use
+type LoadShedder interface {
+	// Shed reports whether a call to service should be rejected, and why.
+	// method is empty when checked by GetConn
+	Shed(ctx context.Context, service, method string) (ShedReason, bool)
+}
+
+// CallObserver is implemented by shedders that also want the outcome of
+// admitted calls, e.g. to track downstream error rates
+type CallObserver interface {
+	ObserveCall(service string, err error)
+}
+
+// LoadShedderFunc adapts a function to the LoadShedder interface
+type LoadShedderFunc func(ctx context.Context, service, method string) (ShedReason, bool)
+
+// Shed calls f
+func (f LoadShedderFunc) Shed(ctx context.Context, service, method string) (ShedReason, bool) {
+	return f(ctx, service, method)
+}
+
+// WithLoadShedder consults s before every RPC on managed connections, and
+// in GetConn and GetConnContext when onGetConn is set, failing rejected
+// calls with *ShedError (RESOURCE_EXHAUSTED) and counting them in
+// MetricShedCalls
+func WithLoadShedder(s LoadShedder, onGetConn bool) Option {
+	return func(cm *ConnManager) error {
+		if s == nil {
+			return errors.New("nil_load_shedder")
+		}
+
+		cm.shedder = s
+		cm.shedOnGetConn = onGetConn
+
+		return nil
+	}
+}
+
+// shed returns the *ShedError for a rejected call, nil when admitted
+func (cm *ConnManager) shed(ctx context.Context, service, method string) error {
+	reason, ok := cm.shedder.Shed(ctx, service, method)
+	if !ok {
+		return nil
+	}
+
+	cm.metrics.IncrCounter(MetricShedCalls, 1, serviceLabel(service), Label{"reason", string(reason)})
+
+	return &ShedError{Service: service, Method: method, Reason: reason}
+}
+
+// observeCall reports the outcome of an admitted call to the shedder
+func (cm *ConnManager) observeCall(service string, err error) {
+	if o, ok := cm.shedder.(CallObserver); ok {
+		o.ObserveCall(service, err)
+	}
+}
+
+func (cm *ConnManager) shedUnaryInterceptor(service string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := cm.shed(ctx, service, method); err != nil {
+			return err
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cm.observeCall(service, err)
+
+		return err
+	}
+}
+
+// shedStreamInterceptor checks streams when they are opened; only failures
+// to open one are observed
+func (cm *ConnManager) shedStreamInterceptor(service string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := cm.shed(ctx, service, method); err != nil {
+			return nil, err
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cm.observeCall(service, err)
+		}
+
+		return stream, err
+	}
+}
+
+// ShedThresholds configures a ThresholdShedder. Zero limits are disabled
+type ShedThresholds struct {
+	// CPU returns the process CPU utilization in [0, 1], as measured by the
+	// application (e.g. from cgroup stats); it is sampled on every call
+	CPU    func() float64
+	MaxCPU float64
+
+	MaxHeapBytes uint64 // live heap objects, from runtime/metrics
+
+	MaxErrorRate float64       // failed fraction of calls to a service
+	Window       time.Duration // for MaxErrorRate, default 10s
+	MinCalls     int           // calls in the window before the rate counts, default 20
+
+	Protect []string // services never shed, e.g. the critical tier
+}
+
+// ThresholdShedder sheds calls while CPU, heap or a service's error rate is
+// above its threshold. The error rate counts UNAVAILABLE, DEADLINE_EXCEEDED,
+// INTERNAL and UNKNOWN failures over a sliding window
+type ThresholdShedder struct {
+	t ShedThresholds
+
+	heap     atomic.Uint64
+	heapRead atomic.Int64 // unix nanos of the last sample
+
+	mu    sync.Mutex
+	rates map[string]*errorWindow
+}
+
+// NewThresholdShedder returns a shedder enforcing t
+func NewThresholdShedder(t ShedThresholds) *ThresholdShedder {
+	if t.Window <= 0 {
+		t.Window = defaultShedWindow
+	}
+
+	if t.MinCalls <= 0 {
+		t.MinCalls = defaultShedMinCalls
+	}
+
+	return &ThresholdShedder{t: t, rates: make(map[string]*errorWindow)}
+}
+
+// Shed implements LoadShedder
+func (s *ThresholdShedder) Shed(_ context.Context, service, _ string) (ShedReason, bool) {
+	if slices.Contains(s.t.Protect, service) {
+		return "", false
+	}
+
+	if s.t.CPU != nil && s.t.MaxCPU > 0 && s.t.CPU() > s.t.MaxCPU {
+		return ShedCPU, true
+	}
+
+	if s.t.MaxHeapBytes > 0 && s.heapBytes() > s.t.MaxHeapBytes {
+		return ShedMemory, true
+	}
+
+	if s.t.MaxErrorRate > 0 && s.errorRate(service, time.Now()) > s.t.MaxErrorRate {
+		return ShedErrorRate, true
+	}
+
+	return "", false
+}
+
+// ObserveCall implements CallObserver
+func (s *ThresholdShedder) ObserveCall(service string, err error) {
+	if s.t.MaxErrorRate <= 0 {
+		return
+	}
+
+	failed := false
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		failed = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.rates[service]
+	if !ok {
+		w = &errorWindow{}
+		s.rates[service] = w
+	}
+
+	w.rotate(time.Now(), s.t.Window)
+	w.calls++
+
+	if failed {
+		w.failures++
+	}
+}
+
+// errorRate returns the failed fraction of calls to service over the
+// window, 0 below MinCalls
+func (s *ThresholdShedder) errorRate(service string, now time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.rates[service]
+	if !ok {
+		return 0
+	}
+
+	w.rotate(now, s.t.Window)
+
+	calls := w.calls + w.prevCalls
+	if calls < s.t.MinCalls {
+		return 0
+	}
+
+	return float64(w.failures+w.prevFailures) / float64(calls)
+}
+
+// heapBytes returns the live heap, sampled at most every heapSampleInterval
+func (s *ThresholdShedder) heapBytes() uint64 {
+	now := time.Now().UnixNano()
+
+	last := s.heapRead.Load()
+	if now-last < int64(heapSampleInterval) || !s.heapRead.CompareAndSwap(last, now) {
+		return s.heap.Load()
+	}
+
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		s.heap.Store(sample[0].Value.Uint64())
+	}
+
+	return s.heap.Load()
+}
+
+// errorWindow counts calls in the current and the previous window
+type errorWindow struct {
+	start                   time.Time
+	calls, failures         int
+	prevCalls, prevFailures int
+}
+
+// rotate starts a new window once the current one is over; after two
+// windows without calls both are empty
+func (w *errorWindow) rotate(now time.Time, window time.Duration) {
+	switch elapsed := now.Sub(w.start); {
+	case elapsed < window:
+		return
+	case elapsed < 2*window:
+		w.prevCalls, w.prevFailures = w.calls, w.failures
+	default:
+		w.prevCalls, w.prevFailures = 0, 0
+	}
+
+	w.start = now
+	w.calls, w.failures = 0, 0
+}
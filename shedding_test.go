@@ -0,0 +1,140 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// shedService rejects every call to service
+func shedService(service string) LoadShedder {
+	return LoadShedderFunc(func(_ context.Context, svc, _ string) (ShedReason, bool) {
+		return ShedCPU, svc == service
+	})
+}
+
+func TestLoadShedder_RejectsCalls(t *testing.T) {
+	rec := newRecordingSink()
+	cm := newTestManager(t, []string{"svc", "other"}, WithLoadShedder(shedService("svc"), false), WithMetrics(rec))
+
+	port := startGRPCServer(t)
+	for _, svc := range []string{"svc", "other"} {
+		if err := cm.refresh(t.Context(), svc, testEntries(svc, port)); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := cm.Invoke(ctx, "svc", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("code = %s, want ResourceExhausted", status.Code(err))
+	}
+
+	var shed *ShedError
+	if !errors.As(err, &shed) || shed.Reason != ShedCPU || shed.Method != healthCheckMethod {
+		t.Errorf("err = %v, want a cpu ShedError for the method", err)
+	}
+
+	if rec.counters[MetricShedCalls] != 1 {
+		t.Errorf("shed calls = %v, want 1", rec.counters[MetricShedCalls])
+	}
+
+	conn, err := cm.GetConn("svc")
+	if err != nil {
+		t.Fatalf("GetConn is not checked without onGetConn: %v", err)
+	}
+
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	if _, err := conn.NewStream(ctx, desc, "/grpc.health.v1.Health/Watch"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("stream: code = %s, want ResourceExhausted", status.Code(err))
+	}
+
+	if err := cm.Invoke(ctx, "other", healthCheckMethod, &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{}); err != nil {
+		t.Errorf("other service shed: %v", err)
+	}
+}
+
+func TestLoadShedder_OnGetConn(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithLoadShedder(shedService("svc"), true))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("svc"); !errors.Is(err, ErrLoadShed) {
+		t.Errorf("GetConn err = %v, want ErrLoadShed", err)
+	}
+
+	if _, err := cm.GetConnContext(context.Background(), "svc"); !errors.Is(err, ErrLoadShed) {
+		t.Errorf("GetConnContext err = %v, want ErrLoadShed", err)
+	}
+}
+
+func TestThresholdShedder(t *testing.T) {
+	cpu := 0.5
+	s := NewThresholdShedder(ShedThresholds{
+		CPU:          func() float64 { return cpu },
+		MaxCPU:       0.9,
+		MaxErrorRate: 0.5,
+		MinCalls:     4,
+		Window:       time.Minute,
+		Protect:      []string{"critical"},
+	})
+
+	ctx := context.Background()
+
+	if _, shed := s.Shed(ctx, "svc", ""); shed {
+		t.Fatal("shed below every threshold")
+	}
+
+	cpu = 0.95
+	if reason, shed := s.Shed(ctx, "svc", ""); !shed || reason != ShedCPU {
+		t.Errorf("high cpu: %q %v, want cpu", reason, shed)
+	}
+
+	if _, shed := s.Shed(ctx, "critical", ""); shed {
+		t.Error("protected service shed")
+	}
+
+	cpu = 0.5
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	for range 3 {
+		s.ObserveCall("svc", unavailable)
+	}
+
+	if _, shed := s.Shed(ctx, "svc", ""); shed {
+		t.Error("shed below MinCalls")
+	}
+
+	s.ObserveCall("svc", nil)
+	s.ObserveCall("svc", status.Error(codes.NotFound, "client error"))
+
+	if reason, shed := s.Shed(ctx, "svc", ""); !shed || reason != ShedErrorRate {
+		t.Errorf("3 of 5 failed: %q %v, want error_rate", reason, shed)
+	}
+
+	if _, shed := s.Shed(ctx, "other", ""); shed {
+		t.Error("error rate of svc shed another service")
+	}
+
+	if rate := s.errorRate("svc", time.Now().Add(3*time.Minute)); rate != 0 {
+		t.Errorf("rate after idle windows = %v, want 0", rate)
+	}
+}
+
+func TestThresholdShedder_Heap(t *testing.T) {
+	s := NewThresholdShedder(ShedThresholds{MaxHeapBytes: 1})
+
+	if reason, shed := s.Shed(context.Background(), "svc", ""); !shed || reason != ShedMemory {
+		t.Errorf("%q %v, want memory", reason, shed)
+	}
+}
@@ -0,0 +1,86 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// topology is an immutable copy of the service connections and healthy sets.
+// A new one is published on every change so readers never lock
+type topology struct {
+	services  []string // watch order
+	conns     map[string]*managedConn
+	instances map[string][]Instance // slices are replaced, never mutated
+	taken     time.Time
+}
+
+// storeTopologyLocked publishes a copy of the current topology; callers hold cm.mu
+func (cm *ConnManager) storeTopologyLocked() {
+	cm.topo.Store(&topology{
+		services:  cm.watchList,
+		conns:     maps.Clone(cm.conns),
+		instances: maps.Clone(cm.instances),
+		taken:     time.Now(),
+	})
+}
+
+// loadTopology returns the current snapshot, empty before the first
+// publication
+func (cm *ConnManager) loadTopology() *topology {
+	if t := cm.topo.Load(); t != nil {
+		return t
+	}
+
+	return &topology{services: cm.watchList, taken: time.Now()}
+}
+
+// View is an immutable point-in-time snapshot of the topology. Reads through
+// one View are consistent across services, so a request fanning out to
+// several dependencies never mixes states from before and after a change
+type View struct {
+	topo *topology
+}
+
+// View returns a snapshot of the current topology
+func (cm *ConnManager) View() View {
+	return View{topo: cm.loadTopology()}
+}
+
+// GetConn returns the connection service had when the view was taken. It
+// may have been closed since if the service switched targets
+func (v View) GetConn(service string) (*grpc.ClientConn, error) {
+	mc, ok := v.topo.conns[service]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConnNotFound, service)
+	}
+
+	return mc.conn, nil
+}
+
+// Target returns the dial target of service in the view
+func (v View) Target(service string) (string, bool) {
+	mc, ok := v.topo.conns[service]
+	if !ok {
+		return "", false
+	}
+
+	return mc.target, true
+}
+
+// Instances returns the healthy instances of service in the view. The
+// returned slice is a copy
+func (v View) Instances(service string) []Instance {
+	return slices.Clone(v.topo.instances[service])
+}
+
+// GetInstance returns the instance of service with the given ID in the view,
+// false when none or healthy instances on several nodes have it
+func (v View) GetInstance(service, id string) (Instance, bool) {
+	inst, err := instanceByID(v.topo.instances[service], service, id)
+
+	return inst, err == nil
+}
@@ -0,0 +1,119 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newBenchManager returns a manager connected to n services
+func newBenchManager(tb testing.TB, n int) (*ConnManager, []string) {
+	tb.Helper()
+
+	services := make([]string, n)
+	for i := range services {
+		services[i] = fmt.Sprintf("svc-%d", i)
+	}
+
+	cm := newTestManager(tb, services)
+
+	for i, svc := range services {
+		if err := cm.refresh(tb.Context(), svc, testEntries(svc, 9000+i)); err != nil {
+			tb.Fatalf("refresh: %v", err)
+		}
+	}
+
+	return cm, services
+}
+
+func TestGetConn_AllocationFree(t *testing.T) {
+	cm, services := newBenchManager(t, 4)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := cm.GetConn(services[2]); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Errorf("GetConn allocated %v times per call", allocs)
+	}
+}
+
+func TestGetConn_SeesSwaps(t *testing.T) {
+	cm, _ := newBenchManager(t, 1)
+
+	if err := cm.refresh(t.Context(), "svc-0", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := cm.GetConn("svc-0"); err == nil {
+		t.Error("removed connection still visible")
+	}
+
+	cm.CloseAll()
+
+	if _, err := cm.GetConn("svc-0"); err == nil {
+		t.Error("closed connection still visible")
+	}
+}
+
+func BenchmarkGetConn(b *testing.B) {
+	cm, services := newBenchManager(b, 16)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			_, _ = cm.GetConn(services[i%len(services)])
+		}
+	})
+}
+
+// BenchmarkGetConn_RWMutex is the previous locked read path, for comparison
+func BenchmarkGetConn_RWMutex(b *testing.B) {
+	cm, services := newBenchManager(b, 16)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			cm.mu.RLock()
+			_ = cm.conns[services[i%len(services)]]
+			cm.mu.RUnlock()
+		}
+	})
+}
+
+func TestView_IsPointInTime(t *testing.T) {
+	cm, _ := newBenchManager(t, 2)
+
+	view := cm.View()
+
+	if err := cm.refresh(t.Context(), "svc-0", testEntries("svc-0", 9100)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := cm.refresh(t.Context(), "svc-1", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if target, ok := view.Target("svc-0"); !ok || target != "127.0.0.1:9000" {
+		t.Errorf("view target = %q, want the pre-change target", target)
+	}
+
+	if _, err := view.GetConn("svc-1"); err != nil {
+		t.Errorf("view lost svc-1: %v", err)
+	}
+
+	if _, ok := view.GetInstance("svc-1", "svc-1-9001"); !ok {
+		t.Error("view lost svc-1 instance")
+	}
+
+	now := cm.View()
+
+	if target, _ := now.Target("svc-0"); target != "127.0.0.1:9100" {
+		t.Errorf("new view target = %q", target)
+	}
+
+	if len(now.Instances("svc-1")) != 0 {
+		t.Error("new view should see svc-1 without instances")
+	}
+}
@@ -0,0 +1,276 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// spreadSessionTTL is the TTL of the session owning this client's spread
+// keys; Consul deletes them once the session is not renewed
+const spreadSessionTTL = 15 * time.Second
+
+// WithSpreadCoordination publishes this client's chosen instance per service
+// under prefix/<service>/<client>, owned by a Consul session so entries of
+// dead clients disappear, and biases selection toward the instances chosen by
+// the fewest other clients. This approximates global least-connections
+// balancing across a fleet using one connection per service
+func WithSpreadCoordination(prefix string) Option {
+	return func(cm *ConnManager) error {
+		prefix, err := normalizeKVPrefix(prefix)
+		if err != nil {
+			return err
+		}
+
+		host, _ := os.Hostname()
+
+		cm.spreadPrefix = prefix
+		cm.spreadClient = fmt.Sprintf("%s-%d", host, os.Getpid())
+		cm.spreadQueue = make(chan Event, publishQueueSize)
+		cm.eventHandlers = append(cm.eventHandlers, cm.enqueueSpread)
+		cm.background = append(cm.background, cm.runSpreadWriter, cm.runSpreadWatcher)
+
+		return nil
+	}
+}
+
+// enqueueSpread hands selection events to the spread writer without blocking
+// the watcher
+func (cm *ConnManager) enqueueSpread(ev Event) {
+	if (ev.Type != EventTargetSelected && ev.Type != EventConnRemoved) || ev.DryRun {
+		return
+	}
+
+	select {
+	case cm.spreadQueue <- ev:
+	default:
+		cm.logger.Warn("spread queue full, dropping update", zap.String("service", ev.Service))
+	}
+}
+
+// runSpreadWriter keeps this client's choices in KV under a live session,
+// re-creating the session and republishing when it is lost
+func (cm *ConnManager) runSpreadWriter(ctx context.Context) {
+	choices := make(map[string]Event)
+
+	var (
+		session string
+		lost    chan struct{}
+		retry   <-chan time.Time // republishes after a failed write
+	)
+
+	publish := func(ev Event) {
+		if err := cm.writeSpread(ctx, session, ev); err != nil {
+			cm.logger.Warn("publish spread choice", zap.String("service", ev.Service), zap.Error(err))
+
+			if retry == nil {
+				retry = time.After(backoff(cm.retryInterval))
+			}
+		}
+	}
+
+	for ctx.Err() == nil {
+		if session == "" {
+			id, l, err := cm.newSpreadSession(ctx)
+			if err != nil {
+				cm.logger.Warn("create spread session", zap.Error(err))
+				sleepCtx(ctx, backoff(cm.retryInterval))
+
+				continue
+			}
+
+			session, lost = id, l
+
+			for _, ev := range choices {
+				publish(ev)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-lost:
+			cm.logger.Warn("spread session lost, re-creating")
+
+			session = ""
+		case <-retry:
+			retry = nil
+
+			for _, ev := range choices {
+				publish(ev)
+			}
+		case ev := <-cm.spreadQueue:
+			if ev.Type == EventConnRemoved {
+				delete(choices, ev.Service)
+			} else {
+				choices[ev.Service] = ev
+			}
+
+			publish(ev)
+		}
+	}
+}
+
+// newSpreadSession creates the session owning this client's keys and renews
+// it until ctx is done, when it is destroyed. The returned channel is closed
+// if renewal fails
+func (cm *ConnManager) newSpreadSession(ctx context.Context) (string, chan struct{}, error) {
+	wctx, cancel := context.WithTimeout(ctx, kvWriteTimeout)
+	defer cancel()
+
+	id, _, err := cm.client.Session().Create(&api.SessionEntry{
+		Name:     "consul-sd-spread-" + cm.spreadClient,
+		TTL:      spreadSessionTTL.String(),
+		Behavior: api.SessionBehaviorDelete,
+	}, (&api.WriteOptions{}).WithContext(wctx))
+	if err != nil {
+		return "", nil, err
+	}
+
+	lost := make(chan struct{})
+
+	go func() {
+		err := cm.client.Session().RenewPeriodic(spreadSessionTTL.String(), id, &api.WriteOptions{}, ctx.Done())
+		if ctx.Err() == nil {
+			cm.logger.Warn("renew spread session", zap.Error(err))
+			close(lost)
+		}
+	}()
+
+	return id, lost, nil
+}
+
+// writeSpread publishes or deletes this client's choice for ev.Service. The
+// key may still be held by a lost session of this client until Consul's
+// lock delay expires, which fails the write
+func (cm *ConnManager) writeSpread(ctx context.Context, session string, ev Event) error {
+	ctx, cancel := context.WithTimeout(ctx, kvWriteTimeout)
+	defer cancel()
+
+	key := cm.spreadPrefix + ev.Service + "/" + cm.spreadClient
+	w := (&api.WriteOptions{}).WithContext(ctx)
+
+	var err error
+
+	if ev.Type == EventConnRemoved {
+		_, err = cm.client.KV().Delete(key, w)
+	} else {
+		var value []byte
+
+		value, err = json.Marshal(PublishedTarget{
+			Service:    ev.Service,
+			Target:     ev.Target,
+			InstanceID: ev.InstanceID,
+			Node:       ev.Node,
+			Publisher:  cm.spreadClient,
+			UpdatedAt:  ev.Time,
+		})
+		if err == nil {
+			var acquired bool
+
+			acquired, _, err = cm.client.KV().Acquire(&api.KVPair{Key: key, Value: value, Session: session}, w)
+			if err == nil && !acquired {
+				err = fmt.Errorf("%s held by another session", key)
+			}
+		}
+	}
+
+	return err
+}
+
+// runSpreadWatcher follows the choices of other clients with blocking KV
+// queries
+func (cm *ConnManager) runSpreadWatcher(ctx context.Context) {
+	var waitIdx uint64
+
+	for ctx.Err() == nil {
+		q := (&api.QueryOptions{WaitIndex: waitIdx, WaitTime: cm.waitTime}).WithContext(ctx)
+
+		pairs, meta, err := cm.client.KV().List(cm.spreadPrefix, q)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			cm.logger.Warn("spread query", zap.Error(err))
+			sleepCtx(ctx, backoff(cm.retryInterval))
+
+			continue
+		}
+
+		if meta.LastIndex == waitIdx {
+			continue
+		}
+
+		waitIdx = nextWaitIndex(waitIdx, meta.LastIndex)
+		cm.updateSpread(pairs)
+	}
+}
+
+// updateSpread counts, per service and instance, the other clients that
+// chose it
+func (cm *ConnManager) updateSpread(pairs api.KVPairs) {
+	counts := make(map[string]map[instanceRef]int)
+
+	for _, p := range pairs {
+		service, client, ok := strings.Cut(strings.TrimPrefix(p.Key, cm.spreadPrefix), "/")
+		if !ok || client == cm.spreadClient {
+			continue
+		}
+
+		var pt PublishedTarget
+		if err := json.Unmarshal(p.Value, &pt); err != nil {
+			cm.logger.Warn("invalid spread entry", zap.String("key", p.Key), zap.Error(err))
+
+			continue
+		}
+
+		if counts[service] == nil {
+			counts[service] = make(map[instanceRef]int)
+		}
+
+		counts[service][instanceRef{pt.Node, pt.InstanceID}]++
+	}
+
+	cm.mu.Lock()
+	cm.spreadCounts = counts
+	cm.mu.Unlock()
+}
+
+// leastChosen keeps the candidates chosen by the fewest other clients
+func (cm *ConnManager) leastChosen(service string, candidates []Instance) []Instance {
+	if cm.spreadPrefix == "" || len(candidates) < 2 {
+		return candidates
+	}
+
+	cm.mu.RLock()
+	counts := cm.spreadCounts[service]
+	cm.mu.RUnlock()
+
+	if len(counts) == 0 {
+		return candidates
+	}
+
+	lowest := -1
+	out := make([]Instance, 0, len(candidates))
+
+	for _, inst := range candidates {
+		n := counts[inst.ref()]
+
+		switch {
+		case lowest == -1 || n < lowest:
+			lowest = n
+			out = append(out[:0], inst)
+		case n == lowest:
+			out = append(out, inst)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,132 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func spreadNodePair(t *testing.T, key, node, instanceID string) *api.KVPair {
+	t.Helper()
+
+	value, err := json.Marshal(PublishedTarget{InstanceID: instanceID, Node: node})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	return &api.KVPair{Key: key, Value: value}
+}
+
+func TestLeastChosen_PrefersLessChosenInstances(t *testing.T) {
+	cm := newTestManager(t, []string{"users"}, WithSpreadCoordination("spread"))
+
+	cm.updateSpread(api.KVPairs{
+		spreadNodePair(t, "spread/users/a", "node-9001", "users-9001"),
+		spreadNodePair(t, "spread/users/b", "node-9001", "users-9001"),
+		spreadNodePair(t, "spread/users/c", "node-9002", "users-9002"),
+		spreadNodePair(t, "spread/users/"+cm.spreadClient, "node-9003", "users-9003"), // own choice is ignored
+	})
+
+	instances := instancesFromEntries(testEntries("users", 9001, 9002, 9003))
+
+	for range 20 {
+		if inst, ok := cm.selectInstance("users", instances); !ok || inst.ID != "users-9003" {
+			t.Fatalf("selected %+v, want least chosen users-9003", inst)
+		}
+	}
+
+	got := cm.leastChosen("users", instances[:2])
+	if len(got) != 1 || got[0].ID != "users-9002" {
+		t.Errorf("least chosen = %+v, want users-9002", got)
+	}
+}
+
+func TestLeastChosen_SharedID(t *testing.T) {
+	cm := newTestManager(t, []string{"users"}, WithSpreadCoordination("spread"))
+
+	cm.updateSpread(api.KVPairs{
+		spreadNodePair(t, "spread/users/a", "node-9001", "users"),
+		spreadNodePair(t, "spread/users/b", "node-9001", "users"),
+		spreadNodePair(t, "spread/users/c", "node-9002", "users"),
+	})
+
+	instances := instancesFromEntries(sharedIDEntries("users", 9001, 9002, 9003))
+
+	for range 20 {
+		if inst, ok := cm.selectInstance("users", instances); !ok || inst.Node != "node-9003" {
+			t.Fatalf("selected %+v, want the unchosen instance on node-9003", inst)
+		}
+	}
+}
+
+func TestSpreadCoordination_PublishesChoice(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"users"},
+		WithWaitTime(50*time.Millisecond),
+		WithSpreadCoordination("spread"),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.Start(ctx)
+
+	key := "spread/users/" + cm.spreadClient
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if raw, ok := fake.getKV(key); ok {
+			var pt PublishedTarget
+			if err := json.Unmarshal(raw, &pt); err != nil || pt.InstanceID != "users-9001" {
+				t.Fatalf("published %q (err %v)", raw, err)
+			}
+
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("choice was not published")
+}
+
+func TestSpreadCoordination_RetriesHeldKey(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001)
+	fake.refuseAcquires = 2
+
+	cm, err := New(newTestClient(t, fake), []string{"users"},
+		WithWaitTime(50*time.Millisecond),
+		WithRetryInterval(20*time.Millisecond),
+		WithSpreadCoordination("spread"),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.Start(ctx)
+
+	key := "spread/users/" + cm.spreadClient
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if _, ok := fake.getKV(key); ok {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("choice was not republished after the key was released")
+}
@@ -0,0 +1,184 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	sshDefaultPort = "22"
+	sshDialTimeout = 10 * time.Second
+)
+
+// WithSSHTunnel opens every connection through an SSH jump host, so developers
+// can reach discovered targets from a laptop without VPN-wide routing. The
+// private key at keyPath must not be passphrase protected; the host key is
+// verified against ~/.ssh/known_hosts. host may omit the port (default 22).
+// Intended for development; use WithSSHTunnelConfig for full control
+func WithSSHTunnel(user, host, keyPath string) Option {
+	return func(cm *ConnManager) error {
+		if user == "" || host == "" {
+			return errors.New("empty_ssh_user_or_host")
+		}
+
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return fmt.Errorf("read ssh key: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("parse ssh key: %w", err)
+		}
+
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("locate known_hosts: %w", err)
+		}
+
+		hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+		if err != nil {
+			return fmt.Errorf("load known_hosts: %w", err)
+		}
+
+		return WithSSHTunnelConfig(host, &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeys,
+			Timeout:         sshDialTimeout,
+		})(cm)
+	}
+}
+
+// WithSSHTunnelConfig is WithSSHTunnel with a caller-provided SSH client
+// configuration (auth methods, host key policy, timeouts)
+func WithSSHTunnelConfig(host string, cfg *ssh.ClientConfig) Option {
+	return func(cm *ConnManager) error {
+		if host == "" || cfg == nil {
+			return errors.New("empty_ssh_host_or_config")
+		}
+
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, sshDefaultPort)
+		}
+
+		t := &sshTunnel{addr: host, cfg: cfg}
+		cm.proxyDial = t.dial
+		cm.proxyOptions = append(cm.proxyOptions, "WithSSHTunnel")
+		cm.closers = append(cm.closers, t)
+
+		return nil
+	}
+}
+
+// sshTunnel multiplexes target connections over one SSH client connection,
+// re-establishing it when it breaks
+type sshTunnel struct {
+	addr string
+	cfg  *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func (t *sshTunnel) dial(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := t.clientConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.DialContext(ctx, "tcp", addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	// The host refused to open a channel to addr (e.g. connection refused
+	// there): the SSH connection is fine and carries other targets
+	var refused *ssh.OpenChannelError
+	if errors.As(err, &refused) || ctx.Err() != nil {
+		return nil, err
+	}
+
+	// The SSH connection may have died; retry once on a fresh one
+	t.reset(client)
+
+	if client, err = t.clientConn(ctx); err != nil {
+		return nil, err
+	}
+
+	return client.DialContext(ctx, "tcp", addr)
+}
+
+func (t *sshTunnel) clientConn(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	d := net.Dialer{Timeout: t.cfg.Timeout}
+
+	raw, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial ssh host %s: %w", t.addr, err)
+	}
+
+	// cfg.Timeout also bounds the handshake, like the connect
+	deadline, ok := ctx.Deadline()
+	if limit := time.Now().Add(t.cfg.Timeout); t.cfg.Timeout > 0 && (!ok || limit.Before(deadline)) {
+		deadline, ok = limit, true
+	}
+
+	if ok {
+		_ = raw.SetDeadline(deadline)
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(raw, t.addr, t.cfg)
+	if err != nil {
+		_ = raw.Close()
+
+		return nil, fmt.Errorf("ssh handshake with %s: %w", t.addr, err)
+	}
+
+	_ = raw.SetDeadline(time.Time{})
+
+	t.client = ssh.NewClient(c, chans, reqs)
+
+	return t.client, nil
+}
+
+// reset drops client if it is still the current one
+func (t *sshTunnel) reset(client *ssh.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == client {
+		_ = t.client.Close()
+		t.client = nil
+	}
+}
+
+// Close shuts down the SSH connection
+func (t *sshTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == nil {
+		return nil
+	}
+
+	err := t.client.Close()
+	t.client = nil
+
+	return err
+}
@@ -0,0 +1,239 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer runs a minimal SSH server accepting any public key and
+// forwarding direct-tcpip channels
+func startSSHServer(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("host key: %v", err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) { return nil, nil },
+	}
+	cfg.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			raw, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSSH(raw, cfg)
+		}
+	}()
+
+	return ln.Addr().String(), hostKey.PublicKey()
+}
+
+func serveSSH(raw net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(raw, cfg)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "direct-tcpip" {
+			_ = nc.Reject(ssh.UnknownChannelType, "unsupported")
+
+			continue
+		}
+
+		// payload: host string, port uint32, origin host string, origin port uint32
+		data := nc.ExtraData()
+		hostLen := binary.BigEndian.Uint32(data)
+		host := string(data[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(data[4+hostLen:])
+
+		upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+
+			continue
+		}
+
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			_ = upstream.Close()
+
+			continue
+		}
+
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			defer ch.Close()
+			defer upstream.Close()
+
+			go func() { _, _ = io.Copy(ch, upstream) }()
+			_, _ = io.Copy(upstream, ch)
+		}()
+	}
+}
+
+func TestSSHTunnel_Dial(t *testing.T) {
+	echo := startEcho(t)
+	addr, hostKey := startSSHServer(t)
+
+	_, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(clientPriv)
+
+	cm := &ConnManager{}
+	err := WithSSHTunnelConfig(addr, &ssh.ClientConfig{
+		User:            "dev",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+	})(cm)
+	if err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	defer cm.closers[0].Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := cm.dialerFor("svc")(ctx, echo)
+	if err != nil {
+		t.Fatalf("dial through tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo through tunnel = %q, %v", buf, err)
+	}
+}
+
+// tunnelManager returns a manager tunneling through the SSH server at addr
+func tunnelManager(t *testing.T, addr string, hostKey ssh.PublicKey, timeout time.Duration) (*ConnManager, *sshTunnel) {
+	t.Helper()
+
+	_, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(clientPriv)
+
+	cm := &ConnManager{}
+	err := WithSSHTunnelConfig(addr, &ssh.ClientConfig{
+		User:            "dev",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         timeout,
+	})(cm)
+	if err != nil {
+		t.Fatalf("option: %v", err)
+	}
+
+	tunnel := cm.closers[0].(*sshTunnel)
+	t.Cleanup(func() { _ = tunnel.Close() })
+
+	return cm, tunnel
+}
+
+func TestSSHTunnel_RefusedTargetKeepsTunnel(t *testing.T) {
+	echo := startEcho(t)
+	addr, hostKey := startSSHServer(t)
+	cm, tunnel := tunnelManager(t, addr, hostKey, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := cm.dialerFor("svc")(ctx, echo)
+	if err != nil {
+		t.Fatalf("dial through tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	client := tunnel.client
+
+	_, err = cm.dialerFor("svc")(ctx, "127.0.0.1:"+strconv.Itoa(closedPort(t)))
+
+	var refused *ssh.OpenChannelError
+	if !errors.As(err, &refused) {
+		t.Fatalf("err = %v, want *ssh.OpenChannelError", err)
+	}
+
+	if tunnel.client != client {
+		t.Error("SSH client replaced after a refused target")
+	}
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo after refused dial = %q, %v", buf, err)
+	}
+}
+
+func TestSSHTunnel_HandshakeTimeout(t *testing.T) {
+	// accepts TCP but never speaks SSH
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		var held []net.Conn
+
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				for _, c := range held {
+					_ = c.Close()
+				}
+
+				return
+			}
+
+			held = append(held, conn)
+		}
+	}()
+
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewPublicKey(pub)
+
+	cm, _ := tunnelManager(t, ln.Addr().String(), hostKey, 100*time.Millisecond)
+
+	start := time.Now()
+
+	if _, err := cm.dialerFor("svc")(context.Background(), "127.0.0.1:1"); err == nil {
+		t.Fatal("expected a handshake timeout")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("dial took %s, want it bounded by the 100ms config timeout", elapsed)
+	}
+}
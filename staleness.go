@@ -0,0 +1,43 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// WithMaxStaleness lets watchers read from any Consul server instead of the
+// leader, spreading query load across followers, as long as the answering
+// server heard from the leader within d. A response staler than that is
+// discarded and the query repeated against the leader at once; the next
+// query is a stale read again
+func WithMaxStaleness(d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if d <= 0 {
+			return errors.New("max_staleness_must_be_positive")
+		}
+
+		cm.maxStaleness = d
+
+		return nil
+	}
+}
+
+// tooStale reports whether a stale read of service lags the leader by more
+// than WithMaxStaleness allows
+func (cm *ConnManager) tooStale(service string, q *api.QueryOptions, meta *api.QueryMeta) bool {
+	if !q.AllowStale || meta.LastContact <= cm.maxStaleness {
+		return false
+	}
+
+	cm.metrics.IncrCounter(MetricStaleReads, 1, serviceLabel(service))
+	cm.logger.Debug("stale read beyond bound, querying the leader",
+		zap.String("service", service),
+		zap.Duration("last_contact", meta.LastContact),
+		zap.Duration("max_staleness", cm.maxStaleness),
+	)
+
+	return true
+}
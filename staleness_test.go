@@ -0,0 +1,100 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lagging answers stale health reads with the given leader contact age and
+// records the read modes it saw
+type lagging struct {
+	fake *fakeConsul
+	lag  time.Duration
+
+	mu    sync.Mutex
+	modes []string
+}
+
+func (l *lagging) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/v1/health/service/") {
+		mode := "leader"
+		if r.URL.Query().Has("stale") {
+			mode = "stale"
+			w.Header().Set("X-Consul-LastContact", strconv.FormatInt(l.lag.Milliseconds(), 10))
+		}
+
+		l.mu.Lock()
+		l.modes = append(l.modes, mode)
+		l.mu.Unlock()
+	}
+
+	l.fake.ServeHTTP(w, r)
+}
+
+func (l *lagging) seen() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.modes...)
+}
+
+func TestMaxStaleness(t *testing.T) {
+	cases := []struct {
+		name string
+		lag  time.Duration
+		want []string // first read modes
+	}{
+		{"fresh enough", 100 * time.Millisecond, []string{"stale"}},
+		{"too stale", 5 * time.Second, []string{"stale", "leader"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeConsul()
+			fake.setInstances("svc", 9001)
+
+			h := &lagging{fake: fake, lag: c.lag}
+
+			cm, err := New(newTestClient(t, h), []string{"svc"},
+				WithMaxStaleness(time.Second), WithWaitTime(time.Second))
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			cm.Start(ctx)
+
+			waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+			modes := h.seen()
+			if len(modes) < len(c.want) {
+				t.Fatalf("reads = %v, want %v first", modes, c.want)
+			}
+
+			for i, m := range c.want {
+				if modes[i] != m {
+					t.Errorf("reads = %v, want %v first", modes, c.want)
+
+					break
+				}
+			}
+
+			if len(c.want) == 1 && slices.Contains(modes, "leader") {
+				t.Errorf("reads = %v, want no leader read", modes)
+			}
+		})
+	}
+}
+
+func TestWithMaxStaleness_Validation(t *testing.T) {
+	if err := WithMaxStaleness(0)(newTestManager(t, []string{"svc"})); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,172 @@
+package consul_service_discovery
+
+import (
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// WithStandbyConn keeps a second, already connecting client to another
+// healthy instance of service. When the instance in use leaves the eligible
+// set the standby takes over with a swap instead of a dial, skipping the
+// TCP, TLS and HTTP/2 setup that otherwise delays failover, and a new
+// standby is dialed. Standby connections count towards WithMaxTotalConns:
+// one is only dialed while the cap leaves room, and it is closed first when
+// a service connection needs that room
+func WithStandbyConn(service string, enabled bool) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if enabled {
+			cm.withStandby[service] = struct{}{}
+		} else {
+			delete(cm.withStandby, service)
+		}
+
+		return nil
+	}
+}
+
+// hasStandby reports whether service keeps a standby connection
+func (cm *ConnManager) hasStandby(service string) bool {
+	_, ok := cm.withStandby[service]
+
+	return ok && !cm.dryRun && !cm.isHTTP(service)
+}
+
+// promoteStandby hands over the standby of service when the current
+// instance is no longer eligible and the standby instance still is
+func (cm *ConnManager) promoteStandby(service string, instances []Instance) (*managedConn, bool) {
+	eligible := cm.eligible(service, instances)
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	sb, ok := cm.standbys[service]
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := findInstance(eligible, sb.ref()); !ok {
+		return nil, false
+	}
+
+	if cur, ok := cm.conns[service]; ok {
+		if _, ok := findInstance(eligible, cur.ref()); ok {
+			return nil, false
+		}
+	}
+
+	delete(cm.standbys, service)
+
+	return sb, true
+}
+
+// takeStandby hands over the standby of service when it is connected to the
+// instance identified by ref
+func (cm *ConnManager) takeStandby(service string, ref instanceRef) (*managedConn, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	sb, ok := cm.standbys[service]
+	if !ok || sb.ref() != ref {
+		return nil, false
+	}
+
+	delete(cm.standbys, service)
+
+	return sb, true
+}
+
+// maintainStandby drops a standby that is no longer useful and dials a new
+// one to the instance selection prefers after the current one
+func (cm *ConnManager) maintainStandby(service string, instances []Instance) {
+	eligible := cm.eligible(service, instances)
+
+	cm.mu.Lock()
+	cur, connected := cm.conns[service]
+
+	if sb, ok := cm.standbys[service]; ok {
+		if _, stillEligible := findInstance(eligible, sb.ref()); stillEligible && connected && sb.target != cur.target {
+			cm.mu.Unlock()
+
+			return
+		}
+
+		_ = cm.releaseLocked(sb.conn)
+		delete(cm.standbys, service)
+	}
+
+	room := cm.hasConnRoomLocked()
+	cm.mu.Unlock()
+
+	if !connected || !room {
+		return
+	}
+
+	others := slices.DeleteFunc(slices.Clone(instances), func(inst Instance) bool {
+		return inst.ref() == cur.ref()
+	})
+
+	inst, ok := cm.selectInstance(service, others)
+	if !ok {
+		return
+	}
+
+	mc, err := cm.dialInstance(service, inst)
+	if err != nil {
+		cm.logger.Debug("dial standby", zap.String("service", service), zap.String("instance", inst.ID), zap.Error(err))
+
+		return
+	}
+
+	if mc.target == cur.target {
+		cm.mu.Lock()
+		_ = cm.releaseLocked(mc.conn)
+		cm.mu.Unlock()
+
+		return
+	}
+
+	cm.mu.Lock()
+	if !cm.hasConnRoomLocked() {
+		_ = cm.releaseLocked(mc.conn)
+		cm.mu.Unlock()
+
+		return
+	}
+
+	cm.standbys[service] = mc
+	cm.mu.Unlock()
+
+	mc.conn.Connect()
+
+	cm.logger.Debug("standby connection ready",
+		zap.String("service", service),
+		zap.String("target", mc.target),
+		zap.String("instance", mc.instanceID),
+	)
+}
+
+// dropStandbyLocked closes one standby connection to free its room under the
+// connection budget, reporting whether there was one
+func (cm *ConnManager) dropStandbyLocked() bool {
+	for service, sb := range cm.standbys {
+		delete(cm.standbys, service)
+
+		if err := cm.releaseLocked(sb.conn); err != nil {
+			cm.logger.Warn("close standby conn", zap.String("service", service), zap.Error(err))
+		}
+
+		cm.logger.Info("closed standby conn to stay within budget",
+			zap.String("service", service),
+			zap.Int("limit", cm.maxConns),
+		)
+
+		return true
+	}
+
+	return false
+}
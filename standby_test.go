@@ -0,0 +1,106 @@
+package consul_service_discovery
+
+import (
+	"testing"
+)
+
+func TestStandbyConn_Failover(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithStandbyConn("svc", true))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	cur, standby := cm.conns["svc"], cm.standbys["svc"]
+	if cur == nil || standby == nil || standby.instanceID == cur.instanceID {
+		t.Fatalf("current %+v, standby %+v: want both on different instances", cur, standby)
+	}
+
+	// the current instance dies: the standby takes over as is
+	survivor := 9001
+	if cur.instanceID == "svc-9001" {
+		survivor = 9002
+	}
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", survivor)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if got := cm.conns["svc"]; got != standby {
+		t.Fatalf("after failover conn = %+v, want the standby %+v", got, standby)
+	}
+
+	if sb, ok := cm.standbys["svc"]; ok {
+		t.Errorf("standby %+v kept without another instance", sb)
+	}
+
+	// a new instance gets the other connection; re-selecting the standby
+	// instance reuses its connection
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", survivor, 9003)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	for range 10 {
+		prev, prevStandby := cm.conns["svc"], cm.standbys["svc"]
+
+		if err := cm.refresh(t.Context(), "svc", testEntries("svc", survivor, 9003)); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		cur, sb := cm.conns["svc"], cm.standbys["svc"]
+		if sb == nil || sb.instanceID == cur.instanceID {
+			t.Fatalf("current %+v, standby %+v: want both on different instances", cur, sb)
+		}
+
+		if cur.instanceID != prev.instanceID && cur != prevStandby {
+			t.Fatalf("switched to %s with a new dial instead of the standby", cur.instanceID)
+		}
+	}
+
+	cm.CloseAll()
+
+	if len(cm.standbys) != 0 {
+		t.Error("CloseAll kept standby connections")
+	}
+}
+
+func TestStandbyConn_UnknownService(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := WithStandbyConn("other", true)(cm); err == nil {
+		t.Error("expected error for an unwatched service")
+	}
+}
+
+func TestStandbyConn_CountsTowardsBudget(t *testing.T) {
+	cm := newTestManager(t, []string{"svc", "other"}, WithStandbyConn("svc", true), WithMaxTotalConns(2))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, ok := cm.standbys["svc"]; !ok {
+		t.Fatal("no standby while the budget has room")
+	}
+
+	// another service needs the room: the standby gives it up
+	if err := cm.refresh(t.Context(), "other", testEntries("other", 9101)); err != nil {
+		t.Fatalf("refresh other: %v", err)
+	}
+
+	if _, ok := cm.conns["other"]; !ok {
+		t.Fatal("other service not connected")
+	}
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if sb, ok := cm.standbys["svc"]; ok {
+		t.Errorf("standby %+v dialed beyond the budget", sb)
+	}
+
+	if open := cm.openConnsLocked(); open != 2 {
+		t.Errorf("open = %d, want 2", open)
+	}
+}
@@ -0,0 +1,125 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsdSink is a MetricsSink writing the StatsD line protocol over UDP.
+// In DogStatsD mode labels are sent as tags; otherwise their values are
+// folded into the metric name (prefix.name.value1.value2)
+type StatsdSink struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+// NewStatsdSink dials the StatsD agent at addr. Sends are fire-and-forget;
+// write errors are dropped so metrics never block discovery
+func NewStatsdSink(addr, prefix string, dogstatsd bool) (*StatsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial statsd: %w", err)
+	}
+
+	return &StatsdSink{conn: conn, prefix: strings.TrimSuffix(prefix, "."), tags: dogstatsd}, nil
+}
+
+// WithStatsd emits discovery metrics to a plain StatsD agent at addr
+func WithStatsd(addr, prefix string) Option {
+	return withStatsd(addr, prefix, false)
+}
+
+// WithDogStatsd emits discovery metrics to a DogStatsD agent at addr, sending
+// labels as tags
+func WithDogStatsd(addr, prefix string) Option {
+	return withStatsd(addr, prefix, true)
+}
+
+func withStatsd(addr, prefix string, dogstatsd bool) Option {
+	return func(cm *ConnManager) error {
+		if addr == "" {
+			return errors.New("empty_statsd_addr")
+		}
+
+		sink, err := NewStatsdSink(addr, prefix, dogstatsd)
+		if err != nil {
+			return err
+		}
+
+		cm.metrics = append(cm.metrics, sink)
+		cm.closers = append(cm.closers, sink)
+
+		return nil
+	}
+}
+
+func (s *StatsdSink) IncrCounter(name string, value float64, labels ...Label) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "c", labels)
+}
+
+func (s *StatsdSink) SetGauge(name string, value float64, labels ...Label) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", labels)
+}
+
+func (s *StatsdSink) ObserveDuration(name string, d time.Duration, labels ...Label) {
+	s.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms", labels)
+}
+
+// Close releases the UDP socket
+func (s *StatsdSink) Close() error { return s.conn.Close() }
+
+func (s *StatsdSink) send(name, value, kind string, labels []Label) {
+	_, _ = s.conn.Write([]byte(s.format(name, value, kind, labels)))
+}
+
+// format renders a single StatsD line
+func (s *StatsdSink) format(name, value, kind string, labels []Label) string {
+	var b strings.Builder
+
+	if s.prefix != "" {
+		b.WriteString(s.prefix)
+		b.WriteByte('.')
+	}
+
+	b.WriteString(name)
+
+	if !s.tags {
+		for _, l := range labels {
+			b.WriteByte('.')
+			b.WriteString(strings.ReplaceAll(sanitizeStatsd(l.Value), ".", "_"))
+		}
+	}
+
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+
+	if s.tags && len(labels) > 0 {
+		b.WriteString("|#")
+
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			b.WriteString(sanitizeStatsd(l.Name))
+			b.WriteByte(':')
+			b.WriteString(sanitizeStatsd(l.Value))
+		}
+	}
+
+	return b.String()
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_")
+
+// sanitizeStatsd replaces characters with special meaning in the protocol
+func sanitizeStatsd(s string) string {
+	return statsdReplacer.Replace(s)
+}
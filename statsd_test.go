@@ -0,0 +1,79 @@
+package consul_service_discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestStatsdSink_Format(t *testing.T) {
+	labels := []Label{serviceLabel("users.v2"), {"result", "ok"}}
+
+	plain := &StatsdSink{prefix: "app"}
+	if got, want := plain.format(MetricQueries, "1", "c", labels), "app.consul_sd_queries_total.users_v2.ok:1|c"; got != want {
+		t.Errorf("statsd line = %q, want %q", got, want)
+	}
+
+	dog := &StatsdSink{tags: true}
+	if got, want := dog.format(MetricInstances, "3", "g", labels), "consul_sd_healthy_instances:3|g|#service:users.v2,result:ok"; got != want {
+		t.Errorf("dogstatsd line = %q, want %q", got, want)
+	}
+}
+
+func TestStatsdSink_Send(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer pc.Close()
+
+	sink, err := NewStatsdSink(pc.LocalAddr().String(), "app.", true)
+	if err != nil {
+		t.Fatalf("new sink: %v", err)
+	}
+	defer sink.Close()
+
+	sink.ObserveDuration(MetricQueryLatency, 1500*time.Microsecond, serviceLabel("users"))
+
+	buf := make([]byte, 512)
+	_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	if got, want := string(buf[:n]), "app.consul_sd_query_duration:1.500|ms|#service:users"; got != want {
+		t.Errorf("packet = %q, want %q", got, want)
+	}
+}
+
+// recordingSink remembers the last value per metric name for assertions
+type recordingSink struct {
+	counters map[string]float64
+	gauges   map[string]float64
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{counters: map[string]float64{}, gauges: map[string]float64{}}
+}
+
+func (r *recordingSink) IncrCounter(name string, v float64, _ ...Label)  { r.counters[name] += v }
+func (r *recordingSink) SetGauge(name string, v float64, _ ...Label)     { r.gauges[name] = v }
+func (r *recordingSink) ObserveDuration(string, time.Duration, ...Label) {}
+
+func TestReplaceConn_EmitsMetrics(t *testing.T) {
+	rec := newRecordingSink()
+	cm := newStatusManager(t)
+	cm.metrics = fanoutSink{rec}
+
+	cm.replaceConn("users", nil)
+
+	if rec.counters[MetricConnSwaps] != 1 {
+		t.Errorf("swaps = %v, want 1", rec.counters[MetricConnSwaps])
+	}
+
+	if v, ok := rec.gauges[MetricConnected]; !ok || v != 0 {
+		t.Errorf("connected gauge = %v (set=%v), want 0", v, ok)
+	}
+}
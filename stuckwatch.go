@@ -0,0 +1,123 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithStuckWatcherDetection restarts the watcher of a service that made no
+// progress (no query answered or failed, no new loop iteration) for
+// threshold, e.g. frozen on a hung connection to the agent, emitting
+// EventWatcherStuck and MetricWatcherStuck. Paused watchers and those
+// holding after a 429 are not stuck. It also reports MetricWatcherAge for
+// every watcher. The threshold must exceed the query timeout
+func WithStuckWatcherDetection(threshold time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if threshold <= 0 {
+			return errors.New("stuck_threshold_must_be_positive")
+		}
+
+		cm.stuckAfter = threshold
+		cm.background = append(cm.background, cm.runStuckDetector)
+
+		return nil
+	}
+}
+
+// heartbeat records watcher progress, and a successful query when ok
+func (ws *watchState) heartbeat(ok bool) {
+	now := time.Now()
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.beat = now
+
+	if ok {
+		ws.lastSuccess = now
+	}
+}
+
+// launchWatcher starts the watcher goroutine of service, stopping the one
+// started before, if any
+func (cm *ConnManager) launchWatcher(ctx context.Context, service string) {
+	ws, ok := cm.watchStates[service]
+	if !ok {
+		go cm.watchLabeled(ctx, service)
+
+		return
+	}
+
+	wctx, stop := context.WithCancel(ctx)
+
+	ws.mu.Lock()
+	if ws.stop != nil {
+		ws.stop()
+	}
+
+	ws.stop = stop
+	ws.beat = time.Now()
+	ws.mu.Unlock()
+
+	go cm.watchLabeled(wctx, service)
+}
+
+// runStuckDetector checks the watchers a few times per threshold until ctx
+// is done
+func (cm *ConnManager) runStuckDetector(ctx context.Context) {
+	ticker := time.NewTicker(cm.stuckAfter / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cm.checkWatchers(ctx, now)
+		}
+	}
+}
+
+// checkWatchers reports watcher liveness and restarts stuck watchers
+func (cm *ConnManager) checkWatchers(ctx context.Context, now time.Time) {
+	held := time.Unix(0, cm.queryHold.Load())
+
+	for _, svc := range cm.watchList {
+		ws, ok := cm.watchStates[svc]
+		if !ok {
+			continue
+		}
+
+		ws.mu.Lock()
+		launched, paused, beat, success := ws.stop != nil, ws.paused != nil, ws.beat, ws.lastSuccess
+		ws.mu.Unlock()
+
+		if !success.IsZero() {
+			cm.metrics.SetGauge(MetricWatcherAge, now.Sub(success).Seconds(), serviceLabel(svc))
+		}
+
+		// a hold after a 429 keeps every watcher waiting until it ends
+		idle := now.Sub(beat)
+		if since := now.Sub(held); since < idle {
+			idle = since
+		}
+
+		if !launched || paused || idle < cm.stuckAfter {
+			continue
+		}
+
+		cm.logger.Error("watcher stuck, restarting",
+			zap.String("service", svc),
+			zap.Duration("idle", idle),
+			zap.Time("last_success", success),
+		)
+		cm.metrics.IncrCounter(MetricWatcherStuck, 1, serviceLabel(svc))
+		cm.emit(Event{Type: EventWatcherStuck, Service: svc, Err: fmt.Errorf("no progress for %s", idle.Round(time.Millisecond))})
+
+		cm.launchWatcher(ctx, svc)
+	}
+}
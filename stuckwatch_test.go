@@ -0,0 +1,123 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// freezingTransport hangs the first request regardless of its context, like
+// a connection wedged below the HTTP client
+type freezingTransport struct {
+	once    sync.Once
+	release chan struct{}
+}
+
+func (f *freezingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	frozen := false
+	f.once.Do(func() { frozen = true })
+
+	if frozen {
+		<-f.release
+	}
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestStuckWatcher_Restarted(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	transport := &freezingTransport{release: make(chan struct{})}
+	t.Cleanup(func() { close(transport.release) })
+
+	cfg := api.DefaultConfig()
+	cfg.Address = srv.URL
+	cfg.HttpClient = &http.Client{Transport: transport}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("consul client: %v", err)
+	}
+
+	rec := &eventRecorder{}
+
+	cm, err := New(client, []string{"svc"},
+		WithWaitTime(50*time.Millisecond),
+		WithQueryTimeout(100*time.Millisecond),
+		WithStuckWatcherDetection(300*time.Millisecond),
+		WithEventHandler(rec.handle),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	t.Cleanup(cm.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.Start(ctx)
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if !slices.Contains(rec.types(), EventWatcherStuck) {
+		t.Errorf("events = %v, want %s", rec.types(), EventWatcherStuck)
+	}
+}
+
+func TestCheckWatchers_SkipsIdleWatchers(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithStuckWatcherDetection(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // restarted watchers exit at once
+
+	ws := cm.watchStates["svc"]
+	now := time.Now()
+	stuck := now.Add(-2 * time.Minute)
+
+	var stops int
+
+	cases := []struct {
+		name    string
+		prepare func()
+		restart bool
+	}{
+		{"progressing", func() { ws.beat = now.Add(-time.Second) }, false},
+		{"paused", func() { ws.beat, ws.paused = stuck, make(chan struct{}) }, false},
+		{"holding after 429", func() { ws.beat = stuck; cm.queryHold.Store(now.Add(-time.Second).UnixNano()) }, false},
+		{"stuck", func() { ws.beat = stuck }, true},
+	}
+
+	for _, c := range cases {
+		ws.paused = nil
+		cm.queryHold.Store(0)
+		ws.stop = func() { stops++ }
+		c.prepare()
+
+		before := stops
+		cm.checkWatchers(ctx, now)
+
+		if restarted := stops > before; restarted != c.restart {
+			t.Errorf("%s: restarted = %v, want %v", c.name, restarted, c.restart)
+		}
+	}
+}
+
+func TestStuckWatcherDetection_MustExceedQueryTimeout(t *testing.T) {
+	_, err := New(newTestClient(t, hangingConsul), []string{"svc"},
+		WithQueryTimeout(time.Minute),
+		WithStuckWatcherDetection(30*time.Second),
+	)
+	if !errors.Is(err, ErrOptionConflict) {
+		t.Errorf("err = %v, want ErrOptionConflict", err)
+	}
+}
@@ -0,0 +1,245 @@
+package consul_service_discovery
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"time"
+)
+
+// historySize is the number of recent events kept for SupportBundle
+const historySize = 256
+
+// eventHistory is a ring of the most recent events
+type eventHistory struct {
+	mu   sync.Mutex
+	buf  []Event
+	next int
+}
+
+func (h *eventHistory) add(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.buf) < historySize {
+		h.buf = append(h.buf, ev)
+
+		return
+	}
+
+	h.buf[h.next] = ev
+	h.next = (h.next + 1) % historySize
+}
+
+// events returns the kept events, oldest first
+func (h *eventHistory) events() []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append(slices.Clone(h.buf[h.next:]), h.buf[:h.next]...)
+}
+
+// SupportBundle writes a zip archive describing the manager to w, to attach
+// to bug reports and incident tickets:
+//
+//   - config.json, config.md: the ConfigReport
+//   - status.json: Status of every service
+//   - topology.json: targets and healthy instances of every service
+//   - history.json: the last events, oldest first
+//   - errors.json: why services are unavailable and the recent error events
+//     by service and type
+//   - goroutines.txt: a goroutine profile, with discovery pprof labels
+//
+// The bundle holds no credentials but does hold service addresses and
+// metadata
+func (cm *ConnManager) SupportBundle(ctx context.Context, w io.Writer) error {
+	report := cm.ConfigReport()
+	history := cm.history.events()
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"config.json", jsonFile(report)},
+		{"config.md", func(w io.Writer) error {
+			_, err := io.WriteString(w, report.Markdown())
+
+			return err
+		}},
+		{"status.json", jsonFile(cm.Status())},
+		{"topology.json", jsonFile(cm.bundleTopology())},
+		{"history.json", jsonFile(bundleEvents(history))},
+		{"errors.json", jsonFile(cm.bundleErrors(history))},
+		{"goroutines.txt", func(w io.Writer) error {
+			if _, err := fmt.Fprintf(w, "# %s %s/%s, %d goroutines, %s\n",
+				runtime.Version(), runtime.GOOS, runtime.GOARCH, runtime.NumGoroutine(),
+				time.Now().Format(time.RFC3339)); err != nil {
+				return err
+			}
+
+			return pprof.Lookup("goroutine").WriteTo(w, 1)
+		}},
+	}
+
+	zw := zip.NewWriter(w)
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return fmt.Errorf("support bundle %s: %w", f.name, err)
+		}
+
+		if err := f.write(fw); err != nil {
+			return fmt.Errorf("support bundle %s: %w", f.name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+func jsonFile(v any) func(io.Writer) error {
+	return func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	}
+}
+
+// bundleService is the topology.json entry of a service
+type bundleService struct {
+	Service    string     `json:"service"`
+	Target     string     `json:"target,omitempty"`
+	InstanceID string     `json:"instance_id,omitempty"`
+	Node       string     `json:"node,omitempty"`
+	Instances  []Instance `json:"instances"`
+}
+
+func (cm *ConnManager) bundleTopology() []bundleService {
+	view := cm.View()
+
+	var out []bundleService
+
+	for svc, info := range view.All() {
+		out = append(out, bundleService{
+			Service:    svc,
+			Target:     info.Target,
+			InstanceID: info.InstanceID,
+			Node:       info.Node,
+			Instances:  view.Instances(svc),
+		})
+	}
+
+	return out
+}
+
+// bundleEvent is an Event with its error as text
+type bundleEvent struct {
+	Time       time.Time `json:"time"`
+	Type       EventType `json:"type"`
+	Service    string    `json:"service,omitempty"`
+	Target     string    `json:"target,omitempty"`
+	InstanceID string    `json:"instance_id,omitempty"`
+	Node       string    `json:"node,omitempty"`
+	Instances  int       `json:"instances,omitempty"`
+	Err        string    `json:"error,omitempty"`
+}
+
+func bundleEvents(events []Event) []bundleEvent {
+	out := make([]bundleEvent, 0, len(events))
+
+	for _, ev := range events {
+		be := bundleEvent{
+			Time:       ev.Time,
+			Type:       ev.Type,
+			Service:    ev.Service,
+			Target:     ev.Target,
+			InstanceID: ev.InstanceID,
+			Node:       ev.Node,
+			Instances:  ev.Instances,
+		}
+
+		if ev.Err != nil {
+			be.Err = ev.Err.Error()
+		}
+
+		out = append(out, be)
+	}
+
+	return out
+}
+
+// bundleErrorSummary is errors.json
+type bundleErrorSummary struct {
+	Unavailable []bundleReason     `json:"unavailable"`
+	Recent      []bundleErrorCount `json:"recent"`
+}
+
+type bundleReason struct {
+	Service string    `json:"service"`
+	Cause   Cause     `json:"cause"`
+	Since   time.Time `json:"since"`
+	Err     string    `json:"error,omitempty"`
+}
+
+type bundleErrorCount struct {
+	Service   string    `json:"service"`
+	Type      EventType `json:"type"`
+	Count     int       `json:"count"`
+	Last      time.Time `json:"last"`
+	LastError string    `json:"last_error"`
+}
+
+func (cm *ConnManager) bundleErrors(history []Event) bundleErrorSummary {
+	sum := bundleErrorSummary{
+		Unavailable: []bundleReason{},
+		Recent:      []bundleErrorCount{},
+	}
+
+	for _, svc := range cm.watchList {
+		r := cm.Unavailability(svc)
+		if r == nil {
+			continue
+		}
+
+		br := bundleReason{Service: svc, Cause: r.Cause, Since: r.Since}
+		if r.Err != nil {
+			br.Err = r.Err.Error()
+		}
+
+		sum.Unavailable = append(sum.Unavailable, br)
+	}
+
+	index := make(map[[2]string]int)
+
+	for _, ev := range history {
+		if ev.Err == nil {
+			continue
+		}
+
+		key := [2]string{ev.Service, string(ev.Type)}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(sum.Recent)
+			index[key] = i
+			sum.Recent = append(sum.Recent, bundleErrorCount{Service: ev.Service, Type: ev.Type})
+		}
+
+		sum.Recent[i].Count++
+		sum.Recent[i].Last = ev.Time
+		sum.Recent[i].LastError = ev.Err.Error()
+	}
+
+	return sum
+}
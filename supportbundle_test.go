@@ -0,0 +1,135 @@
+package consul_service_discovery
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// bundleFiles unzips a support bundle
+func bundleFiles(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+
+	files := make(map[string][]byte)
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+
+		files[f.Name], err = io.ReadAll(rc)
+		_ = rc.Close()
+
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+	}
+
+	return files
+}
+
+func TestSupportBundle(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"users", "orders"}, WithOptionalServices("orders"))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	cm.Start(ctx)
+
+	waitTarget(t, cm, "users", "127.0.0.1:9001")
+
+	cm.emit(Event{Type: EventQueryError, Service: "orders", Err: errors.New("boom 1")})
+	cm.emit(Event{Type: EventQueryError, Service: "orders", Err: errors.New("boom 2")})
+
+	var buf bytes.Buffer
+	if err := cm.SupportBundle(context.Background(), &buf); err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+
+	files := bundleFiles(t, buf.Bytes())
+
+	for _, name := range []string{"config.json", "config.md", "status.json", "topology.json", "history.json", "errors.json", "goroutines.txt"} {
+		if len(files[name]) == 0 {
+			t.Errorf("%s missing or empty", name)
+		}
+	}
+
+	var topo []bundleService
+	if err := json.Unmarshal(files["topology.json"], &topo); err != nil {
+		t.Fatalf("topology: %v", err)
+	}
+
+	if len(topo) != 2 || topo[0].Target != "127.0.0.1:9001" || len(topo[0].Instances) != 1 {
+		t.Errorf("topology = %+v", topo)
+	}
+
+	var history []bundleEvent
+	if err := json.Unmarshal(files["history.json"], &history); err != nil {
+		t.Fatalf("history: %v", err)
+	}
+
+	if last := history[len(history)-1]; last.Type != EventQueryError || last.Err != "boom 2" {
+		t.Errorf("last event = %+v", last)
+	}
+
+	var errs bundleErrorSummary
+	if err := json.Unmarshal(files["errors.json"], &errs); err != nil {
+		t.Fatalf("errors: %v", err)
+	}
+
+	if len(errs.Unavailable) != 1 || errs.Unavailable[0].Service != "orders" {
+		t.Errorf("unavailable = %+v", errs.Unavailable)
+	}
+
+	if len(errs.Recent) != 1 || errs.Recent[0].Count != 2 || errs.Recent[0].LastError != "boom 2" {
+		t.Errorf("recent errors = %+v", errs.Recent)
+	}
+
+	if !strings.Contains(string(files["goroutines.txt"]), "goroutine profile") {
+		t.Error("goroutines.txt is not a goroutine profile")
+	}
+}
+
+func TestSupportBundle_CanceledContext(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := cm.SupportBundle(ctx, io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestEventHistory_KeepsLatest(t *testing.T) {
+	var h eventHistory
+
+	for i := range historySize + 10 {
+		h.add(Event{Instances: i})
+	}
+
+	events := h.events()
+	if len(events) != historySize {
+		t.Fatalf("kept %d events, want %d", len(events), historySize)
+	}
+
+	if events[0].Instances != 10 || events[historySize-1].Instances != historySize+9 {
+		t.Errorf("kept events %d..%d", events[0].Instances, events[historySize-1].Instances)
+	}
+}
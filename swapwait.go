@@ -0,0 +1,87 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// WithSwapWaitForReady smooths failovers: for window after the manager
+// switches a service to a new target, RPCs on that target's connection are
+// made with grpc.WaitForReady(true), so they queue while it connects instead
+// of failing fast. Unary calls in the window are also given a deadline of at
+// most timeout, so callers without one cannot hang on a target that never
+// comes up
+func WithSwapWaitForReady(window, timeout time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if window <= 0 {
+			return errors.New("swap_window_must_be_positive")
+		}
+
+		if timeout <= 0 {
+			return errors.New("swap_timeout_must_be_positive")
+		}
+
+		cm.swapWindow = window
+		cm.swapTimeout = timeout
+
+		return nil
+	}
+}
+
+// markSwap opens the swap window of target
+func (cm *ConnManager) markSwap(target string) {
+	if cm.swapWindow > 0 {
+		cm.swaps.Store(target, time.Now().Add(cm.swapWindow))
+	}
+}
+
+// swapping reports whether target is inside its swap window
+func (cm *ConnManager) swapping(target string) bool {
+	v, ok := cm.swaps.Load(target)
+	if !ok {
+		return false
+	}
+
+	if time.Now().Before(v.(time.Time)) {
+		return true
+	}
+
+	cm.swaps.CompareAndDelete(target, v)
+
+	return false
+}
+
+// swapUnaryInterceptor applies WaitForReady and the swap timeout to unary
+// calls made during a swap window. The target is taken from cc so a conn
+// pooled across services needs no per-service state
+func (cm *ConnManager) swapUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if cc == nil || !cm.swapping(cc.Target()) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > cm.swapTimeout {
+			var cancel context.CancelFunc
+
+			ctx, cancel = context.WithTimeout(ctx, cm.swapTimeout)
+			defer cancel()
+		}
+
+		return invoker(ctx, method, req, reply, cc, append(opts, grpc.WaitForReady(true))...)
+	}
+}
+
+// swapStreamInterceptor applies WaitForReady to streams opened during a swap
+// window. Their deadline is left alone, see WithDefaultTimeout
+func (cm *ConnManager) swapStreamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if cc != nil && cm.swapping(cc.Target()) {
+			opts = append(opts, grpc.WaitForReady(true))
+		}
+
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
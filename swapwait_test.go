@@ -0,0 +1,111 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func hasWaitForReady(opts []grpc.CallOption) bool {
+	for _, opt := range opts {
+		if o, ok := opt.(grpc.FailFastCallOption); ok && !o.FailFast {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestSwapWaitForReady_Window(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithSwapWaitForReady(time.Hour, time.Second))
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	conn, err := cm.GetConn("svc")
+	if err != nil {
+		t.Fatalf("get conn: %v", err)
+	}
+
+	var (
+		gotOpts     []grpc.CallOption
+		gotDeadline time.Time
+	)
+
+	invoker := func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, opts ...grpc.CallOption) error {
+		gotOpts = opts
+		gotDeadline, _ = ctx.Deadline()
+
+		return nil
+	}
+
+	interceptor := cm.swapUnaryInterceptor()
+
+	start := time.Now()
+	_ = interceptor(context.Background(), "/svc/M", nil, nil, conn, invoker)
+
+	if !hasWaitForReady(gotOpts) {
+		t.Error("wait for ready not set during the swap window")
+	}
+
+	if gotDeadline.IsZero() || gotDeadline.Sub(start) > time.Second+100*time.Millisecond {
+		t.Errorf("swap timeout not applied: %v", gotDeadline)
+	}
+
+	cm.swaps.Store(conn.Target(), time.Now().Add(-time.Second))
+
+	_ = interceptor(context.Background(), "/svc/M", nil, nil, conn, invoker)
+
+	if hasWaitForReady(gotOpts) || !gotDeadline.IsZero() {
+		t.Error("call options changed after the swap window")
+	}
+
+	if _, ok := cm.swaps.Load(conn.Target()); ok {
+		t.Error("expired swap window not dropped")
+	}
+}
+
+func TestSwapWaitForReady_KeepsShorterDeadline(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithSwapWaitForReady(time.Hour, time.Hour))
+
+	cc, err := grpc.NewClient("passthrough:///svc", cm.dialOpts...)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	defer cc.Close()
+
+	cm.markSwap(cc.Target())
+
+	want := time.Now().Add(time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), want)
+	defer cancel()
+
+	var got time.Time
+
+	invoker := func(ctx context.Context, _ string, _, _ any, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		got, _ = ctx.Deadline()
+
+		return nil
+	}
+
+	_ = cm.swapUnaryInterceptor()(ctx, "/svc/M", nil, nil, cc, invoker)
+
+	if !got.Equal(want) {
+		t.Errorf("caller deadline overridden: got %v, want %v", got, want)
+	}
+}
+
+func TestSwapWaitForReady_Validation(t *testing.T) {
+	cm := &ConnManager{}
+
+	if err := WithSwapWaitForReady(0, time.Second)(cm); err == nil {
+		t.Error("zero window accepted")
+	}
+
+	if err := WithSwapWaitForReady(time.Second, 0)(cm); err == nil {
+		t.Error("zero timeout accepted")
+	}
+}
@@ -0,0 +1,63 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// WithMinSwitchInterval keeps service on its current instance for at least d
+// after connecting to it, as long as the instance stays healthy and
+// eligible, so two instances whose health blinks alternately do not make
+// the connection oscillate between them. Losing the current instance still
+// switches at once
+func WithMinSwitchInterval(service string, d time.Duration) Option {
+	return func(cm *ConnManager) error {
+		if err := cm.checkWatched(service); err != nil {
+			return err
+		}
+
+		if d <= 0 {
+			return errors.New("invalid_min_switch_interval")
+		}
+
+		cm.minSwitch[service] = d
+
+		return nil
+	}
+}
+
+// holdSwitch reports whether service must stay on its current instance,
+// connected less than its minimum switch interval ago and still eligible
+func (cm *ConnManager) holdSwitch(service string, instances []Instance) bool {
+	d, ok := cm.minSwitch[service]
+	if !ok {
+		return false
+	}
+
+	cm.mu.RLock()
+	mc, ok := cm.conns[service]
+	cm.mu.RUnlock()
+
+	if !ok || mc.instanceID == "" {
+		return false
+	}
+
+	age := time.Since(mc.since)
+	if age >= d {
+		return false
+	}
+
+	if _, ok := findInstance(cm.eligible(service, instances), mc.ref()); !ok {
+		return false
+	}
+
+	cm.logger.Debug("holding connection within min switch interval",
+		zap.String("service", service),
+		zap.String("instance", mc.instanceID),
+		zap.Duration("connected", age),
+	)
+
+	return true
+}
@@ -0,0 +1,60 @@
+package consul_service_discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// taggedEntries returns entries of service on the given ports, the first
+// one tagged preferred
+func taggedEntries(service string, ports ...int) []*api.ServiceEntry {
+	entries := testEntries(service, ports...)
+	entries[0].Service.Tags = []string{"preferred"}
+
+	return entries
+}
+
+func TestMinSwitchInterval(t *testing.T) {
+	const interval = 100 * time.Millisecond
+
+	cm := newTestManager(t, []string{"svc"},
+		WithTagPreference("svc", []string{"preferred"}),
+		WithMinSwitchInterval("svc", interval))
+
+	refresh := func(entries []*api.ServiceEntry, want string) {
+		t.Helper()
+
+		if err := cm.refresh(t.Context(), "svc", entries); err != nil {
+			t.Fatalf("refresh: %v", err)
+		}
+
+		if got := connTarget(cm, "svc"); got != want {
+			t.Fatalf("target = %q, want %q", got, want)
+		}
+	}
+
+	refresh(testEntries("svc", 9002), "127.0.0.1:9002")
+
+	// a preferred instance appears: held on the healthy current one
+	refresh(taggedEntries("svc", 9001, 9002), "127.0.0.1:9002")
+
+	time.Sleep(interval)
+	refresh(taggedEntries("svc", 9001, 9002), "127.0.0.1:9001")
+
+	// the current instance fails: switch at once
+	refresh(testEntries("svc", 9002), "127.0.0.1:9002")
+}
+
+func TestWithMinSwitchInterval_Validation(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := WithMinSwitchInterval("svc", 0)(cm); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+
+	if err := WithMinSwitchInterval("other", time.Second)(cm); err == nil {
+		t.Error("expected an error for an unwatched service")
+	}
+}
@@ -0,0 +1,179 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// pinWarnInterval is how often a manual pin is logged while active
+const pinWarnInterval = time.Minute
+
+// manualPin is an operator override of discovery for one service
+type manualPin struct {
+	target string
+	until  time.Time
+	stop   chan struct{}
+}
+
+// PinTarget points service at target (e.g. "10.0.0.5:9000"), ignoring
+// discovery until ttl expires or Unpin is called. The target is dialed as
+// given, without the configured target scheme or builder. A warning is logged
+// every minute while the pin is active
+func (cm *ConnManager) PinTarget(service, target string, ttl time.Duration) error {
+	if err := cm.checkWatched(service); err != nil {
+		return err
+	}
+
+	if target == "" {
+		return errors.New("empty_target")
+	}
+
+	if ttl <= 0 {
+		return errors.New("ttl_must_be_positive")
+	}
+
+	if cm.dryRun {
+		cm.mu.Lock()
+		cm.selected[service] = target
+		cm.notifyLocked()
+		cm.mu.Unlock()
+	} else {
+		var (
+			conn *grpc.ClientConn
+			err  error
+		)
+
+		release := cm.acquireDial(service)
+
+		dialLabeled(service, target, func() {
+			if conn, err = grpc.NewClient(target, cm.dialOptionsFor(service)...); err != nil {
+				return
+			}
+
+			if err = cm.connectEager(conn); err != nil {
+				_ = conn.Close()
+			}
+		})
+		release()
+
+		if err != nil {
+			cm.metrics.IncrCounter(MetricDialErrors, 1, serviceLabel(service))
+
+			return fmt.Errorf("dial %s: %w", target, err)
+		}
+
+		if err := cm.replaceConn(service, &managedConn{target: target, conn: conn}); err != nil {
+			return err
+		}
+	}
+
+	pin := &manualPin{target: target, until: time.Now().Add(ttl), stop: make(chan struct{})}
+
+	cm.mu.Lock()
+	if old, ok := cm.manualPins[service]; ok {
+		close(old.stop)
+	}
+	cm.manualPins[service] = pin
+	cm.mu.Unlock()
+
+	cm.logger.Warn("target pinned manually, discovery overridden",
+		zap.String("service", service),
+		zap.String("target", target),
+		zap.Duration("ttl", ttl),
+	)
+	cm.emit(Event{Type: EventTargetPinned, Service: service, Target: target, DryRun: cm.dryRun})
+
+	go cm.watchPin(service, pin, ttl)
+
+	return nil
+}
+
+// Unpin removes a manual pin and resumes discovery for service right away.
+// Unpinning a service that is not pinned is a no-op
+func (cm *ConnManager) Unpin(service string) error {
+	if err := cm.checkWatched(service); err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	pin, ok := cm.manualPins[service]
+	if ok {
+		delete(cm.manualPins, service)
+		close(pin.stop)
+	}
+	cm.mu.Unlock()
+
+	if ok {
+		cm.releasePin(service, pin, "unpinned")
+	}
+
+	return nil
+}
+
+// PinnedTarget returns the manually pinned target of service, if any
+func (cm *ConnManager) PinnedTarget(service string) (string, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	return cm.manualTargetLocked(service)
+}
+
+// manualTargetLocked returns the active pin target; callers hold cm.mu
+func (cm *ConnManager) manualTargetLocked(service string) (string, bool) {
+	pin, ok := cm.manualPins[service]
+	if !ok || !time.Now().Before(pin.until) {
+		return "", false
+	}
+
+	return pin.target, true
+}
+
+// watchPin logs reminders while pin is active and expires it after ttl
+func (cm *ConnManager) watchPin(service string, pin *manualPin, ttl time.Duration) {
+	expire := time.NewTimer(ttl)
+	defer expire.Stop()
+
+	remind := time.NewTicker(pinWarnInterval)
+	defer remind.Stop()
+
+	for {
+		select {
+		case <-pin.stop:
+			return
+		case <-remind.C:
+			cm.logger.Warn("target still pinned manually",
+				zap.String("service", service),
+				zap.String("target", pin.target),
+				zap.Duration("remaining", time.Until(pin.until)),
+			)
+		case <-expire.C:
+			cm.mu.Lock()
+			current := cm.manualPins[service] == pin
+			if current {
+				delete(cm.manualPins, service)
+			}
+			cm.mu.Unlock()
+
+			if current {
+				cm.releasePin(service, pin, "expired")
+			}
+
+			return
+		}
+	}
+}
+
+// releasePin hands service back to discovery after a pin ends
+func (cm *ConnManager) releasePin(service string, pin *manualPin, reason string) {
+	cm.logger.Warn("manual target pin released",
+		zap.String("service", service),
+		zap.String("target", pin.target),
+		zap.String("reason", reason),
+	)
+	cm.emit(Event{Type: EventTargetUnpinned, Service: service, Target: pin.target})
+	cm.kick(service)
+}
@@ -0,0 +1,106 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPinTarget_OverridesDiscoveryUntilUnpin(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	rec := &eventRecorder{}
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"},
+		WithWaitTime(50*time.Millisecond),
+		WithEventHandler(rec.handle),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer cm.CloseAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if err := cm.PinTarget("svc", "10.0.0.5:9000", time.Hour); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+
+	if target, ok := cm.PinnedTarget("svc"); !ok || target != "10.0.0.5:9000" {
+		t.Errorf("PinnedTarget = %q, %v", target, ok)
+	}
+
+	fake.setInstances("svc", 9002)
+	time.Sleep(150 * time.Millisecond)
+
+	if got := connTarget(cm, "svc"); got != "10.0.0.5:9000" {
+		t.Fatalf("pinned service switched to %q", got)
+	}
+
+	if err := cm.Unpin("svc"); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9002")
+
+	var pinned, unpinned bool
+	for _, typ := range rec.types() {
+		pinned = pinned || typ == EventTargetPinned
+		unpinned = unpinned || typ == EventTargetUnpinned
+	}
+
+	if !pinned || !unpinned {
+		t.Errorf("events = %v, want pinned and unpinned", rec.types())
+	}
+}
+
+func TestPinTarget_Expires(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithWaitTime(time.Minute))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer cm.CloseAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if err := cm.PinTarget("svc", "10.0.0.5:9000", 50*time.Millisecond); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	if _, ok := cm.PinnedTarget("svc"); ok {
+		t.Error("pin should have expired")
+	}
+}
+
+func TestPinTarget_Validation(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := cm.PinTarget("other", "10.0.0.5:9000", time.Minute); !errors.Is(err, errUnknownService) {
+		t.Errorf("unknown service err = %v", err)
+	}
+
+	if err := cm.PinTarget("svc", "", time.Minute); err == nil {
+		t.Error("expected error for empty target")
+	}
+
+	if err := cm.PinTarget("svc", "10.0.0.5:9000", 0); err == nil {
+		t.Error("expected error for non-positive ttl")
+	}
+}
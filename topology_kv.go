@@ -0,0 +1,223 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+const (
+	publishQueueSize = 64
+	kvWriteTimeout   = 5 * time.Second
+)
+
+// PublishedTarget is the value written under a topology KV prefix for each
+// service by WithTopologyPublisher
+type PublishedTarget struct {
+	Service    string    `json:"service"`
+	Target     string    `json:"target"`
+	InstanceID string    `json:"instance_id"`
+	Node       string    `json:"node,omitempty"`
+	Publisher  string    `json:"publisher"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WithTopologyPublisher writes every target selection to the Consul KV store
+// under prefix/<service> (and deletes the key when a service loses its
+// connection), so other processes can mirror this process's choices
+func WithTopologyPublisher(prefix string) Option {
+	return func(cm *ConnManager) error {
+		prefix, err := normalizeKVPrefix(prefix)
+		if err != nil {
+			return err
+		}
+
+		cm.publishPrefix = prefix
+		cm.publishQueue = make(chan Event, publishQueueSize)
+		cm.eventHandlers = append(cm.eventHandlers, cm.enqueuePublish)
+		cm.background = append(cm.background, cm.runPublisher)
+
+		return nil
+	}
+}
+
+// WithTopologyMirror makes selection follow the instance choices published
+// under prefix by another manager (see WithTopologyPublisher), so a fleet
+// converges on identical targets while debugging. When the published instance
+// is not healthy here, normal selection applies
+func WithTopologyMirror(prefix string) Option {
+	return func(cm *ConnManager) error {
+		prefix, err := normalizeKVPrefix(prefix)
+		if err != nil {
+			return err
+		}
+
+		cm.mirrorPrefix = prefix
+		cm.background = append(cm.background, cm.runMirror)
+
+		return nil
+	}
+}
+
+func normalizeKVPrefix(prefix string) (string, error) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return "", errors.New("empty_kv_prefix")
+	}
+
+	return prefix + "/", nil
+}
+
+// enqueuePublish hands selection events to the publisher goroutine without
+// blocking the watcher
+func (cm *ConnManager) enqueuePublish(ev Event) {
+	if ev.Type != EventTargetSelected && ev.Type != EventConnRemoved {
+		return
+	}
+
+	select {
+	case cm.publishQueue <- ev:
+	default:
+		cm.logger.Warn("topology publish queue full, dropping update", zap.String("service", ev.Service))
+	}
+}
+
+// runPublisher writes queued selections to KV until ctx is done
+func (cm *ConnManager) runPublisher(ctx context.Context) {
+	host, _ := os.Hostname()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-cm.publishQueue:
+			if err := cm.publish(ctx, ev, host); err != nil {
+				cm.logger.Warn("publish topology", zap.String("service", ev.Service), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (cm *ConnManager) publish(ctx context.Context, ev Event, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, kvWriteTimeout)
+	defer cancel()
+
+	key := cm.publishPrefix + ev.Service
+	w := (&api.WriteOptions{}).WithContext(ctx)
+
+	if ev.Type == EventConnRemoved {
+		_, err := cm.client.KV().Delete(key, w)
+
+		return err
+	}
+
+	value, err := json.Marshal(PublishedTarget{
+		Service:    ev.Service,
+		Target:     ev.Target,
+		InstanceID: ev.InstanceID,
+		Node:       ev.Node,
+		Publisher:  host,
+		UpdatedAt:  ev.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = cm.client.KV().Put(&api.KVPair{Key: key, Value: value}, w)
+
+	return err
+}
+
+// runMirror follows the published topology with blocking KV queries and
+// re-runs selection for services whose published instance changed
+func (cm *ConnManager) runMirror(ctx context.Context) {
+	var waitIdx uint64
+
+	for ctx.Err() == nil {
+		q := (&api.QueryOptions{WaitIndex: waitIdx, WaitTime: cm.waitTime}).WithContext(ctx)
+
+		pairs, meta, err := cm.client.KV().List(cm.mirrorPrefix, q)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			cm.logger.Warn("mirror topology query", zap.Error(err))
+			sleepCtx(ctx, backoff(cm.retryInterval))
+
+			continue
+		}
+
+		if meta.LastIndex == waitIdx {
+			continue
+		}
+
+		waitIdx = nextWaitIndex(waitIdx, meta.LastIndex)
+
+		for _, svc := range cm.updateMirrored(pairs) {
+			cm.kick(svc)
+		}
+	}
+}
+
+// updateMirrored stores the published instance per service and returns the
+// services whose choice changed
+func (cm *ConnManager) updateMirrored(pairs api.KVPairs) []string {
+	next := make(map[string]instanceRef, len(pairs))
+
+	for _, p := range pairs {
+		var pt PublishedTarget
+		if err := json.Unmarshal(p.Value, &pt); err != nil {
+			cm.logger.Warn("invalid mirrored topology entry", zap.String("key", p.Key), zap.Error(err))
+
+			continue
+		}
+
+		next[strings.TrimPrefix(p.Key, cm.mirrorPrefix)] = instanceRef{pt.Node, pt.InstanceID}
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	var changed []string
+
+	for _, svc := range cm.watchList {
+		if cm.mirrored[svc] != next[svc] {
+			changed = append(changed, svc)
+		}
+	}
+
+	cm.mirrored = next
+
+	return changed
+}
+
+// mirroredInstance returns the instance published for service, if mirroring
+// is enabled and it is among instances
+func (cm *ConnManager) mirroredInstance(service string, instances []Instance) (Instance, bool) {
+	if cm.mirrorPrefix == "" {
+		return Instance{}, false
+	}
+
+	cm.mu.RLock()
+	ref, ok := cm.mirrored[service]
+	cm.mu.RUnlock()
+
+	if !ok {
+		return Instance{}, false
+	}
+
+	inst, found := findInstance(instances, ref)
+	if !found {
+		cm.logger.Warn("mirrored instance not healthy, selecting locally",
+			zap.String("service", service), zap.String("node", ref.node), zap.String("instance", ref.id))
+	}
+
+	return inst, found
+}
@@ -0,0 +1,95 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTopologyPublisher_WritesSelection(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"users"},
+		WithWaitTime(20*time.Millisecond),
+		WithTopologyPublisher("debug/topology/"),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.Start(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if raw, ok := fake.getKV("debug/topology/users"); ok {
+			var pt PublishedTarget
+			if err := json.Unmarshal(raw, &pt); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			if pt.InstanceID != "users-9001" || pt.Target != "127.0.0.1:9001" {
+				t.Errorf("published %+v", pt)
+			}
+
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("selection was not published")
+}
+
+func TestTopologyMirror_FollowsPublishedInstance(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("users", 9001, 9002, 9003, 9004, 9005)
+
+	publish := func(node, id string) {
+		raw, _ := json.Marshal(PublishedTarget{Service: "users", InstanceID: id, Node: node})
+		fake.putKV("debug/topology/users", raw)
+	}
+
+	publish("node-9004", "users-9004")
+
+	cm, err := New(newTestClient(t, fake), []string{"users"},
+		WithWaitTime(time.Second),
+		WithTopologyMirror("debug/topology"),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cm.Start(ctx)
+
+	waitForInstance := func(want string) {
+		t.Helper()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			cm.mu.RLock()
+			mc := cm.conns["users"]
+			cm.mu.RUnlock()
+
+			if mc != nil && mc.instanceID == want {
+				return
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("manager did not converge on %s", want)
+	}
+
+	waitForInstance("users-9004")
+
+	publish("node-9002", "users-9002")
+	waitForInstance("users-9002")
+}
@@ -0,0 +1,115 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// virtualTaggedAddress is the tagged address holding a service's virtual IP
+const virtualTaggedAddress = "consul-virtual"
+
+// tproxyRecheck is how often TransparentProxyAuto re-reads the agent
+const tproxyRecheck = time.Minute
+
+// TransparentProxyMode controls dialing through a Consul service mesh
+// transparent proxy, which intercepts traffic to virtual service addresses
+type TransparentProxyMode int
+
+const (
+	// TransparentProxyOff dials instance addresses (default)
+	TransparentProxyOff TransparentProxyMode = iota
+	// TransparentProxyAuto dials virtual addresses while a sidecar proxy in
+	// transparent mode is registered with the local agent
+	TransparentProxyAuto
+	// TransparentProxyOn always dials virtual addresses when known
+	TransparentProxyOn
+)
+
+// WithTransparentProxy makes connections target the virtual address of a
+// service (its consul-virtual tagged address) instead of instance addresses
+// when the workload runs behind a transparent proxy, so traffic goes through
+// the mesh rather than around it. Instances without a virtual address are
+// dialed directly
+func WithTransparentProxy(mode TransparentProxyMode) Option {
+	return func(cm *ConnManager) error {
+		switch mode {
+		case TransparentProxyOff:
+		case TransparentProxyOn:
+			cm.tproxy.Store(true)
+		case TransparentProxyAuto:
+			cm.tproxyAuto = true
+			cm.background = append(cm.background, cm.runTProxyDetector)
+		default:
+			return errors.New("invalid_transparent_proxy_mode")
+		}
+
+		return nil
+	}
+}
+
+// runTProxyDetector follows whether a transparent sidecar is registered
+// locally and re-runs selection for every service when that changes
+func (cm *ConnManager) runTProxyDetector(ctx context.Context) {
+	for {
+		enabled, err := cm.detectTProxy(ctx)
+
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+
+			cm.logger.Warn("detect transparent proxy", zap.Error(err))
+		case cm.tproxy.Swap(enabled) != enabled:
+			cm.logger.Info("transparent proxy mode changed", zap.Bool("enabled", enabled))
+
+			for _, svc := range cm.watchList {
+				cm.kick(svc)
+			}
+		}
+
+		if !sleepCtx(ctx, tproxyRecheck) {
+			return
+		}
+	}
+}
+
+// detectTProxy reports whether the local agent has a sidecar proxy in
+// transparent mode
+func (cm *ConnManager) detectTProxy(ctx context.Context) (bool, error) {
+	q := (&api.QueryOptions{}).WithContext(ctx)
+
+	proxies, err := cm.client.Agent().ServicesWithFilterOpts(`Kind == "connect-proxy"`, q)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range proxies {
+		if p.Proxy != nil && p.Proxy.Mode == api.ProxyModeTransparent {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// virtualAddress returns the host:port of the virtual address of e, if any
+func virtualAddress(e *api.ServiceEntry) string {
+	addr, ok := e.Service.TaggedAddresses[virtualTaggedAddress]
+	if !ok || addr.Address == "" {
+		return ""
+	}
+
+	port := addr.Port
+	if port == 0 {
+		port = e.Service.Port
+	}
+
+	return net.JoinHostPort(addr.Address, strconv.Itoa(port))
+}
@@ -0,0 +1,88 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// virtualEntries returns entries of service whose instances share a virtual
+// address
+func virtualEntries(service, vip string, ports ...int) []*api.ServiceEntry {
+	entries := testEntries(service, ports...)
+	for _, e := range entries {
+		e.Service.TaggedAddresses = map[string]api.ServiceAddress{
+			virtualTaggedAddress: {Address: vip, Port: 80},
+		}
+	}
+
+	return entries
+}
+
+func TestTransparentProxy_DialsVirtualAddress(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithTransparentProxy(TransparentProxyOn))
+
+	if err := cm.refresh(t.Context(), "svc", virtualEntries("svc", "240.0.0.3", 9001, 9002)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if target := connTarget(cm, "svc"); target != "240.0.0.3:80" {
+		t.Errorf("target = %s, want the virtual address", target)
+	}
+
+	off := newTestManager(t, []string{"svc"})
+	if err := off.refresh(t.Context(), "svc", virtualEntries("svc", "240.0.0.3", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if target := connTarget(off, "svc"); target != "127.0.0.1:9001" {
+		t.Errorf("target = %s, want the instance address by default", target)
+	}
+}
+
+func TestTransparentProxy_AutoDetect(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/agent/services" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]*api.AgentService{
+			"web-sidecar-proxy": {
+				ID:    "web-sidecar-proxy",
+				Kind:  api.ServiceKindConnectProxy,
+				Proxy: &api.AgentServiceConnectProxyConfig{Mode: api.ProxyModeTransparent},
+			},
+		})
+	}))
+
+	cm, err := New(client, []string{"svc"}, WithTransparentProxy(TransparentProxyAuto))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.runTProxyDetector(ctx)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cm.tproxy.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("transparent proxy not detected")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithTransparentProxy_Invalid(t *testing.T) {
+	if err := WithTransparentProxy(TransparentProxyMode(7))(&ConnManager{}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
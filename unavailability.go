@@ -0,0 +1,63 @@
+package consul_service_discovery
+
+import (
+	"time"
+)
+
+// Cause classifies why a service has no connection. Values are stable and
+// suitable as metric labels
+type Cause string
+
+const (
+	// CauseNeverDiscovered: no Consul response has been acted upon yet
+	CauseNeverDiscovered Cause = "never_discovered"
+	// CauseNoHealthyInstances: Consul reports no eligible healthy instance
+	CauseNoHealthyInstances Cause = "no_healthy_instances"
+	// CauseDialFailing: the selected instance could not be resolved or dialed
+	CauseDialFailing Cause = "dial_failing"
+	// CauseQueryFailing: queries to Consul fail
+	CauseQueryFailing Cause = "query_failing"
+	// CauseCircuitOpen: queries to Consul are on hold after it rate limited
+	// the client
+	CauseCircuitOpen Cause = "circuit_open"
+	// CausePaused: discovery is paused (see Pause) and no connection was kept
+	CausePaused Cause = "paused"
+)
+
+// Reason describes why a service is unavailable
+type Reason struct {
+	Cause Cause
+	Since time.Time // when the cause began
+	Err   error     // underlying failure, nil for causes without one
+}
+
+// Unavailability returns why service has no connection, or nil when it is
+// connected or not watched
+func (cm *ConnManager) Unavailability(service string) *Reason {
+	ws, ok := cm.watchStates[service]
+	if !ok {
+		return nil
+	}
+
+	if _, ok := cm.loadTopology().conns[service]; ok {
+		return nil
+	}
+
+	ws.mu.Lock()
+	paused, pausedAt, f := ws.paused != nil, ws.pausedAt, ws.failure
+	ws.mu.Unlock()
+
+	if paused {
+		return &Reason{Cause: CausePaused, Since: pausedAt}
+	}
+
+	if hold := cm.queryHold.Load(); hold > time.Now().UnixNano() && f != nil {
+		return &Reason{Cause: CauseCircuitOpen, Since: f.since, Err: f.err}
+	}
+
+	if f == nil {
+		return &Reason{Cause: CauseNeverDiscovered, Since: cm.created}
+	}
+
+	return &Reason{Cause: f.cause, Since: f.since, Err: f.err}
+}
@@ -0,0 +1,82 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUnavailability(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if r := cm.Unavailability("other"); r != nil {
+		t.Errorf("unwatched service reason = %+v, want nil", r)
+	}
+
+	if r := cm.Unavailability("svc"); r == nil || r.Cause != CauseNeverDiscovered || r.Since.IsZero() {
+		t.Errorf("reason before discovery = %+v", r)
+	}
+
+	if err := cm.refresh(t.Context(), "svc", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	r := cm.Unavailability("svc")
+	if r == nil || r.Cause != CauseNoHealthyInstances || !errors.Is(r.Err, errNoHealthyInstances) {
+		t.Errorf("reason without instances = %+v", r)
+	}
+
+	cm.noteFailure("svc", CauseDialFailing, errors.New("connection refused"))
+
+	if r := cm.Unavailability("svc"); r == nil || r.Cause != CauseDialFailing {
+		t.Errorf("reason after a dial failure = %+v", r)
+	}
+
+	cm.queryHold.Store(time.Now().Add(time.Hour).UnixNano())
+
+	if r := cm.Unavailability("svc"); r == nil || r.Cause != CauseCircuitOpen {
+		t.Errorf("reason during a rate-limit hold = %+v", r)
+	}
+
+	cm.queryHold.Store(0)
+
+	if err := cm.Pause("svc"); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+
+	if r := cm.Unavailability("svc"); r == nil || r.Cause != CausePaused {
+		t.Errorf("reason while paused = %+v", r)
+	}
+
+	if err := cm.Resume("svc"); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	if err := cm.refresh(t.Context(), "svc", testEntries("svc", 9001)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if r := cm.Unavailability("svc"); r != nil {
+		t.Errorf("connected service reason = %+v, want nil", r)
+	}
+}
+
+func TestUnavailability_SinceResetsOnNewCause(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	cm.noteFailure("svc", CauseQueryFailing, errors.New("agent down"))
+	first := cm.Unavailability("svc").Since
+
+	time.Sleep(10 * time.Millisecond)
+	cm.noteFailure("svc", CauseQueryFailing, errors.New("agent still down"))
+
+	if got := cm.Unavailability("svc").Since; !got.Equal(first) {
+		t.Errorf("since moved within one cause: %v -> %v", first, got)
+	}
+
+	cm.noteFailure("svc", CauseNoHealthyInstances, errNoHealthyInstances)
+
+	if got := cm.Unavailability("svc").Since; !got.After(first) {
+		t.Errorf("since kept across causes: %v", got)
+	}
+}
@@ -0,0 +1,55 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ErrOptionConflict is matched (via errors.Is) by the errors New returns for
+// options that contradict each other
+var ErrOptionConflict = errors.New("option_conflict")
+
+// validateOptions checks the applied options against each other, so that
+// contradicting ones fail New instead of silently losing to each other at
+// runtime. All conflicts are reported at once
+func (cm *ConnManager) validateOptions() error {
+	var errs []error
+
+	conflict := func(msg string) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrOptionConflict, msg))
+	}
+
+	if cm.targetBuilder != nil && cm.targetScheme != "" {
+		conflict("WithTargetScheme has no effect with WithTargetBuilder; add the scheme in the builder")
+	}
+
+	if len(cm.proxyOptions) > 1 {
+		conflict(fmt.Sprintf("only one of %v may tunnel connections", cm.proxyOptions))
+	}
+
+	if cm.eagerTimeout > 0 && !cm.eagerConnect {
+		conflict("WithEagerConnectTimeout requires WithEagerConnect(true)")
+	}
+
+	if cm.dryRun && cm.eagerConnect {
+		conflict("WithEagerConnect has no effect with WithDryRun, which never dials")
+	}
+
+	if cm.dryRun && cm.callQueue != nil {
+		conflict("WithReconnectQueue has no effect with WithDryRun, where Invoke always fails")
+	}
+
+	if cm.stuckAfter > 0 && cm.stuckAfter <= cm.effectiveQueryTimeout() {
+		conflict(fmt.Sprintf("WithStuckWatcherDetection threshold %s must exceed the query timeout %s", cm.stuckAfter, cm.effectiveQueryTimeout()))
+	}
+
+	if cm.maxInstances > 0 {
+		for _, svc := range slices.Sorted(maps.Keys(cm.pinnedInstances)) {
+			conflict(fmt.Sprintf("WithCacheLimits may drop the instance %s is pinned to with WithInstanceID", svc))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,53 @@
+package consul_service_discovery
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNew_OptionConflicts(t *testing.T) {
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		t.Fatalf("consul client: %v", err)
+	}
+
+	builder := func(inst Instance) string { return inst.Address }
+
+	cases := map[string][]Option{
+		"WithTargetScheme":        {WithTargetBuilder(builder), WithTargetScheme("dns")},
+		"only one of":             {WithProxy("socks5://127.0.0.1:1080"), WithSSHTunnelConfig("bastion", &ssh.ClientConfig{})},
+		"WithEagerConnectTimeout": {WithEagerConnectTimeout(time.Second)},
+		"WithEagerConnect has":    {WithDryRun(true), WithEagerConnect(true)},
+		"WithReconnectQueue":      {WithDryRun(true), WithReconnectQueue(1, time.Second)},
+		"WithCacheLimits":         {WithInstanceID("svc", "svc-1"), WithCacheLimits(CacheLimits{MaxInstancesPerService: 2})},
+	}
+
+	for want, opts := range cases {
+		_, err := New(client, []string{"svc"}, opts...)
+		if !errors.Is(err, ErrOptionConflict) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want option conflict", want, err)
+		}
+	}
+}
+
+func TestNew_ReportsAllConflicts(t *testing.T) {
+	client, _ := api.NewClient(api.DefaultConfig())
+
+	_, err := New(client, []string{"svc"}, WithDryRun(true), WithEagerConnect(true), WithReconnectQueue(1, time.Second))
+	if n := strings.Count(err.Error(), ErrOptionConflict.Error()); n != 2 {
+		t.Errorf("err = %v, want both conflicts", err)
+	}
+}
+
+func TestNew_EagerTimeoutDefault(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"}, WithEagerConnect(true))
+
+	if cm.eagerTimeout != defaultEagerConnectTimeout {
+		t.Errorf("eager timeout = %s, want default", cm.eagerTimeout)
+	}
+}
@@ -0,0 +1,103 @@
+package consul_service_discovery
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ChangeKind classifies a Change between two views
+type ChangeKind string
+
+const (
+	ChangeInstanceAdded   ChangeKind = "instance_added"
+	ChangeInstanceRemoved ChangeKind = "instance_removed"
+	ChangeInstanceUpdated ChangeKind = "instance_updated"
+	// ChangeTargetSwitched reports a different dial target, including a
+	// service getting or losing its connection (From or To empty)
+	ChangeTargetSwitched ChangeKind = "target_switched"
+)
+
+// Change is one entry of the changelog produced by View.Diff
+type Change struct {
+	Kind       ChangeKind
+	Service    string
+	InstanceID string // the instance changed, or the one switched to
+	From, To   string // previous and new target, set for ChangeTargetSwitched
+}
+
+func (c Change) String() string {
+	if c.Kind == ChangeTargetSwitched {
+		return fmt.Sprintf("%s %s: %q -> %q", c.Kind, c.Service, c.From, c.To)
+	}
+
+	return fmt.Sprintf("%s %s: %s", c.Kind, c.Service, c.InstanceID)
+}
+
+// Diff returns the changes from v to other: per service in watch order, the
+// instances removed, added and updated, then any target switch. Views of
+// different managers may be compared, e.g. before and after a deploy or a
+// Consul upgrade; an empty result means they agree
+func (v View) Diff(other View) []Change {
+	from, to := v.topology(), other.topology()
+
+	var changes []Change
+
+	for _, svc := range unionOrdered(from.services, to.services) {
+		d := DiffInstances(from.instances[svc], to.instances[svc])
+
+		for _, set := range []struct {
+			kind      ChangeKind
+			instances []Instance
+		}{
+			{ChangeInstanceRemoved, d.Removed},
+			{ChangeInstanceAdded, d.Added},
+			{ChangeInstanceUpdated, d.Changed},
+		} {
+			for _, inst := range set.instances {
+				changes = append(changes, Change{Kind: set.kind, Service: svc, InstanceID: inst.ID})
+			}
+		}
+
+		before, after := from.conns[svc], to.conns[svc]
+		if targetOf(before) != targetOf(after) {
+			c := Change{Kind: ChangeTargetSwitched, Service: svc, From: targetOf(before), To: targetOf(after)}
+			if after != nil {
+				c.InstanceID = after.instanceID
+			}
+
+			changes = append(changes, c)
+		}
+	}
+
+	return changes
+}
+
+// topology returns the snapshot of v, empty for the zero View
+func (v View) topology() *topology {
+	if v.topo == nil {
+		return &topology{}
+	}
+
+	return v.topo
+}
+
+func targetOf(mc *managedConn) string {
+	if mc == nil {
+		return ""
+	}
+
+	return mc.target
+}
+
+// unionOrdered returns a followed by the elements of b not in a
+func unionOrdered(a, b []string) []string {
+	out := slices.Clone(a)
+
+	for _, s := range b {
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,49 @@
+package consul_service_discovery
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestView_Diff(t *testing.T) {
+	cm, _ := newBenchManager(t, 3)
+
+	before := cm.View()
+
+	if err := cm.refresh(t.Context(), "svc-0", testEntries("svc-0", 9100)); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if err := cm.refresh(t.Context(), "svc-1", nil); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	entries := testEntries("svc-2", 9002)
+	entries[0].Service.Tags = []string{"canary"}
+
+	if err := cm.refresh(t.Context(), "svc-2", entries); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	want := []Change{
+		{Kind: ChangeInstanceRemoved, Service: "svc-0", InstanceID: "svc-0-9000"},
+		{Kind: ChangeInstanceAdded, Service: "svc-0", InstanceID: "svc-0-9100"},
+		{Kind: ChangeTargetSwitched, Service: "svc-0", InstanceID: "svc-0-9100", From: "127.0.0.1:9000", To: "127.0.0.1:9100"},
+		{Kind: ChangeInstanceRemoved, Service: "svc-1", InstanceID: "svc-1-9001"},
+		{Kind: ChangeTargetSwitched, Service: "svc-1", From: "127.0.0.1:9001"},
+		{Kind: ChangeInstanceUpdated, Service: "svc-2", InstanceID: "svc-2-9002"},
+	}
+
+	if got := before.Diff(cm.View()); !slices.Equal(got, want) {
+		t.Errorf("diff =\n%v\nwant\n%v", got, want)
+	}
+
+	if got := cm.View().Diff(cm.View()); len(got) != 0 {
+		t.Errorf("diff of equal views = %v", got)
+	}
+
+	// a zero View compares as empty
+	if got := (View{}).Diff(before); len(got) != 6 {
+		t.Errorf("diff from empty view = %v, want 3 additions and 3 targets", got)
+	}
+}
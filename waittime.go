@@ -0,0 +1,71 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxWaitTime is the longest blocking wait Consul agents serve with the
+	// default max_query_time; WithWaitTime accepts up to it
+	MaxWaitTime = 10 * time.Minute
+
+	defaultWaitTime = 30 * time.Second
+
+	agentSelfTimeout = 5 * time.Second
+)
+
+// blockingWait returns the wait time watchers ask for, lowered to the
+// agent's max_query_time when that is known to be shorter
+func (cm *ConnManager) blockingWait() time.Duration {
+	if capped := time.Duration(cm.agentMaxWait.Load()); capped > 0 && capped < cm.waitTime {
+		return capped
+	}
+
+	return cm.waitTime
+}
+
+// detectMaxWait reads the agent's max_query_time, which cuts longer blocking
+// waits short, so query timeouts follow the wait actually served. Reading
+// it needs agent:read; without it the configured wait is kept
+func (cm *ConnManager) detectMaxWait(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, agentSelfTimeout)
+	defer cancel()
+
+	var self map[string]map[string]any
+
+	if _, err := cm.client.Raw().Query("/v1/agent/self", &self, (&api.QueryOptions{}).WithContext(ctx)); err != nil {
+		cm.logger.Debug("read agent max query time", zap.Error(err))
+
+		return
+	}
+
+	maxWait, ok := agentDuration(self["DebugConfig"]["MaxQueryTime"])
+	if !ok || maxWait >= cm.waitTime {
+		return
+	}
+
+	cm.agentMaxWait.Store(int64(maxWait))
+	cm.logger.Info("consul agent caps blocking queries below the wait time",
+		zap.Duration("wait_time", cm.waitTime),
+		zap.Duration("max_query_time", maxWait),
+	)
+}
+
+// agentDuration decodes a duration of the agent's sanitized config: a
+// string such as "10m0s", or nanoseconds in older agents
+func agentDuration(v any) (time.Duration, bool) {
+	switch v := v.(type) {
+	case string:
+		d, err := time.ParseDuration(v)
+
+		return d, err == nil && d > 0
+	case float64:
+		return time.Duration(v), v > 0
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,70 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWithWaitTime_Max(t *testing.T) {
+	cm := newTestManager(t, []string{"svc"})
+
+	if err := WithWaitTime(MaxWaitTime)(cm); err != nil {
+		t.Errorf("MaxWaitTime rejected: %v", err)
+	}
+
+	if err := WithWaitTime(MaxWaitTime + time.Second)(cm); err == nil {
+		t.Error("expected an error above MaxWaitTime")
+	}
+}
+
+func TestDetectMaxWait(t *testing.T) {
+	cases := []struct {
+		name     string
+		self     string
+		wantWait time.Duration
+	}{
+		{"lower cap", `{"DebugConfig": {"MaxQueryTime": "2m0s"}}`, 2 * time.Minute},
+		{"nanoseconds", `{"DebugConfig": {"MaxQueryTime": 120000000000}}`, 2 * time.Minute},
+		{"higher cap", `{"DebugConfig": {"MaxQueryTime": "10m0s"}}`, 5 * time.Minute},
+		{"not readable", ``, 5 * time.Minute},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := newFakeConsul()
+
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/agent/self" {
+					fake.ServeHTTP(w, r)
+
+					return
+				}
+
+				if c.self == "" {
+					http.Error(w, "Permission denied", http.StatusForbidden)
+
+					return
+				}
+
+				_, _ = w.Write([]byte(c.self))
+			})
+
+			cm, err := New(newTestClient(t, h), []string{"svc"}, WithWaitTime(5*time.Minute))
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+
+			cm.detectMaxWait(context.Background())
+
+			if got := cm.blockingWait(); got != c.wantWait {
+				t.Errorf("wait = %s, want %s", got, c.wantWait)
+			}
+
+			if got, want := cm.effectiveQueryTimeout(), c.wantWait+c.wantWait/16+queryTimeoutGrace; got != want {
+				t.Errorf("query timeout = %s, want %s", got, want)
+			}
+		})
+	}
+}
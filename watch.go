@@ -0,0 +1,474 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"go.uber.org/zap"
+)
+
+// watchState lets other goroutines interrupt a watcher's in-flight blocking
+// query and force re-selection
+type watchState struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc // cancels the in-flight query, if any
+	kicked bool
+	paused chan struct{} // non-nil while paused; closed on resume
+	seeded uint64        // digest of a bulk read already applied, see WithBulkInitialRead
+
+	// Refresh requests and the rounds answering them
+	refreshReq  uint64
+	refreshDone uint64
+	refreshErr  error
+	refreshed   chan struct{} // closed and replaced when refreshDone advances
+
+	failure  *discoveryFailure // why the service has no connection, see GetConn
+	pausedAt time.Time
+
+	// liveness, see WithStuckWatcherDetection
+	beat        time.Time // last loop iteration or query response
+	lastSuccess time.Time
+	stop        context.CancelFunc // stops the watcher goroutine
+}
+
+// seed records the digest of entries applied before the watcher started
+func (ws *watchState) seed(digest uint64) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.seeded = digest
+}
+
+// takeSeed returns and clears the seeded digest, 0 when none
+func (ws *watchState) takeSeed() uint64 {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	seeded := ws.seeded
+	ws.seeded = 0
+
+	return seeded
+}
+
+// pausedCh returns the channel closed on resume, or nil when not paused
+func (ws *watchState) pausedCh() chan struct{} {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.paused
+}
+
+// begin registers the cancel func of a query about to be issued and returns
+// the Refresh generation its response answers
+func (ws *watchState) begin(cancel context.CancelFunc) uint64 {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.cancel = cancel
+
+	if ws.kicked {
+		cancel()
+	}
+
+	return ws.refreshReq
+}
+
+// end unregisters the in-flight query and reports (and clears) a pending kick
+func (ws *watchState) end() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.cancel = nil
+	kicked := ws.kicked
+	ws.kicked = false
+
+	return kicked
+}
+
+// kick interrupts the watcher of service so it re-queries Consul without
+// blocking and re-runs selection
+func (cm *ConnManager) kick(service string) {
+	ws, ok := cm.watchStates[service]
+	if !ok {
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.kicked = true
+
+	if ws.cancel != nil {
+		ws.cancel()
+	}
+}
+
+// watchService performs a Consul blocking query loop for a single service
+func (cm *ConnManager) watchService(ctx context.Context, service string) {
+	var (
+		waitIdx     uint64
+		digest      uint64 // of the last response, see entriesDigest
+		lastRefresh = time.Now()
+		lastCached  time.Time
+		retry       bool // last selection failed and must be re-run
+		force       bool // re-select on the next response (after a kick)
+		leader      bool // next query skips stale reads, see WithMaxStaleness
+		ws          = cm.watchStates[service]
+	)
+
+	if ws == nil {
+		ws = &watchState{}
+	}
+
+	seeded := ws.takeSeed()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if resumed := ws.pausedCh(); resumed != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-resumed:
+				waitIdx, force = 0, true // catch up on changes missed while paused
+			}
+		}
+
+		if !cm.waitQueryHold(ctx) {
+			return
+		}
+
+		ws.heartbeat(false)
+
+		q := &api.QueryOptions{
+			WaitTime:      cm.queryWaitTime(lastRefresh),
+			WaitIndex:     waitIdx,
+			AllowStale:    cm.maxStaleness > 0 && !leader,
+			SamenessGroup: cm.samenessGroups[service],
+			Token:         cm.serviceTokens[service],
+		}
+
+		if force || leader {
+			q.WaitIndex = 0 // answer immediately
+		}
+
+		qctx, qcancel := context.WithTimeout(ctx, cm.effectiveQueryTimeout())
+		gen := ws.begin(qcancel)
+		began := time.Now()
+		entries, meta, err := cm.client.Health().Service(cm.consulName(service), "", true, q.WithContext(qctx))
+
+		qcancel()
+		cm.metrics.ObserveDuration(MetricQueryLatency, time.Since(began), serviceLabel(service))
+
+		if ctx.Err() != nil {
+			return // stopped, maybe replaced by a restarted watcher sharing ws
+		}
+
+		ws.heartbeat(err == nil)
+
+		if ws.end() {
+			force = true
+
+			if err != nil {
+				continue // interrupted on purpose; re-query right away
+			}
+		}
+
+		if ws.pausedCh() != nil {
+			continue // paused while the query was in flight; do not act on it
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			cm.metrics.IncrCounter(MetricQueries, 1, serviceLabel(service), Label{"result", "error"})
+			cm.emit(Event{Type: EventQueryError, Service: service, Err: err})
+			cm.noteFailure(service, CauseQueryFailing, fmt.Errorf("consul query: %w", err))
+
+			if d, ok := cm.rateLimitDelay(err); ok {
+				cm.holdQueries(service, d, err)
+
+				continue
+			}
+
+			cm.logger.Warn("consul query error", zap.String("service", service), zap.Error(err))
+
+			// the agent may have restarted or restored a snapshot meanwhile, and
+			// its index may have come back around to waitIdx with other
+			// content; resync with a non-blocking read
+			waitIdx = 0
+			force = ws.finish(gen, err) || force
+
+			if !sleepCtx(ctx, backoff(cm.retryInterval)) {
+				return
+			}
+
+			continue
+		}
+
+		if leader = cm.tooStale(service, q, meta); leader {
+			continue
+		}
+
+		cm.metrics.IncrCounter(MetricQueries, 1, serviceLabel(service), Label{"result", "ok"})
+		cm.metrics.SetGauge(MetricInstances, float64(len(entries)), serviceLabel(service))
+
+		// meta.LastIndex updates only when the result set changes. A wait that
+		// times out returns the same index; skip re-selection unless a forced
+		// refresh is due or the previous attempt failed. The digest catches a
+		// reused index with other content, e.g. after a snapshot restore the
+		// watch did not see
+		prevDigest := digest
+		digest = entriesDigest(entries)
+		changed := waitIdx == 0 || meta.LastIndex != waitIdx || digest != prevDigest
+
+		if seeded != 0 {
+			// first response after a bulk read: act only on differences
+			changed, seeded = digest != seeded, 0
+		}
+		forced := cm.forcedRefresh > 0 && time.Since(lastRefresh) >= cm.forcedRefresh
+
+		if cm.sharedCache != nil && (changed || time.Since(lastCached) >= sharedCacheTTL/2) {
+			cm.storeShared(ctx, service, entries)
+			lastCached = time.Now()
+		}
+
+		waitIdx = nextWaitIndex(waitIdx, meta.LastIndex)
+		if !changed && !forced && !retry && !force {
+			continue
+		}
+
+		lastRefresh = time.Now()
+		force = false
+
+		err = cm.refresh(ctx, service, entries)
+
+		// a Refresh made after this query began needs another round
+		force = ws.finish(gen, err)
+
+		if err != nil {
+			cm.noteFailure(service, CauseDialFailing, err)
+			cm.logger.Warn("select instance", zap.String("service", service), zap.Error(err))
+			cm.emit(Event{Type: EventSelectError, Service: service, Err: err})
+
+			retry = true
+
+			if !sleepCtx(ctx, backoff(cm.retryInterval)) {
+				return
+			}
+
+			continue
+		}
+
+		retry = false
+	}
+}
+
+// refresh records the healthy set, selects an instance from it and swaps the
+// service connection to it. An empty eligible set drops the current connection
+func (cm *ConnManager) refresh(ctx context.Context, service string, entries []*api.ServiceEntry) error {
+	instances := instancesFromEntries(entries)
+	cm.applyLoad(entries, instances)
+	cm.applyNomad(service, entries, instances)
+	instances = cm.withSecondary(service, instances)
+	instances = cm.boundInstances(service, instances)
+
+	cm.mu.RLock()
+	prev := cm.instances[service]
+	cm.mu.RUnlock()
+
+	carryFirstSeen(prev, instances, time.Now())
+
+	var diff InstanceDiff
+	if cm.diffUpdates {
+		diff = DiffInstances(prev, instances)
+	}
+
+	cm.setInstances(service, instances)
+	cm.emit(Event{Type: EventInstancesChanged, Service: service, Instances: len(instances)})
+	cm.emitDiff(service, diff)
+	cm.reportDuplicates(service, instances)
+
+	cm.mu.RLock()
+	pinned, isPinned := cm.manualTargetLocked(service)
+	cm.mu.RUnlock()
+
+	if isPinned {
+		cm.logger.Warn("target pinned manually, ignoring discovery update",
+			zap.String("service", service),
+			zap.String("target", pinned),
+			zap.Int("instances", len(instances)),
+		)
+
+		return nil
+	}
+
+	if cm.holdForMaintenance(service, len(instances)) {
+		return nil
+	}
+
+	if cm.hasStandby(service) {
+		defer cm.maintainStandby(service, instances)
+	}
+
+	if cm.diffUpdates && cm.keepCurrent(service, instances, diff) {
+		return nil
+	}
+
+	if cm.holdSwitch(service, instances) {
+		return nil
+	}
+
+	if cm.hasStandby(service) {
+		if mc, ok := cm.promoteStandby(service, instances); ok {
+			return cm.replaceConn(service, mc)
+		}
+	}
+
+	selected, ok := cm.selectInstance(service, instances)
+	if !ok {
+		if cm.isOptional(service) || cm.inMaintenance(service) {
+			cm.logger.Info("no healthy instances of optional service", zap.String("service", service))
+		} else {
+			cm.logger.Warn("no healthy instances", zap.String("service", service))
+		}
+
+		cm.noteFailure(service, CauseNoHealthyInstances, errNoHealthyInstances)
+
+		if len(instances) == 0 {
+			if handled, err := cm.allCritical(ctx, service); handled {
+				return err
+			}
+		}
+
+		if cm.dryRun || cm.isHTTP(service) {
+			return cm.recordSelection(service, nil)
+		}
+
+		return cm.replaceConn(service, nil)
+	}
+
+	return cm.switchTo(service, selected)
+}
+
+// switchTo makes selected the target of service, dialing it unless a
+// standby connection to it is ready
+func (cm *ConnManager) switchTo(service string, selected Instance) error {
+	if cm.dryRun || cm.isHTTP(service) {
+		return cm.recordSelection(service, &selected)
+	}
+
+	if mc, ok := cm.takeStandby(service, selected.ref()); ok {
+		return cm.replaceConn(service, mc)
+	}
+
+	mc, err := cm.dialInstance(service, selected)
+	if err != nil {
+		if cm.scorer != nil {
+			cm.signals.failed(instanceKey{service: service, instanceRef: selected.ref()})
+		}
+
+		return err
+	}
+
+	return cm.replaceConn(service, mc)
+}
+
+// queryWaitTime returns the blocking wait for the next query, shortened so a
+// pending forced refresh is not delayed by a full wait
+func (cm *ConnManager) queryWaitTime(lastRefresh time.Time) time.Duration {
+	if cm.forcedRefresh <= 0 {
+		return cm.blockingWait()
+	}
+
+	remaining := cm.forcedRefresh - time.Since(lastRefresh)
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+
+	return min(remaining, cm.blockingWait())
+}
+
+// effectiveQueryTimeout returns the hard deadline applied to one blocking query
+func (cm *ConnManager) effectiveQueryTimeout() time.Duration {
+	if cm.queryTimeout > 0 {
+		return cm.queryTimeout
+	}
+
+	wait := cm.blockingWait()
+
+	return wait + wait/16 + queryTimeoutGrace
+}
+
+// nextWaitIndex returns the index for the next blocking query. Per Consul's
+// guidance, an index that goes backwards (e.g. after a snapshot restore) or is
+// zero resets the watch to avoid blocking on a stale value
+func nextWaitIndex(prev, last uint64) uint64 {
+	if last < prev || last == 0 {
+		return 0
+	}
+
+	return last
+}
+
+// backoff returns jittered sleep duration on failures; bases too short to
+// jitter (below 2ns) are returned as is
+func backoff(base time.Duration) time.Duration {
+	delta := base / 2
+	if delta <= 0 {
+		return base
+	}
+
+	return base + time.Duration(rand.Int63n(int64(delta)))
+}
+
+// entriesDigest hashes what selection reads from entries
+func entriesDigest(entries []*api.ServiceEntry) uint64 {
+	h := fnv.New64a()
+
+	for _, e := range entries {
+		_, _ = h.Write([]byte(e.Service.ID))
+		_, _ = h.Write([]byte(e.Service.Address))
+		_, _ = h.Write([]byte(strconv.Itoa(e.Service.Port)))
+		_, _ = h.Write([]byte(strconv.FormatUint(e.Service.ModifyIndex, 10)))
+
+		for _, tag := range e.Service.Tags {
+			_, _ = h.Write([]byte(tag))
+		}
+
+		if e.Node != nil {
+			_, _ = h.Write([]byte(e.Node.Node))
+			_, _ = h.Write([]byte(e.Node.Address))
+		}
+
+		_, _ = h.Write([]byte{0})
+	}
+
+	return h.Sum64()
+}
+
+// sleepCtx sleeps for d or until ctx is done. It reports whether the full
+// duration elapsed
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
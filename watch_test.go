@@ -0,0 +1,219 @@
+package consul_service_discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// newTestClient returns a Consul client talking to an httptest server backed
+// by h
+func newTestClient(t *testing.T, h http.Handler) *api.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = srv.URL
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("new consul client: %v", err)
+	}
+
+	return client
+}
+
+func TestEffectiveQueryTimeout(t *testing.T) {
+	cm := &ConnManager{waitTime: 16 * time.Second}
+
+	if got, want := cm.effectiveQueryTimeout(), 17*time.Second+queryTimeoutGrace; got != want {
+		t.Errorf("derived timeout = %v, want %v", got, want)
+	}
+
+	cm.queryTimeout = time.Minute
+	if got := cm.effectiveQueryTimeout(); got != time.Minute {
+		t.Errorf("explicit timeout = %v, want 1m", got)
+	}
+}
+
+func TestNew_QueryTimeoutMustExceedWaitTime(t *testing.T) {
+	client, _ := api.NewClient(api.DefaultConfig())
+
+	_, err := New(client, []string{"svc"},
+		WithWaitTime(time.Second),
+		WithQueryTimeout(time.Second),
+	)
+	if err == nil {
+		t.Fatal("expected error for query timeout <= wait time")
+	}
+}
+
+func TestWatchService_QueryTimeoutAbortsHungAgent(t *testing.T) {
+	var calls atomic.Int32
+
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-r.Context().Done()
+	}))
+
+	cm, err := New(client, []string{"svc"},
+		WithWaitTime(20*time.Millisecond),
+		WithRetryInterval(20*time.Millisecond),
+		WithQueryTimeout(50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	cm.watchService(ctx, "svc")
+
+	if n := calls.Load(); n < 2 {
+		t.Errorf("expected hung queries to be retried, got %d call(s)", n)
+	}
+}
+
+func TestWatchService_CancelInterruptsLongPoll(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	cm, err := New(client, []string{"svc"}, WithWaitTime(time.Minute))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		cm.watchService(ctx, "svc")
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher did not return after context cancellation")
+	}
+}
+
+func TestNextWaitIndex(t *testing.T) {
+	cases := []struct{ prev, last, want uint64 }{
+		{0, 5, 5},
+		{5, 5, 5},
+		{5, 7, 7},
+		{7, 3, 0},
+		{7, 0, 0},
+	}
+
+	for _, c := range cases {
+		if got := nextWaitIndex(c.prev, c.last); got != c.want {
+			t.Errorf("nextWaitIndex(%d, %d) = %d, want %d", c.prev, c.last, got, c.want)
+		}
+	}
+}
+
+// watchTargets runs a watcher for d and returns every distinct target the
+// service was connected to, in order
+func watchTargets(t *testing.T, cm *ConnManager, service string, d time.Duration) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	go cm.watchService(ctx, service)
+
+	var targets []string
+
+	for ctx.Err() == nil {
+		cm.mu.RLock()
+		mc, ok := cm.conns[service]
+		cm.mu.RUnlock()
+
+		if ok && (len(targets) == 0 || targets[len(targets)-1] != mc.target) {
+			targets = append(targets, mc.target)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cm.CloseAll()
+
+	return targets
+}
+
+func TestBackoff(t *testing.T) {
+	for _, base := range []time.Duration{1, 2, time.Millisecond, 5 * time.Second} {
+		if got := backoff(base); got < base || got > base+base/2 {
+			t.Errorf("backoff(%s) = %s, want within [base, 1.5 base]", base, got)
+		}
+	}
+}
+
+func TestWatchService_UnchangedIndexKeepsTarget(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001, 9002, 9003, 9004, 9005, 9006, 9007, 9008, 9009, 9010)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithWaitTime(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if targets := watchTargets(t, cm, "svc", 300*time.Millisecond); len(targets) != 1 {
+		t.Errorf("target changed without a topology change: %v", targets)
+	}
+}
+
+func TestWatchService_ForcedRefreshReselects(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001, 9002, 9003, 9004, 9005, 9006, 9007, 9008, 9009, 9010)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"},
+		WithWaitTime(20*time.Millisecond),
+		WithForcedRefresh(30*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	if targets := watchTargets(t, cm, "svc", 500*time.Millisecond); len(targets) < 2 {
+		t.Errorf("forced refresh never re-selected: %v", targets)
+	}
+}
+
+func TestWatchService_ReusedIndexRefreshes(t *testing.T) {
+	fake := newFakeConsul()
+	fake.setInstances("svc", 9001)
+
+	cm, err := New(newTestClient(t, fake), []string{"svc"}, WithWaitTime(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cm.watchService(ctx, "svc")
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9001")
+
+	// other content under the same index, as after an unnoticed restore
+	fake.mu.Lock()
+	fake.services["svc"] = testEntries("svc", 9002)
+	fake.mu.Unlock()
+
+	waitTarget(t, cm, "svc", "127.0.0.1:9002")
+}